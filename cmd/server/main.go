@@ -1,14 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/audit"
 	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/config"
 	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/editor"
 	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/filesystem"
@@ -61,7 +66,28 @@ func main() {
 	}
 
 	// Create the file manager with allowed directories from config
-	fileManager := filesystem.NewFileManager(cfg.AllowedDirectories)
+	fileManager := filesystem.NewFileManagerWithDirectories(allowedDirectories(cfg))
+	if cfg.MaxEntries != 0 {
+		fileManager.SetMaxEntries(cfg.MaxEntries)
+	}
+	fileManager.SetRetryPolicy(filesystem.RetryPolicy{
+		MaxAttempts: cfg.Retry.MaxAttempts,
+		Backoff:     time.Duration(cfg.Retry.BackoffMs) * time.Millisecond,
+	})
+	fileManager.SetHiddenDirectories(cfg.HiddenDirectories)
+	fileManager.SetDeniedPatterns(cfg.DeniedPatterns)
+	fileManager.SetFileModes(os.FileMode(cfg.FileMode), os.FileMode(cfg.DirMode))
+	fileManager.SetMaxWriteBytes(cfg.MaxWriteBytes)
+	if cfg.MaxReadBytes != nil {
+		fileManager.SetMaxReadBytes(*cfg.MaxReadBytes)
+	}
+	fileManager.SetBaseDirectory(cfg.BaseDirectory)
+	fileManager.SetMaxOpenFiles(cfg.MaxOpenFiles)
+	fileManager.SetMaxWait(time.Duration(cfg.MaxWaitMs) * time.Millisecond)
+	fileManager.SetMaxSearchFileBytes(cfg.MaxSearchFileBytes)
+	if cfg.BareFilenameRoot {
+		fileManager.SetBareFilenameRoot(cfg.AllowedDirectories[0].Path)
+	}
 
 	// Create the edit manager for undo functionality
 	backupDir := filepath.Join(os.TempDir(), "mcp-filesystem-backups")
@@ -70,9 +96,27 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error creating edit manager: %v\n", err)
 		os.Exit(1)
 	}
+	if cfg.MaxConcurrentEdits != 0 {
+		editManager.SetMaxConcurrentEdits(cfg.MaxConcurrentEdits)
+	}
+	editManager.SetWritableCheck(fileManager.IsWritable)
+	editManager.SetWriteReservation(fileManager.ReserveWrite)
+	editManager.SetFileModes(os.FileMode(cfg.FileMode), os.FileMode(cfg.DirMode))
+	editManager.SetRetention(cfg.MaxEditHistory, time.Duration(cfg.MaxBackupAgeHours)*time.Hour)
+
+	// Watch files that clients subscribe to as resources; if no watcher can be
+	// created the server runs without resource subscriptions
+	var server *mcp.Server
+	resourceWatcher, err := filesystem.NewResourceWatcher(fileManager, filesystem.ResourceUpdateDebounce, func(path string, sessions []string) {
+		notifyResourceUpdated(server, path, sessions)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Resource subscriptions disabled: %v\n", err)
+		resourceWatcher = nil
+	}
 
 	// Create and configure the MCP server
-	server := mcp.NewServer(
+	server = mcp.NewServer(
 		mcp.ServerInfo{
 			Name:    "secure-filesystem-server",
 			Version: Version,
@@ -83,19 +127,49 @@ func main() {
 					"list": true,
 					"call": true,
 				},
+				Completions: &mcp.CompletionsCapability{},
+				Resources:   &mcp.ResourcesCapability{Subscribe: resourceWatcher != nil},
+				Prompts:     &mcp.PromptsCapability{},
 			},
 		},
 	)
 
+	// Log at the configured level; clients choose their own with logging/setLevel
+	logLevel := mcp.LevelInfo
+	if cfg.LogLevel != "" {
+		logLevel, err = mcp.ParseLogLevel(cfg.LogLevel)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in configuration: logLevel: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	server.SetLogger(mcp.NewLevelLogger(os.Stderr, logLevel))
+
+	// Tool options, including the audit log of filesystem changes
+	opts := toolOptions{
+		toolPrefix:       cfg.ToolPrefix,
+		responseMetadata: cfg.ResponseMetadata,
+		auditReads:       cfg.AuditReads,
+		clientInfo:       server.ClientInfo,
+	}
+	if cfg.AuditLogPath != "" {
+		opts.auditLog, err = audit.Open(cfg.AuditLogPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening audit log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Set up handlers
-	setupServerHandlers(server, fileManager, editManager)
+	setupServerHandlers(server, fileManager, editManager, resourceWatcher, opts)
 
 	// Choose transport based on configuration
 	var transport mcp.Transport
 	
 	if cfg.Network.Enabled {
 		// Network mode
-		fmt.Fprintf(os.Stderr, "Secure MCP Filesystem Server v%s starting in NETWORK mode on %s:%d\n", Version, cfg.Network.Host, cfg.Network.Port)
+		fmt.Fprintf(os.Stderr, "Secure MCP Filesystem Server v%s starting in NETWORK mode (%s) on %s:%d\n",
+			Version, cfg.Network.Mode, cfg.Network.Host, cfg.Network.Port)
 		
 		netConfig, err := mcp.ParseNetworkConfig(
 			cfg.Network.Host,
@@ -107,8 +181,23 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error creating network config: %v\n", err)
 			os.Exit(1)
 		}
+		netConfig.LogFormat = cfg.Network.LogFormat
+		netConfig.Compression = cfg.Network.Compression
+		netConfig.CompressionMinBytes = cfg.Network.CompressionMinBytes
+		netConfig.Path = cfg.Network.Path
+		netConfig.MaxConnections = cfg.Network.MaxConnections
+		netConfig.IdleTimeout = time.Duration(cfg.Network.IdleTimeoutSeconds) * time.Second
+		netConfig.Framing = cfg.Framing
+		netConfig.AllowedOrigins = cfg.Network.AllowedOrigins
 		
-		transport, err = mcp.NewNetworkTransport(netConfig)
+		switch cfg.Network.Mode {
+		case config.NetworkModeWebSocket:
+			transport, err = mcp.NewWebSocketTransport(netConfig)
+		case config.NetworkModeHTTP:
+			transport, err = mcp.NewHTTPTransport(netConfig)
+		default:
+			transport, err = mcp.NewNetworkTransport(netConfig)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating network transport: %v\n", err)
 			os.Exit(1)
@@ -116,10 +205,18 @@ func main() {
 	} else {
 		// Stdio mode (default)
 		fmt.Fprintf(os.Stderr, "Secure MCP Filesystem Server v%s starting in STDIO mode\n", Version)
-		transport = mcp.NewStdioTransport()
+		stdio := mcp.NewStdioTransport()
+		if err := stdio.SetFraming(cfg.Framing); err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating stdio transport: %v\n", err)
+			os.Exit(1)
+		}
+		transport = stdio
 	}
 
-	fmt.Fprintf(os.Stderr, "Allowed directories: %v\n", cfg.AllowedDirectories)
+	fmt.Fprintf(os.Stderr, "Allowed directories: %v\n", cfg.DirectoryPaths())
+	if cfg.ToolPrefix != "" {
+		fmt.Fprintf(os.Stderr, "Tool name prefix: %s\n", cfg.ToolPrefix)
+	}
 	fmt.Fprintf(os.Stderr, "Edit backup directory: %s\n", backupDir)
 	
 	err = server.Connect(transport)
@@ -133,43 +230,222 @@ func main() {
 	select {} // Wait forever
 }
 
-// setupServerHandlers sets up the request handlers for the server
-func setupServerHandlers(server *mcp.Server, fileManager *filesystem.FileManager, editManager *editor.EditManager) {
+// notifyResourceUpdated tells the sessions subscribed to a file that it changed
+func notifyResourceUpdated(server *mcp.Server, path string, sessions []string) {
+	for _, session := range sessions {
+		server.SendSessionNotification(session, "notifications/resources/updated", mcp.ResourceUpdatedParams{URI: filesystem.FileURI(path)})
+	}
+}
+
+// allowedDirectories converts the configured directories to FileManager settings
+func allowedDirectories(cfg *config.Config) []filesystem.AllowedDirectory {
+	dirs := make([]filesystem.AllowedDirectory, len(cfg.AllowedDirectories))
+	for i, dir := range cfg.AllowedDirectories {
+		dirs[i] = filesystem.AllowedDirectory{Path: dir.Path, MaxSearchDepth: -1, ReadOnly: dir.ReadOnly}
+		if dir.MaxSearchDepth != nil {
+			dirs[i].MaxSearchDepth = *dir.MaxSearchDepth
+		}
+		if dir.WriteQuota != nil {
+			dirs[i].WriteQuota = *dir.WriteQuota
+		}
+	}
+	return dirs
+}
+
+// toolsPageSize is how many tools one tools/list page holds
+const toolsPageSize = 100
+
+// toolOptions holds configuration that affects how tools are advertised and answered
+type toolOptions struct {
+	// toolPrefix, when non-empty, is prepended to every advertised tool name and
+	// stripped again from incoming calls so the dispatch switch stays unchanged
+	toolPrefix string
+	// responseMetadata adds a _meta block describing each operation to tool results
+	responseMetadata bool
+	// auditLog, when set, receives an entry for every successful tool call that
+	// changes files, and with auditReads for read-only calls too
+	auditLog   *audit.Log
+	auditReads bool
+	// clientInfo names the client of a session, for the audit log
+	clientInfo func(session string) mcp.ClientInfo
+}
+
+// Tool capability classes reported by list_tool_capabilities
+const (
+	capabilityReadOnly    = "read-only"   // Never modifies files
+	capabilityMutating    = "mutating"    // Creates or changes files; edits can be undone
+	capabilityDestructive = "destructive" // May overwrite or remove existing data
+)
+
+// toolCapabilities classifies every filesystem and editor tool by its side effects
+var toolCapabilities = map[string]string{
+	"read_file":                capabilityReadOnly,
+	"read_multiple_files":      capabilityReadOnly,
+	"read_file_chunk":          capabilityReadOnly,
+	"list_directory":           capabilityReadOnly,
+	"directory_tree":           capabilityReadOnly,
+	"hash_file":                capabilityReadOnly,
+	"search_files":             capabilityReadOnly,
+	"search_content":           capabilityReadOnly,
+	"find_in_file":             capabilityReadOnly,
+	"glob_files":               capabilityReadOnly,
+	"get_file_info":            capabilityReadOnly,
+	"get_directory_size":       capabilityReadOnly,
+	"list_allowed_directories": capabilityReadOnly,
+	"list_tool_capabilities":   capabilityReadOnly,
+	"same_file":                capabilityReadOnly,
+	"classify_file":            capabilityReadOnly,
+	"read_enclosing_block":     capabilityReadOnly,
+	"read_with_includes":       capabilityReadOnly,
+	"text_stats":               capabilityReadOnly,
+	"latest_modification":      capabilityReadOnly,
+	"verify_manifest":          capabilityReadOnly,
+	"which_root":               capabilityReadOnly,
+	"read_file_full":           capabilityReadOnly,
+	"json_get":                 capabilityReadOnly,
+	"wait_for_file":            capabilityReadOnly,
+	"read_link":                capabilityReadOnly,
+	"watch_file":               capabilityReadOnly,
+	"compare_directories":      capabilityReadOnly,
+	"read_between_markers":     capabilityReadOnly,
+	"can_write":                capabilityReadOnly,
+	"create_directory":         capabilityMutating,
+	"touch_file":               capabilityMutating,
+	"create_symlink":           capabilityMutating,
+	"create_temp_file":         capabilityMutating,
+	"begin_write":              capabilityMutating,
+	"append_chunk":             capabilityMutating,
+	"abort_write":              capabilityMutating,
+	"str_replace":              capabilityMutating,
+	"regex_replace":            capabilityMutating,
+	"insert":                   capabilityMutating,
+	"delete_lines":             capabilityMutating,
+	"replace_lines":            capabilityMutating,
+	"apply_patch":              capabilityMutating,
+	"replace_between_markers":  capabilityMutating,
+	"undo_edit":                capabilityMutating,
+	"redo_edit":                capabilityMutating,
+	"rename_pattern":           capabilityMutating,
+	"copy_file":                capabilityMutating,
+	"append_file":              capabilityMutating,
+	"snapshot_file":            capabilityMutating,
+	"restore_to_snapshot":      capabilityMutating,
+	"list_backups":             capabilityReadOnly,
+	"restore_backup":           capabilityMutating,
+	"export_changes":           capabilityReadOnly,
+	"lock_file":                capabilityMutating,
+	"unlock_file":              capabilityMutating,
+	"write_file":               capabilityDestructive,
+	"move_file":                capabilityDestructive,
+	"commit_write":             capabilityDestructive,
+	"delete_directory":         capabilityDestructive,
+}
+
+// toolCapability returns the capability class of a tool.
+// Unclassified tools are reported as destructive so clients err on the side of caution.
+func toolCapability(name string) string {
+	if capability, ok := toolCapabilities[name]; ok {
+		return capability
+	}
+	return capabilityDestructive
+}
+
+// toolAnnotations converts a tool's capability class to MCP tool annotations
+func toolAnnotations(name string) *mcp.ToolAnnotations {
+	capability := toolCapability(name)
+	return &mcp.ToolAnnotations{
+		ReadOnlyHint:    capability == capabilityReadOnly,
+		DestructiveHint: capability == capabilityDestructive,
+	}
+}
+
+// listToolCapabilities returns JSON mapping each advertised tool name to its capability class
+func listToolCapabilities(prefix string) string {
+	names := make([]string, 0, len(filesystem.FilesystemTools)+len(editor.EditorTools))
+	for name := range filesystem.FilesystemTools {
+		names = append(names, name)
+	}
+	for name := range editor.EditorTools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type toolCapabilityEntry struct {
+		Name       string `json:"name"`
+		Capability string `json:"capability"`
+	}
+	entries := make([]toolCapabilityEntry, len(names))
+	for i, name := range names {
+		entries[i] = toolCapabilityEntry{Name: prefix + name, Capability: toolCapability(name)}
+	}
+
+	jsonResult, _ := json.Marshal(map[string]interface{}{"tools": entries})
+	return string(jsonResult)
+}
+
+// listTools returns every filesystem and editor tool, named with prefix and
+// sorted by name so tools/list pages are stable between calls
+func listTools(prefix string) []mcp.Tool {
+	allTools := make([]mcp.Tool, 0, len(filesystem.FilesystemTools)+len(editor.EditorTools))
+
+	// Add filesystem tools
+	for _, toolDef := range filesystem.FilesystemTools {
+		inputSchema, err := json.Marshal(toolDef.InputSchema)
+		if err != nil {
+			continue
+		}
+
+		allTools = append(allTools, mcp.Tool{
+			Name:        prefix + toolDef.Name,
+			Description: toolDef.Description,
+			InputSchema: inputSchema,
+			Annotations: toolAnnotations(toolDef.Name),
+		})
+	}
+
+	// Add editor tools
+	for _, toolDef := range editor.EditorTools {
+		inputSchema, err := json.Marshal(toolDef.InputSchema)
+		if err != nil {
+			continue
+		}
+
+		allTools = append(allTools, mcp.Tool{
+			Name:        prefix + toolDef.Name,
+			Description: toolDef.Description,
+			InputSchema: inputSchema,
+			Annotations: toolAnnotations(toolDef.Name),
+		})
+	}
+
+	// Map iteration order is random, so sort to keep cursors meaningful
+	sort.Slice(allTools, func(i, j int) bool { return allTools[i].Name < allTools[j].Name })
+	return allTools
+}
+
+// setupServerHandlers sets up the request handlers for the server.
+// resourceWatcher may be nil, in which case resource subscriptions are not handled.
+func setupServerHandlers(server *mcp.Server, fileManager *filesystem.FileManager, editManager *editor.EditManager, resourceWatcher *filesystem.ResourceWatcher, opts toolOptions) {
 	// Handler for tools/list
 	server.SetRequestHandler("tools/list", func(params json.RawMessage) (json.RawMessage, error) {
-		// Combine filesystem and editor tools
-		allTools := make([]mcp.Tool, 0, len(filesystem.FilesystemTools)+len(editor.EditorTools))
-		
-		// Add filesystem tools
-		for _, toolDef := range filesystem.FilesystemTools {
-			inputSchema, err := json.Marshal(toolDef.InputSchema)
-			if err != nil {
-				continue
+		var request mcp.ListToolsParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &request); err != nil {
+				return nil, fmt.Errorf("invalid tools/list parameters: %w", err)
 			}
-			
-			allTools = append(allTools, mcp.Tool{
-				Name:        toolDef.Name,
-				Description: toolDef.Description,
-				InputSchema: inputSchema,
-			})
 		}
-		
-		// Add editor tools
-		for _, toolDef := range editor.EditorTools {
-			inputSchema, err := json.Marshal(toolDef.InputSchema)
-			if err != nil {
-				continue
-			}
-			
-			allTools = append(allTools, mcp.Tool{
-				Name:        toolDef.Name,
-				Description: toolDef.Description,
-				InputSchema: inputSchema,
-			})
+
+		allTools := listTools(opts.toolPrefix)
+
+		// Page through the tools; every tool fits on the first page for now
+		start, end, nextCursor, err := mcp.PageBounds(len(allTools), request.Cursor, toolsPageSize)
+		if err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: err.Error()}
 		}
-		
+
 		response := mcp.ListToolsResponse{
-			Tools: allTools,
+			Tools:      allTools[start:end],
+			NextCursor: nextCursor,
 		}
 		
 		return json.Marshal(response)
@@ -181,58 +457,368 @@ func setupServerHandlers(server *mcp.Server, fileManager *filesystem.FileManager
 		return handler(params)
 	})
 	
-	// Handler for tools/call
-	server.SetRequestHandler("tools/call", func(params json.RawMessage) (json.RawMessage, error) {
+	// Handler for tools/call; the context lets clients cancel long waits
+	callTool := func(ctx context.Context, session string, params json.RawMessage) (json.RawMessage, error) {
 		var request mcp.CallToolRequest
 		if err := json.Unmarshal(params, &request); err != nil {
 			return nil, fmt.Errorf("invalid call parameters: %w", err)
 		}
 		
+		// Map the namespaced name back to the internal tool name; with a
+		// prefix configured, only prefixed names are tools
+		name, ok := strings.CutPrefix(request.Name, opts.toolPrefix)
+		if !ok {
+			return nil, &mcp.RPCError{Code: mcp.CodeMethodNotFound, Message: fmt.Sprintf("unknown tool %s", request.Name)}
+		}
+		request.Name = name
+
+		// Reject arguments that do not match the tool's declared input schema
+		if schema, ok := toolInputSchema(request.Name); ok {
+			if violations := mcp.ValidateArguments(schema, request.Arguments); len(violations) > 0 {
+				return nil, &mcp.RPCError{
+					Code:    mcp.CodeInvalidParams,
+					Message: fmt.Sprintf("invalid arguments for %s: %s", request.Name, strings.Join(violations, "; ")),
+					Data:    map[string]interface{}{"violations": violations},
+				}
+			}
+		}
+		
+		// Files locked by another session may not be modified
+		if err := checkFileLocks(request, session, fileManager, editManager); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		
+		// Long-running tools report progress only to clients that sent a token
+		var progress func(scanned int)
+		if request.Meta != nil && len(request.Meta.ProgressToken) > 0 {
+			token := request.Meta.ProgressToken
+			progress = func(scanned int) {
+				server.SendSessionNotification(session, "notifications/progress", mcp.ProgressParams{
+					ProgressToken: token,
+					Progress:      scanned,
+					Message:       fmt.Sprintf("%d entries scanned", scanned),
+				})
+			}
+		}
+
 		// Process the tool call
-		return handleToolCall(request, fileManager, editManager)
-	})
+		return handleToolCall(ctx, request, session, fileManager, editManager, progress, opts)
+	}
+	server.SetContextRequestHandler("tools/call", callTool)
 
 	// Handler for call_tool (backward compatibility)
-	server.SetRequestHandler("call_tool", func(params json.RawMessage) (json.RawMessage, error) {
-		handler := server.GetHandler("tools/call")
-		return handler(params)
+	server.SetContextRequestHandler("call_tool", callTool)
+
+	// Locks die with the session that holds them
+	server.OnSessionClosed(func(session string) {
+		if released := editManager.ReleaseSession(session); released > 0 {
+			fmt.Fprintf(os.Stderr, "Released %d file lock(s) held by session %s\n", released, session)
+		}
+	})
+
+	// Handler for completion/complete: suggests paths for path arguments of tools
+	server.SetRequestHandler("completion/complete", func(params json.RawMessage) (json.RawMessage, error) {
+		var request mcp.CompleteParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid completion parameters: %w", err)
+		}
+
+		result := mcp.CompleteResult{Completion: mcp.Completion{Values: []string{}}}
+		if name, ok := strings.CutPrefix(request.Ref.Name, opts.toolPrefix); ok && isPathArgument(name, request.Argument.Name) {
+			values, total := fileManager.CompletePath(request.Argument.Value)
+			result.Completion = mcp.Completion{
+				Values:  values,
+				Total:   total,
+				HasMore: total > len(values),
+			}
+		}
+
+		return json.Marshal(result)
+	})
+
+	// Handler for resources/list: every file in the allowed directories, paged
+	server.SetRequestHandler("resources/list", func(params json.RawMessage) (json.RawMessage, error) {
+		var request mcp.ListResourcesParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &request); err != nil {
+				return nil, fmt.Errorf("invalid resources/list parameters: %w", err)
+			}
+		}
+
+		files, nextCursor, err := fileManager.ListResources(request.Cursor, filesystem.DefaultResourcePageSize)
+		if err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: err.Error()}
+		}
+
+		result := mcp.ListResourcesResult{Resources: make([]mcp.Resource, 0, len(files)), NextCursor: nextCursor}
+		for _, file := range files {
+			result.Resources = append(result.Resources, mcp.Resource{
+				URI:      filesystem.FileURI(file.Path),
+				Name:     file.Name,
+				MimeType: file.MimeType,
+				Size:     file.Size,
+			})
+		}
+		return json.Marshal(result)
+	})
+
+	// Handler for resources/read: the content of one file:// resource
+	server.SetRequestHandler("resources/read", func(params json.RawMessage) (json.RawMessage, error) {
+		var request mcp.ReadResourceParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid resources/read parameters: %w", err)
+		}
+
+		path, err := filesystem.PathFromFileURI(request.URI)
+		if err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: err.Error()}
+		}
+		file, content, err := fileManager.ReadResource(path)
+		if err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeResourceNotFound, Message: err.Error(), Data: map[string]string{"uri": request.URI}}
+		}
+
+		contents := mcp.ResourceContents{URI: request.URI, MimeType: file.MimeType}
+		if file.Binary {
+			contents.Blob = base64.StdEncoding.EncodeToString(content)
+		} else {
+			contents.Text = string(content)
+		}
+		return json.Marshal(mcp.ReadResourceResult{Contents: []mcp.ResourceContents{contents}})
+	})
+
+	// Handler for prompts/list: the prompt templates, each taking a path
+	server.SetRequestHandler("prompts/list", func(params json.RawMessage) (json.RawMessage, error) {
+		result := mcp.ListPromptsResult{Prompts: make([]mcp.Prompt, 0, len(filesystem.PromptTemplates))}
+		for _, template := range filesystem.PromptTemplates {
+			result.Prompts = append(result.Prompts, mcp.Prompt{
+				Name:        template.Name,
+				Description: template.Description,
+				Arguments:   []mcp.PromptArgument{{Name: "path", Description: template.PathHelp, Required: true}},
+			})
+		}
+		return json.Marshal(result)
 	})
+
+	// Handler for prompts/get: renders a template with the file or directory embedded
+	server.SetRequestHandler("prompts/get", func(params json.RawMessage) (json.RawMessage, error) {
+		var request mcp.GetPromptParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid prompts/get parameters: %w", err)
+		}
+
+		template, ok := filesystem.FindPromptTemplate(request.Name)
+		if !ok {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: fmt.Sprintf("unknown prompt: %s", request.Name)}
+		}
+		path := request.Arguments["path"]
+		if path == "" {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: fmt.Sprintf("prompt %s requires a path argument", request.Name)}
+		}
+
+		text, err := fileManager.RenderPrompt(template, path)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(mcp.GetPromptResult{
+			Description: template.Description,
+			Messages:    []mcp.PromptMessage{{Role: "user", Content: mcp.ContentItem{Type: "text", Text: text}}},
+		})
+	})
+
+	if resourceWatcher == nil {
+		return
+	}
+
+	// Handlers for resources/subscribe and resources/unsubscribe: changes to a
+	// subscribed file are sent as notifications/resources/updated
+	server.SetSessionRequestHandler("resources/subscribe", func(session string, params json.RawMessage) (json.RawMessage, error) {
+		var request mcp.SubscribeParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid resources/subscribe parameters: %w", err)
+		}
+		path, err := filesystem.PathFromFileURI(request.URI)
+		if err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: err.Error()}
+		}
+		if _, err := resourceWatcher.Subscribe(session, path); err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeResourceNotFound, Message: err.Error(), Data: map[string]string{"uri": request.URI}}
+		}
+		return json.Marshal(struct{}{})
+	})
+
+	server.SetSessionRequestHandler("resources/unsubscribe", func(session string, params json.RawMessage) (json.RawMessage, error) {
+		var request mcp.SubscribeParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, fmt.Errorf("invalid resources/unsubscribe parameters: %w", err)
+		}
+		path, err := filesystem.PathFromFileURI(request.URI)
+		if err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeInvalidParams, Message: err.Error()}
+		}
+		if err := resourceWatcher.Unsubscribe(session, path); err != nil {
+			return nil, &mcp.RPCError{Code: mcp.CodeResourceNotFound, Message: err.Error(), Data: map[string]string{"uri": request.URI}}
+		}
+		return json.Marshal(struct{}{})
+	})
+
+	// Subscriptions end with the session that made them
+	server.OnSessionClosed(resourceWatcher.CloseSession)
+}
+
+// pathArgumentNames are tool argument names that hold a filesystem path
+var pathArgumentNames = map[string]bool{
+	"path":        true,
+	"paths":       true,
+	"source":      true,
+	"destination": true,
+	"directory":   true,
+	"path1":       true,
+	"path2":       true,
+}
+
+// toolInputSchema returns the input schema of the named tool
+func toolInputSchema(tool string) (map[string]interface{}, bool) {
+	if toolDef, ok := filesystem.FilesystemTools[tool]; ok {
+		return toolDef.InputSchema, true
+	}
+	if toolDef, ok := editor.EditorTools[tool]; ok {
+		return toolDef.InputSchema, true
+	}
+	return nil, false
+}
+
+// isPathArgument reports whether argument of the named tool takes a path
+func isPathArgument(tool, argument string) bool {
+	schema, ok := toolInputSchema(tool)
+	if !ok {
+		return false
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	_, declared := properties[argument]
+	return declared && pathArgumentNames[argument]
+}
+
+// checkFileLocks rejects a call to a tool that modifies files when one of its
+// path arguments is locked by another session
+func checkFileLocks(request mcp.CallToolRequest, session string, fileManager *filesystem.FileManager, editManager *editor.EditManager) error {
+	if toolCapability(request.Name) == capabilityReadOnly {
+		return nil
+	}
+
+	var arguments map[string]interface{}
+	if err := json.Unmarshal(request.Arguments, &arguments); err != nil {
+		return nil // The tool's own parser reports malformed arguments
+	}
+
+	for name, value := range arguments {
+		if !isPathArgument(request.Name, name) {
+			continue
+		}
+
+		var paths []string
+		switch typed := value.(type) {
+		case string:
+			paths = append(paths, typed)
+		case []interface{}:
+			for _, item := range typed {
+				if path, ok := item.(string); ok {
+					paths = append(paths, path)
+				}
+			}
+		}
+
+		for _, path := range paths {
+			validPath, err := fileManager.ValidatePath(path)
+			if err != nil {
+				continue // Invalid paths are reported by the tool itself
+			}
+			if err := editManager.CheckLock(validPath, session); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// operationMeta describes the effects of a tool call for the optional _meta block
+type operationMeta struct {
+	path     string     // Path as requested; resolved before reporting
+	bytes    int64      // Bytes read or written, -1 when not applicable
+	backupID string     // Backup created by an editor operation
+	preview  bool       // The call only previewed a change and changed nothing
+	moves    []fileMove // Files moved, renamed or copied; each gets its own audit entry
 }
 
-// handleToolCall handles a tool call request
-func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileManager, editManager *editor.EditManager) (json.RawMessage, error) {
+// fileMove is a file moved, renamed or copied by a tool call, as requested
+type fileMove struct {
+	from, to string
+}
+
+// handleToolCall handles a tool call request. progress, when not nil, receives
+// the number of entries scanned so far by tools that walk directory trees.
+func handleToolCall(ctx context.Context, request mcp.CallToolRequest, session string, fileManager *filesystem.FileManager, editManager *editor.EditManager, progress func(scanned int), opts toolOptions) (json.RawMessage, error) {
 	var response mcp.CallToolResponse
+	start := time.Now()
+	meta := operationMeta{bytes: -1}
 	
 	// Process based on tool name
 	switch request.Name {
 	// Filesystem tools
 	case "read_file":
-		path, err := filesystem.ParseReadFileArgs(request.Arguments)
+		path, options, err := filesystem.ParseReadFileArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
 		
-		content, err := fileManager.ReadFile(path)
+		content, err := fileManager.ReadFileRange(path, options)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		content = filesystem.ExpandTabs(content, options.TabWidth)
+		meta.path, meta.bytes = path, int64(len(content))
+
+		if options.AsLines {
+			lines, trailingNewline := filesystem.SplitContentLines(content)
+			result := mcp.ReadFileLinesResult{Success: true, Path: path, Lines: lines, TrailingNewline: trailingNewline}
+			resultJSON, _ := json.Marshal(result)
+			response = mcp.CallToolResponse{
+				Content: []mcp.ContentItem{
+					{Type: "text", Text: string(resultJSON)},
+				},
+				StructuredContent: result,
+			}
+			break
+		}
 		
+		result := mcp.ReadFileResult{Success: true, Path: path, Size: len(content), Content: content}
+		if options.Encoding == filesystem.EncodingBase64 {
+			result.Encoding = options.Encoding
+		}
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: content},
 			},
+			StructuredContent: result,
 		}
 	
 	case "read_multiple_files":
-		paths, err := filesystem.ParseReadMultipleFilesArgs(request.Arguments)
+		paths, format, err := filesystem.ParseReadMultipleFilesArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
 		
-		content, err := fileManager.ReadMultipleFiles(paths)
+		read := fileManager.ReadMultipleFiles
+		if format == filesystem.MultiReadFormatJSON {
+			read = fileManager.ReadMultipleFilesJSON
+		}
+		content, err := read(paths)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.bytes = int64(len(content))
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
@@ -250,11 +836,13 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path, meta.bytes = path, int64(len(content))
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: fmt.Sprintf("Successfully wrote to %s", path)},
 			},
+			StructuredContent: mcp.WriteFileResult{Success: true, Path: path, BytesWritten: len(content)},
 		}
 	
 	case "create_directory":
@@ -267,23 +855,80 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path = path
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: fmt.Sprintf("Successfully created directory %s", path)},
 			},
+			StructuredContent: mcp.PathResult{Success: true, Path: path},
 		}
 	
+	case "touch_file":
+		path, err := filesystem.ParseTouchFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := fileManager.Touch(path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully touched %s", path)},
+			},
+			StructuredContent: mcp.PathResult{Success: true, Path: path},
+		}
+
+	case "create_symlink":
+		target, path, err := filesystem.ParseCreateSymlinkArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := fileManager.CreateSymlink(target, path); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully created symlink %s -> %s", path, target)},
+			},
+			StructuredContent: mcp.PathResult{Success: true, Path: path},
+		}
+
+	case "read_link":
+		path, err := filesystem.ParseReadLinkArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		target, err := fileManager.ReadLink(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: target},
+			},
+		}
+
 	case "list_directory":
-		path, err := filesystem.ParseListDirectoryArgs(request.Arguments)
+		path, options, err := filesystem.ParseListDirectoryArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
 		
-		listing, err := fileManager.ListDirectory(path)
+		listing, err := fileManager.ListDirectory(path, options)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path = path
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
@@ -301,23 +946,28 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path = destination
+		meta.moves = []fileMove{{source, destination}}
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: fmt.Sprintf("Successfully moved %s to %s", source, destination)},
 			},
+			StructuredContent: mcp.MoveFileResult{Success: true, Source: source, Destination: destination},
 		}
 	
 	case "search_files":
-		path, pattern, err := filesystem.ParseSearchFilesArgs(request.Arguments)
+		path, pattern, options, err := filesystem.ParseSearchFilesArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		options.Progress = progress
 		
-		results, err := filesystem.SearchFiles(fileManager, path, pattern)
+		results, err := filesystem.SearchFiles(fileManager, path, pattern, options)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path = path
 		
 		var resultText string
 		if len(results) > 0 {
@@ -330,6 +980,7 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: resultText},
 			},
+			StructuredContent: mcp.SearchResult{Success: true, Path: path, Matches: results},
 		}
 	
 	case "get_file_info":
@@ -342,6 +993,7 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path = path
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
@@ -355,54 +1007,782 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 				{Type: "text", Text: fileManager.ListAllowedDirectories()},
 			},
 		}
-	
-	// Editor tools
-	case "str_replace":
-		path, oldStr, newStr, err := editor.ParseStrReplaceArgs(request.Arguments)
-		if err != nil {
-			return createErrorResponse(err.Error())
+
+	case "list_tool_capabilities":
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: listToolCapabilities(opts.toolPrefix)},
+			},
 		}
-		
-		// Validate path first
-		validPath, err := fileManager.ValidatePath(path)
+	
+	case "same_file":
+		path1, path2, err := filesystem.ParseSameFileArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
-		
-		err = editManager.StrReplace(validPath, oldStr, newStr)
+
+		result, err := fileManager.SameFile(path1, path2)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
-		
+
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
-				{Type: "text", Text: fmt.Sprintf("Successfully replaced text in %s", path)},
+				{Type: "text", Text: result},
 			},
 		}
-	
-	case "insert":
-		path, lineNumber, text, err := editor.ParseInsertArgs(request.Arguments)
+
+	case "classify_file":
+		path, err := filesystem.ParseClassifyFileArgs(request.Arguments)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
-		
-		// Validate path first
-		validPath, err := fileManager.ValidatePath(path)
+
+		result, err := fileManager.ClassifyFile(path)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
-		
-		err = editManager.Insert(validPath, lineNumber, text)
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "create_temp_file":
+		directory, prefix, suffix, err := filesystem.ParseCreateTempFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		tempPath, err := fileManager.CreateTempFile(directory, prefix, suffix)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = tempPath, 0
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: tempPath},
+			},
+			StructuredContent: mcp.PathResult{Success: true, Path: tempPath},
+		}
+
+	case "read_enclosing_block":
+		path, line, mode, err := filesystem.ParseReadEnclosingBlockArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.ReadEnclosingBlock(path, line, mode)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "can_write":
+		path, size, err := filesystem.ParseCanWriteArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.CanWrite(path, size)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "read_with_includes":
+		path, pattern, maxDepth, err := filesystem.ParseReadWithIncludesArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		content, err := fileManager.ReadWithIncludes(path, pattern, maxDepth)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = path, int64(len(content))
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: content},
+			},
+			StructuredContent: mcp.ReadFileResult{Success: true, Path: path, Size: len(content), Content: content},
+		}
+
+	case "rename_pattern":
+		directory, match, replacement, dryRun, err := filesystem.ParseRenamePatternArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.RenamePattern(directory, match, replacement, dryRun)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = directory
+		meta.preview = dryRun
+		meta.moves = renamedFiles(result)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "text_stats":
+		path, err := filesystem.ParseTextStatsArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.TextStats(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "latest_modification":
+		path, maxDepth, err := filesystem.ParseLatestModificationArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.LatestModification(path, maxDepth)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "verify_manifest":
+		directory, manifest, algorithm, reportExtra, err := filesystem.ParseVerifyManifestArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.VerifyManifest(directory, manifest, algorithm, reportExtra)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = directory
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "begin_write":
+		path, err := filesystem.ParseBeginWriteArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		writeID, err := fileManager.BeginWrite(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		result, _ := json.Marshal(map[string]interface{}{"writeId": writeID, "path": path})
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(result)},
+			},
+		}
+
+	case "append_chunk":
+		writeID, content, err := filesystem.ParseAppendChunkArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		total, err := fileManager.AppendChunk(writeID, content)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.bytes = int64(len(content))
+
+		result, _ := json.Marshal(map[string]interface{}{"writeId": writeID, "totalBytes": total})
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(result)},
+			},
+		}
+
+	case "commit_write":
+		writeID, err := filesystem.ParseWriteSessionArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		path, size, err := fileManager.CommitWrite(writeID)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = path, size
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully wrote %d bytes to %s", size, path)},
+			},
+			StructuredContent: mcp.WriteFileResult{Success: true, Path: path, BytesWritten: int(size)},
+		}
+
+	case "abort_write":
+		writeID, err := filesystem.ParseWriteSessionArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := fileManager.AbortWrite(writeID); err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Discarded write %s", writeID)},
+			},
+		}
+
+	case "which_root":
+		path, err := filesystem.ParseWhichRootArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.WhichRoot(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "read_file_full":
+		path, maxBytes, err := filesystem.ParseReadFileFullArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.ReadFileFull(path, maxBytes)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "json_get":
+		path, query, err := filesystem.ParseJSONGetArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.JSONGet(path, query)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = path, int64(len(result))
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "wait_for_file":
+		path, timeout, err := filesystem.ParseWaitForFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.WaitForFile(path, timeout)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "watch_file":
+		path, timeout, err := filesystem.ParseWatchFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.WatchPath(ctx, path, timeout)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "compare_directories":
+		pathA, pathB, ignoreMtimes, err := filesystem.ParseCompareDirectoriesArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.CompareDirectories(pathA, pathB, ignoreMtimes)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = pathA
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "read_between_markers":
+		path, startMarker, endMarker, inclusive, err := filesystem.ParseReadBetweenMarkersArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, err := fileManager.ReadBetweenMarkers(path, startMarker, endMarker, inclusive)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: result},
+			},
+		}
+
+	case "delete_directory":
+		path, recursive, err := filesystem.ParseDeleteDirectoryArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := fileManager.DeleteDirectory(path, recursive); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully deleted directory %s", path)},
+			},
+		}
+
+	case "copy_file":
+		source, destination, err := filesystem.ParseCopyFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := fileManager.CopyFile(source, destination); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = destination
+		meta.moves = []fileMove{{source, destination}}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully copied %s to %s", source, destination)},
+			},
+			StructuredContent: mcp.MoveFileResult{Success: true, Source: source, Destination: destination},
+		}
+
+	case "append_file":
+		path, content, err := filesystem.ParseAppendFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := fileManager.AppendFile(path, content); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = path, int64(len(content))
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully appended %d bytes to %s", len(content), path)},
+			},
+			StructuredContent: mcp.WriteFileResult{Success: true, Path: path, BytesWritten: len(content)},
+		}
+
+	case "search_content":
+		path, pattern, options, err := filesystem.ParseSearchContentArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		results, err := filesystem.SearchContent(fileManager, path, pattern, options)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		var resultText string
+		if len(results) > 0 {
+			resultText = fmt.Sprintf("%d matches found:\n%s", len(results), strings.Join(results, "\n"))
+		} else {
+			resultText = "No matches found"
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: resultText},
+			},
+			StructuredContent: mcp.SearchResult{Success: true, Path: path, Matches: results},
+		}
+
+	case "find_in_file":
+		path, pattern, options, err := filesystem.ParseFindInFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		results, err := filesystem.FindInFile(fileManager, path, pattern, options)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		var resultText string
+		if len(results) > 0 {
+			resultText = fmt.Sprintf("%d matches found:\n%s", len(results), strings.Join(results, "\n"))
+		} else {
+			resultText = "No matches found"
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: resultText},
+			},
+			StructuredContent: mcp.SearchResult{Success: true, Path: path, Matches: results},
+		}
+
+	case "glob_files":
+		path, pattern, err := filesystem.ParseGlobFilesArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		results, err := filesystem.GlobFiles(fileManager, path, pattern)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		var resultText string
+		if len(results) > 0 {
+			resultText = fmt.Sprintf("%d matches found:\n%s", len(results), strings.Join(results, "\n"))
+		} else {
+			resultText = "No matches found"
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: resultText},
+			},
+			StructuredContent: mcp.SearchResult{Success: true, Path: path, Matches: results},
+		}
+
+	case "directory_tree":
+		path, maxDepth, err := filesystem.ParseDirectoryTreeArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		tree, err := fileManager.DirectoryTree(path, maxDepth)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = path, int64(len(tree))
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: tree},
+			},
+		}
+
+	case "hash_file":
+		path, algorithm, err := filesystem.ParseHashFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		digest, err := fileManager.HashFile(path, algorithm)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: digest},
+			},
+		}
+
+	case "read_file_chunk":
+		path, offset, size, encoding, err := filesystem.ParseReadFileChunkArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		chunk, err := fileManager.ReadFileChunk(path, offset, size, encoding)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = path, int64(chunk.Size)
+
+		result, _ := json.Marshal(chunk)
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(result)},
+			},
+		}
+
+	case "get_directory_size":
+		path, err := filesystem.ParseGetDirectorySizeArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		size, files, err := fileManager.DirectorySize(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = path
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("%s: %s (%d bytes) in %d files", path, filesystem.FormatSize(size), size, files)},
+			},
+		}
+
+	// Editor tools
+	case "str_replace":
+		path, oldStr, newStr, replaceAll, expectedHash, err := editor.ParseStrReplaceArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		
+		if editor.ParsePreviewArg(request.Arguments) {
+			diff, err := editManager.PreviewStrReplace(validPath, oldStr, newStr, replaceAll)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			meta.path = validPath
+			meta.preview = true
+			response = previewResponse(diff)
+			break
+		}
+
+		replacements, err := editManager.StrReplace(validPath, oldStr, newStr, replaceAll, expectedHash)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+		
+		message := fmt.Sprintf("Successfully replaced text in %s", path)
+		if replaceAll {
+			message = fmt.Sprintf("Successfully replaced %d occurrence(s) in %s", replacements, path)
+		}
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: message},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+	
+	case "regex_replace":
+		path, pattern, replacement, all, err := editor.ParseRegexReplaceArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if editor.ParsePreviewArg(request.Arguments) {
+			diff, err := editManager.PreviewRegexReplace(validPath, pattern, replacement, all)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			meta.path = validPath
+			meta.preview = true
+			response = previewResponse(diff)
+			break
+		}
+
+		if err := editManager.RegexReplace(validPath, pattern, replacement, all); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully replaced pattern matches in %s", path)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
+	case "insert":
+		path, lineNumber, text, err := editor.ParseInsertArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		
+		if editor.ParsePreviewArg(request.Arguments) {
+			diff, err := editManager.PreviewInsert(validPath, lineNumber, text)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			meta.path = validPath
+			meta.preview = true
+			response = previewResponse(diff)
+			break
+		}
+
+		err = editManager.Insert(validPath, lineNumber, text)
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: fmt.Sprintf("Successfully inserted text at line %d in %s", lineNumber, path)},
 			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
 		}
 	
+	case "delete_lines":
+		path, startLine, endLine, err := editor.ParseDeleteLinesArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if editor.ParsePreviewArg(request.Arguments) {
+			diff, err := editManager.PreviewDeleteLines(validPath, startLine, endLine)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			meta.path = validPath
+			meta.preview = true
+			response = previewResponse(diff)
+			break
+		}
+
+		if err := editManager.DeleteLines(validPath, startLine, endLine); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully deleted lines %d-%d in %s", startLine, endLine, path)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
+	case "replace_lines":
+		path, startLine, endLine, text, err := editor.ParseReplaceLinesArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if editor.ParsePreviewArg(request.Arguments) {
+			diff, err := editManager.PreviewReplaceLines(validPath, startLine, endLine, text)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+			meta.path = validPath
+			meta.preview = true
+			response = previewResponse(diff)
+			break
+		}
+
+		if err := editManager.ReplaceLines(validPath, startLine, endLine, text); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully replaced lines %d-%d in %s", startLine, endLine, path)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
 	case "undo_edit":
 		path, err := editor.ParseUndoEditArgs(request.Arguments)
 		if err != nil {
@@ -419,27 +1799,368 @@ func handleToolCall(request mcp.CallToolRequest, fileManager *filesystem.FileMan
 		if err != nil {
 			return createErrorResponse(err.Error())
 		}
+		meta.path = validPath
 		
 		response = mcp.CallToolResponse{
 			Content: []mcp.ContentItem{
 				{Type: "text", Text: fmt.Sprintf("Successfully undid last edit to %s", path)},
 			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath},
 		}
 	
+	case "redo_edit":
+		path, err := editor.ParseRedoEditArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := editManager.RedoEdit(validPath); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = validPath
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully redid last undone edit to %s", path)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath},
+		}
+
+	case "apply_patch":
+		path, patch, fuzz, err := editor.ParseApplyPatchArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		hunks, err := editManager.ApplyPatch(validPath, patch, fuzz)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Successfully applied %d hunk(s) to %s", hunks, path)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
+	case "snapshot_file":
+		path, err := editor.ParseSnapshotFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		snapshotID, err := editManager.SnapshotFile(validPath)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, snapshotID
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Created snapshot %s of %s", snapshotID, path)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: snapshotID},
+		}
+
+	case "restore_to_snapshot":
+		path, snapshotID, err := editor.ParseRestoreToSnapshotArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := editManager.RestoreToSnapshot(validPath, snapshotID); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Restored %s to snapshot %s", path, snapshotID)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
+	case "list_backups":
+		path, err := editor.ParseListBackupsArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		result, _ := json.Marshal(map[string]interface{}{
+			"path":    validPath,
+			"backups": editManager.ListBackups(validPath),
+		})
+		meta.path = validPath
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: string(result)},
+			},
+		}
+
+	case "restore_backup":
+		path, backupID, err := editor.ParseRestoreBackupArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		if err := editManager.RestoreBackup(validPath, backupID); err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Restored %s to backup %s", path, backupID)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
+	case "export_changes":
+		path, err := editor.ParseExportChangesArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		validPath := ""
+		if path != "" {
+			validPath, err = fileManager.ValidatePath(path)
+			if err != nil {
+				return createErrorResponse(err.Error())
+			}
+		}
+
+		bundle, files, err := editManager.ExportChanges(validPath)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.bytes = validPath, int64(len(bundle))
+
+		text := bundle
+		if files == 0 {
+			text = "No changes recorded"
+		}
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: text},
+			},
+		}
+
+	case "lock_file", "unlock_file":
+		path, err := editor.ParseLockFileArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path = validPath
+
+		message := fmt.Sprintf("Locked %s for this session", path)
+		if request.Name == "lock_file" {
+			err = editManager.LockFile(validPath, session)
+		} else {
+			err = editManager.UnlockFile(validPath, session)
+			message = fmt.Sprintf("Unlocked %s", path)
+		}
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: message},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath},
+		}
+
+	case "replace_between_markers":
+		path, startMarker, endMarker, text, err := editor.ParseReplaceBetweenMarkersArgs(request.Arguments)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		// Validate path first
+		validPath, err := fileManager.ValidatePath(path)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+
+		endLine, err := editManager.ReplaceBetweenMarkers(validPath, startMarker, endMarker, text)
+		if err != nil {
+			return createErrorResponse(err.Error())
+		}
+		meta.path, meta.backupID = validPath, latestBackupID(editManager, validPath)
+
+		response = mcp.CallToolResponse{
+			Content: []mcp.ContentItem{
+				{Type: "text", Text: fmt.Sprintf("Replaced the region between markers in %s (end marker now on line %d)", path, endLine)},
+			},
+			StructuredContent: mcp.EditResult{Success: true, Path: validPath, BackupID: meta.backupID},
+		}
+
 	default:
 		return createErrorResponse(fmt.Sprintf("Unknown tool: %s", request.Name))
 	}
+
+	if opts.responseMetadata {
+		response.Meta = buildResponseMeta(request.Name, meta, start, fileManager)
+	}
+	if opts.auditLog != nil && !meta.preview && (opts.auditReads || toolCapability(request.Name) != capabilityReadOnly) {
+		recordAudit(request.Name, session, meta, fileManager, opts)
+	}
 	
 	return json.Marshal(response)
 }
 
+// buildResponseMeta creates the _meta block for a successful tool call
+func buildResponseMeta(toolName string, meta operationMeta, start time.Time, fileManager *filesystem.FileManager) map[string]interface{} {
+	result := map[string]interface{}{
+		"tool":       toolName,
+		"durationMs": time.Since(start).Milliseconds(),
+	}
+
+	if meta.path != "" {
+		result["path"] = resolvedPath(meta.path, fileManager)
+	}
+	if meta.bytes >= 0 {
+		result["bytes"] = meta.bytes
+	}
+	if meta.backupID != "" {
+		result["backupId"] = meta.backupID
+	}
+
+	return result
+}
+
+// resolvedPath returns a path as validated when it can still be validated;
+// it may no longer exist after a move or undo
+func resolvedPath(path string, fileManager *filesystem.FileManager) string {
+	if resolved, err := fileManager.ValidatePath(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// renamedFiles lists the renames reported in a rename_pattern result
+func renamedFiles(result string) []fileMove {
+	var parsed struct {
+		Directory string `json:"directory"`
+		Renamed   []struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"renamed"`
+	}
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		return nil
+	}
+	moves := make([]fileMove, len(parsed.Renamed))
+	for i, rename := range parsed.Renamed {
+		moves[i] = fileMove{filepath.Join(parsed.Directory, rename.From), filepath.Join(parsed.Directory, rename.To)}
+	}
+	return moves
+}
+
+// recordAudit appends a successful tool call to the audit log. A call that
+// moved files gets one entry per file, naming its source and destination.
+func recordAudit(toolName, session string, meta operationMeta, fileManager *filesystem.FileManager, opts toolOptions) {
+	entry := audit.Entry{Operation: toolName, Session: session}
+	if meta.path != "" {
+		entry.Path = resolvedPath(meta.path, fileManager)
+	}
+	if meta.bytes >= 0 {
+		entry.Bytes = &meta.bytes
+	}
+	if client := opts.clientInfo(session); client.Name != "" {
+		entry.Client = &audit.Client{Name: client.Name, Version: client.Version}
+	}
+
+	entries := []audit.Entry{entry}
+	if meta.moves != nil {
+		entries = entries[:0]
+		for _, move := range meta.moves {
+			entry.Source = resolvedPath(move.from, fileManager)
+			entry.Path = resolvedPath(move.to, fileManager)
+			entries = append(entries, entry)
+		}
+	}
+	for _, entry := range entries {
+		if err := opts.auditLog.Record(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing audit log: %v\n", err)
+		}
+	}
+}
+
+// latestBackupID returns the identifier of the most recent backup for a file
+func latestBackupID(editManager *editor.EditManager, filePath string) string {
+	history := editManager.GetEditHistory(filePath)
+	if len(history) == 0 {
+		return ""
+	}
+	return history[len(history)-1].ID()
+}
+
+// previewResponse reports the diff an editor tool would apply in preview mode
+func previewResponse(diff string) mcp.CallToolResponse {
+	if diff == "" {
+		diff = "No changes"
+	}
+	return mcp.CallToolResponse{
+		Content: []mcp.ContentItem{
+			{Type: "text", Text: diff},
+		},
+	}
+}
+
 // createErrorResponse creates an error response for a tool call
 func createErrorResponse(message string) (json.RawMessage, error) {
 	response := mcp.CallToolResponse{
 		Content: []mcp.ContentItem{
 			{Type: "text", Text: fmt.Sprintf("Error: %s", message)},
 		},
-		IsError: true,
+		StructuredContent: mcp.ErrorResult{Success: false, Error: message},
+		IsError:           true,
 	}
 	
 	return json.Marshal(response)
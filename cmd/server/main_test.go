@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/audit"
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/editor"
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/filesystem"
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/mcp"
+)
+
+// toolResult is a decoded tools/call result
+type toolResult struct {
+	Content           []mcp.ContentItem      `json:"content"`
+	StructuredContent json.RawMessage        `json:"structuredContent"`
+	IsError           bool                   `json:"isError"`
+	Meta              map[string]interface{} `json:"_meta"`
+}
+
+// text returns the result's text content
+func (r toolResult) text() string {
+	var parts []string
+	for _, item := range r.Content {
+		parts = append(parts, item.Text)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// newTestServer sets up the server's handlers over a temporary allowed
+// directory holding a.txt ("alpha\n") and sub/b.txt ("beta\n")
+func newTestServer(t *testing.T, opts toolOptions) (*mcp.Server, *filesystem.FileManager, string) {
+	t.Helper()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+	for name, content := range map[string]string{"a.txt": "alpha\n", "sub/b.txt": "beta\n"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	fileManager := filesystem.NewFileManager([]string{dir})
+	editManager, err := editor.NewEditManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	editManager.SetWritableCheck(fileManager.IsWritable)
+	editManager.SetWriteReservation(fileManager.ReserveWrite)
+
+	server := mcp.NewServer(mcp.ServerInfo{Name: "test"}, mcp.ServerConfig{})
+	server.SetLogger(mcp.NopLogger{})
+	if opts.clientInfo == nil {
+		opts.clientInfo = server.ClientInfo
+	}
+	setupServerHandlers(server, fileManager, editManager, nil, opts)
+	return server, fileManager, dir
+}
+
+// callTool calls a tool through the tools/call handler
+func callTool(t *testing.T, server *mcp.Server, name string, args interface{}) (toolResult, error) {
+	t.Helper()
+
+	params, err := json.Marshal(map[string]interface{}{"name": name, "arguments": args})
+	if err != nil {
+		t.Fatalf("Failed to encode arguments: %v", err)
+	}
+	raw, err := server.GetHandler("tools/call")(params)
+	if err != nil {
+		return toolResult{}, err
+	}
+
+	var result toolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("Failed to decode result %s: %v", raw, err)
+	}
+	return result, nil
+}
+
+func TestListToolsPages(t *testing.T) {
+	want := len(filesystem.FilesystemTools) + len(editor.EditorTools)
+
+	// Small pages force many round trips; each call rebuilds the list as the handler does
+	seen := make(map[string]int)
+	cursor := ""
+	for {
+		tools := listTools("fs_")
+		start, end, next, err := mcp.PageBounds(len(tools), cursor, 7)
+		if err != nil {
+			t.Fatalf("PageBounds failed: %v", err)
+		}
+		for _, tool := range tools[start:end] {
+			seen[tool.Name]++
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(seen) != want {
+		t.Errorf("Expected %d distinct tools across pages, got %d", want, len(seen))
+	}
+	for name, count := range seen {
+		if count != 1 {
+			t.Errorf("Tool %s appeared %d times across pages", name, count)
+		}
+	}
+
+	tools := listTools("")
+	for i := 1; i < len(tools); i++ {
+		if tools[i-1].Name >= tools[i].Name {
+			t.Errorf("Tools not sorted: %s before %s", tools[i-1].Name, tools[i].Name)
+		}
+	}
+}
+
+func TestToolPrefixIsRequired(t *testing.T) {
+	server, _, dir := newTestServer(t, toolOptions{toolPrefix: "fs_"})
+	args := map[string]interface{}{"path": filepath.Join(dir, "a.txt")}
+
+	result, err := callTool(t, server, "fs_read_file", args)
+	if err != nil || result.IsError || !strings.Contains(result.text(), "alpha") {
+		t.Errorf("Expected the prefixed name to read the file, got %+v (%v)", result, err)
+	}
+
+	_, err = callTool(t, server, "read_file", args)
+	var rpcErr *mcp.RPCError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != mcp.CodeMethodNotFound {
+		t.Errorf("Expected method not found for the unprefixed name, got %v", err)
+	}
+
+	// Without a prefix, plain names work as before
+	server, _, dir = newTestServer(t, toolOptions{})
+	result, err = callTool(t, server, "read_file", map[string]interface{}{"path": filepath.Join(dir, "a.txt")})
+	if err != nil || result.IsError {
+		t.Errorf("Expected the plain name to work without a prefix, got %+v (%v)", result, err)
+	}
+}
+
+func TestWriteFileTrailingNewline(t *testing.T) {
+	server, _, dir := newTestServer(t, toolOptions{})
+	path := filepath.Join(dir, "out.txt")
+
+	tests := []struct {
+		policy  string
+		content string
+		want    string
+	}{
+		{"", "one\n\n", "one\n\n"},
+		{"preserve", "one", "one"},
+		{"ensure", "one", "one\n"},
+		{"ensure", "one\r\ntwo\r\n\r\n", "one\r\ntwo\r\n"},
+		{"strip", "one\n\n", "one"},
+	}
+	for _, tt := range tests {
+		args := map[string]interface{}{"path": path, "content": tt.content}
+		if tt.policy != "" {
+			args["trailing_newline"] = tt.policy
+		}
+		result, err := callTool(t, server, "write_file", args)
+		if err != nil || result.IsError {
+			t.Errorf("%q: write_file failed: %+v (%v)", tt.policy, result, err)
+			continue
+		}
+		if content, _ := os.ReadFile(path); string(content) != tt.want {
+			t.Errorf("%q with %q: expected %q on disk, got %q", tt.policy, tt.content, tt.want, string(content))
+		}
+	}
+
+	result, err := callTool(t, server, "write_file", map[string]interface{}{"path": path, "content": "x", "trailing_newline": "always"})
+	if err == nil && !result.IsError {
+		t.Error("Expected an unknown trailing_newline policy to be rejected")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "one" {
+		t.Errorf("Expected the rejected write to leave the file alone, got %q", string(content))
+	}
+}
+
+func TestResponseMetadata(t *testing.T) {
+	server, _, dir := newTestServer(t, toolOptions{responseMetadata: true})
+	path := filepath.Join(dir, "sub", "..", "out.txt")
+
+	result, err := callTool(t, server, "write_file", map[string]interface{}{"path": path, "content": "hello"})
+	if err != nil || result.IsError {
+		t.Fatalf("write_file failed: %+v (%v)", result, err)
+	}
+	if result.Meta["tool"] != "write_file" || result.Meta["path"] != filepath.Join(dir, "out.txt") || result.Meta["bytes"] != float64(5) {
+		t.Errorf("Unexpected write_file metadata: %v", result.Meta)
+	}
+	if _, ok := result.Meta["durationMs"]; !ok {
+		t.Errorf("Expected a duration in %v", result.Meta)
+	}
+
+	// Edits report the backup they can be undone from
+	result, err = callTool(t, server, "str_replace", map[string]interface{}{"path": path, "old_str": "hello", "new_str": "bye"})
+	if err != nil || result.IsError {
+		t.Fatalf("str_replace failed: %+v (%v)", result, err)
+	}
+	if backup, _ := result.Meta["backupId"].(string); backup == "" {
+		t.Errorf("Expected a backup id in %v", result.Meta)
+	}
+
+	// Failed calls and servers without the flag carry no metadata
+	result, _ = callTool(t, server, "read_file", map[string]interface{}{"path": filepath.Join(dir, "missing.txt")})
+	if !result.IsError || result.Meta != nil {
+		t.Errorf("Expected an error without metadata, got %+v", result)
+	}
+	server, _, dir = newTestServer(t, toolOptions{})
+	result, _ = callTool(t, server, "read_file", map[string]interface{}{"path": filepath.Join(dir, "a.txt")})
+	if result.Meta != nil {
+		t.Errorf("Expected no metadata when disabled, got %v", result.Meta)
+	}
+}
+
+func TestStructuredContent(t *testing.T) {
+	server, _, dir := newTestServer(t, toolOptions{})
+	path := filepath.Join(dir, "a.txt")
+
+	result, err := callTool(t, server, "read_file", map[string]interface{}{"path": path})
+	if err != nil || result.IsError {
+		t.Fatalf("read_file failed: %+v (%v)", result, err)
+	}
+	var read mcp.ReadFileResult
+	if err := json.Unmarshal(result.StructuredContent, &read); err != nil {
+		t.Fatalf("Failed to decode read_file result %s: %v", result.StructuredContent, err)
+	}
+	if want := (mcp.ReadFileResult{Success: true, Path: path, Size: 6, Content: "alpha\n"}); read != want {
+		t.Errorf("Expected %+v, got %+v", want, read)
+	}
+	if result.text() != "alpha\n" {
+		t.Errorf("Expected the text content to stay the file's content, got %q", result.text())
+	}
+
+	result, err = callTool(t, server, "write_file", map[string]interface{}{"path": path, "content": "hello"})
+	if err != nil || result.IsError {
+		t.Fatalf("write_file failed: %+v (%v)", result, err)
+	}
+	var written mcp.WriteFileResult
+	if err := json.Unmarshal(result.StructuredContent, &written); err != nil {
+		t.Fatalf("Failed to decode write_file result %s: %v", result.StructuredContent, err)
+	}
+	if want := (mcp.WriteFileResult{Success: true, Path: path, BytesWritten: 5}); written != want {
+		t.Errorf("Expected %+v, got %+v", want, written)
+	}
+
+	// Failures carry the error message in the same shape for every tool
+	result, _ = callTool(t, server, "read_file", map[string]interface{}{"path": filepath.Join(dir, "missing.txt")})
+	var failed mcp.ErrorResult
+	if err := json.Unmarshal(result.StructuredContent, &failed); err != nil {
+		t.Fatalf("Failed to decode error result %s: %v", result.StructuredContent, err)
+	}
+	if !result.IsError || failed.Success || failed.Error == "" || !strings.Contains(result.text(), failed.Error) {
+		t.Errorf("Unexpected error result %+v with %+v", result, failed)
+	}
+}
+
+func TestToolCapabilities(t *testing.T) {
+	// Every advertised tool needs an explicit class; the destructive fallback
+	// is only a safety net
+	for _, tool := range listTools("") {
+		if _, ok := toolCapabilities[tool.Name]; !ok {
+			t.Errorf("Tool %s has no capability class", tool.Name)
+		}
+	}
+	for name := range toolCapabilities {
+		_, fsTool := filesystem.FilesystemTools[name]
+		_, editTool := editor.EditorTools[name]
+		if !fsTool && !editTool {
+			t.Errorf("Capability class for unknown tool %s", name)
+		}
+	}
+	if toolCapability("no_such_tool") != capabilityDestructive {
+		t.Error("Expected unclassified tools to be reported as destructive")
+	}
+
+	annotations := map[string]mcp.ToolAnnotations{}
+	for _, tool := range listTools("fs_") {
+		annotations[tool.Name] = *tool.Annotations
+	}
+	for name, want := range map[string]mcp.ToolAnnotations{
+		"fs_read_file":   {ReadOnlyHint: true},
+		"fs_str_replace": {},
+		"fs_write_file":  {DestructiveHint: true},
+	} {
+		if annotations[name] != want {
+			t.Errorf("%s: expected annotations %+v, got %+v", name, want, annotations[name])
+		}
+	}
+
+	server, _, _ := newTestServer(t, toolOptions{toolPrefix: "fs_"})
+	result, err := callTool(t, server, "fs_list_tool_capabilities", map[string]interface{}{})
+	if err != nil || result.IsError {
+		t.Fatalf("list_tool_capabilities failed: %+v (%v)", result, err)
+	}
+	var listed struct {
+		Tools []struct {
+			Name       string `json:"name"`
+			Capability string `json:"capability"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal([]byte(result.text()), &listed); err != nil {
+		t.Fatalf("Failed to decode %s: %v", result.text(), err)
+	}
+	if len(listed.Tools) != len(annotations) {
+		t.Errorf("Expected %d tools, got %d", len(annotations), len(listed.Tools))
+	}
+	for _, tool := range listed.Tools {
+		if !strings.HasPrefix(tool.Name, "fs_") || tool.Capability != toolCapability(strings.TrimPrefix(tool.Name, "fs_")) {
+			t.Errorf("Unexpected capability for %s: %s", tool.Name, tool.Capability)
+		}
+	}
+}
+
+// sessionTransport passes the notifications sent to single sessions to a channel
+type sessionTransport struct {
+	sent chan string // "session method"
+}
+
+func (t *sessionTransport) Start(handler mcp.RequestHandlerFunc, closed mcp.SessionClosedFunc) error {
+	return nil
+}
+
+func (t *sessionTransport) Stop() error                                        { return nil }
+func (t *sessionTransport) SendNotification(method string, params interface{}) {}
+func (t *sessionTransport) SetLogger(logger mcp.Logger)                        {}
+
+func (t *sessionTransport) SendSessionNotification(session, method string, params interface{}) {
+	t.sent <- session + " " + method
+}
+
+func TestResourceUpdatesGoToSubscribers(t *testing.T) {
+	server, fileManager, dir := newTestServer(t, toolOptions{})
+	transport := &sessionTransport{sent: make(chan string, 10)}
+	if err := server.Connect(transport); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+
+	watcher, err := filesystem.NewResourceWatcher(fileManager, 50*time.Millisecond, func(path string, sessions []string) {
+		notifyResourceUpdated(server, path, sessions)
+	})
+	if err != nil {
+		t.Skipf("File watching unavailable: %v", err)
+	}
+	defer watcher.Close()
+
+	// Two sessions, each subscribed to a different file
+	path := filepath.Join(dir, "a.txt")
+	if _, err := watcher.Subscribe("one", path); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if _, err := watcher.Subscribe("two", filepath.Join(dir, "sub", "b.txt")); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	os.WriteFile(path, []byte("changed\n"), 0644)
+	select {
+	case got := <-transport.sent:
+		if got != "one notifications/resources/updated" {
+			t.Errorf("Expected the update for session one, got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a resource update")
+	}
+	select {
+	case got := <-transport.sent:
+		t.Errorf("Expected one notification, got %q as well", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestAuditMovesAndRenames(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(logPath)
+	if err != nil {
+		t.Fatalf("audit.Open failed: %v", err)
+	}
+	defer auditLog.Close()
+	server, _, dir := newTestServer(t, toolOptions{auditLog: auditLog})
+	os.WriteFile(filepath.Join(dir, "sub", "c.txt"), []byte("gamma\n"), 0644)
+
+	if _, err := callTool(t, server, "move_file", map[string]string{"source": filepath.Join(dir, "a.txt"), "destination": filepath.Join(dir, "moved.txt")}); err != nil {
+		t.Fatalf("move_file failed: %v", err)
+	}
+	// A dry run changes nothing, so it is not audited
+	rename := map[string]interface{}{"directory": filepath.Join(dir, "sub"), "match": "*.txt", "replacement": "$1.md", "dry_run": true}
+	if _, err := callTool(t, server, "rename_pattern", rename); err != nil {
+		t.Fatalf("rename_pattern dry run failed: %v", err)
+	}
+	rename["dry_run"] = false
+	if _, err := callTool(t, server, "rename_pattern", rename); err != nil {
+		t.Fatalf("rename_pattern failed: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry audit.Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		got = append(got, entry.Operation+" "+entry.Source+" -> "+entry.Path)
+	}
+	want := []string{
+		"move_file " + filepath.Join(dir, "a.txt") + " -> " + filepath.Join(dir, "moved.txt"),
+		"rename_pattern " + filepath.Join(dir, "sub", "b.txt") + " -> " + filepath.Join(dir, "sub", "b.md"),
+		"rename_pattern " + filepath.Join(dir, "sub", "c.txt") + " -> " + filepath.Join(dir, "sub", "c.md"),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected audit entries\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
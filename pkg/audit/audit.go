@@ -0,0 +1,198 @@
+// Package audit writes a tamper-evident log of filesystem operations: one
+// JSON line per operation, each carrying the SHA-256 of the line before it,
+// so a removed or altered line breaks the chain.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// tailSize is how much of an existing log is read to find its last line
+const tailSize = 64 * 1024
+
+// Client identifies the client that requested an operation
+type Client struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Entry is one audited operation
+type Entry struct {
+	Time      string  `json:"time"` // RFC 3339, filled in by Record when empty
+	Operation string  `json:"operation"`
+	Source    string  `json:"source,omitempty"` // Where a moved, renamed or copied file came from
+	Path      string  `json:"path,omitempty"`
+	Bytes     *int64  `json:"bytes,omitempty"` // Bytes read or written, when known
+	Session   string  `json:"session,omitempty"`
+	Client    *Client `json:"client,omitempty"`
+	Prev      string  `json:"prev"` // SHA-256 of the previous line; set by Record
+}
+
+// Log appends entries to an audit log file. It reopens the file when it has
+// been rotated away, continuing the hash chain in the new file.
+type Log struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+	prev  string // Hash of the last line written
+}
+
+// Open opens or creates the audit log at path, continuing the hash chain
+// from its last line
+func Open(path string) (*Log, error) {
+	l := &Log{path: path}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	last, err := lastLine(path)
+	if err != nil {
+		l.file.Close()
+		return nil, fmt.Errorf("failed to read audit log %s: %w", path, err)
+	}
+	if last != nil {
+		l.prev = lineHash(last)
+	}
+	return l, nil
+}
+
+// Record appends an entry as one JSON line. The line is written with a
+// single append and synced before Record returns.
+func (l *Log) Record(entry Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log %s is closed", l.path)
+	}
+	if err := l.reopenIfRotated(); err != nil {
+		return err
+	}
+
+	if entry.Time == "" {
+		entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	entry.Prev = l.prev
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", l.path, err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log %s: %w", l.path, err)
+	}
+	l.prev = lineHash(line)
+	return nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Verify checks the hash chain of a log, returning how many entries it
+// holds. The first entry's prev is not checked, since it links to a
+// previous, rotated file.
+func Verify(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	count := 0
+	prev := ""
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return count, fmt.Errorf("line %d: %w", count+1, err)
+		}
+		if count > 0 && entry.Prev != prev {
+			return count, fmt.Errorf("line %d: hash chain broken", count+1)
+		}
+		prev = lineHash(line)
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// open opens the log file for appending, creating it if needed
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", l.path, err)
+	}
+	l.file = file
+	return nil
+}
+
+// reopenIfRotated reopens the log when the file at its path is no longer
+// the one being written, e.g. after logrotate moved or deleted it
+func (l *Log) reopenIfRotated() error {
+	current, err := l.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to check audit log %s: %w", l.path, err)
+	}
+	if onDisk, err := os.Stat(l.path); err == nil && os.SameFile(current, onDisk) {
+		return nil
+	}
+
+	l.file.Close()
+	return l.open()
+}
+
+// lastLine returns the last line of a file, or nil if it has none
+func lastLine(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size() - tailSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	tail = bytes.TrimRight(tail, "\n")
+	if len(tail) == 0 {
+		return nil, nil
+	}
+	if i := bytes.LastIndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	return tail, nil
+}
+
+// lineHash returns the hex SHA-256 of a line without its newline
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogChainsEntriesAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	size := int64(5)
+	if err := log.Record(Entry{Operation: "write_file", Path: "/a.txt", Bytes: &size, Client: &Client{Name: "test", Version: "1"}}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	log.Record(Entry{Operation: "move_file", Path: "/b.txt"})
+
+	// Rotating the file away starts a new one that continues the chain
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate log: %v", err)
+	}
+	log.Record(Entry{Operation: "delete_directory", Path: "/c"})
+	log.Close()
+
+	rotated, _ := os.ReadFile(path + ".1")
+	current, _ := os.ReadFile(path)
+	if count, err := Verify(strings.NewReader(string(rotated) + string(current))); err != nil || count != 3 {
+		t.Errorf("Expected a valid chain of 3 entries, got %d (%v)", count, err)
+	}
+	if !strings.Contains(string(rotated), `"bytes":5`) {
+		t.Errorf("Expected the byte count to be recorded, got %s", rotated)
+	}
+
+	// Reopening continues from the last line
+	log, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	log.Record(Entry{Operation: "write_file", Path: "/d.txt"})
+	log.Close()
+	current, _ = os.ReadFile(path)
+	if count, err := Verify(strings.NewReader(string(rotated) + string(current))); err != nil || count != 4 {
+		t.Errorf("Expected a valid chain of 4 entries, got %d (%v)", count, err)
+	}
+
+	// Altering an entry breaks the chain
+	tampered := strings.Replace(string(rotated), "/b.txt", "/x.txt", 1)
+	if _, err := Verify(strings.NewReader(tampered + string(current))); err == nil {
+		t.Error("Expected a tampered entry to break the chain")
+	}
+}
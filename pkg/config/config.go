@@ -6,21 +6,137 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Network transports selectable with network.mode
+const (
+	NetworkModeTCP       = "tcp"
+	NetworkModeWebSocket = "websocket"
+	NetworkModeHTTP      = "http"
 )
 
 // NetworkConfig holds network-specific configuration
 type NetworkConfig struct {
-	Enabled        bool     `json:"enabled"`
-	Host           string   `json:"host"`
-	Port           int      `json:"port"`
-	AllowedIPs     []string `json:"allowedIPs"`
-	AllowedSubnets []string `json:"allowedSubnets"`
+	Enabled             bool     `json:"enabled"`
+	Mode                string   `json:"mode,omitempty"` // Transport when enabled: "tcp" (default), "websocket" or "http"
+	Path                string   `json:"path,omitempty"` // URL path the WebSocket and HTTP transports serve (default "/mcp")
+	Host                string   `json:"host"`
+	Port                int      `json:"port"`
+	AllowedIPs          []string `json:"allowedIPs"`
+	AllowedSubnets      []string `json:"allowedSubnets"`
+	LogFormat           string   `json:"logFormat,omitempty"`           // Connection log format: "text" (default) or "json"
+	Compression         string   `json:"compression,omitempty"`         // Response compression: "none" (default) or "gzip"
+	CompressionMinBytes int      `json:"compressionMinBytes,omitempty"` // Smallest response that is compressed
+	MaxConnections      int      `json:"maxConnections,omitempty"`      // Clients served at once (0 = unlimited)
+	IdleTimeoutSeconds  int      `json:"idleTimeoutSeconds,omitempty"`  // Close connections idle this long (0 = never)
+	AllowedOrigins      []string `json:"allowedOrigins,omitempty"`      // Browser origins the WebSocket and HTTP transports accept
+}
+
+// AllowedDirectory is an allowed directory with optional per-directory settings.
+// In config.json it may be written either as a plain path string or as an
+// object such as {"path": "/data", "maxSearchDepth": 2, "readOnly": true}.
+type AllowedDirectory struct {
+	Path           string `json:"path"`
+	MaxSearchDepth *int   `json:"maxSearchDepth,omitempty"` // Deepest level searches below this directory may reach
+	WriteQuota     *int64 `json:"writeQuota,omitempty"`     // Bytes the server may write into this directory, less deletions
+	ReadOnly       bool   `json:"readOnly,omitempty"`       // Expose the directory for reading only
+}
+
+// UnmarshalJSON accepts either a plain path string or an object
+func (d *AllowedDirectory) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*d = AllowedDirectory{Path: path}
+		return nil
+	}
+
+	// Use an alias type to avoid recursing into this method
+	type allowedDirectoryObject AllowedDirectory
+	var obj allowedDirectoryObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("allowed directory must be a path string or an object with a \"path\": %w", err)
+	}
+	*d = AllowedDirectory(obj)
+	return nil
+}
+
+// MarshalJSON writes directories without extra settings as plain strings
+func (d AllowedDirectory) MarshalJSON() ([]byte, error) {
+	if d.MaxSearchDepth == nil && d.WriteQuota == nil && !d.ReadOnly {
+		return json.Marshal(d.Path)
+	}
+	type allowedDirectoryObject AllowedDirectory
+	return json.Marshal(allowedDirectoryObject(d))
+}
+
+// Mode is a permission mode written in config.json as an octal string such as "0640"
+type Mode os.FileMode
+
+// UnmarshalJSON parses an octal permission string
+func (m *Mode) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("permission mode must be an octal string such as \"0644\": %w", err)
+	}
+	parsed, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid permission mode %q: must be octal such as \"0644\"", value)
+	}
+	if parsed > 0777 {
+		return fmt.Errorf("invalid permission mode %q: only permission bits (0000-0777) are allowed", value)
+	}
+	*m = Mode(parsed)
+	return nil
+}
+
+// MarshalJSON writes the mode as an octal string
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%04o", uint32(m)))
+}
+
+// RetryConfig controls retries of transient filesystem errors
+type RetryConfig struct {
+	MaxAttempts int `json:"maxAttempts"` // Total attempts; 0 or 1 disables retries
+	BackoffMs   int `json:"backoffMs"`   // Initial delay between attempts, doubled each retry
 }
 
 // Config holds the application configuration
 type Config struct {
-	AllowedDirectories []string      `json:"allowedDirectories"`
-	Network            NetworkConfig `json:"network"`
+	AllowedDirectories []AllowedDirectory `json:"allowedDirectories"`
+	Network            NetworkConfig      `json:"network"`
+	ToolPrefix         string             `json:"toolPrefix,omitempty"`       // Prepended to every advertised tool name
+	MaxEntries         int                `json:"maxEntries,omitempty"`       // Entry limit for recursive operations (0 = default, -1 = unlimited)
+	ResponseMetadata   bool               `json:"responseMetadata,omitempty"` // Attach a _meta block to tool results
+	Retry              RetryConfig        `json:"retry"`
+	HiddenDirectories  []string           `json:"hiddenDirectories,omitempty"`  // Directory names left out of listings and searches
+	MaxWriteBytes      int64              `json:"maxWriteBytes,omitempty"`      // Largest file a write may produce (0 = unlimited)
+	BaseDirectory      string             `json:"baseDirectory,omitempty"`      // Directory relative tool paths resolve against (default: working directory)
+	MaxOpenFiles       int                `json:"maxOpenFiles,omitempty"`       // Files operations may hold open at once (0 = unlimited)
+	BareFilenameRoot   bool               `json:"bareFilenameRoot,omitempty"`   // Resolve bare filenames against the first allowed directory
+	MaxConcurrentEdits int                `json:"maxConcurrentEdits,omitempty"` // Edits that may run at once (0 = default, -1 = unlimited)
+	MaxEditHistory     int                `json:"maxEditHistory,omitempty"`     // Edits kept for undo (0 = default 100)
+	MaxBackupAgeHours  int                `json:"maxBackupAgeHours,omitempty"`  // Age after which edit backups are removed (0 = no limit)
+	MaxWaitMs          int                `json:"maxWaitMs,omitempty"`          // Longest wait_for_file and watch_file may block (0 = default)
+	MaxSearchFileBytes int64              `json:"maxSearchFileBytes,omitempty"` // Largest file search_content scans (0 = default)
+	DeniedPatterns     []string           `json:"deniedPatterns,omitempty"`     // Globs for paths refused even inside allowed directories
+	MaxReadBytes       *int64             `json:"maxReadBytes,omitempty"`       // Largest file a read may load (unset = 10MB, 0 = unlimited)
+	FileMode           Mode               `json:"fileMode,omitempty"`           // Permissions for files the server creates (0 = 0644)
+	DirMode            Mode               `json:"dirMode,omitempty"`            // Permissions for directories the server creates (0 = 0755)
+	Framing            string             `json:"framing,omitempty"`            // Message framing for stdio and tcp: "line" (default) or "lsp"
+	LogLevel           string             `json:"logLevel,omitempty"`           // Least severe level logged to stderr: "debug", "info" (default), "warning", ...
+	AuditLogPath       string             `json:"auditLogPath,omitempty"`       // File receiving a JSON line for every filesystem change (empty = no audit log)
+	AuditReads         bool               `json:"auditReads,omitempty"`         // Also audit read-only tools
+}
+
+// DirectoryPaths returns the paths of all allowed directories
+func (c *Config) DirectoryPaths() []string {
+	paths := make([]string, len(c.AllowedDirectories))
+	for i, dir := range c.AllowedDirectories {
+		paths[i] = dir.Path
+	}
+	return paths
 }
 
 // Default config file name
@@ -87,12 +203,24 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Resolve and validate all directory paths
-	resolvedDirs := make([]string, 0, len(config.AllowedDirectories))
+	resolvedDirs := make([]AllowedDirectory, 0, len(config.AllowedDirectories))
 	for _, dir := range config.AllowedDirectories {
+		if dir.Path == "" {
+			return nil, fmt.Errorf("allowed directory entry is missing a path")
+		}
+
+		if dir.MaxSearchDepth != nil && *dir.MaxSearchDepth < 0 {
+			return nil, fmt.Errorf("maxSearchDepth for %s must not be negative", dir.Path)
+		}
+
+		if dir.WriteQuota != nil && *dir.WriteQuota < 0 {
+			return nil, fmt.Errorf("writeQuota for %s must not be negative", dir.Path)
+		}
+
 		// Convert to absolute path
-		absPath, err := filepath.Abs(dir)
+		absPath, err := filepath.Abs(dir.Path)
 		if err != nil {
-			return nil, fmt.Errorf("error resolving path %s: %w", dir, err)
+			return nil, fmt.Errorf("error resolving path %s: %w", dir.Path, err)
 		}
 
 		// Check if it exists and is a directory
@@ -104,12 +232,51 @@ func LoadConfig() (*Config, error) {
 			return nil, fmt.Errorf("error: %s is not a directory", absPath)
 		}
 
-		resolvedDirs = append(resolvedDirs, absPath)
+		dir.Path = absPath
+		resolvedDirs = append(resolvedDirs, dir)
 	}
 	
 	// Update the config with resolved paths
 	config.AllowedDirectories = resolvedDirs
 
+	if config.MaxEditHistory < 0 || config.MaxBackupAgeHours < 0 {
+		return nil, fmt.Errorf("maxEditHistory and maxBackupAgeHours must not be negative")
+	}
+
+	if config.MaxReadBytes != nil && *config.MaxReadBytes < 0 {
+		return nil, fmt.Errorf("maxReadBytes must not be negative")
+	}
+
+	// The server must still be able to use what it creates
+	if config.FileMode != 0 && config.FileMode&0600 != 0600 {
+		return nil, fmt.Errorf("fileMode %04o must give the owner read and write permission", uint32(config.FileMode))
+	}
+	if config.DirMode != 0 && config.DirMode&0700 != 0700 {
+		return nil, fmt.Errorf("dirMode %04o must give the owner read, write and execute permission", uint32(config.DirMode))
+	}
+
+	for _, pattern := range config.DeniedPatterns {
+		if _, err := filepath.Match(strings.TrimRight(pattern, "/"), ""); err != nil {
+			return nil, fmt.Errorf("invalid deniedPatterns entry %q: %w", pattern, err)
+		}
+	}
+
+	// Resolve the base directory for relative tool paths
+	if config.BaseDirectory != "" {
+		absPath, err := filepath.Abs(config.BaseDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving baseDirectory %s: %w", config.BaseDirectory, err)
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			return nil, fmt.Errorf("error accessing baseDirectory %s: %w", absPath, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("error: baseDirectory %s is not a directory", absPath)
+		}
+		config.BaseDirectory = absPath
+	}
+
 	// Set network defaults if not specified
 	if config.Network.Host == "" {
 		config.Network.Host = "localhost"
@@ -117,6 +284,17 @@ func LoadConfig() (*Config, error) {
 	if config.Network.Port == 0 {
 		config.Network.Port = 3002
 	}
+	if config.Network.MaxConnections < 0 || config.Network.IdleTimeoutSeconds < 0 {
+		return nil, fmt.Errorf("network.maxConnections and network.idleTimeoutSeconds must not be negative")
+	}
+	switch config.Network.Mode {
+	case "":
+		config.Network.Mode = NetworkModeTCP
+	case NetworkModeTCP, NetworkModeWebSocket, NetworkModeHTTP:
+	default:
+		return nil, fmt.Errorf("invalid network mode %q (use %q, %q or %q)",
+			config.Network.Mode, NetworkModeTCP, NetworkModeWebSocket, NetworkModeHTTP)
+	}
 
 	fmt.Fprintf(os.Stderr, "Configuration loaded successfully\n")
 	fmt.Fprintf(os.Stderr, "Network mode: %v\n", config.Network.Enabled)
@@ -132,7 +310,7 @@ func createDefaultConfig(configFilePath string) (*Config, error) {
 	}
 	
 	config := &Config{
-		AllowedDirectories: []string{cwd},
+		AllowedDirectories: []AllowedDirectory{{Path: cwd}},
 	}
 
 	// Convert config to JSON
@@ -0,0 +1,187 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultDiffContext is how many unchanged lines surround each change in a generated diff
+const DefaultDiffContext = 3
+
+// diffOp is one line of an edit script: kept (' '), removed ('-') or added ('+').
+// oldPos and newPos count the old and new lines that precede it.
+type diffOp struct {
+	kind   byte
+	oldPos int
+	newPos int
+}
+
+// diffLines computes a shortest edit script turning a into b (Myers' algorithm)
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the script
+	var reversed []byte
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, ' ')
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			reversed = append(reversed, '+')
+			y--
+		} else {
+			reversed = append(reversed, '-')
+			x--
+		}
+	}
+
+	ops := make([]diffOp, len(reversed))
+	x, y = 0, 0
+	for i := range reversed {
+		kind := reversed[len(reversed)-1-i]
+		ops[i] = diffOp{kind: kind, oldPos: x, newPos: y}
+		if kind != '+' {
+			x++
+		}
+		if kind != '-' {
+			y++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff returns a unified diff from oldContent to newContent with the given
+// number of context lines, or "" if they are equal. Missing final newlines are
+// marked the way diff(1) does, so apply_patch can reproduce the new content exactly.
+func unifiedDiff(oldName, newName, oldContent, newContent string, context int) string {
+	if oldContent == newContent {
+		return ""
+	}
+
+	oldLines, oldEndings := splitLines(oldContent)
+	newLines, newEndings := splitLines(newContent)
+
+	// Compare lines with their endings so a gained or lost final newline is a change
+	oldKeys := make([]string, len(oldLines))
+	for i := range oldLines {
+		oldKeys[i] = oldLines[i] + oldEndings[i]
+	}
+	newKeys := make([]string, len(newLines))
+	for i := range newLines {
+		newKeys[i] = newLines[i] + newEndings[i]
+	}
+	ops := diffLines(oldKeys, newKeys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Merge changes separated by at most twice the context into one hunk
+		last := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			} else if j-last > 2*context {
+				break
+			}
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		stop := last + context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		writeHunk(&b, ops[start:stop], oldLines, oldEndings, newLines, newEndings)
+		i = stop
+	}
+
+	return b.String()
+}
+
+// writeHunk writes one hunk of a unified diff
+func writeHunk(b *strings.Builder, ops []diffOp, oldLines, oldEndings, newLines, newEndings []string) {
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+
+	// An empty side is numbered by the line before it
+	oldStart, newStart := ops[0].oldPos+1, ops[0].newPos+1
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+
+	for _, op := range ops {
+		var line, ending string
+		if op.kind == '+' {
+			line, ending = newLines[op.newPos], newEndings[op.newPos]
+		} else {
+			line, ending = oldLines[op.oldPos], oldEndings[op.oldPos]
+		}
+		b.WriteByte(op.kind)
+		b.WriteString(line)
+		b.WriteByte('\n')
+		if ending == "" {
+			b.WriteString("\\ No newline at end of file\n")
+		}
+	}
+}
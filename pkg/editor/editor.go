@@ -1,54 +1,101 @@
 package editor
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/filesystem"
 )
 
 // EditHistory tracks file edits for undo functionality
 type EditHistory struct {
-	FilePath     string
-	OriginalHash string
-	BackupPath   string
-	Timestamp    time.Time
+	FilePath     string    `json:"filePath"`
+	OriginalHash string    `json:"originalHash,omitempty"` // SHA-256 of the backed up content
+	ResultHash   string    `json:"resultHash,omitempty"`   // SHA-256 of the file once the entry was recorded
+	BackupPath   string    `json:"backupPath"`
+	Timestamp    time.Time `json:"timestamp"`
+	Snapshot     bool      `json:"snapshot,omitempty"` // Restore point created by snapshot_file rather than by an edit
+}
+
+// ID returns the opaque identifier of the entry's backup
+func (h EditHistory) ID() string {
+	return filepath.Base(h.BackupPath)
 }
 
 // EditManager manages file editing operations with undo capability
 type EditManager struct {
 	history      []EditHistory
+	redo         map[string][]EditHistory // Undone changes by file, most recent last; guarded by historyMutex
 	historyMutex sync.RWMutex
+	maxHistory   int           // Edits kept for undo
+	maxBackupAge time.Duration // Backups older than this are dropped (0 = no age limit)
 	backupDir    string
+	editSlots    chan struct{} // Bounds concurrent edits; nil means unlimited
+	editLocks    fileMutexes   // Serializes edits, undo and redo per file
+	locksMutex   sync.Mutex
+	locks        map[string]fileLock                           // Advisory locks by file path
+	writable     func(path string) bool                        // Refuses edits to read-only files; nil allows all
+	reserve      func(path string, size int64) (func(), error) // Checks writes against the server's limits; nil allows all
+	fileMode     os.FileMode                                   // Permissions for files and backups the editor creates
+	dirMode      os.FileMode                                   // Permissions for directories the editor creates
 }
 
-// NewEditManager creates a new EditManager
+// NewEditManager creates a new EditManager, restoring any edit history
+// saved in backupDir by a previous run
 func NewEditManager(backupDir string) (*EditManager, error) {
 	if backupDir == "" {
 		// Use system temp directory
 		backupDir = filepath.Join(os.TempDir(), "mcp-filesystem-backups")
 	}
 
-	// Ensure backup directory exists
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
+	// Ensure backup directory exists; it is private since undo trusts its contents
+	if err := os.MkdirAll(backupDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
-	return &EditManager{
-		history:   make([]EditHistory, 0),
-		backupDir: backupDir,
-	}, nil
+	em := &EditManager{
+		history:    make([]EditHistory, 0),
+		redo:       make(map[string][]EditHistory),
+		maxHistory: DefaultMaxHistory,
+		backupDir:  backupDir,
+		editSlots:  make(chan struct{}, DefaultMaxConcurrentEdits),
+		locks:      make(map[string]fileLock),
+		fileMode:   filesystem.DefaultFileMode,
+		dirMode:    filesystem.DefaultDirMode,
+	}
+	em.loadHistory()
+
+	return em, nil
+}
+
+// SetFileModes sets the permissions used for new files, backups and
+// directories. A zero mode restores the default. The process umask still applies.
+func (em *EditManager) SetFileModes(fileMode, dirMode os.FileMode) {
+	if fileMode == 0 {
+		fileMode = filesystem.DefaultFileMode
+	}
+	if dirMode == 0 {
+		dirMode = filesystem.DefaultDirMode
+	}
+	em.fileMode, em.dirMode = fileMode, dirMode
 }
 
 // createBackup creates a backup of a file before editing
-func (em *EditManager) createBackup(filePath string) (string, error) {
+// Returns the backup path and the content backed up
+func (em *EditManager) createBackup(filePath string) (string, []byte, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file for backup: %w", err)
+		return "", nil, fmt.Errorf("failed to read file for backup: %w", err)
 	}
 
 	// Create a unique backup filename
@@ -56,86 +103,242 @@ func (em *EditManager) createBackup(filePath string) (string, error) {
 	backupName := fmt.Sprintf("%s_%d.bak", filepath.Base(filePath), timestamp)
 	backupPath := filepath.Join(em.backupDir, backupName)
 
-	if err := os.WriteFile(backupPath, content, 0644); err != nil {
-		return "", fmt.Errorf("failed to write backup: %w", err)
+	if err := filesystem.AtomicWrite(backupPath, content, em.fileMode); err != nil {
+		return "", nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return backupPath, content, nil
+}
+
+// contentHash returns the hex SHA-256 of content
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyHash checks that content has the expected SHA-256, given in hex with
+// an optional "sha256:" prefix. An empty expected hash matches anything.
+func verifyHash(content []byte, expected string) error {
+	expected = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(expected)), "sha256:")
+	if expected == "" {
+		return nil
+	}
+	if actual := contentHash(content); actual != expected {
+		return fmt.Errorf("file has been modified (expected sha256 %s, found %s)", expected, actual)
 	}
+	return nil
+}
 
-	return backupPath, nil
+// addToHistory adds an edit to the history. A fresh edit discards anything
+// undone for the file, as it can no longer be redone on top of the new content.
+func (em *EditManager) addToHistory(filePath, backupPath string, original, result []byte) {
+	em.clearRedo(filePath)
+	em.addEntry(EditHistory{
+		FilePath:     filePath,
+		OriginalHash: contentHash(original),
+		ResultHash:   contentHash(result),
+		BackupPath:   backupPath,
+		Timestamp:    time.Now(),
+	})
 }
 
-// addToHistory adds an edit to the history
-func (em *EditManager) addToHistory(filePath, backupPath string) {
+// addEntry appends an entry to the history, evicting the oldest beyond the limit
+func (em *EditManager) addEntry(entry EditHistory) {
 	em.historyMutex.Lock()
 	defer em.historyMutex.Unlock()
 
-	entry := EditHistory{
-		FilePath:   filePath,
-		BackupPath: backupPath,
-		Timestamp:  time.Now(),
+	em.history = append(em.history, entry)
+	em.trimHistory()
+	em.saveHistory()
+}
+
+// trimHistory evicts the oldest entries beyond the count limit, and entries
+// and undone changes older than the age limit; historyMutex must be held
+func (em *EditManager) trimHistory() {
+	now := time.Now()
+	kept := em.history[:0]
+	for i, entry := range em.history {
+		if len(em.history)-i > em.maxHistory || em.expired(entry, now) {
+			// Remove old backup file
+			if err := os.Remove(entry.BackupPath); err != nil {
+				// Log error but continue
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove old backup: %v\n", err)
+			}
+			continue
+		}
+		kept = append(kept, entry)
 	}
+	em.history = kept
 
-	em.history = append(em.history, entry)
+	for filePath, stack := range em.redo {
+		for len(stack) > 0 && em.expired(stack[0], now) {
+			os.Remove(stack[0].BackupPath)
+			stack = stack[1:]
+		}
+		if len(stack) == 0 {
+			delete(em.redo, filePath)
+		} else {
+			em.redo[filePath] = stack
+		}
+	}
+}
+
+// clearRedo discards a file's redo stack and its backups
+func (em *EditManager) clearRedo(filePath string) {
+	em.historyMutex.Lock()
+	defer em.historyMutex.Unlock()
 
-	// Keep only the last 100 edits
-	if len(em.history) > 100 {
-		// Remove old backup file
-		if err := os.Remove(em.history[0].BackupPath); err != nil {
-			// Log error but continue
-			fmt.Fprintf(os.Stderr, "Warning: failed to remove old backup: %v\n", err)
+	for _, entry := range em.redo[filePath] {
+		if err := os.Remove(entry.BackupPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove redo backup: %v\n", err)
 		}
-		em.history = em.history[1:]
 	}
+	delete(em.redo, filePath)
 }
 
-// StrReplace performs an exact string match and replace in a file
-func (em *EditManager) StrReplace(filePath, oldStr, newStr string) error {
+// StrReplace performs an exact string match and replace in a file.
+// Unless replaceAll is set the string must appear exactly once.
+// If expectedHash is not empty the edit is refused unless the file still has
+// that SHA-256, so a client can make sure it is editing the content it last read.
+// Returns the number of replacements made.
+func (em *EditManager) StrReplace(filePath, oldStr, newStr string, replaceAll bool, expectedHash string) (int, error) {
+	if err := em.checkWritable(filePath); err != nil {
+		return 0, err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
 	// Read the entire file
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	if err := verifyHash(content, expectedHash); err != nil {
+		return 0, fmt.Errorf("%w since it was last read; read it again before editing", err)
 	}
 
-	fileContent := string(content)
+	newContent, count, err := strReplaceContent(string(content), oldStr, newStr, replaceAll)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, em.writeEdit(filePath, newContent)
+}
+
+// strReplaceContent performs StrReplace on content
+func strReplaceContent(fileContent, oldStr, newStr string, replaceAll bool) (string, int, error) {
+	// Multi-line strings are usually sent with LF; in a CRLF file match and
+	// write them with CRLF so the file's line endings stay intact
+	if ending := dominantLineEnding(fileContent); ending != "\n" {
+		if crlfOld := withLineEnding(oldStr, ending); !strings.Contains(fileContent, oldStr) && strings.Contains(fileContent, crlfOld) {
+			oldStr = crlfOld
+		}
+		newStr = withLineEnding(newStr, ending)
+	}
 
 	// Check if old string exists
 	if !strings.Contains(fileContent, oldStr) {
-		return fmt.Errorf("string not found in file: %q", oldStr)
+		return "", 0, fmt.Errorf("string not found in file: %q", oldStr)
 	}
 
 	// Count occurrences
 	count := strings.Count(fileContent, oldStr)
-	if count > 1 {
-		return fmt.Errorf("string appears %d times in file; it must appear exactly once for str_replace", count)
+	if count > 1 && !replaceAll {
+		return "", 0, fmt.Errorf("string appears %d times in file; it must appear exactly once for str_replace "+
+			"(set replace_all to replace every occurrence)", count)
 	}
 
+	// Perform replacement
+	return strings.ReplaceAll(fileContent, oldStr, newStr), count, nil
+}
+
+// writeEdit backs up a file, replaces its content and records the edit in the history
+func (em *EditManager) writeEdit(filePath, newContent string) error {
 	// Create backup before modifying
-	backupPath, err := em.createBackup(filePath)
+	backupPath, original, err := em.createBackup(filePath)
 	if err != nil {
 		return err
 	}
 
-	// Perform replacement
-	newContent := strings.Replace(fileContent, oldStr, newStr, 1)
-
 	// Write the modified content
-	if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
+	if err := em.writeFile(filePath, []byte(newContent)); err != nil {
+		os.Remove(backupPath)
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
 	// Add to history
-	em.addToHistory(filePath, backupPath)
+	em.addToHistory(filePath, backupPath, original, []byte(newContent))
 
 	return nil
 }
 
+// RegexReplace replaces matches of a regular expression in a file. The
+// replacement may refer to capture groups as $1 or ${name}. Unless all is set
+// only the first match is replaced.
+func (em *EditManager) RegexReplace(filePath, pattern, replacement string, all bool) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+	}
+
+	if err := em.checkWritable(filePath); err != nil {
+		return err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := regexReplaceContent(string(content), re, replacement, all)
+	if err != nil {
+		return err
+	}
+
+	return em.writeEdit(filePath, newContent)
+}
+
+// regexReplaceContent performs RegexReplace on content
+func regexReplaceContent(fileContent string, re *regexp.Regexp, replacement string, all bool) (string, error) {
+	replacement = withLineEnding(replacement, dominantLineEnding(fileContent))
+	match := re.FindStringSubmatchIndex(fileContent)
+	if match == nil {
+		return "", fmt.Errorf("pattern not found in file: %q", re.String())
+	}
+
+	if all {
+		return re.ReplaceAllString(fileContent, replacement), nil
+	}
+	expanded := re.ExpandString(nil, replacement, fileContent, match)
+	return fileContent[:match[0]] + string(expanded) + fileContent[match[1]:], nil
+}
+
 // Insert inserts text after a specified line number
 // Supports special line_number value -1 to append to end
 // Auto-creates files if they don't exist (when lineNumber is 0 or -1)
 func (em *EditManager) Insert(filePath string, lineNumber int, text string) error {
+	if err := em.checkWritable(filePath); err != nil {
+		return err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	// Try to read the file
-	file, err := os.Open(filePath)
-	
-	var lines []string
+	content, err := os.ReadFile(filePath)
 	
 	if err != nil {
 		// Check if error is "file not found"
@@ -147,13 +350,13 @@ func (em *EditManager) Insert(filePath string, lineNumber int, text string) erro
 			
 			// Create parent directory if needed
 			parentDir := filepath.Dir(filePath)
-			if err := os.MkdirAll(parentDir, 0755); err != nil {
+			if err := os.MkdirAll(parentDir, em.dirMode); err != nil {
 				return fmt.Errorf("failed to create parent directory: %w", err)
 			}
 			
 			// Create new file with just the text
 			newContent := text + "\n"
-			if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
+			if err := em.writeFile(filePath, []byte(newContent)); err != nil {
 				return fmt.Errorf("failed to create file: %w", err)
 			}
 			
@@ -163,17 +366,19 @@ func (em *EditManager) Insert(filePath string, lineNumber int, text string) erro
 		// Other errors (not file not found)
 		return fmt.Errorf("failed to open file: %w", err)
 	}
-	defer file.Close()
 
-	// File exists - read it
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	newContent, err := insertContent(string(content), lineNumber, text)
+	if err != nil {
+		return err
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading file: %w", err)
-	}
+	return em.writeEdit(filePath, newContent)
+}
+
+// insertContent performs Insert on the content of an existing file
+func insertContent(content string, lineNumber int, text string) (string, error) {
+	// Split keeping each line's own ending (LF or CRLF)
+	lines, endings := splitLines(content)
 
 	// Handle special value -1 (append to end)
 	if lineNumber == -1 {
@@ -182,36 +387,304 @@ func (em *EditManager) Insert(filePath string, lineNumber int, text string) erro
 
 	// Validate line number (1-indexed for user, but we use 0-indexed internally)
 	if lineNumber < 0 || lineNumber > len(lines) {
-		return fmt.Errorf("invalid line number %d; file has %d lines (use 0 to insert at beginning, %d to append)", 
+		return "", fmt.Errorf("invalid line number %d; file has %d lines (use 0 to insert at beginning, %d to append)", 
 			lineNumber, len(lines), len(lines))
 	}
 
-	// Create backup before modifying
-	backupPath, err := em.createBackup(filePath)
-	if err != nil {
-		return err
+	// The inserted text uses the line ending of its surroundings
+	ending := lineEndingNear(endings, lineNumber-1)
+	insertedLines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	insertedEndings := make([]string, len(insertedLines))
+	for i := range insertedEndings {
+		insertedEndings[i] = ending
+	}
+
+	// Appending after an unterminated last line terminates it and leaves the
+	// inserted text unterminated instead, so the file keeps its final state
+	if lineNumber == len(lines) && (len(lines) == 0 || endings[len(lines)-1] == "") {
+		if len(lines) > 0 {
+			endings[len(lines)-1] = ending
+		}
+		insertedEndings[len(insertedEndings)-1] = ""
 	}
 
 	// Insert text after the specified line
-	newLines := make([]string, 0, len(lines)+1)
+	newLines := make([]string, 0, len(lines)+len(insertedLines))
 	newLines = append(newLines, lines[:lineNumber]...)
-	newLines = append(newLines, text)
+	newLines = append(newLines, insertedLines...)
 	newLines = append(newLines, lines[lineNumber:]...)
 
-	// Write back to file
-	newContent := strings.Join(newLines, "\n")
-	if err := os.WriteFile(filePath, []byte(newContent), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	newEndings := make([]string, 0, len(newLines))
+	newEndings = append(newEndings, endings[:lineNumber]...)
+	newEndings = append(newEndings, insertedEndings...)
+	newEndings = append(newEndings, endings[lineNumber:]...)
+
+	return joinLines(newLines, newEndings), nil
+}
+
+// DeleteLines removes lines startLine through endLine (1-indexed, inclusive).
+// The file keeps its original ending: if the deleted range includes the last
+// line, the new last line ends the way the old one did.
+func (em *EditManager) DeleteLines(filePath string, startLine, endLine int) error {
+	if err := em.checkWritable(filePath); err != nil {
+		return err
 	}
 
-	// Add to history
-	em.addToHistory(filePath, backupPath)
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := replaceLinesContent(string(content), startLine, endLine, nil)
+	if err != nil {
+		return err
+	}
+
+	return em.writeEdit(filePath, newContent)
+}
+
+// ReplaceLines replaces lines startLine through endLine (1-indexed, inclusive)
+// with text, which may span several lines. A single trailing newline in text
+// is ignored, since each line keeps the file's own line ending.
+func (em *EditManager) ReplaceLines(filePath string, startLine, endLine int, text string) error {
+	if err := em.checkWritable(filePath); err != nil {
+		return err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := replaceLinesContent(string(content), startLine, endLine, replacementLines(text))
+	if err != nil {
+		return err
+	}
+
+	return em.writeEdit(filePath, newContent)
+}
+
+// replacementLines splits ReplaceLines text into lines, ignoring a single trailing newline
+func replacementLines(text string) []string {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	return strings.Split(text, "\n")
+}
+
+// replaceLinesContent replaces lines startLine through endLine of content,
+// deleting them when replacement is empty
+func replaceLinesContent(content string, startLine, endLine int, replacement []string) (string, error) {
+	if startLine < 1 || endLine < startLine {
+		return "", fmt.Errorf("invalid line range %d-%d; start_line must be at least 1 and not after end_line", startLine, endLine)
+	}
+
+	lines, endings := splitLines(content)
+	if endLine > len(lines) {
+		return "", fmt.Errorf("invalid line range %d-%d; file has %d lines (use lines 1 to %d)",
+			startLine, endLine, len(lines), len(lines))
+	}
+
+	lines, endings = replaceLineRange(lines, endings, startLine, endLine, replacement)
+	return joinLines(lines, endings), nil
+}
+
+// ApplyPatch applies a unified diff to a file and returns the number of hunks applied
+// fuzz allows each hunk to match up to that many lines away from its stated position
+func (em *EditManager) ApplyPatch(filePath, patch string, fuzz int) (int, error) {
+	if err := em.checkWritable(filePath); err != nil {
+		return 0, err
+	}
+
+	if fuzz < 0 {
+		return 0, fmt.Errorf("fuzz must not be negative")
+	}
+
+	hunks, err := parseUnifiedDiff(patch)
+	if err != nil {
+		return 0, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := applyHunks(string(content), hunks, fuzz)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := em.writeEdit(filePath, newContent); err != nil {
+		return 0, err
+	}
+
+	return len(hunks), nil
+}
+
+// ReplaceBetweenMarkers replaces the lines between a start marker line and the
+// end marker line that closes it with text, keeping the marker lines themselves.
+// text takes the file's line ending and is terminated if it is not already.
+// Returns the line number of the end marker after the replacement.
+func (em *EditManager) ReplaceBetweenMarkers(filePath, startMarker, endMarker, text string) (int, error) {
+	if err := em.checkWritable(filePath); err != nil {
+		return 0, err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	fileContent := string(content)
+
+	region, err := filesystem.FindMarkerRegion(fileContent, startMarker, endMarker)
+	if err != nil {
+		return 0, err
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	insertedLines := strings.Count(text, "\n")
+	if region.LineEnding != "\n" {
+		text = strings.ReplaceAll(text, "\n", region.LineEnding)
+	}
+
+	newContent := fileContent[:region.InnerStart] + text + fileContent[region.InnerEnd:]
+	if err := em.writeEdit(filePath, newContent); err != nil {
+		return 0, err
+	}
+
+	return region.StartLine + insertedLines + 1, nil
+}
+
+// SnapshotFile records a restore point for a file without changing it.
+// The snapshot is pushed onto the edit history, so undo_edit restores it like an edit.
+// Returns the snapshot id.
+func (em *EditManager) SnapshotFile(filePath string) (string, error) {
+	unlock := em.editLocks.lock(filePath)
+	defer unlock()
+
+	backupPath, content, err := em.createBackup(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	hash := contentHash(content)
+	entry := EditHistory{
+		FilePath:     filePath,
+		OriginalHash: hash,
+		ResultHash:   hash,
+		BackupPath:   backupPath,
+		Timestamp:    time.Now(),
+		Snapshot:     true,
+	}
+	em.addEntry(entry)
+
+	return entry.ID(), nil
+}
+
+// RestoreToSnapshot restores a file to the content of a specific backup in its
+// history, whether a snapshot or an edit backup. The restore is recorded as a
+// new edit, so it can itself be undone, and the snapshot is kept for reuse.
+func (em *EditManager) RestoreToSnapshot(filePath, snapshotID string) error {
+	return em.restoreBackup(filePath, snapshotID, "snapshot")
+}
+
+// RestoreBackup restores a file to the content of one of the backups listed
+// by ListBackups. It behaves like RestoreToSnapshot, reporting errors in
+// terms of backups.
+func (em *EditManager) RestoreBackup(filePath, backupID string) error {
+	return em.restoreBackup(filePath, backupID, "backup")
+}
+
+// restoreBackup restores a file from the history entry with the given id;
+// kind names the entry in error messages
+func (em *EditManager) restoreBackup(filePath, id, kind string) error {
+	if err := em.checkWritable(filePath); err != nil {
+		return err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	em.historyMutex.RLock()
+	var snapshot *EditHistory
+	for i := range em.history {
+		if em.history[i].ID() == id {
+			entry := em.history[i]
+			snapshot = &entry
+			break
+		}
+	}
+	em.historyMutex.RUnlock()
+
+	if snapshot == nil {
+		return fmt.Errorf("%s not found: %s", kind, id)
+	}
+	if snapshot.FilePath != filePath {
+		return fmt.Errorf("%s %s belongs to %s, not %s", kind, id, snapshot.FilePath, filePath)
+	}
+
+	snapshotContent, err := os.ReadFile(snapshot.BackupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", kind, err)
+	}
+
+	// Create backup before modifying
+	backupPath, original, err := em.createBackup(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := em.writeFile(filePath, snapshotContent); err != nil {
+		os.Remove(backupPath)
+		return fmt.Errorf("failed to restore file: %w", err)
+	}
+
+	em.addToHistory(filePath, backupPath, original, snapshotContent)
 
 	return nil
 }
 
 // UndoEdit undoes the last edit made to a specific file
 func (em *EditManager) UndoEdit(filePath string) error {
+	if err := em.checkWritable(filePath); err != nil {
+		return err
+	}
+
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	em.historyMutex.Lock()
 	defer em.historyMutex.Unlock()
 
@@ -236,7 +709,27 @@ func (em *EditManager) UndoEdit(filePath string) error {
 		return fmt.Errorf("failed to read backup file: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, backupContent, 0644); err != nil {
+	// Keep the content being undone so redo_edit can bring it back.
+	// A file deleted since the edit has nothing to redo.
+	redoPath, current, err := em.createBackup(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Refuse to silently discard changes made to the file since the edit,
+	// e.g. by another program. Entries saved before hashes were recorded have none.
+	if redoPath != "" && entry.ResultHash != "" {
+		if err := verifyHash(current, entry.ResultHash); err != nil {
+			os.Remove(redoPath)
+			return fmt.Errorf("cannot undo: %w since the last edit; use restore_to_snapshot with id %s "+
+				"to restore the backup anyway", err, entry.ID())
+		}
+	}
+
+	if err := em.writeFile(filePath, backupContent); err != nil {
+		if redoPath != "" {
+			os.Remove(redoPath)
+		}
 		return fmt.Errorf("failed to restore file: %w", err)
 	}
 
@@ -247,27 +740,181 @@ func (em *EditManager) UndoEdit(filePath string) error {
 
 	// Remove from history
 	em.history = append(em.history[:lastEditIndex], em.history[lastEditIndex+1:]...)
+	em.saveHistory()
+
+	if redoPath != "" {
+		em.redo[filePath] = append(em.redo[filePath], EditHistory{
+			FilePath:     filePath,
+			OriginalHash: contentHash(current),
+			ResultHash:   contentHash(backupContent),
+			BackupPath:   redoPath,
+			Timestamp:    time.Now(),
+			Snapshot:     entry.Snapshot,
+		})
+	}
 
 	return nil
 }
 
-// GetEditHistory returns the edit history for a specific file
-func (em *EditManager) GetEditHistory(filePath string) []EditHistory {
-	em.historyMutex.RLock()
-	defer em.historyMutex.RUnlock()
-
-	var fileHistory []EditHistory
-	for _, entry := range em.history {
-		if entry.FilePath == filePath {
-			fileHistory = append(fileHistory, entry)
-		}
+// RedoEdit re-applies the change most recently undone on a specific file.
+// The redone change goes back onto the edit history, so it can be undone again.
+func (em *EditManager) RedoEdit(filePath string) error {
+	if err := em.checkWritable(filePath); err != nil {
+		return err
 	}
 
-	return fileHistory
-}
+	release, err := em.acquireEdit(filePath)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	em.historyMutex.Lock()
+	defer em.historyMutex.Unlock()
+
+	stack := em.redo[filePath]
+	if len(stack) == 0 {
+		return fmt.Errorf("nothing to redo for file: %s", filePath)
+	}
+	entry := stack[len(stack)-1]
+
+	redoContent, err := os.ReadFile(entry.BackupPath)
+	if err != nil {
+		return fmt.Errorf("failed to read redo backup: %w", err)
+	}
+
+	// Back up the current content so the redo can be undone
+	backupPath, current, err := em.createBackup(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if backupPath == "" {
+		return fmt.Errorf("cannot redo: file no longer exists: %s", filePath)
+	}
+	if err := verifyHash(current, entry.ResultHash); err != nil {
+		os.Remove(backupPath)
+		return fmt.Errorf("cannot redo: %w since the undo", err)
+	}
+
+	if err := em.writeFile(filePath, redoContent); err != nil {
+		os.Remove(backupPath)
+		return fmt.Errorf("failed to redo edit: %w", err)
+	}
+
+	if err := os.Remove(entry.BackupPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove redo backup: %v\n", err)
+	}
+	if len(stack) == 1 {
+		delete(em.redo, filePath)
+	} else {
+		em.redo[filePath] = stack[:len(stack)-1]
+	}
+
+	em.history = append(em.history, EditHistory{
+		FilePath:     filePath,
+		OriginalHash: contentHash(current),
+		ResultHash:   contentHash(redoContent),
+		BackupPath:   backupPath,
+		Timestamp:    time.Now(),
+		Snapshot:     entry.Snapshot,
+	})
+	em.trimHistory()
+	em.saveHistory()
+
+	return nil
+}
+
+// ExportChanges bundles every change recorded in the edit history as one
+// multi-file unified diff, comparing each file's oldest retained backup with
+// its current content. Files whose edits cancel out are left out, and a file
+// deleted since it was edited is diffed against /dev/null. If filePath is not
+// empty only that file is exported. Returns the bundle and how many files it covers.
+func (em *EditManager) ExportChanges(filePath string) (string, int, error) {
+	em.historyMutex.RLock()
+	var order []string
+	baselines := make(map[string]string)
+	for _, entry := range em.history {
+		if filePath != "" && entry.FilePath != filePath {
+			continue
+		}
+		if _, seen := baselines[entry.FilePath]; !seen {
+			order = append(order, entry.FilePath)
+			baselines[entry.FilePath] = entry.BackupPath
+		}
+	}
+	em.historyMutex.RUnlock()
+
+	var bundle strings.Builder
+	files := 0
+	for _, path := range order {
+		before, err := os.ReadFile(baselines[path])
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read backup of %s: %w", path, err)
+		}
+
+		newName := path
+		after, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			newName = "/dev/null"
+		} else if err != nil {
+			return "", 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		if diff := unifiedDiff(path, newName, string(before), string(after), DefaultDiffContext); diff != "" {
+			bundle.WriteString(diff)
+			files++
+		}
+	}
+
+	return bundle.String(), files, nil
+}
+
+// GetEditHistory returns the edit history for a specific file
+func (em *EditManager) GetEditHistory(filePath string) []EditHistory {
+	em.historyMutex.RLock()
+	defer em.historyMutex.RUnlock()
+
+	var fileHistory []EditHistory
+	for _, entry := range em.history {
+		if entry.FilePath == filePath {
+			fileHistory = append(fileHistory, entry)
+		}
+	}
+
+	return fileHistory
+}
+
+// BackupInfo describes one backup of a file that RestoreBackup can restore
+type BackupInfo struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	BackupPath string    `json:"backupPath"`
+	Snapshot   bool      `json:"snapshot,omitempty"` // Created by snapshot_file rather than by an edit
+}
+
+// ListBackups returns the backups in a file's edit history, oldest first.
+// Each holds the content the file had before the edit it was taken for.
+func (em *EditManager) ListBackups(filePath string) []BackupInfo {
+	backups := []BackupInfo{}
+	for _, entry := range em.GetEditHistory(filePath) {
+		backups = append(backups, BackupInfo{
+			ID:         entry.ID(),
+			Timestamp:  entry.Timestamp,
+			BackupPath: entry.BackupPath,
+			Snapshot:   entry.Snapshot,
+		})
+	}
+	return backups
+}
 
 // Tool schemas for editor operations
 
+// previewProperty is the schema of the preview flag shared by content-editing tools
+var previewProperty = map[string]interface{}{
+	"type":        "boolean",
+	"description": "Return a unified diff of the change instead of making it; nothing is written and no backup is created (default false)",
+}
+
 // StrReplaceSchema defines the schema for str_replace tool input
 var StrReplaceSchema = map[string]interface{}{
 	"type": "object",
@@ -278,16 +925,51 @@ var StrReplaceSchema = map[string]interface{}{
 		},
 		"old_str": map[string]interface{}{
 			"type":        "string",
-			"description": "The exact string to replace (must appear exactly once in the file)",
+			"description": "The exact string to replace (must appear exactly once in the file unless replace_all is set)",
 		},
 		"new_str": map[string]interface{}{
 			"type":        "string",
 			"description": "The string to replace it with (can be empty to delete)",
 		},
+		"replace_all": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Replace every occurrence instead of requiring exactly one (default false)",
+		},
+		"expected_hash": map[string]interface{}{
+			"type": "string",
+			"description": "SHA-256 (hex) the file must still have, e.g. from hash_file when it was read; " +
+				"the edit is refused if the file has changed since",
+		},
+		"preview": previewProperty,
 	},
 	"required": []string{"path", "old_str"},
 }
 
+// RegexReplaceSchema defines the schema for regex_replace tool input
+var RegexReplaceSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to edit",
+		},
+		"pattern": map[string]interface{}{
+			"type":        "string",
+			"description": "Regular expression (Go RE2 syntax) to match",
+		},
+		"replacement": map[string]interface{}{
+			"type":        "string",
+			"description": "Replacement text; $1 or ${name} insert capture groups (use ${1} when followed by a letter or digit)",
+		},
+		"all": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Replace every match instead of only the first (default false)",
+		},
+		"preview": previewProperty,
+	},
+	"required": []string{"path", "pattern", "replacement"},
+}
+
 // InsertSchema defines the schema for insert tool input
 var InsertSchema = map[string]interface{}{
 	"type": "object",
@@ -304,7 +986,7 @@ var InsertSchema = map[string]interface{}{
 				},
 				map[string]interface{}{
 					"type":        "string",
-					"enum":        []string{"start", "beginning", "end", "append"},
+					"enum":        []string{"start", "begin", "beginning", "end", "append", "bottom"},
 					"description": "Keyword: 'start'/'beginning' (insert at beginning) or 'end'/'append' (append to end)",
 				},
 			},
@@ -314,10 +996,61 @@ var InsertSchema = map[string]interface{}{
 			"type":        "string",
 			"description": "Text to insert",
 		},
+		"preview": previewProperty,
 	},
 	"required": []string{"path", "line_number", "text"},
 }
 
+// DeleteLinesSchema defines the schema for delete_lines tool input
+var DeleteLinesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to edit",
+		},
+		"start_line": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     1,
+			"description": "First line to delete (1-indexed)",
+		},
+		"end_line": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     1,
+			"description": "Last line to delete (1-indexed, inclusive)",
+		},
+		"preview": previewProperty,
+	},
+	"required": []string{"path", "start_line", "end_line"},
+}
+
+// ReplaceLinesSchema defines the schema for replace_lines tool input
+var ReplaceLinesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to edit",
+		},
+		"start_line": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     1,
+			"description": "First line to replace (1-indexed)",
+		},
+		"end_line": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     1,
+			"description": "Last line to replace (1-indexed, inclusive)",
+		},
+		"text": map[string]interface{}{
+			"type":        "string",
+			"description": "Replacement lines; may span several lines",
+		},
+		"preview": previewProperty,
+	},
+	"required": []string{"path", "start_line", "end_line", "text"},
+}
+
 // UndoEditSchema defines the schema for undo_edit tool input
 var UndoEditSchema = map[string]interface{}{
 	"type": "object",
@@ -330,6 +1063,141 @@ var UndoEditSchema = map[string]interface{}{
 	"required": []string{"path"},
 }
 
+// RedoEditSchema defines the schema for redo_edit tool input
+var RedoEditSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to redo edits for",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// SnapshotFileSchema defines the schema for snapshot_file tool input
+var SnapshotFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to snapshot",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// RestoreToSnapshotSchema defines the schema for restore_to_snapshot tool input
+var RestoreToSnapshotSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to restore",
+		},
+		"snapshot_id": map[string]interface{}{
+			"type":        "string",
+			"description": "Id returned by snapshot_file, or the backup id of an earlier edit",
+		},
+	},
+	"required": []string{"path", "snapshot_id"},
+}
+
+// ListBackupsSchema defines the schema for list_backups tool input
+var ListBackupsSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file whose backups to list",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// RestoreBackupSchema defines the schema for restore_backup tool input
+var RestoreBackupSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to restore",
+		},
+		"backup_id": map[string]interface{}{
+			"type":        "string",
+			"description": "Id of the backup to restore, as returned by list_backups",
+		},
+	},
+	"required": []string{"path", "backup_id"},
+}
+
+// ExportChangesSchema defines the schema for export_changes tool input
+var ExportChangesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Only export changes to this file (default: every edited file)",
+		},
+	},
+}
+
+// LockFileSchema defines the schema for lock_file and unlock_file tool input
+var LockFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to lock or unlock",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// ReplaceBetweenMarkersSchema defines the schema for replace_between_markers tool input
+var ReplaceBetweenMarkersSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to edit",
+		},
+		"start_marker": map[string]interface{}{
+			"type":        "string",
+			"description": "Text identifying the line that opens the region",
+		},
+		"end_marker": map[string]interface{}{
+			"type":        "string",
+			"description": "Text identifying the line that closes the region",
+		},
+		"text": map[string]interface{}{
+			"type":        "string",
+			"description": "New content for the lines between the markers (empty clears the region)",
+		},
+	},
+	"required": []string{"path", "start_marker", "end_marker", "text"},
+}
+
+// ApplyPatchSchema defines the schema for apply_patch tool input
+var ApplyPatchSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the file to patch",
+		},
+		"patch": map[string]interface{}{
+			"type":        "string",
+			"description": "Unified diff for this file (hunks starting with @@ -a,b +c,d @@)",
+		},
+		"fuzz": map[string]interface{}{
+			"type":        "integer",
+			"description": "How many lines away from its stated position a hunk may still match (default 0)",
+		},
+	},
+	"required": []string{"path", "patch"},
+}
+
 // EditorTool defines the schema for an editor tool
 type EditorTool struct {
 	Name        string
@@ -342,11 +1210,22 @@ var EditorTools = map[string]EditorTool{
 	"str_replace": {
 		Name: "str_replace",
 		Description: "Replace an exact string in a file with another string. The old_str must appear " +
-			"exactly once in the file. This is the safest way to make surgical edits to files. " +
+			"exactly once in the file unless replace_all is true, in which case every occurrence is replaced " +
+			"and the count is reported. This is the safest way to make surgical edits to files. " +
 			"A backup is automatically created before the edit. Use this instead of rewriting entire files " +
-			"when making small changes. Only works within allowed directories.",
+			"when making small changes. Only works within allowed directories. " +
+			"Set preview to see the change as a diff without making it.",
 		InputSchema: StrReplaceSchema,
 	},
+	"regex_replace": {
+		Name: "regex_replace",
+		Description: "Replace matches of a regular expression in a file, e.g. to rename a symbol. The " +
+			"replacement can use capture groups ($1, ${name}). Only the first match is replaced unless 'all' is " +
+			"true. Prefix the pattern with (?m) to make ^ and $ match at line boundaries. A backup is " +
+			"automatically created and the change can be reverted with undo_edit. Only works within allowed directories. " +
+			"Set preview to see the change as a diff without making it.",
+		InputSchema: RegexReplaceSchema,
+	},
 	"insert": {
 		Name: "insert",
 		Description: "Insert text after a specified line number in a file. If the file doesn't exist, it will be created.\n\n" +
@@ -359,41 +1238,169 @@ var EditorTools = map[string]EditorTool{
 			"- If file doesn't exist and line_number is 0/'start'/-1/'end'/'append': Creates file with text\n" +
 			"- If file doesn't exist and line_number is other value: Returns error\n" +
 			"- Parent directories are created automatically if needed\n\n" +
-			"A backup is automatically created before editing existing files. Only works within allowed directories.",
+			"A backup is automatically created before editing existing files. Only works within allowed directories. " +
+			"Set preview to see the change as a diff without making it.",
 		InputSchema: InsertSchema,
 	},
+	"delete_lines": {
+		Name: "delete_lines",
+		Description: "Delete lines start_line through end_line (1-indexed, inclusive) from a file. The rest " +
+			"of the file, including its line endings and whether it ends with a newline, is left as it was. " +
+			"A backup is automatically created and the change can be reverted with undo_edit. Only works " +
+			"within allowed directories. " +
+			"Set preview to see the change as a diff without making it.",
+		InputSchema: DeleteLinesSchema,
+	},
+	"replace_lines": {
+		Name: "replace_lines",
+		Description: "Replace lines start_line through end_line (1-indexed, inclusive) of a file with new text, " +
+			"which may have more or fewer lines than the range. The replacement uses the file's line endings. " +
+			"Read the file first to get the line numbers right. A backup is automatically created and the " +
+			"change can be reverted with undo_edit. Only works within allowed directories. " +
+			"Set preview to see the change as a diff without making it.",
+		InputSchema: ReplaceLinesSchema,
+	},
+	"apply_patch": {
+		Name: "apply_patch",
+		Description: "Apply a unified diff to a file. Every hunk's context and removed lines must match " +
+			"the current file; if any hunk fails to match, nothing is written and the failing hunk is reported. " +
+			"Use 'fuzz' to tolerate hunks that have shifted by a few lines. A backup is automatically created " +
+			"and the change can be reverted with undo_edit. Only works within allowed directories.",
+		InputSchema: ApplyPatchSchema,
+	},
+	"replace_between_markers": {
+		Name: "replace_between_markers",
+		Description: "Replace the lines between a line containing 'start_marker' and the next line containing " +
+			"'end_marker' with new text, keeping the marker lines. Use this to update a generated or managed " +
+			"block without touching the hand-written content around it. Fails without changing the file if a " +
+			"marker is missing or the markers are not properly paired. A backup is automatically created and " +
+			"the change can be reverted with undo_edit. Only works within allowed directories.",
+		InputSchema: ReplaceBetweenMarkersSchema,
+	},
+	"snapshot_file": {
+		Name: "snapshot_file",
+		Description: "Create a restore point for a file without editing it. The file's current content is " +
+			"backed up and recorded in the edit history, so a later undo_edit that reaches the snapshot restores " +
+			"the file to this state. Returns the snapshot id. Use before a risky sequence of edits. " +
+			"Only works within allowed directories.",
+		InputSchema: SnapshotFileSchema,
+	},
+	"restore_to_snapshot": {
+		Name: "restore_to_snapshot",
+		Description: "Restore a file to the content recorded by a specific snapshot, regardless of how many " +
+			"edits were made since. Accepts an id returned by snapshot_file or the backup id of an earlier edit; " +
+			"the id must belong to the given file. The restore is itself recorded as an edit, so undo_edit reverts " +
+			"it, and the snapshot remains available. Only works within allowed directories.",
+		InputSchema: RestoreToSnapshotSchema,
+	},
+	"list_backups": {
+		Name: "list_backups",
+		Description: "List the backups kept for a file, oldest first. Each edit backs up the content the file " +
+			"had before it, and snapshot_file adds restore points. Returns JSON with each backup's 'id', " +
+			"'timestamp' and 'backupPath', and whether it is a snapshot. Only the last 100 edits across all " +
+			"files are kept. Only works within allowed directories.",
+		InputSchema: ListBackupsSchema,
+	},
+	"restore_backup": {
+		Name: "restore_backup",
+		Description: "Restore a file to a specific backup from list_backups, to go back several edits at once. " +
+			"The backup must belong to the given file. The restore is itself recorded as an edit, so undo_edit " +
+			"reverts it, and the backup remains available. Only works within allowed directories.",
+		InputSchema: RestoreBackupSchema,
+	},
+	"export_changes": {
+		Name: "export_changes",
+		Description: "Export the changes made by this server's edits as a single unified diff covering " +
+			"every edited file, for review or to reapply elsewhere. Each file is compared from its oldest backup " +
+			"still in the edit history (the last 100 edits are kept) to its current content, so later changes " +
+			"made outside the editor tools are included. Files created by insert are not tracked. " +
+			"Only works within allowed directories.",
+		InputSchema: ExportChangesSchema,
+	},
+	"lock_file": {
+		Name: "lock_file",
+		Description: "Lock a file against changes from other client sessions while you make a series of " +
+			"edits. Any tool that would modify the file, when called from another session, fails with a " +
+			"'file locked' error until you call unlock_file or disconnect. The lock is advisory: it only " +
+			"affects this server's tools. The file does not need to exist. Only works within allowed directories.",
+		InputSchema: LockFileSchema,
+	},
+	"unlock_file": {
+		Name:        "unlock_file",
+		Description: "Release a lock this session holds on a file from lock_file. Only works within allowed directories.",
+		InputSchema: LockFileSchema,
+	},
 	"undo_edit": {
 		Name: "undo_edit",
 		Description: "Undo the last edit made to a specific file. This will restore the file to its state " +
-			"before the last str_replace or insert operation. Can be called multiple times to undo multiple " +
-			"edits. Only works within allowed directories.",
+			"before the last str_replace or insert operation, or to the last snapshot_file restore point. " +
+			"Can be called multiple times to undo multiple edits. Only works within allowed directories.",
 		InputSchema: UndoEditSchema,
 	},
+	"redo_edit": {
+		Name: "redo_edit",
+		Description: "Re-apply the change most recently reverted by undo_edit on a specific file. Can be called " +
+			"multiple times to redo several undone edits. Any new edit to the file discards what is left to redo. " +
+			"Only works within allowed directories.",
+		InputSchema: RedoEditSchema,
+	},
 }
 
 // Argument parsing functions
 
 // ParseStrReplaceArgs parses arguments for str_replace
-func ParseStrReplaceArgs(args json.RawMessage) (path, oldStr, newStr string, err error) {
+func ParseStrReplaceArgs(args json.RawMessage) (path, oldStr, newStr string, replaceAll bool, expectedHash string, err error) {
 	var params struct {
-		Path   string `json:"path"`
-		OldStr string `json:"old_str"`
-		NewStr string `json:"new_str"`
+		Path         string `json:"path"`
+		OldStr       string `json:"old_str"`
+		NewStr       string `json:"new_str"`
+		ReplaceAll   bool   `json:"replace_all"`
+		ExpectedHash string `json:"expected_hash"`
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", "", "", fmt.Errorf("invalid arguments for str_replace: %w", err)
+		return "", "", "", false, "", fmt.Errorf("invalid arguments for str_replace: %w", err)
 	}
 
 	if params.Path == "" {
-		return "", "", "", fmt.Errorf("path parameter is required")
+		return "", "", "", false, "", fmt.Errorf("path parameter is required")
 	}
 
 	if params.OldStr == "" {
-		return "", "", "", fmt.Errorf("old_str parameter is required")
+		return "", "", "", false, "", fmt.Errorf("old_str parameter is required")
+	}
+
+	return params.Path, params.OldStr, params.NewStr, params.ReplaceAll, params.ExpectedHash, nil
+}
+
+// ParsePreviewArg reports whether an editor tool call asks for a preview
+// rather than the edit itself. Malformed arguments are left to the tool's own parser.
+func ParsePreviewArg(args json.RawMessage) bool {
+	var params struct {
+		Preview bool `json:"preview"`
+	}
+	json.Unmarshal(args, &params)
+	return params.Preview
+}
+
+// ParseRegexReplaceArgs parses arguments for regex_replace
+func ParseRegexReplaceArgs(args json.RawMessage) (path, pattern, replacement string, all bool, err error) {
+	var params struct {
+		Path        string  `json:"path"`
+		Pattern     string  `json:"pattern"`
+		Replacement *string `json:"replacement"`
+		All         bool    `json:"all"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", "", false, fmt.Errorf("invalid arguments for regex_replace: %w", err)
+	}
+
+	if params.Path == "" || params.Pattern == "" || params.Replacement == nil {
+		return "", "", "", false, fmt.Errorf("path, pattern and replacement parameters are required")
 	}
 
-	return params.Path, params.OldStr, params.NewStr, nil
+	return params.Path, params.Pattern, *params.Replacement, params.All, nil
 }
 
 // ParseInsertArgs parses arguments for insert
@@ -438,6 +1445,84 @@ func ParseInsertArgs(args json.RawMessage) (path string, lineNumber int, text st
 	return path, lineNumber, text, nil
 }
 
+// ParseDeleteLinesArgs parses arguments for delete_lines
+func ParseDeleteLinesArgs(args json.RawMessage) (path string, startLine, endLine int, err error) {
+	var params struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, 0, fmt.Errorf("invalid arguments for delete_lines: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", 0, 0, fmt.Errorf("path parameter is required")
+	}
+
+	if params.StartLine < 1 || params.EndLine < 1 {
+		return "", 0, 0, fmt.Errorf("start_line and end_line are required and must be at least 1")
+	}
+
+	if params.StartLine > params.EndLine {
+		return "", 0, 0, fmt.Errorf("start_line %d is after end_line %d", params.StartLine, params.EndLine)
+	}
+
+	return params.Path, params.StartLine, params.EndLine, nil
+}
+
+// ParseReplaceLinesArgs parses arguments for replace_lines
+func ParseReplaceLinesArgs(args json.RawMessage) (path string, startLine, endLine int, text string, err error) {
+	var params struct {
+		Path      string  `json:"path"`
+		StartLine int     `json:"start_line"`
+		EndLine   int     `json:"end_line"`
+		Text      *string `json:"text"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, 0, "", fmt.Errorf("invalid arguments for replace_lines: %w", err)
+	}
+
+	if params.Path == "" || params.Text == nil {
+		return "", 0, 0, "", fmt.Errorf("path and text parameters are required")
+	}
+
+	if params.StartLine < 1 || params.EndLine < 1 {
+		return "", 0, 0, "", fmt.Errorf("start_line and end_line are required and must be at least 1")
+	}
+
+	if params.StartLine > params.EndLine {
+		return "", 0, 0, "", fmt.Errorf("start_line %d is after end_line %d", params.StartLine, params.EndLine)
+	}
+
+	return params.Path, params.StartLine, params.EndLine, *params.Text, nil
+}
+
+// ParseApplyPatchArgs parses arguments for apply_patch
+func ParseApplyPatchArgs(args json.RawMessage) (path, patch string, fuzz int, err error) {
+	var params struct {
+		Path  string `json:"path"`
+		Patch string `json:"patch"`
+		Fuzz  int    `json:"fuzz"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", 0, fmt.Errorf("invalid arguments for apply_patch: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", "", 0, fmt.Errorf("path parameter is required")
+	}
+
+	if params.Patch == "" {
+		return "", "", 0, fmt.Errorf("patch parameter is required")
+	}
+
+	return params.Path, params.Patch, params.Fuzz, nil
+}
+
 // ParseUndoEditArgs parses arguments for undo_edit
 func ParseUndoEditArgs(args json.RawMessage) (path string, err error) {
 	var params struct {
@@ -454,3 +1539,143 @@ func ParseUndoEditArgs(args json.RawMessage) (path string, err error) {
 
 	return params.Path, nil
 }
+
+// ParseRedoEditArgs parses arguments for redo_edit
+func ParseRedoEditArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for redo_edit: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseSnapshotFileArgs parses arguments for snapshot_file
+func ParseSnapshotFileArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for snapshot_file: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseRestoreToSnapshotArgs parses arguments for restore_to_snapshot
+func ParseRestoreToSnapshotArgs(args json.RawMessage) (path, snapshotID string, err error) {
+	var params struct {
+		Path       string `json:"path"`
+		SnapshotID string `json:"snapshot_id"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for restore_to_snapshot: %w", err)
+	}
+
+	if params.Path == "" || params.SnapshotID == "" {
+		return "", "", fmt.Errorf("path and snapshot_id parameters are required")
+	}
+
+	return params.Path, params.SnapshotID, nil
+}
+
+// ParseListBackupsArgs parses arguments for list_backups
+func ParseListBackupsArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for list_backups: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseRestoreBackupArgs parses arguments for restore_backup
+func ParseRestoreBackupArgs(args json.RawMessage) (path, backupID string, err error) {
+	var params struct {
+		Path     string `json:"path"`
+		BackupID string `json:"backup_id"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for restore_backup: %w", err)
+	}
+
+	if params.Path == "" || params.BackupID == "" {
+		return "", "", fmt.Errorf("path and backup_id parameters are required")
+	}
+
+	return params.Path, params.BackupID, nil
+}
+
+// ParseExportChangesArgs parses arguments for export_changes
+// The path is optional; an empty path exports every edited file
+func ParseExportChangesArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", fmt.Errorf("invalid arguments for export_changes: %w", err)
+		}
+	}
+
+	return params.Path, nil
+}
+
+// ParseLockFileArgs parses arguments for lock_file and unlock_file
+func ParseLockFileArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for lock_file: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseReplaceBetweenMarkersArgs parses arguments for replace_between_markers
+func ParseReplaceBetweenMarkersArgs(args json.RawMessage) (path, startMarker, endMarker, text string, err error) {
+	var params struct {
+		Path        string  `json:"path"`
+		StartMarker string  `json:"start_marker"`
+		EndMarker   string  `json:"end_marker"`
+		Text        *string `json:"text"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", "", "", fmt.Errorf("invalid arguments for replace_between_markers: %w", err)
+	}
+
+	if params.Path == "" || params.StartMarker == "" || params.EndMarker == "" || params.Text == nil {
+		return "", "", "", "", fmt.Errorf("path, start_marker, end_marker and text parameters are required")
+	}
+
+	return params.Path, params.StartMarker, params.EndMarker, *params.Text, nil
+}
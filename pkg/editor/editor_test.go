@@ -1,9 +1,17 @@
 package editor
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/filesystem"
 )
 
 func TestStrReplace(t *testing.T) {
@@ -28,7 +36,7 @@ func TestStrReplace(t *testing.T) {
 	}
 
 	// Test successful replacement
-	err = em.StrReplace(testFile, "This is a test", "This is modified")
+	_, err = em.StrReplace(testFile, "This is a test", "This is modified", false, "")
 	if err != nil {
 		t.Errorf("StrReplace failed: %v", err)
 	}
@@ -44,7 +52,7 @@ func TestStrReplace(t *testing.T) {
 	}
 
 	// Test string not found
-	err = em.StrReplace(testFile, "nonexistent", "replacement")
+	_, err = em.StrReplace(testFile, "nonexistent", "replacement", false, "")
 	if err == nil {
 		t.Error("Expected error for nonexistent string, got nil")
 	}
@@ -54,10 +62,22 @@ func TestStrReplace(t *testing.T) {
 	if err := os.WriteFile(testFile, []byte(multiContent), 0644); err != nil {
 		t.Fatalf("Failed to write test file: %v", err)
 	}
-	err = em.StrReplace(testFile, "foo", "baz")
+	_, err = em.StrReplace(testFile, "foo", "baz", false, "")
 	if err == nil {
 		t.Error("Expected error for multiple occurrences, got nil")
 	}
+
+	// replace_all replaces every occurrence and reports how many
+	count, err := em.StrReplace(testFile, "foo", "baz", true, "")
+	if err != nil {
+		t.Fatalf("StrReplace with replaceAll failed: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); count != 2 || string(content) != "baz bar baz" {
+		t.Errorf("Expected 2 replacements giving %q, got %d giving %q", "baz bar baz", count, string(content))
+	}
+	if len(em.GetEditHistory(testFile)) == 0 {
+		t.Error("Expected a backup before replacing every occurrence")
+	}
 }
 
 func TestInsert(t *testing.T) {
@@ -164,7 +184,7 @@ func TestUndoEdit(t *testing.T) {
 	}
 
 	// Make an edit
-	err = em.StrReplace(testFile, "Original Content", "Modified Content")
+	_, err = em.StrReplace(testFile, "Original Content", "Modified Content", false, "")
 	if err != nil {
 		t.Fatalf("StrReplace failed: %v", err)
 	}
@@ -222,7 +242,7 @@ func TestMultipleEditsAndUndo(t *testing.T) {
 	}
 
 	// Make multiple edits
-	err = em.StrReplace(testFile, "Line 1", "Modified Line 1")
+	_, err = em.StrReplace(testFile, "Line 1", "Modified Line 1", false, "")
 	if err != nil {
 		t.Fatalf("First StrReplace failed: %v", err)
 	}
@@ -232,7 +252,7 @@ func TestMultipleEditsAndUndo(t *testing.T) {
 		t.Fatalf("Insert failed: %v", err)
 	}
 
-	err = em.StrReplace(testFile, "Line 2", "Modified Line 2")
+	_, err = em.StrReplace(testFile, "Line 2", "Modified Line 2", false, "")
 	if err != nil {
 		t.Fatalf("Second StrReplace failed: %v", err)
 	}
@@ -280,6 +300,112 @@ func TestMultipleEditsAndUndo(t *testing.T) {
 	}
 }
 
+func TestApplyPatch(t *testing.T) {
+	// Create a temporary directory for testing
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Create an edit manager
+	em, err := NewEditManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	// Create a test file
+	testFile := filepath.Join(tmpDir, "test.txt")
+	originalContent := "one\ntwo\nthree\nfour\nfive\n"
+	if err := os.WriteFile(testFile, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	patch := "--- a/test.txt\n+++ b/test.txt\n" +
+		"@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n" +
+		"@@ -4,2 +4,3 @@\n four\n five\n+six\n"
+
+	hunks, err := em.ApplyPatch(testFile, patch, 0)
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if hunks != 2 {
+		t.Errorf("Expected 2 hunks applied, got %d", hunks)
+	}
+
+	content, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	expected := "one\nTWO\nthree\nfour\nfive\nsix\n"
+	if string(content) != expected {
+		t.Errorf("Content mismatch. Expected:\n%s\nGot:\n%s", expected, string(content))
+	}
+
+	// Mismatched context must fail without touching the file
+	badPatch := "@@ -1,2 +1,2 @@\n one\n-missing\n+x\n"
+	if _, err := em.ApplyPatch(testFile, badPatch, 0); err == nil {
+		t.Error("Expected error for mismatched context, got nil")
+	}
+	content, _ = os.ReadFile(testFile)
+	if string(content) != expected {
+		t.Error("File was modified by a failing patch")
+	}
+
+	// A hunk whose position is off by one only applies with fuzz
+	shiftedPatch := "@@ -2,2 +2,2 @@\n three\n-four\n+FOUR\n"
+	if _, err := em.ApplyPatch(testFile, shiftedPatch, 0); err == nil {
+		t.Error("Expected error for shifted hunk without fuzz, got nil")
+	}
+	if _, err := em.ApplyPatch(testFile, shiftedPatch, 2); err != nil {
+		t.Fatalf("ApplyPatch with fuzz failed: %v", err)
+	}
+	content, _ = os.ReadFile(testFile)
+	expected = "one\nTWO\nthree\nFOUR\nfive\nsix\n"
+	if string(content) != expected {
+		t.Errorf("Content mismatch. Expected:\n%s\nGot:\n%s", expected, string(content))
+	}
+
+	// The patch is undoable like any other edit
+	if err := em.UndoEdit(testFile); err != nil {
+		t.Fatalf("UndoEdit failed: %v", err)
+	}
+	content, _ = os.ReadFile(testFile)
+	if string(content) != "one\nTWO\nthree\nfour\nfive\nsix\n" {
+		t.Errorf("Undo did not restore pre-patch content, got:\n%s", string(content))
+	}
+}
+
+func TestApplyPatchToEmptyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"terminated", "--- /dev/null\n+++ b/test.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n", "one\ntwo\n"},
+		{"no newline marker", "@@ -0,0 +1,2 @@\n+one\n+two\n\\ No newline at end of file\n", "one\ntwo"},
+	}
+	for _, tt := range tests {
+		testFile := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "-")+".txt")
+		if err := os.WriteFile(testFile, nil, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if _, err := em.ApplyPatch(testFile, tt.patch, 0); err != nil {
+			t.Errorf("%s: ApplyPatch failed: %v", tt.name, err)
+			continue
+		}
+		if content, _ := os.ReadFile(testFile); string(content) != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, string(content))
+		}
+	}
+}
+
 func containsString(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && 
 		(s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || 
@@ -294,3 +420,1107 @@ func findInString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestSnapshotFile(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	em, err := NewEditManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	originalContent := "one\ntwo\nthree"
+	if err := os.WriteFile(testFile, []byte(originalContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Snapshotting must not change the file
+	snapshotID, err := em.SnapshotFile(testFile)
+	if err != nil {
+		t.Fatalf("SnapshotFile failed: %v", err)
+	}
+	if snapshotID == "" {
+		t.Error("Expected a snapshot id")
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != originalContent {
+		t.Errorf("SnapshotFile modified the file: %q", string(content))
+	}
+
+	// Two edits after the snapshot, then undo back through them to the snapshot
+	if _, err := em.StrReplace(testFile, "two", "TWO", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "three", "THREE", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	history := em.GetEditHistory(testFile)
+	if len(history) != 3 || !history[0].Snapshot || history[0].ID() != snapshotID {
+		t.Fatalf("Expected snapshot followed by two edits in history, got %+v", history)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := em.UndoEdit(testFile); err != nil {
+			t.Fatalf("UndoEdit %d failed: %v", i+1, err)
+		}
+	}
+	content, _ = os.ReadFile(testFile)
+	if string(content) != originalContent {
+		t.Errorf("Expected snapshot content after undo, got %q", string(content))
+	}
+}
+
+func TestRestoreToSnapshot(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	em, err := NewEditManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	otherFile := filepath.Join(tmpDir, "other.txt")
+	originalContent := "alpha\nbeta"
+	for _, file := range []string{testFile, otherFile} {
+		if err := os.WriteFile(file, []byte(originalContent), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	snapshotID, err := em.SnapshotFile(testFile)
+	if err != nil {
+		t.Fatalf("SnapshotFile failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "alpha", "ALPHA", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "beta", "BETA", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	// The id must belong to the file being restored
+	if err := em.RestoreToSnapshot(otherFile, snapshotID); err == nil {
+		t.Error("Expected error restoring another file's snapshot, got nil")
+	}
+	if err := em.RestoreToSnapshot(testFile, "missing.bak"); err == nil {
+		t.Error("Expected error for unknown snapshot id, got nil")
+	}
+
+	if err := em.RestoreToSnapshot(testFile, snapshotID); err != nil {
+		t.Fatalf("RestoreToSnapshot failed: %v", err)
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != originalContent {
+		t.Errorf("Expected snapshot content, got %q", string(content))
+	}
+
+	// The restore is an edit of its own and can be undone
+	if err := em.UndoEdit(testFile); err != nil {
+		t.Fatalf("UndoEdit failed: %v", err)
+	}
+	content, _ = os.ReadFile(testFile)
+	if string(content) != "ALPHA\nBETA" {
+		t.Errorf("Expected pre-restore content after undo, got %q", string(content))
+	}
+}
+
+func TestListAndRestoreBackups(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	em, err := NewEditManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	otherFile := filepath.Join(tmpDir, "other.txt")
+	for _, file := range []string{testFile, otherFile} {
+		if err := os.WriteFile(file, []byte("one"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if backups := em.ListBackups(testFile); len(backups) != 0 {
+		t.Errorf("Expected no backups before editing, got %v", backups)
+	}
+
+	for _, edit := range [][2]string{{"one", "two"}, {"two", "three"}, {"three", "four"}} {
+		if _, err := em.StrReplace(testFile, edit[0], edit[1], false, ""); err != nil {
+			t.Fatalf("StrReplace failed: %v", err)
+		}
+	}
+	if _, err := em.StrReplace(otherFile, "one", "uno", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	backups := em.ListBackups(testFile)
+	if len(backups) != 3 {
+		t.Fatalf("Expected 3 backups, got %d", len(backups))
+	}
+	if backups[0].Timestamp.After(backups[2].Timestamp) {
+		t.Error("Expected backups oldest first")
+	}
+
+	// Another file's backup is refused
+	if err := em.RestoreBackup(testFile, em.ListBackups(otherFile)[0].ID); err == nil {
+		t.Error("Expected error restoring another file's backup, got nil")
+	}
+
+	// Jump back two edits at once
+	if err := em.RestoreBackup(testFile, backups[1].ID); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	content, _ := os.ReadFile(testFile)
+	if string(content) != "two" {
+		t.Errorf("Expected the content before the second edit, got %q", string(content))
+	}
+	if got := len(em.ListBackups(testFile)); got != 4 {
+		t.Errorf("Expected the restore to add a backup, got %d backups", got)
+	}
+}
+
+func TestInsertPreservesLineEndings(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	em, err := NewEditManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		original   string
+		lineNumber int
+		text       string
+		expected   string
+	}{
+		{"crlf middle", "one\r\ntwo\r\nthree\r\n", 1, "new", "one\r\nnew\r\ntwo\r\nthree\r\n"},
+		{"crlf append", "one\r\ntwo\r\n", 2, "new", "one\r\ntwo\r\nnew\r\n"},
+		{"crlf append unterminated", "one\r\ntwo", 2, "new", "one\r\ntwo\r\nnew"},
+		{"crlf multi-line text", "one\r\ntwo\r\n", 0, "a\nb", "a\r\nb\r\none\r\ntwo\r\n"},
+		{"mixed endings untouched", "one\r\ntwo\nthree\r\n", 2, "new", "one\r\ntwo\nnew\nthree\r\n"},
+		{"lf trailing newline kept", "one\ntwo\n", 2, "new", "one\ntwo\nnew\n"},
+	}
+
+	for _, tt := range tests {
+		testFile := filepath.Join(tmpDir, "test.txt")
+		if err := os.WriteFile(testFile, []byte(tt.original), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if err := em.Insert(testFile, tt.lineNumber, tt.text); err != nil {
+			t.Errorf("%s: Insert failed: %v", tt.name, err)
+			continue
+		}
+
+		content, err := os.ReadFile(testFile)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(content) != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, string(content))
+		}
+	}
+}
+
+func TestMaxConcurrentEdits(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	em, err := NewEditManager(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	em.SetMaxConcurrentEdits(1)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("before"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Hold the only slot so the edit has to queue
+	release, err := em.acquireEdit(filepath.Join(tmpDir, "other.txt"))
+	if err != nil {
+		t.Fatalf("acquireEdit failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := em.StrReplace(testFile, "before", "after", false, "")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected edit to wait for a slot, finished with: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(testFile)
+	if string(content) != "after" {
+		t.Errorf("Expected edited content, got: %q", string(content))
+	}
+
+	// Undo and redo queue for a slot like any other edit
+	for _, step := range []struct {
+		name string
+		op   func(string) error
+	}{{"UndoEdit", em.UndoEdit}, {"RedoEdit", em.RedoEdit}} {
+		name, op := step.name, step.op
+		release, err := em.acquireEdit(filepath.Join(tmpDir, "other.txt"))
+		if err != nil {
+			t.Fatalf("acquireEdit failed: %v", err)
+		}
+		go func(op func(string) error) {
+			done <- op(testFile)
+		}(op)
+
+		select {
+		case err := <-done:
+			t.Fatalf("Expected %s to wait for a slot, finished with: %v", name, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		release()
+		if err := <-done; err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+	}
+}
+
+func TestUnifiedDiffRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+	}{
+		{"change in middle", "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", "a\nb\nc\nD\ne\nf\ng\nh\ni\nJ\nk\n"},
+		{"add to empty", "", "one\ntwo\n"},
+		{"remove all", "one\ntwo\n", ""},
+		{"lose final newline", "one\ntwo\n", "one\ntwo"},
+		{"gain final newline", "one\ntwo", "one\ntwo\n"},
+		{"crlf", "one\r\ntwo\r\nthree\r\n", "one\r\n2\r\nthree\r\n"},
+	}
+
+	for _, tt := range tests {
+		diff := unifiedDiff("old", "new", tt.old, tt.new, DefaultDiffContext)
+		hunks, err := parseUnifiedDiff(diff)
+		if err != nil {
+			t.Errorf("%s: generated diff does not parse: %v\n%s", tt.name, err, diff)
+			continue
+		}
+		patched, err := applyHunks(tt.old, hunks, 0)
+		if err != nil {
+			t.Errorf("%s: generated diff does not apply: %v\n%s", tt.name, err, diff)
+			continue
+		}
+		if patched != tt.new {
+			t.Errorf("%s: expected %q, got %q\n%s", tt.name, tt.new, patched, diff)
+		}
+	}
+
+	// Distant changes get separate hunks
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	diff := unifiedDiff("old", "new", old, strings.Replace(strings.Replace(old, "2\n", "two\n", 1), "11\n", "eleven\n", 1), 1)
+	if count := strings.Count(diff, "@@ -"); count != 2 {
+		t.Errorf("Expected 2 hunks, got %d:\n%s", count, diff)
+	}
+}
+
+func TestExportChanges(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "editor-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	first := filepath.Join(tmpDir, "first.txt")
+	second := filepath.Join(tmpDir, "second.txt")
+	os.WriteFile(first, []byte("one\ntwo\n"), 0644)
+	os.WriteFile(second, []byte("keep\n"), 0644)
+
+	// Two edits to one file collapse into a single diff from the original
+	if _, err := em.StrReplace(first, "one", "ONE", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(first, "two", "TWO", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	// Edits that cancel out are left out
+	if _, err := em.StrReplace(second, "keep", "changed", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(second, "changed", "keep", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	bundle, files, err := em.ExportChanges("")
+	if err != nil {
+		t.Fatalf("ExportChanges failed: %v", err)
+	}
+	expected := "--- " + first + "\n+++ " + first + "\n@@ -1,2 +1,2 @@\n-one\n-two\n+ONE\n+TWO\n"
+	if files != 1 || bundle != expected {
+		t.Errorf("Expected 1 file with diff:\n%s\ngot %d files:\n%s", expected, files, bundle)
+	}
+
+	if _, files, _ := em.ExportChanges(second); files != 0 {
+		t.Errorf("Expected no changes for %s, got %d files", second, files)
+	}
+}
+
+func TestFileLocks(t *testing.T) {
+	em, err := NewEditManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	if err := em.LockFile("/data/a.txt", "one"); err != nil {
+		t.Fatalf("LockFile failed: %v", err)
+	}
+	// Relocking by the holder is allowed; other sessions are refused
+	if err := em.LockFile("/data/a.txt", "one"); err != nil {
+		t.Errorf("Expected relock by the holder to succeed, got: %v", err)
+	}
+	if err := em.LockFile("/data/a.txt", "two"); !errors.Is(err, ErrFileLocked) {
+		t.Errorf("Expected ErrFileLocked for another session, got: %v", err)
+	}
+
+	if err := em.CheckLock("/data/a.txt", "one"); err != nil {
+		t.Errorf("Expected the holder to pass the check, got: %v", err)
+	}
+	if err := em.CheckLock("/data/a.txt", "two"); !errors.Is(err, ErrFileLocked) {
+		t.Errorf("Expected ErrFileLocked for another session, got: %v", err)
+	}
+	if err := em.UnlockFile("/data/a.txt", "two"); !errors.Is(err, ErrFileLocked) {
+		t.Errorf("Expected another session's unlock to fail, got: %v", err)
+	}
+
+	em.LockFile("/data/b.txt", "one")
+	if released := em.ReleaseSession("one"); released != 2 {
+		t.Errorf("Expected 2 locks released, got %d", released)
+	}
+	if err := em.CheckLock("/data/a.txt", "two"); err != nil {
+		t.Errorf("Expected locks to be gone after the session closed, got: %v", err)
+	}
+	if err := em.UnlockFile("/data/a.txt", "one"); err == nil {
+		t.Error("Expected unlocking an unlocked file to fail")
+	}
+}
+
+func TestReplaceBetweenMarkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	original := "head\r\n// BEGIN\r\nold\r\n// END\r\ntail\r\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	endLine, err := em.ReplaceBetweenMarkers(testFile, "BEGIN", "END", "one\ntwo")
+	if err != nil {
+		t.Fatalf("ReplaceBetweenMarkers failed: %v", err)
+	}
+	if endLine != 5 {
+		t.Errorf("Expected end marker on line 5, got %d", endLine)
+	}
+
+	content, _ := os.ReadFile(testFile)
+	expected := "head\r\n// BEGIN\r\none\r\ntwo\r\n// END\r\ntail\r\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+
+	// Unpaired markers leave the file untouched
+	if _, err := em.ReplaceBetweenMarkers(testFile, "BEGIN", "MISSING", "x"); err == nil {
+		t.Error("Expected an error for a missing end marker")
+	}
+
+	if err := em.UndoEdit(testFile); err != nil {
+		t.Fatalf("UndoEdit failed: %v", err)
+	}
+	content, _ = os.ReadFile(testFile)
+	if string(content) != original {
+		t.Errorf("Expected undo to restore %q, got %q", original, string(content))
+	}
+}
+
+func TestWritableCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("Hello World\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	em.SetWritableCheck(func(path string) bool { return path != testFile })
+
+	if _, err := em.StrReplace(testFile, "Hello", "Bye", false, ""); !errors.Is(err, filesystem.ErrReadOnly) {
+		t.Errorf("Expected read-only error from StrReplace, got: %v", err)
+	}
+	if err := em.Insert(testFile, 0, "x"); !errors.Is(err, filesystem.ErrReadOnly) {
+		t.Errorf("Expected read-only error from Insert, got: %v", err)
+	}
+	if _, err := em.ApplyPatch(testFile, "@@ -1 +1 @@\n-Hello World\n+Bye\n", 0); !errors.Is(err, filesystem.ErrReadOnly) {
+		t.Errorf("Expected read-only error from ApplyPatch, got: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "Hello World\n" {
+		t.Errorf("Expected file to be unchanged, got %q", string(content))
+	}
+}
+
+func TestWriteSizeLimit(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	fm := filesystem.NewFileManager([]string{tmpDir})
+	fm.SetMaxWriteBytes(16)
+	em.SetWriteReservation(fm.ReserveWrite)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("Hello World\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if _, err := em.StrReplace(testFile, "World", "Everyone Else", false, ""); err == nil || !strings.Contains(err.Error(), "write limit") {
+		t.Errorf("Expected write limit error from StrReplace, got: %v", err)
+	}
+	if err := em.Insert(testFile, -1, "and more text"); err == nil || !strings.Contains(err.Error(), "write limit") {
+		t.Errorf("Expected write limit error from Insert, got: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "Hello World\n" {
+		t.Errorf("Expected file to be unchanged, got %q", string(content))
+	}
+	if history := em.GetEditHistory(testFile); len(history) != 0 {
+		t.Errorf("Expected no history for refused edits, got %d entries", len(history))
+	}
+
+	// Edits within the limit still go through
+	if _, err := em.StrReplace(testFile, "World", "All", false, ""); err != nil {
+		t.Fatalf("StrReplace within the limit failed: %v", err)
+	}
+}
+
+func TestWriteQuota(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	fm := filesystem.NewFileManagerWithDirectories([]filesystem.AllowedDirectory{{Path: tmpDir, MaxSearchDepth: -1, WriteQuota: 30}})
+	em.SetWriteReservation(fm.ReserveWrite)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("Hello World\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Each edit rewrites the whole file, so same-size edits still use up the quota
+	if _, err := em.StrReplace(testFile, "World", "There", false, ""); err != nil {
+		t.Fatalf("First StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "There", "World", false, ""); err != nil {
+		t.Fatalf("Second StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "World", "There", false, ""); err == nil || !strings.Contains(err.Error(), "write quota exceeded") {
+		t.Errorf("Expected quota error from StrReplace, got: %v", err)
+	}
+	if err := em.UndoEdit(testFile); err == nil || !strings.Contains(err.Error(), "write quota exceeded") {
+		t.Errorf("Expected quota error from UndoEdit, got: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "Hello World\n" {
+		t.Errorf("Expected file to be unchanged, got %q", string(content))
+	}
+
+	// Filesystem writes share the same budget
+	if err := fm.WriteFile(testFile, "Hello There\n"); err == nil || !strings.Contains(err.Error(), "write quota exceeded") {
+		t.Errorf("Expected quota error from WriteFile, got: %v", err)
+	}
+}
+
+func TestRedoEdit(t *testing.T) {
+	tmpDir := t.TempDir()
+	backups := filepath.Join(tmpDir, "backups")
+	em, err := NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("one\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	readFile := func() string {
+		content, _ := os.ReadFile(testFile)
+		return string(content)
+	}
+
+	if err := em.RedoEdit(testFile); err == nil {
+		t.Error("Expected an error with nothing to redo")
+	}
+
+	if _, err := em.StrReplace(testFile, "one", "two", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "two", "three", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	// Undo one step too far, then redo back
+	for i := 0; i < 2; i++ {
+		if err := em.UndoEdit(testFile); err != nil {
+			t.Fatalf("UndoEdit failed: %v", err)
+		}
+	}
+	if readFile() != "one\n" {
+		t.Fatalf("Expected undo to restore one, got %q", readFile())
+	}
+	if err := em.RedoEdit(testFile); err != nil {
+		t.Fatalf("RedoEdit failed: %v", err)
+	}
+	if readFile() != "two\n" {
+		t.Errorf("Expected redo to restore two, got %q", readFile())
+	}
+
+	// A redone edit can be undone again
+	if err := em.UndoEdit(testFile); err != nil {
+		t.Fatalf("UndoEdit after redo failed: %v", err)
+	}
+	if readFile() != "one\n" {
+		t.Errorf("Expected undo after redo to restore one, got %q", readFile())
+	}
+
+	// A fresh edit clears the redo stack and its backups
+	if _, err := em.StrReplace(testFile, "one", "four", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if err := em.RedoEdit(testFile); err == nil {
+		t.Error("Expected a new edit to clear the redo stack")
+	}
+	if backupFiles, _ := filepath.Glob(filepath.Join(backups, "*.bak")); len(backupFiles) != 1 {
+		t.Errorf("Expected only the new edit's backup to remain, found %d files", len(backupFiles))
+	}
+}
+
+func TestRegexReplace(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.go")
+	original := "oldName(1)\noldName(2)\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := em.RegexReplace(testFile, `old(\w+)\((\d)\)`, "new${1}($2)", false); err != nil {
+		t.Fatalf("RegexReplace failed: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "newName(1)\noldName(2)\n" {
+		t.Errorf("Expected only the first match replaced, got %q", string(content))
+	}
+
+	if err := em.RegexReplace(testFile, `(?m)^\w+Name`, "fn", true); err != nil {
+		t.Fatalf("RegexReplace with all failed: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "fn(1)\nfn(2)\n" {
+		t.Errorf("Expected every match replaced, got %q", string(content))
+	}
+
+	if err := em.RegexReplace(testFile, `(`, "x", true); err == nil || !strings.Contains(err.Error(), "invalid regex pattern") {
+		t.Errorf("Expected a compile error, got: %v", err)
+	}
+	if err := em.RegexReplace(testFile, `missing`, "x", true); err == nil {
+		t.Error("Expected an error when nothing matches")
+	}
+
+	if err := em.UndoEdit(testFile); err != nil {
+		t.Fatalf("UndoEdit failed: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "newName(1)\noldName(2)\n" {
+		t.Errorf("Expected undo to restore the previous content, got %q", string(content))
+	}
+}
+
+func TestDeleteLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	testFile := filepath.Join(tmpDir, "test.txt")
+
+	tests := []struct {
+		content    string
+		start, end int
+		want       string
+	}{
+		{"one\ntwo\nthree\n", 2, 2, "one\nthree\n"},
+		{"one\ntwo\nthree\n", 2, 3, "one\n"},
+		{"one\ntwo\nthree", 3, 3, "one\ntwo"},
+		{"one\r\ntwo\r\nthree", 2, 3, "one"},
+		{"one\ntwo\n", 1, 2, ""},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(testFile, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		if err := em.DeleteLines(testFile, tt.start, tt.end); err != nil {
+			t.Errorf("DeleteLines(%q, %d, %d) failed: %v", tt.content, tt.start, tt.end, err)
+			continue
+		}
+		if content, _ := os.ReadFile(testFile); string(content) != tt.want {
+			t.Errorf("DeleteLines(%q, %d, %d) = %q, want %q", tt.content, tt.start, tt.end, string(content), tt.want)
+		}
+	}
+
+	if err := os.WriteFile(testFile, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := em.DeleteLines(testFile, 2, 1); err == nil {
+		t.Error("Expected an error when start_line is after end_line")
+	}
+	if err := em.DeleteLines(testFile, 1, 3); err == nil {
+		t.Error("Expected an error for a range past the end of the file")
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "one\ntwo\n" {
+		t.Errorf("Expected invalid ranges to leave the file untouched, got %q", string(content))
+	}
+}
+
+func TestReplaceLines(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	testFile := filepath.Join(tmpDir, "test.txt")
+
+	tests := []struct {
+		content    string
+		start, end int
+		text       string
+		want       string
+	}{
+		{"one\ntwo\nthree\n", 2, 2, "TWO\nTWO AGAIN", "one\nTWO\nTWO AGAIN\nthree\n"},
+		{"one\ntwo\nthree\n", 1, 3, "only\n", "only\n"},
+		{"one\ntwo", 2, 2, "2\n3", "one\n2\n3"},
+		{"one\r\ntwo\r\n", 1, 1, "a\nb", "a\r\nb\r\ntwo\r\n"},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(testFile, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		if err := em.ReplaceLines(testFile, tt.start, tt.end, tt.text); err != nil {
+			t.Errorf("ReplaceLines(%q, %d, %d) failed: %v", tt.content, tt.start, tt.end, err)
+			continue
+		}
+		if content, _ := os.ReadFile(testFile); string(content) != tt.want {
+			t.Errorf("ReplaceLines(%q, %d, %d) = %q, want %q", tt.content, tt.start, tt.end, string(content), tt.want)
+		}
+	}
+
+	err = em.ReplaceLines(testFile, 2, 5, "x")
+	if err == nil || !strings.Contains(err.Error(), "file has 3 lines") {
+		t.Errorf("Expected an error naming the line count, got: %v", err)
+	}
+}
+
+func TestCRLFPreserved(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	// A Windows file with no trailing newline
+	const fixture = "first\r\nsecond\r\nthird"
+	testFile := filepath.Join(tmpDir, "windows.txt")
+	if err := os.WriteFile(testFile, []byte(fixture), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Strings sent with LF still match and are written back with CRLF
+	if _, err := em.StrReplace(testFile, "first\nsecond", "one\ntwo", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.ApplyPatch(testFile, "@@ -3 +3,2 @@\n-third\n+three\n+four\n\\ No newline at end of file\n", 0); err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if err := em.RegexReplace(testFile, `four`, "four\nfive", false); err != nil {
+		t.Fatalf("RegexReplace failed: %v", err)
+	}
+
+	want := "one\r\ntwo\r\nthree\r\nfour\r\nfive"
+	if content, _ := os.ReadFile(testFile); string(content) != want {
+		t.Errorf("Expected CRLF endings and no trailing newline, got %q", string(content))
+	}
+}
+
+func TestPreviewEdits(t *testing.T) {
+	tmpDir := t.TempDir()
+	backups := filepath.Join(tmpDir, "backups")
+	em, err := NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	original := "one\ntwo\nthree\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	previews := map[string]func() (string, error){
+		"str_replace":   func() (string, error) { return em.PreviewStrReplace(testFile, "two", "TWO", false) },
+		"regex_replace": func() (string, error) { return em.PreviewRegexReplace(testFile, `t(wo)`, "T$1", false) },
+		"insert":        func() (string, error) { return em.PreviewInsert(testFile, 1, "TWO") },
+		"delete_lines":  func() (string, error) { return em.PreviewDeleteLines(testFile, 2, 2) },
+		"replace_lines": func() (string, error) { return em.PreviewReplaceLines(testFile, 2, 2, "TWO") },
+	}
+	for name, preview := range previews {
+		diff, err := preview()
+		if err != nil {
+			t.Errorf("%s preview failed: %v", name, err)
+			continue
+		}
+		if !strings.HasPrefix(diff, "--- "+testFile+"\n+++ "+testFile+"\n@@ ") {
+			t.Errorf("%s preview did not return a unified diff: %q", name, diff)
+		}
+	}
+
+	// The diff is what the edit would do
+	diff, _ := em.PreviewReplaceLines(testFile, 2, 2, "TWO")
+	if !strings.Contains(diff, "\n-two\n+TWO\n") {
+		t.Errorf("Expected diff replacing two with TWO, got %q", diff)
+	}
+
+	// Nothing is written and no backup is made
+	if content, _ := os.ReadFile(testFile); string(content) != original {
+		t.Errorf("Expected preview to leave the file untouched, got %q", string(content))
+	}
+	if entries, _ := os.ReadDir(backups); len(entries) != 0 || len(em.GetEditHistory(testFile)) != 0 {
+		t.Errorf("Expected no backups or history from previews, found %d backups", len(entries))
+	}
+
+	// Errors are the ones the edit itself would report
+	if _, err := em.PreviewStrReplace(testFile, "missing", "x", false); err == nil {
+		t.Error("Expected preview of a failing edit to fail")
+	}
+
+	// Previewing the creation of a new file diffs against /dev/null
+	newFile := filepath.Join(tmpDir, "new.txt")
+	diff, err = em.PreviewInsert(newFile, 0, "hello")
+	if err != nil || !strings.HasPrefix(diff, "--- /dev/null\n") || !strings.Contains(diff, "+hello\n") {
+		t.Errorf("Expected creation diff, got %q (%v)", diff, err)
+	}
+	if _, err := os.Stat(newFile); !os.IsNotExist(err) {
+		t.Error("Expected preview not to create the file")
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	tmpDir := t.TempDir()
+	backups := filepath.Join(tmpDir, "backups")
+	em, err := NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("one\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "one", "two", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "two", "three", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	// A restarted manager can still undo
+	em, err = NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to recreate edit manager: %v", err)
+	}
+	if err := em.UndoEdit(testFile); err != nil {
+		t.Fatalf("UndoEdit after restart failed: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "two\n" {
+		t.Errorf("Expected undo after restart to restore two, got %q", string(content))
+	}
+
+	// Entries whose backups are gone are pruned on load
+	history := em.GetEditHistory(testFile)
+	if len(history) != 1 {
+		t.Fatalf("Expected one remaining history entry, got %d", len(history))
+	}
+	os.Remove(history[0].BackupPath)
+	em, err = NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to recreate edit manager: %v", err)
+	}
+	if len(em.GetEditHistory(testFile)) != 0 {
+		t.Error("Expected history entry with a missing backup to be pruned")
+	}
+
+	// Backups outside the backup directory are never trusted
+	outside := filepath.Join(tmpDir, "outside.bak")
+	os.WriteFile(outside, []byte("x"), 0644)
+	index, _ := json.Marshal([]EditHistory{{FilePath: testFile, BackupPath: outside}})
+	os.WriteFile(filepath.Join(backups, historyIndexName), index, 0644)
+	em, err = NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to recreate edit manager: %v", err)
+	}
+	if len(em.GetEditHistory(testFile)) != 0 {
+		t.Error("Expected history entry pointing outside the backup directory to be dropped")
+	}
+}
+
+func TestHistoryRequiresPrivateBackupDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ownership and permission bits are not checked on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	backups := filepath.Join(tmpDir, "backups")
+	em, err := NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	if info, err := os.Stat(backups); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected backup directory with mode 0700, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("one\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := em.StrReplace(testFile, "one", "two", false, ""); err != nil {
+		t.Fatalf("StrReplace failed: %v", err)
+	}
+
+	historyCount := func() int {
+		t.Helper()
+		em, err := NewEditManager(backups)
+		if err != nil {
+			t.Fatalf("Failed to recreate edit manager: %v", err)
+		}
+		return len(em.GetEditHistory(testFile))
+	}
+	if historyCount() != 1 {
+		t.Fatal("Expected history to load from a private backup directory")
+	}
+
+	index := filepath.Join(backups, historyIndexName)
+	os.Chmod(index, 0666)
+	if historyCount() != 0 {
+		t.Error("Expected a world-writable history index to be ignored")
+	}
+	os.Chmod(index, 0600)
+
+	os.Chmod(backups, 0770)
+	if historyCount() != 0 {
+		t.Error("Expected history in a group-writable backup directory to be ignored")
+	}
+	os.Chmod(backups, 0700)
+
+	// Only root can hand the index to another user
+	if os.Getuid() == 0 {
+		os.Chown(index, 65534, 65534)
+		if historyCount() != 0 {
+			t.Error("Expected a history index owned by another user to be ignored")
+		}
+		os.Chown(index, 0, 0)
+	}
+	if historyCount() != 1 {
+		t.Error("Expected history to load again once the backup directory is private")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	backups := filepath.Join(tmpDir, "backups")
+	em, err := NewEditManager(backups)
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	em.SetRetention(2, 0)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("0\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := em.StrReplace(testFile, fmt.Sprint(i), fmt.Sprint(i+1), false, ""); err != nil {
+			t.Fatalf("StrReplace failed: %v", err)
+		}
+	}
+	if history := em.GetEditHistory(testFile); len(history) != 2 {
+		t.Errorf("Expected history capped at 2 entries, got %d", len(history))
+	}
+	if backupFiles, _ := filepath.Glob(filepath.Join(backups, "*.bak")); len(backupFiles) != 2 {
+		t.Errorf("Expected evicted backups to be removed, found %d", len(backupFiles))
+	}
+
+	// Backups older than the age limit go, whether in the history or left behind
+	stale := filepath.Join(backups, "orphan.txt_1.bak")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to create stale backup: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(stale, old, old)
+	em.historyMutex.Lock()
+	em.history[0].Timestamp = old
+	expiredBackup := em.history[0].BackupPath
+	em.historyMutex.Unlock()
+
+	em.SetRetention(0, 24*time.Hour)
+	if history := em.GetEditHistory(testFile); len(history) != 1 {
+		t.Errorf("Expected the expired entry to be pruned, got %d entries", len(history))
+	}
+	if _, err := os.Stat(expiredBackup); !os.IsNotExist(err) {
+		t.Error("Expected the expired entry's backup to be removed")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(stale); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the stale backup file to be cleaned up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConcurrentEditsToSameFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+	em.SetRetention(1000, 0)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	for i := 0; i < 50; i++ {
+		if err := os.WriteFile(testFile, []byte("alpha\nbeta\n"), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		errs := make(chan error, 2)
+		for _, word := range []string{"alpha", "beta"} {
+			go func(word string) {
+				_, err := em.StrReplace(testFile, word, strings.ToUpper(word), false, "")
+				errs <- err
+			}(word)
+		}
+		for j := 0; j < 2; j++ {
+			if err := <-errs; err != nil {
+				t.Fatalf("StrReplace failed: %v", err)
+			}
+		}
+
+		if content, _ := os.ReadFile(testFile); string(content) != "ALPHA\nBETA\n" {
+			t.Fatalf("Concurrent edits lost a change on attempt %d: %q", i, string(content))
+		}
+	}
+
+	// Per-file locks are dropped once no edit holds them
+	em.editLocks.mutex.Lock()
+	remaining := len(em.editLocks.locks)
+	em.editLocks.mutex.Unlock()
+	if remaining != 0 {
+		t.Errorf("Expected no per-file locks left, got %d", remaining)
+	}
+}
+
+func TestExternalModificationDetected(t *testing.T) {
+	tmpDir := t.TempDir()
+	em, err := NewEditManager(filepath.Join(tmpDir, "backups"))
+	if err != nil {
+		t.Fatalf("Failed to create edit manager: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("one\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// A stale expected hash refuses the edit; the current one allows it
+	if _, err := em.StrReplace(testFile, "one", "two", false, contentHash([]byte("zero\n"))); err == nil {
+		t.Fatal("Expected StrReplace with a stale hash to fail")
+	}
+	if _, err := em.StrReplace(testFile, "one", "two", false, "sha256:"+contentHash([]byte("one\n"))); err != nil {
+		t.Fatalf("StrReplace with the current hash failed: %v", err)
+	}
+
+	history := em.GetEditHistory(testFile)
+	if len(history) != 1 || history[0].OriginalHash != contentHash([]byte("one\n")) ||
+		history[0].ResultHash != contentHash([]byte("two\n")) {
+		t.Fatalf("Expected history to record both hashes, got %+v", history)
+	}
+
+	// Undo refuses to discard a change made behind the editor's back
+	if err := os.WriteFile(testFile, []byte("three\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+	if err := em.UndoEdit(testFile); err == nil || !strings.Contains(err.Error(), history[0].ID()) {
+		t.Fatalf("Expected UndoEdit to refuse and name the backup, got %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "three\n" {
+		t.Errorf("Expected refused undo to leave the file alone, got %q", string(content))
+	}
+
+	// Restoring the backup explicitly still works
+	if err := em.RestoreToSnapshot(testFile, history[0].ID()); err != nil {
+		t.Fatalf("RestoreToSnapshot failed: %v", err)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "one\n" {
+		t.Errorf("Expected restore to bring back one, got %q", string(content))
+	}
+}
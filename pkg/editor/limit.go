@@ -0,0 +1,94 @@
+package editor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMaxConcurrentEdits is how many edits may run at once unless configured otherwise
+const DefaultMaxConcurrentEdits = 4
+
+// editQueueTimeout is how long an edit waits for a free slot before failing
+const editQueueTimeout = 10 * time.Second
+
+// SetMaxConcurrentEdits bounds how many edit operations (str_replace, insert,
+// apply_patch, replace_between_markers, restore_to_snapshot, restore_backup,
+// undo_edit, redo_edit) may run at once,
+// so bursts of edits do not flood the backup directory. Excess edits queue
+// briefly and then fail.
+// Zero or a negative value removes the limit.
+func (em *EditManager) SetMaxConcurrentEdits(limit int) {
+	if limit <= 0 {
+		em.editSlots = nil
+		return
+	}
+	em.editSlots = make(chan struct{}, limit)
+}
+
+// fileMutexes hands out one mutex per file, so edits to the same file run one
+// at a time while edits to different files proceed in parallel. Entries are
+// reference counted and dropped once no edit holds or waits for them.
+type fileMutexes struct {
+	mutex sync.Mutex
+	locks map[string]*fileMutex
+}
+
+// fileMutex is a file's edit lock and how many edits hold or wait for it
+type fileMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the mutex for filePath and returns its unlock function
+func (f *fileMutexes) lock(filePath string) func() {
+	f.mutex.Lock()
+	if f.locks == nil {
+		f.locks = make(map[string]*fileMutex)
+	}
+	lock, ok := f.locks[filePath]
+	if !ok {
+		lock = &fileMutex{}
+		f.locks[filePath] = lock
+	}
+	lock.refs++
+	f.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		f.mutex.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(f.locks, filePath)
+		}
+		f.mutex.Unlock()
+	}
+}
+
+// acquireEdit reserves an edit slot, waiting up to editQueueTimeout, then
+// takes the file's edit lock, and returns the function that releases both
+func (em *EditManager) acquireEdit(filePath string) (func(), error) {
+	slots := em.editSlots
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(editQueueTimeout)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				return nil, fmt.Errorf("too many concurrent edits (limit %d); try again shortly", cap(slots))
+			}
+		}
+	}
+
+	unlock := em.editLocks.lock(filePath)
+	return func() {
+		unlock()
+		if slots != nil {
+			<-slots
+		}
+	}, nil
+}
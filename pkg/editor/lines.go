@@ -0,0 +1,99 @@
+package editor
+
+import "strings"
+
+// splitLines splits content into lines without their terminators, alongside
+// each line's own ending ("\n", "\r\n", or "" for an unterminated last line),
+// so line-based edits can write untouched lines back exactly as they were
+func splitLines(content string) (lines, endings []string) {
+	for content != "" {
+		i := strings.IndexByte(content, '\n')
+		if i == -1 {
+			lines = append(lines, content)
+			endings = append(endings, "")
+			break
+		}
+
+		line, ending := content[:i], "\n"
+		if strings.HasSuffix(line, "\r") {
+			line, ending = line[:len(line)-1], "\r\n"
+		}
+		lines = append(lines, line)
+		endings = append(endings, ending)
+		content = content[i+1:]
+	}
+	return lines, endings
+}
+
+// joinLines reverses splitLines
+func joinLines(lines, endings []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		b.WriteString(line)
+		b.WriteString(endings[i])
+	}
+	return b.String()
+}
+
+// dominantLineEnding returns "\r\n" if most of content's lines end with CRLF,
+// otherwise "\n"
+func dominantLineEnding(content string) string {
+	crlf := strings.Count(content, "\r\n")
+	if crlf > strings.Count(content, "\n")-crlf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// withLineEnding rewrites every line break in text as ending
+func withLineEnding(text, ending string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if ending != "\n" {
+		text = strings.ReplaceAll(text, "\n", ending)
+	}
+	return text
+}
+
+// lineEndingNear picks the line ending for text added after line index i
+// (-1 for the start of the file): the ending of the nearest terminated line
+// at or before i, else the first one in the file, else "\n"
+func lineEndingNear(endings []string, i int) string {
+	for j := i; j >= 0 && j < len(endings); j-- {
+		if endings[j] != "" {
+			return endings[j]
+		}
+	}
+	for _, ending := range endings {
+		if ending != "" {
+			return ending
+		}
+	}
+	return "\n"
+}
+
+// replaceLineRange replaces lines start through end (1-indexed, inclusive)
+// with replacement, which may be empty to delete them. Replacement lines take
+// the ending of the lines they replace, and whatever ends up last in the file
+// keeps the original last line's ending, so a file without a final newline
+// still has none afterwards.
+func replaceLineRange(lines, endings []string, start, end int, replacement []string) ([]string, []string) {
+	ending := lineEndingNear(endings, end-1)
+	finalEnding := endings[len(endings)-1]
+
+	newLines := make([]string, 0, len(lines)-(end-start+1)+len(replacement))
+	newLines = append(newLines, lines[:start-1]...)
+	newLines = append(newLines, replacement...)
+	newLines = append(newLines, lines[end:]...)
+
+	newEndings := make([]string, 0, len(newLines))
+	newEndings = append(newEndings, endings[:start-1]...)
+	for range replacement {
+		newEndings = append(newEndings, ending)
+	}
+	newEndings = append(newEndings, endings[end:]...)
+
+	if end == len(lines) && len(newEndings) > 0 {
+		newEndings[len(newEndings)-1] = finalEnding
+	}
+	return newLines, newEndings
+}
@@ -0,0 +1,74 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrFileLocked is returned when a file is locked by another session
+var ErrFileLocked = errors.New("file locked")
+
+// fileLock is an advisory lock held by one client session
+type fileLock struct {
+	session string
+	since   time.Time
+}
+
+// LockFile locks a file against changes from other sessions until the session
+// unlocks it or disconnects. Locking a file the session already holds is a no-op.
+func (em *EditManager) LockFile(filePath, session string) error {
+	em.locksMutex.Lock()
+	defer em.locksMutex.Unlock()
+
+	if lock, ok := em.locks[filePath]; ok && lock.session != session {
+		return fmt.Errorf("%w: %s has been locked by another session since %s",
+			ErrFileLocked, filePath, lock.since.Format(time.RFC3339))
+	}
+	if _, ok := em.locks[filePath]; !ok {
+		em.locks[filePath] = fileLock{session: session, since: time.Now()}
+	}
+	return nil
+}
+
+// UnlockFile releases a lock the session holds on a file
+func (em *EditManager) UnlockFile(filePath, session string) error {
+	em.locksMutex.Lock()
+	defer em.locksMutex.Unlock()
+
+	lock, ok := em.locks[filePath]
+	if !ok {
+		return fmt.Errorf("%s is not locked", filePath)
+	}
+	if lock.session != session {
+		return fmt.Errorf("%w: %s is locked by another session", ErrFileLocked, filePath)
+	}
+	delete(em.locks, filePath)
+	return nil
+}
+
+// CheckLock returns ErrFileLocked if another session holds a lock on the file
+func (em *EditManager) CheckLock(filePath, session string) error {
+	em.locksMutex.Lock()
+	defer em.locksMutex.Unlock()
+
+	if lock, ok := em.locks[filePath]; ok && lock.session != session {
+		return fmt.Errorf("%w: %s is locked by another session", ErrFileLocked, filePath)
+	}
+	return nil
+}
+
+// ReleaseSession releases every lock held by a session and returns how many there were
+func (em *EditManager) ReleaseSession(session string) int {
+	em.locksMutex.Lock()
+	defer em.locksMutex.Unlock()
+
+	released := 0
+	for filePath, lock := range em.locks {
+		if lock.session == session {
+			delete(em.locks, filePath)
+			released++
+		}
+	}
+	return released
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package editor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkPrivate refuses a file or directory that belongs to another user or
+// that other users could write to
+func checkPrivate(info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by uid %d, not the current user", info.Name(), stat.Uid)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users (mode %v)", info.Name(), info.Mode().Perm())
+	}
+	return nil
+}
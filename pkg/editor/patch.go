@@ -0,0 +1,201 @@
+package editor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeaderPattern matches a unified diff hunk header such as "@@ -12,5 +12,7 @@"
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patchHunk is a single hunk of a unified diff
+type patchHunk struct {
+	header   string
+	oldStart int
+	oldLines []string // Context and removed lines, as they must appear in the file
+	newLines []string // Context and added lines, as they will appear after patching
+	oldNoEOL bool     // Original file has no trailing newline after this hunk
+	newNoEOL bool     // Patched file has no trailing newline after this hunk
+}
+
+// parseUnifiedDiff parses the hunks of a single-file unified diff
+// File headers (---/+++), "diff" and "index" lines are ignored
+func parseUnifiedDiff(patch string) ([]patchHunk, error) {
+	patch = strings.ReplaceAll(patch, "\r\n", "\n")
+	lines := strings.Split(patch, "\n")
+
+	var hunks []patchHunk
+	var current *patchHunk
+	var oldRemaining, newRemaining int
+	var lastOp byte
+
+	for _, line := range lines {
+		if match := hunkHeaderPattern.FindStringSubmatch(line); match != nil {
+			if current != nil && (oldRemaining > 0 || newRemaining > 0) {
+				return nil, fmt.Errorf("malformed hunk %q: hunk is shorter than its header declares", current.header)
+			}
+
+			oldStart, _ := strconv.Atoi(match[1])
+			oldCount, newCount := 1, 1
+			if match[2] != "" {
+				oldCount, _ = strconv.Atoi(match[2])
+			}
+			if match[4] != "" {
+				newCount, _ = strconv.Atoi(match[4])
+			}
+
+			hunks = append(hunks, patchHunk{header: match[0], oldStart: oldStart})
+			current = &hunks[len(hunks)-1]
+			oldRemaining, newRemaining = oldCount, newCount
+			lastOp = 0
+			continue
+		}
+
+		if current == nil || (oldRemaining == 0 && newRemaining == 0) {
+			// Marker lines may trail the final line of a hunk
+			if current != nil && strings.HasPrefix(line, `\`) {
+				markNoEOL(current, lastOp)
+			}
+			// Anything else outside a hunk (file headers, git metadata) is skipped
+			continue
+		}
+
+		if line == "" {
+			// Some tools strip the single space from empty context lines
+			line = " "
+		}
+
+		switch line[0] {
+		case ' ':
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+			oldRemaining--
+			newRemaining--
+		case '-':
+			current.oldLines = append(current.oldLines, line[1:])
+			oldRemaining--
+		case '+':
+			current.newLines = append(current.newLines, line[1:])
+			newRemaining--
+		case '\\':
+			markNoEOL(current, lastOp)
+			continue
+		default:
+			return nil, fmt.Errorf("malformed hunk %q: unexpected line %q", current.header, line)
+		}
+
+		if oldRemaining < 0 || newRemaining < 0 {
+			return nil, fmt.Errorf("malformed hunk %q: hunk is longer than its header declares", current.header)
+		}
+		lastOp = line[0]
+	}
+
+	if current != nil && (oldRemaining > 0 || newRemaining > 0) {
+		return nil, fmt.Errorf("malformed hunk %q: hunk is shorter than its header declares", current.header)
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("patch contains no hunks")
+	}
+
+	return hunks, nil
+}
+
+// markNoEOL records a "\ No newline at end of file" marker against the line before it
+func markNoEOL(hunk *patchHunk, lastOp byte) {
+	switch lastOp {
+	case '-':
+		hunk.oldNoEOL = true
+	case '+':
+		hunk.newNoEOL = true
+	case ' ':
+		hunk.oldNoEOL = true
+		hunk.newNoEOL = true
+	}
+}
+
+// applyHunks applies parsed hunks to content and returns the patched content.
+// fuzz is how many lines away from its stated position a hunk may be found.
+func applyHunks(content string, hunks []patchHunk, fuzz int) (string, error) {
+	newline := dominantLineEnding(content)
+	// Lines added to an empty file are terminated unless a marker says otherwise
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n"), "\n")
+	}
+
+	offset := 0
+	for i, hunk := range hunks {
+		// A hunk with no old lines inserts after oldStart rather than at it
+		expected := hunk.oldStart - 1 + offset
+		if len(hunk.oldLines) == 0 {
+			expected = hunk.oldStart + offset
+		}
+
+		pos := findHunk(lines, hunk.oldLines, expected, fuzz)
+		if pos == -1 {
+			return "", fmt.Errorf("hunk %d (%s) does not apply: context does not match the file near line %d",
+				i+1, hunk.header, expected+1)
+		}
+
+		patched := make([]string, 0, len(lines)-len(hunk.oldLines)+len(hunk.newLines))
+		patched = append(patched, lines[:pos]...)
+		patched = append(patched, hunk.newLines...)
+		patched = append(patched, lines[pos+len(hunk.oldLines):]...)
+
+		// Newline markers only matter when the hunk reaches the end of the file
+		if pos+len(hunk.newLines) == len(patched) {
+			if hunk.newNoEOL {
+				trailingNewline = false
+			} else if hunk.oldNoEOL {
+				trailingNewline = true
+			}
+		}
+
+		offset = pos - (expected - offset) + len(hunk.newLines) - len(hunk.oldLines)
+		lines = patched
+	}
+
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	result := strings.Join(lines, newline)
+	if trailingNewline {
+		result += newline
+	}
+	return result, nil
+}
+
+// findHunk finds where block occurs in lines, starting at expected and
+// searching outwards up to fuzz lines in either direction. Returns -1 if not found.
+func findHunk(lines, block []string, expected, fuzz int) int {
+	for delta := 0; delta <= fuzz; delta++ {
+		for _, pos := range []int{expected - delta, expected + delta} {
+			if blockMatches(lines, block, pos) {
+				return pos
+			}
+			if delta == 0 {
+				break
+			}
+		}
+	}
+	return -1
+}
+
+// blockMatches reports whether block appears in lines at pos
+func blockMatches(lines, block []string, pos int) bool {
+	if pos < 0 || pos+len(block) > len(lines) {
+		return false
+	}
+	for i, line := range block {
+		if lines[pos+i] != line {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/LaurieRhodes/mcp-filesystem-go/pkg/filesystem"
+)
+
+// historyIndexName is the file in the backup directory that records the edit
+// history, so undo keeps working after the server restarts
+const historyIndexName = "history.json"
+
+// loadHistory restores the edit history saved in the backup directory.
+// Nothing is loaded unless the directory and index are the current user's and
+// no one else can write to them. Entries whose backup is missing, or lies
+// outside the backup directory, are dropped. Limits apply from the next edit
+// or SetRetention call.
+func (em *EditManager) loadHistory() {
+	indexPath := filepath.Join(em.backupDir, historyIndexName)
+	indexInfo, err := os.Lstat(indexPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read edit history: %v\n", err)
+		}
+		return
+	}
+	if !indexInfo.Mode().IsRegular() {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring edit history: %s is not a regular file\n", indexPath)
+		return
+	}
+	dirInfo, err := os.Stat(em.backupDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read edit history: %v\n", err)
+		return
+	}
+	for _, info := range []os.FileInfo{dirInfo, indexInfo} {
+		if err := checkPrivate(info); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring edit history: %v\n", err)
+			return
+		}
+	}
+
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to read edit history: %v\n", err)
+		return
+	}
+
+	var saved []EditHistory
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring unreadable edit history: %v\n", err)
+		return
+	}
+
+	em.historyMutex.Lock()
+	defer em.historyMutex.Unlock()
+
+	for _, entry := range saved {
+		// Undo writes backups over files and deletes them afterwards, so only
+		// trust backups this manager could have created
+		if filepath.Dir(entry.BackupPath) != filepath.Clean(em.backupDir) {
+			continue
+		}
+		if _, err := os.Stat(entry.BackupPath); err != nil {
+			continue
+		}
+		em.history = append(em.history, entry)
+	}
+}
+
+// saveHistory writes the edit history to the backup directory; historyMutex must be held.
+// Failures are reported but do not fail the edit that triggered them.
+func (em *EditManager) saveHistory() {
+	data, err := json.MarshalIndent(em.history, "", "  ")
+	if err == nil {
+		// Private regardless of fileMode, since loadHistory refuses a shared index
+		err = filesystem.AtomicWrite(filepath.Join(em.backupDir, historyIndexName), data, 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save edit history: %v\n", err)
+	}
+}
@@ -0,0 +1,82 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Preview methods compute what an edit would do without writing the file or
+// creating a backup. Each returns a unified diff from the current content to
+// the edited content, or "" if the edit changes nothing.
+
+// PreviewStrReplace previews StrReplace
+func (em *EditManager) PreviewStrReplace(filePath, oldStr, newStr string, replaceAll bool) (string, error) {
+	return em.previewEdit(filePath, func(content string) (string, error) {
+		newContent, _, err := strReplaceContent(content, oldStr, newStr, replaceAll)
+		return newContent, err
+	})
+}
+
+// PreviewRegexReplace previews RegexReplace
+func (em *EditManager) PreviewRegexReplace(filePath, pattern, replacement string, all bool) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+	}
+	return em.previewEdit(filePath, func(content string) (string, error) {
+		return regexReplaceContent(content, re, replacement, all)
+	})
+}
+
+// PreviewInsert previews Insert, including the creation of a missing file
+func (em *EditManager) PreviewInsert(filePath string, lineNumber int, text string) (string, error) {
+	if err := em.checkWritable(filePath); err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if lineNumber != 0 && lineNumber != -1 {
+			return "", fmt.Errorf("file doesn't exist; use line_number=0 or 'start' to create at beginning, or line_number=-1/'end'/'append' to create")
+		}
+		return unifiedDiff("/dev/null", filePath, "", text+"\n", DefaultDiffContext), nil
+	}
+
+	return em.previewEdit(filePath, func(content string) (string, error) {
+		return insertContent(content, lineNumber, text)
+	})
+}
+
+// PreviewDeleteLines previews DeleteLines
+func (em *EditManager) PreviewDeleteLines(filePath string, startLine, endLine int) (string, error) {
+	return em.previewEdit(filePath, func(content string) (string, error) {
+		return replaceLinesContent(content, startLine, endLine, nil)
+	})
+}
+
+// PreviewReplaceLines previews ReplaceLines
+func (em *EditManager) PreviewReplaceLines(filePath string, startLine, endLine int, text string) (string, error) {
+	return em.previewEdit(filePath, func(content string) (string, error) {
+		return replaceLinesContent(content, startLine, endLine, replacementLines(text))
+	})
+}
+
+// previewEdit applies edit to the file's content in memory and diffs the result.
+// Files the edit would be refused for are reported the same way as by the edit.
+func (em *EditManager) previewEdit(filePath string, edit func(content string) (string, error)) (string, error) {
+	if err := em.checkWritable(filePath); err != nil {
+		return "", err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := edit(string(content))
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(filePath, filePath, string(content), newContent, DefaultDiffContext), nil
+}
@@ -0,0 +1,42 @@
+package editor
+
+import "github.com/LaurieRhodes/mcp-filesystem-go/pkg/filesystem"
+
+// SetWritableCheck sets the function edits use to decide whether a file may
+// be modified, normally FileManager.IsWritable. A nil check allows every edit.
+func (em *EditManager) SetWritableCheck(check func(path string) bool) {
+	em.writable = check
+}
+
+// SetWriteReservation sets the function edits call before writing size bytes
+// to a file, normally FileManager.ReserveWrite, so edits obey the same write
+// limits as the filesystem tools. A nil reservation allows every write.
+func (em *EditManager) SetWriteReservation(reserve func(path string, size int64) (func(), error)) {
+	em.reserve = reserve
+}
+
+// writeFile atomically replaces a file's content once the write reservation
+// allows it, cancelling the reservation if the write fails
+func (em *EditManager) writeFile(filePath string, content []byte) error {
+	cancel := func() {}
+	if em.reserve != nil {
+		var err error
+		if cancel, err = em.reserve(filePath, int64(len(content))); err != nil {
+			return err
+		}
+	}
+
+	if err := filesystem.AtomicWrite(filePath, content, em.fileMode); err != nil {
+		cancel()
+		return err
+	}
+	return nil
+}
+
+// checkWritable returns filesystem.ErrReadOnly if the writable check refuses filePath
+func (em *EditManager) checkWritable(filePath string) error {
+	if em.writable != nil && !em.writable(filePath) {
+		return filesystem.ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultMaxHistory is how many edits are kept for undo unless configured otherwise
+const DefaultMaxHistory = 100
+
+// SetRetention sets how many edits are kept for undo (0 = DefaultMaxHistory)
+// and how long backups are kept (0 = until they fall out of the history).
+// The history is pruned straight away, and backup files older than
+// maxBackupAge that nothing refers to any more, such as those left by earlier
+// runs, are removed in the background.
+func (em *EditManager) SetRetention(maxHistory int, maxBackupAge time.Duration) {
+	if maxHistory <= 0 {
+		maxHistory = DefaultMaxHistory
+	}
+	if maxBackupAge < 0 {
+		maxBackupAge = 0
+	}
+
+	em.historyMutex.Lock()
+	em.maxHistory, em.maxBackupAge = maxHistory, maxBackupAge
+	em.trimHistory()
+	em.saveHistory()
+	em.historyMutex.Unlock()
+
+	if maxBackupAge > 0 {
+		go em.removeExpiredBackups()
+	}
+}
+
+// expired reports whether an entry is older than the backup age limit
+func (em *EditManager) expired(entry EditHistory, now time.Time) bool {
+	return em.maxBackupAge > 0 && now.Sub(entry.Timestamp) > em.maxBackupAge
+}
+
+// removeExpiredBackups deletes backup files older than maxBackupAge that no
+// history or redo entry refers to
+func (em *EditManager) removeExpiredBackups() {
+	backups, err := filepath.Glob(filepath.Join(em.backupDir, "*.bak"))
+	if err != nil {
+		return
+	}
+
+	em.historyMutex.Lock()
+	defer em.historyMutex.Unlock()
+
+	inUse := make(map[string]bool)
+	for _, entry := range em.history {
+		inUse[entry.BackupPath] = true
+	}
+	for _, stack := range em.redo {
+		for _, entry := range stack {
+			inUse[entry.BackupPath] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-em.maxBackupAge)
+	for _, backup := range backups {
+		info, err := os.Lstat(backup)
+		if err != nil || inUse[backup] || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove expired backup: %v\n", err)
+		}
+	}
+}
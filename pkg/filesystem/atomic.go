@@ -0,0 +1,49 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicWrite replaces the content of path with data by writing a temp file in
+// the same directory and renaming it into place, so a crash or power failure
+// leaves either the old content or the new, never a partly written file.
+// An existing file keeps its permissions; a new one gets mode. A symlink is
+// written through to its target rather than replaced.
+func AtomicWrite(path string, data []byte, mode os.FileMode) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return err
+		}
+		path = target
+	}
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	// The temp file must share the destination's filesystem for the rename to be atomic
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := file.Name()
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempPath, mode)
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+	}
+	return err
+}
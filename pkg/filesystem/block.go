@@ -0,0 +1,207 @@
+package filesystem
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Block detection modes accepted by read_enclosing_block
+const (
+	BlockModeAuto   = "auto"
+	BlockModeBraces = "braces"
+	BlockModeIndent = "indent"
+)
+
+// indentLanguages are extensions whose blocks are delimited by indentation
+var indentLanguages = map[string]bool{
+	".py":     true,
+	".yaml":   true,
+	".yml":    true,
+	".nim":    true,
+	".coffee": true,
+}
+
+// textBlock is a range of 1-indexed, inclusive line numbers
+type textBlock struct {
+	start int
+	end   int
+}
+
+// findEnclosingBlock finds the smallest block containing line (1-indexed)
+// Returns the block and the mode that found it
+func findEnclosingBlock(lines []string, line int, mode, filePath string) (textBlock, string, error) {
+	if line < 1 || line > len(lines) {
+		return textBlock{}, "", fmt.Errorf("invalid line %d; file has %d lines", line, len(lines))
+	}
+
+	switch mode {
+	case "", BlockModeAuto:
+		if !indentLanguages[strings.ToLower(filepath.Ext(filePath))] {
+			if block, ok := findBraceBlock(lines, line); ok {
+				return block, BlockModeBraces, nil
+			}
+		}
+		if block, ok := findIndentBlock(lines, line); ok {
+			return block, BlockModeIndent, nil
+		}
+	case BlockModeBraces:
+		if block, ok := findBraceBlock(lines, line); ok {
+			return block, BlockModeBraces, nil
+		}
+	case BlockModeIndent:
+		if block, ok := findIndentBlock(lines, line); ok {
+			return block, BlockModeIndent, nil
+		}
+	default:
+		return textBlock{}, "", fmt.Errorf("invalid mode %q (use %q, %q or %q)",
+			mode, BlockModeAuto, BlockModeBraces, BlockModeIndent)
+	}
+
+	return textBlock{}, "", fmt.Errorf("no enclosing block found for line %d", line)
+}
+
+// findBraceBlock finds the smallest balanced {...} block containing line.
+// Braces inside string literals and comments are ignored on a best-effort basis.
+func findBraceBlock(lines []string, line int) (textBlock, bool) {
+	var open []int // Line numbers of unmatched opening braces
+	var best textBlock
+	found := false
+	inBlockComment := false
+	var quote byte // Open string delimiter, if inside a string literal
+
+	for i, text := range lines {
+		lineNumber := i + 1
+
+		for j := 0; j < len(text); j++ {
+			c := text[j]
+
+			if inBlockComment {
+				if c == '*' && j+1 < len(text) && text[j+1] == '/' {
+					inBlockComment = false
+					j++
+				}
+				continue
+			}
+
+			if quote != 0 {
+				if c == '\\' && quote != '`' {
+					j++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+
+			switch c {
+			case '"', '\'', '`':
+				quote = c
+			case '/':
+				if j+1 < len(text) && text[j+1] == '/' {
+					j = len(text) // Rest of the line is a comment
+				} else if j+1 < len(text) && text[j+1] == '*' {
+					inBlockComment = true
+					j++
+				}
+			case '#':
+				// Treat # as a comment only at the start of a line (shell, preprocessor)
+				if strings.TrimSpace(text[:j]) == "" {
+					j = len(text)
+				}
+			case '{':
+				open = append(open, lineNumber)
+			case '}':
+				if len(open) == 0 {
+					continue
+				}
+				start := open[len(open)-1]
+				open = open[:len(open)-1]
+				if start <= line && line <= lineNumber &&
+					(!found || lineNumber-start < best.end-best.start) {
+					best = textBlock{start: start, end: lineNumber}
+					found = true
+				}
+			}
+		}
+
+		// Backtick strings may span lines; other quotes end with the line
+		if quote != '`' {
+			quote = 0
+		}
+	}
+
+	return best, found
+}
+
+// findIndentBlock finds the indentation-scoped block containing line.
+// If line is a header (the next non-blank line is indented further) the block
+// starts at line; otherwise it starts at the nearest less-indented line above.
+func findIndentBlock(lines []string, line int) (textBlock, bool) {
+	idx := line - 1
+
+	// Blank lines take the indentation of the next non-blank line
+	for idx < len(lines) && strings.TrimSpace(lines[idx]) == "" {
+		idx++
+	}
+	if idx == len(lines) {
+		return textBlock{}, false
+	}
+
+	header := idx
+	if next := nextNonBlank(lines, idx+1); next == -1 || indentWidth(lines[next]) <= indentWidth(lines[idx]) {
+		// Not a header itself: walk up to the nearest less-indented line
+		header = -1
+		for i := idx - 1; i >= 0; i-- {
+			if strings.TrimSpace(lines[i]) != "" && indentWidth(lines[i]) < indentWidth(lines[idx]) {
+				header = i
+				break
+			}
+		}
+		if header == -1 {
+			return textBlock{}, false
+		}
+	}
+
+	headerIndent := indentWidth(lines[header])
+	end := header
+	for i := header + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if indentWidth(lines[i]) <= headerIndent {
+			break
+		}
+		end = i
+	}
+
+	if end == header {
+		return textBlock{}, false
+	}
+	return textBlock{start: header + 1, end: end + 1}, true
+}
+
+// nextNonBlank returns the index of the first non-blank line at or after from, or -1
+func nextNonBlank(lines []string, from int) int {
+	for i := from; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// indentWidth returns the width of a line's leading whitespace, counting tabs as 4 columns
+func indentWidth(line string) int {
+	width := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
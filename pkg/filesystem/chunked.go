@@ -0,0 +1,251 @@
+package filesystem
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// writeSession is a chunked write in progress, accumulated in a temp file
+// next to its destination so that committing is a single rename
+type writeSession struct {
+	mutex    sync.Mutex
+	path     string // Validated destination
+	tempPath string
+	size     int64
+}
+
+// writeSessions tracks chunked writes by id
+type writeSessions struct {
+	mutex    sync.Mutex
+	sessions map[string]*writeSession
+}
+
+// session looks up a chunked write by id
+func (fm *FileManager) session(id string) (*writeSession, error) {
+	fm.writes.mutex.Lock()
+	defer fm.writes.mutex.Unlock()
+
+	session, ok := fm.writes.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown write session: %s", id)
+	}
+	return session, nil
+}
+
+// endSession forgets a chunked write and removes its temp file if still present
+func (fm *FileManager) endSession(id string, session *writeSession) {
+	fm.writes.mutex.Lock()
+	delete(fm.writes.sessions, id)
+	fm.writes.mutex.Unlock()
+
+	os.Remove(session.tempPath)
+}
+
+// BeginWrite starts a chunked write to path and returns its session id
+func (fm *FileManager) BeginWrite(path string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := fm.checkWritable(validPath); err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(validPath), "."+filepath.Base(validPath)+".*.partial")
+	if err != nil {
+		return "", fmt.Errorf("failed to start write: %w", err)
+	}
+	file.Close()
+
+	// Temp files are private; the committed file gets the configured mode
+	if err := os.Chmod(file.Name(), fm.fileMode); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to start write: %w", err)
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to create write session id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	fm.writes.mutex.Lock()
+	if fm.writes.sessions == nil {
+		fm.writes.sessions = make(map[string]*writeSession)
+	}
+	fm.writes.sessions[id] = &writeSession{path: validPath, tempPath: file.Name()}
+	fm.writes.mutex.Unlock()
+
+	return id, nil
+}
+
+// AppendChunk appends content to a chunked write and returns the total size so far
+func (fm *FileManager) AppendChunk(id, content string) (int64, error) {
+	session, err := fm.session(id)
+	if err != nil {
+		return 0, err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	// The per-file cap applies to the accumulated total, not each chunk
+	if err := fm.checkWriteSize(session.size + int64(len(content))); err != nil {
+		return session.size, err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	file, err := os.OpenFile(session.tempPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return session.size, fmt.Errorf("failed to append chunk: %w", err)
+	}
+	n, err := file.WriteString(content)
+	session.size += int64(n)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return session.size, fmt.Errorf("failed to append chunk: %w", err)
+	}
+
+	return session.size, nil
+}
+
+// CommitWrite moves the accumulated content into place and ends the session.
+// Returns the destination path and its size.
+func (fm *FileManager) CommitWrite(id string) (string, int64, error) {
+	session, err := fm.session(id)
+	if err != nil {
+		return "", 0, err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	defer fm.endSession(id, session)
+
+	// The destination may have changed (e.g. into a symlink) since the write began
+	validPath, err := fm.ValidatePath(session.path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	delta := session.size
+	if err := fm.chargeQuota(validPath, delta); err != nil {
+		return "", 0, err
+	}
+
+	err = fm.withRetry(func() error {
+		return os.Rename(session.tempPath, validPath)
+	})
+	if err != nil {
+		fm.chargeQuota(validPath, -delta)
+		return "", 0, fmt.Errorf("failed to commit write: %w", err)
+	}
+
+	return validPath, session.size, nil
+}
+
+// AbortWrite discards a chunked write
+func (fm *FileManager) AbortWrite(id string) error {
+	session, err := fm.session(id)
+	if err != nil {
+		return err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	fm.endSession(id, session)
+	return nil
+}
+
+// DefaultChunkSize is how many bytes read_file_chunk returns when no size is given
+const DefaultChunkSize = 64 << 10
+
+// FileChunk is one window of a file returned by ReadFileChunk
+type FileChunk struct {
+	Path      string `json:"path"`
+	Offset    int64  `json:"offset"`
+	Size      int    `json:"size"`      // Bytes in this chunk
+	TotalSize int64  `json:"totalSize"` // Size of the whole file
+	EOF       bool   `json:"eof"`       // No bytes remain after this chunk
+	Content   string `json:"content"`
+	Encoding  string `json:"encoding"`
+}
+
+// ReadFileChunk reads up to size bytes of path starting at offset, so large
+// files can be read in a loop without loading them whole. A size of 0 reads
+// DefaultChunkSize bytes. Offsets at or past the end return an empty chunk.
+func (fm *FileManager) ReadFileChunk(path string, offset, size int64, encoding string) (FileChunk, error) {
+	if offset < 0 || size < 0 {
+		return FileChunk{}, fmt.Errorf("offset and size must not be negative")
+	}
+	if size == 0 {
+		size = DefaultChunkSize
+	}
+	if encoding == "" {
+		encoding = EncodingUTF8
+	}
+
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return FileChunk{}, err
+	}
+
+	// A single chunk is held in memory, so it is bounded like any other read
+	if err := fm.checkReadSize(size); err != nil {
+		return FileChunk{}, err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	var file *os.File
+	err = fm.withRetry(func() error {
+		var openErr error
+		file, openErr = os.Open(validPath)
+		return openErr
+	})
+	if err != nil {
+		return FileChunk{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return FileChunk{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.IsDir() {
+		return FileChunk{}, fmt.Errorf("path is a directory: %s", path)
+	}
+
+	chunk := FileChunk{Path: path, Offset: offset, TotalSize: info.Size(), Encoding: encoding}
+	if offset < info.Size() {
+		if remaining := info.Size() - offset; size > remaining {
+			size = remaining
+		}
+		buffer := make([]byte, size)
+		n, err := file.ReadAt(buffer, offset)
+		if err != nil && err != io.EOF {
+			return FileChunk{}, fmt.Errorf("failed to read file: %w", err)
+		}
+		chunk.Size = n
+		if encoding == EncodingBase64 {
+			chunk.Content = base64.StdEncoding.EncodeToString(buffer[:n])
+		} else {
+			chunk.Content = string(buffer[:n])
+		}
+	}
+	chunk.EOF = offset+int64(chunk.Size) >= info.Size()
+
+	return chunk, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package filesystem
+
+import "errors"
+
+// diskFree is not implemented on this platform
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("free space reporting is not supported on this platform")
+}
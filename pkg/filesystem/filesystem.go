@@ -2,13 +2,24 @@ package filesystem
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // FileInfo represents metadata about a file
@@ -20,28 +31,423 @@ type FileInfo struct {
 	IsDirectory bool      `json:"isDirectory"`
 	IsFile      bool      `json:"isFile"`
 	Permissions string    `json:"permissions"`
+	ContentType string    `json:"contentType,omitempty"` // Detected MIME type; empty for directories
+}
+
+// DefaultMaxEntries bounds how many entries a single recursive operation may visit
+const DefaultMaxEntries = 100000
+
+// ErrTooManyEntries is returned when a recursive operation exceeds the entry limit
+var ErrTooManyEntries = errors.New("too many entries")
+
+// AllowedDirectory is an allowed directory with its per-directory settings
+type AllowedDirectory struct {
+	Path           string
+	MaxSearchDepth int   // Deepest level a search below this directory may reach (-1 = unlimited)
+	WriteQuota     int64 // Bytes this server may write into this directory, less deletions (0 = unlimited)
+	ReadOnly       bool  // Refuse writes, edits, moves and deletes below this directory
 }
 
 // FileManager handles filesystem operations with security checks
 type FileManager struct {
-	allowedDirectories []string
-	originalDirectories []string // Store original paths for display
+	allowedDirectories  []string
+	originalDirectories []string           // Store original paths for display
+	directorySettings   []AllowedDirectory // Per-directory settings, parallel to allowedDirectories
+	maxEntries          int                // Limit on entries visited by one recursive operation (0 = unlimited)
+	retryPolicy         RetryPolicy
+	hiddenDirectories   []string // Directory names omitted from listings and walks
+	maxWriteBytes       int64    // Largest file a single write may produce (0 = unlimited)
+	quotaMu             sync.Mutex
+	quotaUsed           []int64          // Bytes written into each allowed directory less deletions, parallel to allowedDirectories
+	baseDirectory       string           // Directory relative paths resolve against (empty = working directory)
+	openFiles           *openFileLimiter // Bounds simultaneously open files (nil = unlimited)
+	writes              writeSessions    // Chunked writes in progress
+	bareFilenameRoot    string           // Directory bare filenames resolve against (empty = like other relative paths)
+	maxWait             time.Duration    // Longest wait_for_file may block
+	maxSearchFileBytes  int64            // Largest file search_content scans
+	deniedPatterns      []string         // Globs; paths with a matching component are refused
+	maxReadBytes        int64            // Largest read that loads a whole file or range into memory (0 = unlimited)
+	fileMode            os.FileMode      // Permissions for files this server creates
+	dirMode             os.FileMode      // Permissions for directories this server creates
+	appends             pathMutexes      // Serializes append_file calls per file
+}
+
+// pathMutexes hands out one mutex per validated path
+type pathMutexes struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock locks the mutex for path and returns its unlock function
+func (p *pathMutexes) lock(path string) func() {
+	p.mutex.Lock()
+	if p.locks == nil {
+		p.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := p.locks[path]
+	if !ok {
+		lock = &sync.Mutex{}
+		p.locks[path] = lock
+	}
+	p.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
 }
 
 // NewFileManager creates a new FileManager with the given allowed directories
 func NewFileManager(allowedDirs []string) *FileManager {
+	dirs := make([]AllowedDirectory, len(allowedDirs))
+	for i, dir := range allowedDirs {
+		dirs[i] = AllowedDirectory{Path: dir, MaxSearchDepth: -1}
+	}
+	return NewFileManagerWithDirectories(dirs)
+}
+
+// NewFileManagerWithDenyList creates a new FileManager with the given allowed
+// directories that refuses paths matching any of the denied patterns
+func NewFileManagerWithDenyList(allowedDirs, deniedPatterns []string) *FileManager {
+	fm := NewFileManager(allowedDirs)
+	fm.SetDeniedPatterns(deniedPatterns)
+	return fm
+}
+
+// NewFileManagerWithDirectories creates a new FileManager with per-directory settings
+func NewFileManagerWithDirectories(allowedDirs []AllowedDirectory) *FileManager {
 	// Normalize all paths consistently for comparison
 	normalizedDirs := make([]string, len(allowedDirs))
 	originalDirs := make([]string, len(allowedDirs))
 	for i, dir := range allowedDirs {
-		normalizedDirs[i] = normalizePath(filepath.Clean(dir))
-		originalDirs[i] = dir // Store original path for display
+		normalizedDirs[i] = normalizePath(filepath.Clean(dir.Path))
+		originalDirs[i] = dir.Path // Store original path for display
 	}
 
 	return &FileManager{
-		allowedDirectories: normalizedDirs,
+		allowedDirectories:  normalizedDirs,
 		originalDirectories: originalDirs,
+		directorySettings:   allowedDirs,
+		maxEntries:          DefaultMaxEntries,
+		maxWait:             DefaultMaxWait,
+		maxSearchFileBytes:  DefaultMaxSearchFileBytes,
+		maxReadBytes:        DefaultMaxReadBytes,
+		fileMode:            DefaultFileMode,
+		dirMode:             DefaultDirMode,
+		quotaUsed:           make([]int64, len(allowedDirs)),
+	}
+}
+
+// rootIndex returns the index of the allowed directory containing path,
+// preferring the most specific one when directories are nested, or -1
+func (fm *FileManager) rootIndex(path string) int {
+	normalized := normalizePath(path)
+	best := -1
+	for i, dir := range fm.allowedDirectories {
+		if isWithinDirectory(normalized, dir) && (best == -1 || len(dir) > len(fm.allowedDirectories[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+// searchDepthLimit returns the effective depth limit for a search starting at
+// validRoot, combining the requested limit with the containing directory's
+// maxSearchDepth so that configuration can only make searches stricter.
+// A result of -1 means unlimited; an error means the start is already too deep.
+func (fm *FileManager) searchDepthLimit(validRoot string, requested int) (int, error) {
+	limit := requested
+	if i := fm.rootIndex(validRoot); i != -1 {
+		if rootLimit := fm.directorySettings[i].MaxSearchDepth; rootLimit >= 0 {
+			// The configured depth counts from the allowed directory itself,
+			// so subtract how far below it the search starts
+			rel, err := filepath.Rel(fm.allowedDirectories[i], normalizePath(validRoot))
+			if err == nil && rel != "." {
+				rootLimit -= len(strings.Split(rel, string(filepath.Separator)))
+			}
+			if rootLimit < 0 {
+				return 0, fmt.Errorf("search start %s is deeper than the maxSearchDepth configured for %s",
+					validRoot, fm.originalDirectories[i])
+			}
+			if limit < 0 || rootLimit < limit {
+				limit = rootLimit
+			}
+		}
+	}
+	return limit, nil
+}
+
+// walkDepth returns how many directory levels path is below root
+// (0 for root's immediate contents)
+func walkDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return -1
+	}
+	return strings.Count(rel, string(filepath.Separator))
+}
+
+// SetMaxEntries sets how many entries a single recursive operation may visit
+// before it is aborted. Zero or a negative value disables the guard.
+func (fm *FileManager) SetMaxEntries(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	fm.maxEntries = limit
+}
+
+// SetBaseDirectory sets the directory relative paths are resolved against.
+// An empty directory restores resolution against the process working directory.
+func (fm *FileManager) SetBaseDirectory(dir string) {
+	if dir != "" {
+		dir = filepath.Clean(dir)
+	}
+	fm.baseDirectory = dir
+}
+
+// SetBareFilenameRoot makes bare filenames (no directory part, e.g. "notes.txt")
+// resolve against dir instead of the base directory. Paths with a directory
+// part, including "./notes.txt", are unaffected. An empty dir disables this.
+func (fm *FileManager) SetBareFilenameRoot(dir string) {
+	if dir != "" {
+		dir = filepath.Clean(dir)
+	}
+	fm.bareFilenameRoot = dir
+}
+
+// isBareFilename reports whether path is a plain file name with no directory part
+func isBareFilename(path string) bool {
+	return path != "" && path != "." && path != ".." && !strings.ContainsAny(path, `/\`)
+}
+
+// Default permissions for files and directories the server creates
+const (
+	DefaultFileMode os.FileMode = 0644
+	DefaultDirMode  os.FileMode = 0755
+)
+
+// SetFileModes sets the permissions used for new files and directories.
+// A zero mode restores the default. The process umask still applies.
+func (fm *FileManager) SetFileModes(fileMode, dirMode os.FileMode) {
+	if fileMode == 0 {
+		fileMode = DefaultFileMode
+	}
+	if dirMode == 0 {
+		dirMode = DefaultDirMode
+	}
+	fm.fileMode, fm.dirMode = fileMode, dirMode
+}
+
+// SetMaxWriteBytes sets the largest file size a write may produce (0 = unlimited)
+func (fm *FileManager) SetMaxWriteBytes(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	fm.maxWriteBytes = limit
+}
+
+// ErrReadOnly is returned when an operation would modify a read-only allowed directory
+var ErrReadOnly = errors.New("access denied - directory is read-only")
+
+// IsWritable reports whether path may be modified: it must be valid and must
+// not lie within an allowed directory configured as read-only
+func (fm *FileManager) IsWritable(path string) bool {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return false
+	}
+	return fm.checkWritable(validPath) == nil
+}
+
+// checkWritable returns ErrReadOnly if validPath lies within a read-only allowed directory
+func (fm *FileManager) checkWritable(validPath string) error {
+	if i := fm.rootIndex(validPath); i != -1 && fm.directorySettings[i].ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// DefaultMaxReadBytes is the largest file read_file loads unless configured otherwise
+const DefaultMaxReadBytes = 10 << 20
+
+// SetMaxReadBytes sets the largest file or range a read may load into memory (0 = unlimited)
+func (fm *FileManager) SetMaxReadBytes(limit int64) {
+	if limit < 0 {
+		limit = 0
+	}
+	fm.maxReadBytes = limit
+}
+
+// checkReadSize enforces the read size cap
+func (fm *FileManager) checkReadSize(size int64) error {
+	if fm.maxReadBytes > 0 && size > fm.maxReadBytes {
+		return fmt.Errorf("file too large: %d bytes exceeds limit %d; read it in parts with offset/length or head/tail",
+			size, fm.maxReadBytes)
+	}
+	return nil
+}
+
+// checkWriteSize enforces the per-file write size cap
+func (fm *FileManager) checkWriteSize(size int64) error {
+	if fm.maxWriteBytes > 0 && size > fm.maxWriteBytes {
+		return fmt.Errorf("file too large: %d bytes exceeds write limit %d", size, fm.maxWriteBytes)
+	}
+	return nil
+}
+
+// ReserveWrite checks that writing size bytes to path stays within the write
+// size cap and charges them to the directory's write quota, for writes made
+// outside FileManager such as the editor's. The returned function refunds the
+// charge and must be called if the write then fails.
+func (fm *FileManager) ReserveWrite(path string, size int64) (func(), error) {
+	if err := fm.checkWriteSize(size); err != nil {
+		return nil, err
+	}
+
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := fm.chargeQuota(validPath, size); err != nil {
+		return nil, err
+	}
+	return func() { fm.chargeQuota(validPath, -size) }, nil
+}
+
+// quotaRemaining returns how many more bytes may be written into the allowed
+// directory containing validPath, and false if that directory has no quota
+func (fm *FileManager) quotaRemaining(validPath string) (int64, bool) {
+	i := fm.rootIndex(validPath)
+	if i == -1 || fm.directorySettings[i].WriteQuota <= 0 {
+		return 0, false
+	}
+
+	fm.quotaMu.Lock()
+	defer fm.quotaMu.Unlock()
+	return fm.directorySettings[i].WriteQuota - fm.quotaUsed[i], true
+}
+
+// chargeQuota records delta bytes written into the allowed directory containing
+// validPath, failing if that would exceed its write quota. A negative delta
+// releases bytes, e.g. when a file shrinks or leaves the directory.
+func (fm *FileManager) chargeQuota(validPath string, delta int64) error {
+	i := fm.rootIndex(validPath)
+	if i == -1 {
+		return nil
+	}
+
+	fm.quotaMu.Lock()
+	defer fm.quotaMu.Unlock()
+
+	used := fm.quotaUsed[i] + delta
+	if quota := fm.directorySettings[i].WriteQuota; delta > 0 && quota > 0 && used > quota {
+		return fmt.Errorf("write quota exceeded for %s: writing %d bytes would use %d of %d bytes allowed",
+			fm.originalDirectories[i], delta, used, quota)
+	}
+	if used < 0 {
+		used = 0
+	}
+	fm.quotaUsed[i] = used
+	return nil
+}
+
+// existingFileSize returns the size of the regular file at path, or 0
+func existingFileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// SetHiddenDirectories sets directory names (or filepath.Match patterns such as
+// ".cache*") that are omitted from listings and recursive walks. Hidden
+// directories can still be accessed when their path is requested explicitly.
+func (fm *FileManager) SetHiddenDirectories(names []string) {
+	fm.hiddenDirectories = names
+}
+
+// isHiddenDirectory reports whether a directory name is configured as hidden
+func (fm *FileManager) isHiddenDirectory(name string) bool {
+	for _, pattern := range fm.hiddenDirectories {
+		if matched, err := filepath.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDeniedPatterns sets glob patterns for paths that are refused even inside
+// allowed directories, e.g. "*.env", ".git/" or "id_rsa". A trailing slash is
+// ignored; each pattern is matched against every path component below the
+// allowed directory.
+func (fm *FileManager) SetDeniedPatterns(patterns []string) {
+	fm.deniedPatterns = make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.TrimRight(filepath.ToSlash(pattern), "/")
+		if pattern != "" {
+			fm.deniedPatterns = append(fm.deniedPatterns, pattern)
+		}
+	}
+}
+
+// isDenied reports whether any component of path below its allowed directory
+// matches a denied pattern
+func (fm *FileManager) isDenied(path string) bool {
+	if len(fm.deniedPatterns) == 0 {
+		return false
+	}
+
+	normalized := normalizePath(path)
+	rel := normalized
+	if i := fm.rootIndex(normalized); i != -1 {
+		var err error
+		if rel, err = filepath.Rel(fm.allowedDirectories[i], normalized); err != nil || rel == "." {
+			return false
+		}
+	}
+
+	for _, component := range strings.Split(filepath.ToSlash(rel), "/") {
+		for _, pattern := range fm.deniedPatterns {
+			// Malformed patterns are refused at startup; fail closed on one anyway
+			if matched, err := filepath.Match(pattern, component); err != nil || matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// entryCounter enforces the maxEntries guard for one recursive operation
+type entryCounter struct {
+	limit int
+	count int
+}
+
+// newEntryCounter creates a counter bound to the manager's entry limit
+func (fm *FileManager) newEntryCounter() *entryCounter {
+	return &entryCounter{limit: fm.maxEntries}
+}
+
+// add records one visited entry and fails once the limit is exceeded
+func (c *entryCounter) add() error {
+	c.count++
+	if c.limit > 0 && c.count > c.limit {
+		return fmt.Errorf("%w: operation aborted after visiting more than %d entries", ErrTooManyEntries, c.limit)
+	}
+	return nil
+}
+
+// isWithinDirectory reports whether path is dir or lies below it, comparing
+// whole path segments so that /data does not contain /data-secret.
+// Both paths must already be cleaned (and normalized, when comparing roots).
+func isWithinDirectory(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		// Filesystem roots such as "/" already end in a separator
+		dir += string(filepath.Separator)
 	}
+	return strings.HasPrefix(path, dir)
 }
 
 // normalizePath normalizes a path for secure comparison
@@ -79,8 +485,9 @@ func expandHomePath(path string) (string, error) {
 	return path, nil
 }
 
-// ValidatePath checks if a path is allowed and returns its absolute path
-func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
+// absolutePath expands ~ and converts a requested path to a clean absolute
+// path without resolving symlinks or checking access
+func (fm *FileManager) absolutePath(requestedPath string) (string, error) {
 	// Expand home path if needed
 	expandedPath, err := expandHomePath(requestedPath)
 	if err != nil {
@@ -88,16 +495,31 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 	}
 
 	// Get absolute path - FIX: Properly handle relative paths
-	var absolute string
 	if !filepath.IsAbs(expandedPath) {
-		// For relative paths, convert to absolute using current working directory
+		// Bare filenames such as "notes.txt" can be anchored to a designated root
+		if fm.bareFilenameRoot != "" && isBareFilename(expandedPath) {
+			return filepath.Join(fm.bareFilenameRoot, expandedPath), nil
+		}
+
+		// Relative paths resolve against the configured base directory, so every
+		// tool (including batch tools) treats them the same regardless of process CWD
+		if fm.baseDirectory != "" {
+			return filepath.Join(fm.baseDirectory, filepath.Clean(expandedPath)), nil
+		}
 		cwd, err := os.Getwd()
 		if err != nil {
 			return "", fmt.Errorf("failed to get current working directory: %w", err)
 		}
-		absolute = filepath.Join(cwd, filepath.Clean(expandedPath))
-	} else {
-		absolute = filepath.Clean(expandedPath)
+		return filepath.Join(cwd, filepath.Clean(expandedPath)), nil
+	}
+	return filepath.Clean(expandedPath), nil
+}
+
+// ValidatePath checks if a path is allowed and returns its absolute path
+func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
+	absolute, err := fm.absolutePath(requestedPath)
+	if err != nil {
+		return "", err
 	}
 
 	// Check if path is within allowed directories
@@ -105,7 +527,7 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 	isAllowed := false
 
 	for _, dir := range fm.allowedDirectories {
-		if strings.HasPrefix(normalizedRequested, dir) {
+		if isWithinDirectory(normalizedRequested, dir) {
 			isAllowed = true
 			break
 		}
@@ -115,6 +537,10 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 		return "", fmt.Errorf("access denied - path outside allowed directories: %s", absolute)
 	}
 
+	if fm.isDenied(absolute) {
+		return "", fmt.Errorf("access denied - path matches deny rule: %s", absolute)
+	}
+
 	// Handle symlinks by checking their real path
 	realPath, err := filepath.EvalSymlinks(absolute)
 	if err != nil {
@@ -138,7 +564,7 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 		parentAllowed := false
 		
 		for _, dir := range fm.allowedDirectories {
-			if strings.HasPrefix(normalizedParent, dir) {
+			if isWithinDirectory(normalizedParent, dir) {
 				parentAllowed = true
 				break
 			}
@@ -147,6 +573,10 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 		if !parentAllowed {
 			return "", fmt.Errorf("access denied - parent directory outside allowed directories")
 		}
+
+		if fm.isDenied(realParentPath) {
+			return "", fmt.Errorf("access denied - path matches deny rule: %s", absolute)
+		}
 		
 		return absolute, nil
 	}
@@ -156,7 +586,7 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 	realPathAllowed := false
 	
 	for _, dir := range fm.allowedDirectories {
-		if strings.HasPrefix(normalizedReal, dir) {
+		if isWithinDirectory(normalizedReal, dir) {
 			realPathAllowed = true
 			break
 		}
@@ -165,6 +595,10 @@ func (fm *FileManager) ValidatePath(requestedPath string) (string, error) {
 	if !realPathAllowed {
 		return "", fmt.Errorf("access denied - symlink target outside allowed directories")
 	}
+
+	if fm.isDenied(realPath) {
+		return "", fmt.Errorf("access denied - path matches deny rule: %s", absolute)
+	}
 	
 	return realPath, nil
 }
@@ -176,6 +610,39 @@ var ReadFileSchema = map[string]interface{}{
 		"path": map[string]interface{}{
 			"type": "string",
 		},
+		"expand_tabs": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Render tabs as spaces in the returned content; the file itself is not changed",
+		},
+		"tab_width": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Columns between tab stops when expand_tabs is set (default %d)", DefaultTabWidth),
+		},
+		"as_lines": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Return JSON with a 'lines' array (without line terminators) and a 'trailingNewline' flag instead of one string",
+		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional byte offset to start reading from; an offset past the end of the file returns empty content",
+		},
+		"length": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional maximum number of bytes to read from offset (default: to the end of the file)",
+		},
+		"head": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional: return only the first N lines (cannot be combined with tail)",
+		},
+		"tail": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional: return only the last N lines (cannot be combined with head)",
+		},
+		"encoding": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{EncodingUTF8, EncodingBase64},
+			"description": "'utf8' returns the content as text (default); 'base64' returns it base64-encoded so binary files round-trip",
+		},
 	},
 	"required": []string{"path"},
 }
@@ -190,6 +657,11 @@ var ReadMultipleFilesSchema = map[string]interface{}{
 				"type": "string",
 			},
 		},
+		"format": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{MultiReadFormatText, MultiReadFormatJSON},
+			"description": "'text' concatenates the files with '---' separators (default); 'json' returns an array of {path, content, error} objects",
+		},
 	},
 	"required": []string{"paths"},
 }
@@ -204,6 +676,16 @@ var WriteFileSchema = map[string]interface{}{
 		"content": map[string]interface{}{
 			"type": "string",
 		},
+		"trailing_newline": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{TrailingNewlinePreserve, TrailingNewlineEnsure, TrailingNewlineStrip},
+			"description": "'preserve' writes content verbatim (default), 'ensure' ends the file with exactly one newline, 'strip' removes all trailing newlines",
+		},
+		"encoding": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{EncodingUTF8, EncodingBase64},
+			"description": "'utf8' writes content as text (default); 'base64' decodes content first, for binary files",
+		},
 	},
 	"required": []string{"path", "content"},
 }
@@ -219,6 +701,44 @@ var CreateDirectorySchema = map[string]interface{}{
 	"required": []string{"path"},
 }
 
+// TouchFileSchema defines the schema for touch_file tool input
+var TouchFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// CreateSymlinkSchema defines the schema for create_symlink tool input
+var CreateSymlinkSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Where to create the link",
+		},
+		"target": map[string]interface{}{
+			"type":        "string",
+			"description": "What the link points to; a relative target is resolved from the link's directory",
+		},
+	},
+	"required": []string{"path", "target"},
+}
+
+// ReadLinkSchema defines the schema for read_link tool input
+var ReadLinkSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"path"},
+}
+
 // ListDirectorySchema defines the schema for list_directory tool input
 var ListDirectorySchema = map[string]interface{}{
 	"type": "object",
@@ -226,6 +746,19 @@ var ListDirectorySchema = map[string]interface{}{
 		"path": map[string]interface{}{
 			"type": "string",
 		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "Number of entries to skip (default 0)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum number of entries to list (default: all)",
+		},
+		"sort_by": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{ListSortName, ListSortSize, ListSortModified},
+			"description": "'name' (default), 'size' (largest first) or 'modified' (most recent first)",
+		},
 	},
 	"required": []string{"path"},
 }
@@ -254,6 +787,14 @@ var SearchFilesSchema = map[string]interface{}{
 		"pattern": map[string]interface{}{
 			"type": "string",
 		},
+		"regex": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Treat pattern as a case-sensitive regular expression matched against each name (default: case-insensitive substring)",
+		},
+		"max_depth": map[string]interface{}{
+			"type":        "integer",
+			"description": "Deepest level below path to search (0 = immediate contents only; default unlimited)",
+		},
 	},
 	"required": []string{"path", "pattern"},
 }
@@ -276,480 +817,4070 @@ var ListAllowedDirectoriesSchema = map[string]interface{}{
 	"required": []string{},
 }
 
-// FilesystemTool defines the schema for a filesystem tool
-type FilesystemTool struct {
-	Name        string
-	Description string
-	InputSchema map[string]interface{}
+// SameFileSchema defines the schema for same_file tool input
+var SameFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path1": map[string]interface{}{
+			"type": "string",
+		},
+		"path2": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"path1", "path2"},
 }
 
-// FilesystemTools is a map of tool definitions
-var FilesystemTools = map[string]FilesystemTool{
-	"read_file": {
-		Name: "read_file",
-		Description: "Read the complete contents of a file from the file system. " +
-			"Handles various text encodings and provides detailed error messages " +
-			"if the file cannot be read. Use this tool when you need to examine " +
-			"the contents of a single file. Only works within allowed directories.",
-		InputSchema: ReadFileSchema,
-	},
-	"read_multiple_files": {
-		Name: "read_multiple_files",
-		Description: "Read the contents of multiple files simultaneously. This is more " +
-			"efficient than reading files one by one when you need to analyze " +
-			"or compare multiple files. Each file's content is returned with its " +
-			"path as a reference. Failed reads for individual files won't stop " +
-			"the entire operation. Only works within allowed directories.",
-		InputSchema: ReadMultipleFilesSchema,
+// ClassifyFileSchema defines the schema for classify_file tool input
+var ClassifyFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
 	},
-	"write_file": {
-		Name: "write_file",
-		Description: "Create a new file or completely overwrite an existing file with new content. " +
-			"Use with caution as it will overwrite existing files without warning. " +
-			"Handles text content with proper encoding. Only works within allowed directories.",
-		InputSchema: WriteFileSchema,
+	"required": []string{"path"},
+}
+
+// CreateTempFileSchema defines the schema for create_temp_file tool input
+var CreateTempFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"directory": map[string]interface{}{
+			"type":        "string",
+			"description": "Directory to create the file in",
+		},
+		"prefix": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional file name prefix",
+		},
+		"suffix": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional file name suffix, e.g. '.txt'",
+		},
 	},
-	"create_directory": {
-		Name: "create_directory",
-		Description: "Create a new directory or ensure a directory exists. Can create multiple " +
-			"nested directories in one operation. If the directory already exists, " +
-			"this operation will succeed silently. Perfect for setting up directory " +
-			"structures for projects or ensuring required paths exist. Only works within allowed directories.",
-		InputSchema: CreateDirectorySchema,
+	"required": []string{"directory"},
+}
+
+// ReadEnclosingBlockSchema defines the schema for read_enclosing_block tool input
+var ReadEnclosingBlockSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"line": map[string]interface{}{
+			"type":        "integer",
+			"description": "1-based line number to find the enclosing block for",
+		},
+		"mode": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{BlockModeAuto, BlockModeBraces, BlockModeIndent},
+			"description": "'braces' for {...} languages, 'indent' for indentation-scoped files, 'auto' (default) picks by extension",
+		},
 	},
-	"list_directory": {
-		Name: "list_directory",
-		Description: "Get a detailed listing of all files and directories in a specified path. " +
-			"Results clearly distinguish between files and directories with [FILE] and [DIR] " +
-			"prefixes. This tool is essential for understanding directory structure and " +
-			"finding specific files within a directory. Only works within allowed directories.",
-		InputSchema: ListDirectorySchema,
+	"required": []string{"path", "line"},
+}
+
+// CanWriteSchema defines the schema for can_write tool input
+var CanWriteSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"bytes": map[string]interface{}{
+			"type":        "integer",
+			"description": "Proposed size of the file after the write, in bytes",
+		},
 	},
-	"move_file": {
-		Name: "move_file",
-		Description: "Move or rename files and directories. Can move files between directories " +
-			"and rename them in a single operation. If the destination exists, the " +
-			"operation will fail. Works across different directories and can be used " +
-			"for simple renaming within the same directory. Both source and destination must be within allowed directories.",
-		InputSchema: MoveFileSchema,
+	"required": []string{"path", "bytes"},
+}
+
+// ReadWithIncludesSchema defines the schema for read_with_includes tool input
+var ReadWithIncludesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"pattern": map[string]interface{}{
+			"type":        "string",
+			"description": "Regular expression matching an include directive; its first capture group is the referenced path. Matched per line. Defaults to C-style #include \"file\"",
+		},
+		"max_depth": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Maximum include nesting depth (default %d, at most %d)", DefaultIncludeDepth, MaxIncludeDepth),
+		},
 	},
-	"search_files": {
-		Name: "search_files",
-		Description: "Recursively search for files and directories matching a pattern. " +
-			"Searches through all subdirectories from the starting path. The search " +
-			"is case-insensitive and matches partial names. Returns full paths to all " +
-			"matching items. Great for finding files when you don't know their exact location. " +
-			"Only searches within allowed directories.",
-		InputSchema: SearchFilesSchema,
+	"required": []string{"path"},
+}
+
+// RenamePatternSchema defines the schema for rename_pattern tool input
+var RenamePatternSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"directory": map[string]interface{}{
+			"type":        "string",
+			"description": "Directory whose entries are renamed (not recursive)",
+		},
+		"match": map[string]interface{}{
+			"type":        "string",
+			"description": "Glob matched against entry names, e.g. 'foo_*.txt'. Each * and ? is a capture group",
+		},
+		"replacement": map[string]interface{}{
+			"type":        "string",
+			"description": "New name template referencing captures as $1, $2, e.g. 'bar_$1.txt'. Write ${1} when the number is followed by a letter, digit or underscore ('${1}_old.txt'); a reference to a capture the match lacks, or a new name with nothing before its extension, is rejected",
+		},
+		"dry_run": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Only report the planned renames without changing anything",
+		},
 	},
-	"get_file_info": {
-		Name: "get_file_info",
-		Description: "Retrieve detailed metadata about a file or directory. Returns JSON with an 'exists' field:\n" +
-			"- If file exists: Returns metadata (size, modified, permissions, lines, etc.)\n" +
-			"- If file doesn't exist: Returns {\"exists\": false} (NOT an error)\n\n" +
-			"This makes it easy to check if a file exists before creating or editing it. " +
-			"For text files, includes a 'lines' field with the line count for easy appending. " +
-			"Only works within allowed directories.",
-		InputSchema: GetFileInfoSchema,
+	"required": []string{"directory", "match", "replacement"},
+}
+
+// TextStatsSchema defines the schema for text_stats tool input
+var TextStatsSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
 	},
-	"list_allowed_directories": {
-		Name: "list_allowed_directories",
-		Description: "Returns the list of directories that this server is allowed to access. " +
-			"Use this to understand which directories are available before trying to access files.",
-		InputSchema: ListAllowedDirectoriesSchema,
+	"required": []string{"path"},
+}
+
+// LatestModificationSchema defines the schema for latest_modification tool input
+var LatestModificationSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"max_depth": map[string]interface{}{
+			"type":        "integer",
+			"description": "Deepest level below path to examine (0 = immediate contents only; default unlimited)",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// VerifyManifestSchema defines the schema for verify_manifest tool input
+var VerifyManifestSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"directory": map[string]interface{}{
+			"type":        "string",
+			"description": "Directory the manifest describes; relative manifest paths resolve against it",
+		},
+		"manifest": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{"type": "string"},
+					"hash": map[string]interface{}{"type": "string", "description": "Expected hex digest, optionally prefixed with the algorithm, e.g. 'sha256:...'"},
+				},
+				"required": []string{"path", "hash"},
+			},
+		},
+		"algorithm": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{HashSHA256, HashSHA512, HashSHA1, HashMD5},
+			"description": "Hash algorithm for entries without a prefix (default sha256)",
+		},
+		"report_extra": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Also list files in the directory that are not in the manifest (default true)",
+		},
+	},
+	"required": []string{"directory", "manifest"},
+}
+
+// BeginWriteSchema defines the schema for begin_write tool input
+var BeginWriteSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Destination file, created or replaced on commit_write",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// AppendChunkSchema defines the schema for append_chunk tool input
+var AppendChunkSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"write_id": map[string]interface{}{
+			"type":        "string",
+			"description": "Session id returned by begin_write",
+		},
+		"content": map[string]interface{}{
+			"type":        "string",
+			"description": "Next piece of the file, appended as-is",
+		},
+	},
+	"required": []string{"write_id", "content"},
+}
+
+// WriteSessionSchema defines the schema for commit_write and abort_write tool input
+var WriteSessionSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"write_id": map[string]interface{}{
+			"type":        "string",
+			"description": "Session id returned by begin_write",
+		},
+	},
+	"required": []string{"write_id"},
+}
+
+// WhichRootSchema defines the schema for which_root tool input
+var WhichRootSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// ReadFileFullSchema defines the schema for read_file_full tool input
+var ReadFileFullSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"max_bytes": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Largest amount of content to return; longer files are truncated (default %d)", DefaultReadFullMaxBytes),
+		},
 	},
+	"required": []string{"path"},
+}
+
+// JSONGetSchema defines the schema for json_get tool input
+var JSONGetSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"query": map[string]interface{}{
+			"type":        "string",
+			"description": "Keys and array indexes or slices, e.g. 'items[10:20]' or 'servers[0].name' (empty = whole document)",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// WaitForFileSchema defines the schema for wait_for_file tool input
+var WaitForFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"timeout_ms": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("How long to wait in milliseconds (default %d, capped by the server's maxWaitMs)", DefaultWaitTimeout.Milliseconds()),
+		},
+	},
+	"required": []string{"path"},
+}
+
+// WatchFileSchema defines the schema for watch_file tool input
+var WatchFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"timeout_seconds": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("How long to wait in seconds (default %d, capped by the server's maxWaitMs)", int(DefaultWaitTimeout.Seconds())),
+		},
+	},
+	"required": []string{"path"},
+}
+
+// CompareDirectoriesSchema defines the schema for compare_directories tool input
+var CompareDirectoriesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path_a": map[string]interface{}{
+			"type": "string",
+		},
+		"path_b": map[string]interface{}{
+			"type": "string",
+		},
+		"ignore_mtimes": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Hash every pair of same-sized files instead of treating equal size and modification time as identical",
+		},
+	},
+	"required": []string{"path_a", "path_b"},
+}
+
+// ReadBetweenMarkersSchema defines the schema for read_between_markers tool input
+var ReadBetweenMarkersSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"start_marker": map[string]interface{}{
+			"type":        "string",
+			"description": "Text identifying the line that opens the region, e.g. 'BEGIN GENERATED'",
+		},
+		"end_marker": map[string]interface{}{
+			"type":        "string",
+			"description": "Text identifying the line that closes the region, e.g. 'END GENERATED'",
+		},
+		"inclusive": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Include the marker lines themselves (default false)",
+		},
+	},
+	"required": []string{"path", "start_marker", "end_marker"},
+}
+
+// DeleteDirectorySchema defines the schema for delete_directory tool input
+var DeleteDirectorySchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"recursive": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Delete the directory and everything beneath it (default false: only empty directories are deleted)",
+			"default":     false,
+		},
+	},
+	"required": []string{"path"},
+}
+
+// CopyFileSchema defines the schema for copy_file tool input
+var CopyFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"source": map[string]interface{}{
+			"type": "string",
+		},
+		"destination": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"source", "destination"},
+}
+
+// AppendFileSchema defines the schema for append_file tool input
+var AppendFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"content": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"path", "content"},
+}
+
+// SearchContentSchema defines the schema for search_content tool input
+var SearchContentSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"pattern": map[string]interface{}{
+			"type":        "string",
+			"description": "Text to search for in file contents",
+		},
+		"case_sensitive": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Match the pattern's case exactly (default false)",
+		},
+		"max_matches": map[string]interface{}{
+			"type":        "integer",
+			"description": "Stop scanning a file after this many matching lines and note the truncation (default unlimited)",
+		},
+		"names_only": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Return only the paths of files with at least one match, like grep -l",
+		},
+		"regex": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Treat pattern as a regular expression instead of literal text",
+		},
+	},
+	"required": []string{"path", "pattern"},
+}
+
+// FindInFileSchema defines the schema for find_in_file tool input
+var FindInFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"pattern": map[string]interface{}{
+			"type":        "string",
+			"description": "Text to search for in the file",
+		},
+		"case_sensitive": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Match the pattern's case exactly (default false)",
+		},
+		"max_matches": map[string]interface{}{
+			"type":        "integer",
+			"description": "Stop scanning after this many matching lines and note the truncation (default unlimited)",
+		},
+		"regex": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Treat pattern as a regular expression instead of literal text",
+		},
+	},
+	"required": []string{"path", "pattern"},
+}
+
+// GlobFilesSchema defines the schema for glob_files tool input
+var GlobFilesSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"pattern": map[string]interface{}{
+			"type":        "string",
+			"description": "Shell-style glob relative to path, e.g. '*.go' or '**/*.json'; '**' matches any number of directories",
+		},
+	},
+	"required": []string{"path", "pattern"},
+}
+
+// DirectoryTreeSchema defines the schema for directory_tree tool input
+var DirectoryTreeSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"max_depth": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Deepest level below path whose contents are listed (0 = immediate contents only; default %d)", DefaultTreeDepth),
+		},
+	},
+	"required": []string{"path"},
+}
+
+// HashFileSchema defines the schema for hash_file tool input
+var HashFileSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"algorithm": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{HashSHA256, HashSHA512, HashSHA1, HashMD5},
+			"description": "Hash algorithm (default sha256)",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// ReadFileChunkSchema defines the schema for read_file_chunk tool input
+var ReadFileChunkSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     0,
+			"description": "Byte offset to start reading from (default 0)",
+		},
+		"size": map[string]interface{}{
+			"type":        "integer",
+			"minimum":     0,
+			"description": "Maximum bytes to return (default 65536)",
+		},
+		"encoding": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{EncodingUTF8, EncodingBase64},
+			"description": "Return the chunk as text (utf8, default) or base64 for binary files",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// GetDirectorySizeSchema defines the schema for get_directory_size tool input
+var GetDirectorySizeSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"path": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"required": []string{"path"},
+}
+
+// FilesystemTool defines the schema for a filesystem tool
+type FilesystemTool struct {
+	Name        string
+	Description string
+	InputSchema map[string]interface{}
+}
+
+// FilesystemTools is a map of tool definitions
+var FilesystemTools = map[string]FilesystemTool{
+	"read_file": {
+		Name: "read_file",
+		Description: "Read the complete contents of a file from the file system. " +
+			"Handles various text encodings and provides detailed error messages " +
+			"if the file cannot be read. Use this tool when you need to examine " +
+			"the contents of a single file. Set 'expand_tabs' to get tabs rendered as spaces " +
+			"aligned to 'tab_width' columns, without modifying the file. Set 'as_lines' to get a JSON array " +
+			"of lines plus whether the file ends with a newline. Use 'offset' and 'length' to page through " +
+			"a large file by bytes, or 'head'/'tail' to get only its first or last N lines. " +
+			"Set 'encoding' to 'base64' to read binary files such as images intact. " +
+			"Only works within allowed directories.",
+		InputSchema: ReadFileSchema,
+	},
+	"read_multiple_files": {
+		Name: "read_multiple_files",
+		Description: "Read the contents of multiple files simultaneously. This is more " +
+			"efficient than reading files one by one when you need to analyze " +
+			"or compare multiple files. Each file's content is returned with its " +
+			"path as a reference. Failed reads for individual files won't stop " +
+			"the entire operation. Set 'format' to 'json' to get an array of objects with 'path', " +
+			"'content' and, for failed reads, 'error'. Only works within allowed directories.",
+		InputSchema: ReadMultipleFilesSchema,
+	},
+	"write_file": {
+		Name: "write_file",
+		Description: "Create a new file or completely overwrite an existing file with new content. " +
+			"Use with caution as it will overwrite existing files without warning. " +
+			"Handles text content with proper encoding; set 'encoding' to 'base64' to write binary " +
+			"content. Only works within allowed directories.",
+		InputSchema: WriteFileSchema,
+	},
+	"create_directory": {
+		Name: "create_directory",
+		Description: "Create a new directory or ensure a directory exists. Can create multiple " +
+			"nested directories in one operation. If the directory already exists, " +
+			"this operation will succeed silently. Perfect for setting up directory " +
+			"structures for projects or ensuring required paths exist. Only works within allowed directories.",
+		InputSchema: CreateDirectorySchema,
+	},
+	"touch_file": {
+		Name: "touch_file",
+		Description: "Create an empty file, or set the modification time of an existing file or directory " +
+			"to now without changing its content. Useful for placeholder files and for build tools that " +
+			"compare timestamps. The parent directory must exist. Only works within allowed directories.",
+		InputSchema: TouchFileSchema,
+	},
+	"create_symlink": {
+		Name: "create_symlink",
+		Description: "Create a symbolic link at 'path' pointing to 'target'. A relative target is stored as " +
+			"given and resolved from the link's directory. Both the link and the resolved target must be within " +
+			"allowed directories; the target need not exist yet. Fails if 'path' already exists.",
+		InputSchema: CreateSymlinkSchema,
+	},
+	"read_link": {
+		Name: "read_link",
+		Description: "Return the target of a symbolic link exactly as stored in the link, without resolving " +
+			"it. Fails if the path is not a symlink. Only works within allowed directories.",
+		InputSchema: ReadLinkSchema,
+	},
+	"list_directory": {
+		Name: "list_directory",
+		Description: "Get a detailed listing of all files and directories in a specified path. " +
+			"Results clearly distinguish between files and directories with [FILE] and [DIR] " +
+			"prefixes. This tool is essential for understanding directory structure and " +
+			"finding specific files within a directory. For large directories, pass 'offset' and 'limit' " +
+			"to list one page of entries, followed by a line with the total count, and 'sort_by' to list " +
+			"by size or modification time. Only works within allowed directories.",
+		InputSchema: ListDirectorySchema,
+	},
+	"move_file": {
+		Name: "move_file",
+		Description: "Move or rename files and directories. Can move files between directories " +
+			"and rename them in a single operation. If the destination exists, the " +
+			"operation will fail. Works across different directories and can be used " +
+			"for simple renaming within the same directory. Both source and destination must be within allowed directories.",
+		InputSchema: MoveFileSchema,
+	},
+	"search_files": {
+		Name: "search_files",
+		Description: "Recursively search for files and directories matching a pattern. " +
+			"Searches through all subdirectories from the starting path. The search " +
+			"is case-insensitive and matches partial names; set 'regex' to match names " +
+			"against a regular expression instead. Set 'max_depth' to stop descending below that many " +
+			"levels. Returns full paths to all matching items. Great for finding files when you " +
+			"don't know their exact location. " +
+			"Only searches within allowed directories.",
+		InputSchema: SearchFilesSchema,
+	},
+	"get_file_info": {
+		Name: "get_file_info",
+		Description: "Retrieve detailed metadata about a file or directory. Returns JSON with an 'exists' field:\n" +
+			"- If file exists: Returns metadata (size, modified, permissions, lines, etc.)\n" +
+			"- If file doesn't exist: Returns {\"exists\": false} (NOT an error)\n\n" +
+			"This makes it easy to check if a file exists before creating or editing it. " +
+			"For text files, includes a 'lines' field with the line count for easy appending. " +
+			"Files also get a 'contentType' MIME type detected from their first bytes, so you can tell " +
+			"text from binary before reading. Only works within allowed directories.",
+		InputSchema: GetFileInfoSchema,
+	},
+	"list_allowed_directories": {
+		Name: "list_allowed_directories",
+		Description: "Returns the list of directories that this server is allowed to access. " +
+			"Use this to understand which directories are available before trying to access files.",
+		InputSchema: ListAllowedDirectoriesSchema,
+	},
+	"list_tool_capabilities": {
+		Name: "list_tool_capabilities",
+		Description: "Returns JSON classifying every tool as 'read-only', 'mutating' (creates or changes " +
+			"files, edits can be undone) or 'destructive' (may overwrite or remove existing data). Use this " +
+			"to restrict an agent to read-only tools or decide which calls need approval. The same " +
+			"classification is exposed as readOnlyHint/destructiveHint annotations in tools/list.",
+		InputSchema: ListAllowedDirectoriesSchema,
+	},
+	"same_file": {
+		Name: "same_file",
+		Description: "Check whether two paths refer to the same underlying file. Symlinks are resolved " +
+			"and, on Unix, hard links are detected by comparing device and inode. Returns JSON with " +
+			"'sameFile' and the resolved paths. Useful to detect aliasing before editing what look like " +
+			"two separate files. Both paths must be within allowed directories.",
+		InputSchema: SameFileSchema,
+	},
+	"classify_file": {
+		Name: "classify_file",
+		Description: "Cheaply classify a path before reading it. Returns JSON with 'classification' " +
+			"(one of empty, text, binary, directory, symlink) and 'size'. Binary files are detected " +
+			"by looking for NUL bytes near the start of the file. Use this to decide whether to read a " +
+			"file as text or skip it. Only works within allowed directories.",
+		InputSchema: ClassifyFileSchema,
+	},
+	"create_temp_file": {
+		Name: "create_temp_file",
+		Description: "Create a new, empty scratch file with a guaranteed-unique name inside a directory " +
+			"and return its path. The name is built from the optional prefix, a random component and " +
+			"the optional suffix. Use this instead of guessing unique names. Only works within allowed directories.",
+		InputSchema: CreateTempFileSchema,
+	},
+	"read_enclosing_block": {
+		Name: "read_enclosing_block",
+		Description: "Return the smallest block of code that contains a given line, such as the function " +
+			"around line 42. For brace-delimited languages this is the innermost balanced {...} block; for " +
+			"indentation-based files (Python, YAML) it is the indentation-scoped block under its header line. " +
+			"Returns JSON with 'startLine', 'endLine' and 'content'. Detection is lightweight and best-effort. " +
+			"Only works within allowed directories.",
+		InputSchema: ReadEnclosingBlockSchema,
+	},
+	"can_write": {
+		Name: "can_write",
+		Description: "Check whether writing a file of a given size would succeed, without writing anything. " +
+			"Checks the path against allowed directories, the per-file write size limit and the free space " +
+			"on the target volume. Returns JSON with 'canWrite', the 'reasons' it would fail and the " +
+			"remaining headroom, so large writes can be planned or split. Only works within allowed directories.",
+		InputSchema: CanWriteSchema,
+	},
+	"read_with_includes": {
+		Name: "read_with_includes",
+		Description: "Read a file and recursively inline the files it includes, returning the assembled content. " +
+			"Include directives are found with a regular expression whose first capture group is the referenced " +
+			"path; relative paths are resolved against the including file's directory. The whole matched text is " +
+			"replaced by the referenced file's content. Include cycles, nesting deeper than max_depth and assembled " +
+			"content larger than the read size limit are errors. " +
+			"Every referenced file must be within allowed directories.",
+		InputSchema: ReadWithIncludesSchema,
+	},
+	"rename_pattern": {
+		Name: "rename_pattern",
+		Description: "Rename every entry in a directory whose name matches a glob, computing each new name " +
+			"from a replacement template with capture references (e.g. 'foo_*.txt' -> 'bar_$1.txt'). All new " +
+			"names are checked for collisions before anything is renamed, and if any rename fails the completed " +
+			"ones are rolled back. Returns JSON with the old -> new mapping. Use 'dry_run' to preview. " +
+			"Only works within allowed directories.",
+		InputSchema: RenamePatternSchema,
+	},
+	"text_stats": {
+		Name: "text_stats",
+		Description: "Count lines, words, characters and bytes in a text file in one pass, like wc. Returns JSON " +
+			"with 'lines' (newline count), 'words', 'chars' (UTF-8 characters), 'bytes' and 'endsWithNewline'. " +
+			"The file is streamed, not returned. Binary files are flagged with 'binary': true and not counted. " +
+			"Only works within allowed directories.",
+		InputSchema: TextStatsSchema,
+	},
+	"latest_modification": {
+		Name: "latest_modification",
+		Description: "Find the most recently modified entry under a directory. Returns JSON with 'modified' " +
+			"(RFC 3339 timestamp), the 'path' that has it and how many 'entries' were examined. Directories " +
+			"count too, so removing a file is detected through its parent's timestamp. Use this as a cheap " +
+			"'has anything changed here' check before reprocessing a tree. Unreadable entries are skipped. " +
+			"Only works within allowed directories.",
+		InputSchema: LatestModificationSchema,
+	},
+	"verify_manifest": {
+		Name: "verify_manifest",
+		Description: "Check a directory against a manifest of expected file hashes. Each file is hashed " +
+			"(streamed, not loaded) and compared. Returns JSON listing 'matched', 'mismatched' (with expected and " +
+			"actual digests), 'missing' and, unless report_extra is false, 'extra' files not in the manifest, plus " +
+			"'ok' when everything matches. Use to confirm a workspace has not drifted from a known-good state. " +
+			"Only works within allowed directories.",
+		InputSchema: VerifyManifestSchema,
+	},
+	"begin_write": {
+		Name: "begin_write",
+		Description: "Start writing a large file in pieces. Returns a 'writeId'; send the content with " +
+			"append_chunk, then call commit_write to atomically move the assembled file into place, or " +
+			"abort_write to discard it. The destination is untouched until commit. Only works within allowed directories.",
+		InputSchema: BeginWriteSchema,
+	},
+	"append_chunk": {
+		Name: "append_chunk",
+		Description: "Append the next piece of content to a write started with begin_write. Returns the " +
+			"total bytes accumulated. The per-file write size limit applies to the accumulated total.",
+		InputSchema: AppendChunkSchema,
+	},
+	"commit_write": {
+		Name: "commit_write",
+		Description: "Finish a write started with begin_write: the destination path is validated again and " +
+			"the accumulated content replaces it in a single rename. The session ends either way.",
+		InputSchema: WriteSessionSchema,
+	},
+	"abort_write": {
+		Name: "abort_write",
+		Description: "Discard a write started with begin_write, leaving the destination untouched.",
+		InputSchema: WriteSessionSchema,
+	},
+	"which_root": {
+		Name: "which_root",
+		Description: "Report which allowed directory a path belongs to. Returns JSON with 'allowed', the " +
+			"containing 'root' (the most specific one when allowed directories are nested), its 'mode' and any " +
+			"per-directory settings such as maxSearchDepth and writeQuota. Paths outside every allowed directory " +
+			"return 'allowed': false with the reason instead of an error. The path does not need to exist.",
+		InputSchema: WhichRootSchema,
+	},
+	"read_file_full": {
+		Name: "read_file_full",
+		Description: "Read a file's content together with its complete metadata in one call. Returns JSON with " +
+			"'size', 'created', 'modified', 'accessed', 'permissions', 'mimeType', 'isBinary', 'sha256' of the whole " +
+			"file, 'trailingNewline' and 'content'. Content is omitted for binary files and cut to 'max_bytes' " +
+			"(reported as 'truncated') for large ones. Only works within allowed directories.",
+		InputSchema: ReadFileFullSchema,
+	},
+	"json_get": {
+		Name: "json_get",
+		Description: "Read part of a JSON file. The 'query' selects object keys with dots and array elements " +
+			"with [n]; a slice such as 'items[10:20]' returns that range of elements as a JSON array, and any " +
+			fmt.Sprintf("steps after a slice apply to each element. Slices return at most %d elements. ", MaxJSONSliceLength) +
+			"The file is decoded as a stream, so large arrays are not loaded whole. Only works within allowed directories.",
+		InputSchema: JSONGetSchema,
+	},
+	"wait_for_file": {
+		Name: "wait_for_file",
+		Description: "Wait until a file exists, polling until it appears or 'timeout_ms' elapses. Returns JSON with " +
+			"'appeared', 'waitedMs' and, when the file appeared, its metadata under 'info'. A timeout is not an " +
+			"error. The file's parent directory must already exist. Only works within allowed directories.",
+		InputSchema: WaitForFileSchema,
+	},
+	"watch_file": {
+		Name: "watch_file",
+		Description: "Wait until a file or directory changes, then return what changed. For a directory, a " +
+			"change to any entry directly inside it counts; a file that does not exist yet is watched for its " +
+			"creation. Returns JSON with the 'event' (create, write, remove or rename) and the 'eventPath' it " +
+			"happened to, or 'timedOut' if nothing changed within 'timeout_seconds'. A timeout is not an error. " +
+			"Only works within allowed directories.",
+		InputSchema: WatchFileSchema,
+	},
+	"compare_directories": {
+		Name: "compare_directories",
+		Description: "Compare two directory trees file by file. Returns JSON with relative paths 'onlyInA', " +
+			"'onlyInB' and 'differing' (with the reason: size or content), plus a count of identical files. " +
+			"Files of equal size are compared by SHA-256 unless their modification times also match; set " +
+			"'ignore_mtimes' to always hash them. Both directories must be within allowed directories.",
+		InputSchema: CompareDirectoriesSchema,
+	},
+	"read_between_markers": {
+		Name: "read_between_markers",
+		Description: "Read the region of a file between a line containing 'start_marker' and the next line " +
+			"containing 'end_marker', such as a generated BEGIN/END block. Returns JSON with the 'content' " +
+			"(without the marker lines unless 'inclusive' is set) and the marker line numbers. Fails if a marker " +
+			"is missing or the markers are not properly paired. Only works within allowed directories.",
+		InputSchema: ReadBetweenMarkersSchema,
+	},
+	"delete_directory": {
+		Name: "delete_directory",
+		Description: "Delete a directory. Without 'recursive' only an empty directory is deleted and a non-empty " +
+			"one is reported with the number of entries it still contains. With 'recursive' set to true the whole " +
+			"tree is deleted; every entry is checked first, and nothing is deleted if any entry (such as a symlink) " +
+			"resolves outside the allowed directories. Allowed directories themselves cannot be deleted. " +
+			"Only works within allowed directories.",
+		InputSchema: DeleteDirectorySchema,
+	},
+	"copy_file": {
+		Name: "copy_file",
+		Description: "Copy a file or directory. Directories are copied recursively. Permission bits are " +
+			"preserved and contents are streamed, so large files are never loaded into memory. If the " +
+			"destination exists, the operation will fail. Every nested path is checked before anything is " +
+			"copied. Both source and destination must be within allowed directories.",
+		InputSchema: CopyFileSchema,
+	},
+	"append_file": {
+		Name: "append_file",
+		Description: "Append content to the end of a file, creating it if it doesn't exist. " +
+			"Existing content is never overwritten, which makes this safe for logs. " +
+			"Concurrent appends to the same file are applied one at a time and never interleave. " +
+			"Only works within allowed directories.",
+		InputSchema: AppendFileSchema,
+	},
+	"search_content": {
+		Name: "search_content",
+		Description: "Recursively search the contents of text files for a pattern, like grep. " +
+			"Returns 'path:line:text' for every matching line. The search is case-insensitive " +
+			"unless 'case_sensitive' is set, and 'regex' treats the pattern as a regular expression. Use 'max_matches' to bound the matches reported per file, " +
+			"or 'names_only' to get just the files that contain a match. Binary files and files larger " +
+			"than the server's size cap are skipped. Only searches within allowed directories.",
+		InputSchema: SearchContentSchema,
+	},
+	"find_in_file": {
+		Name: "find_in_file",
+		Description: "Search one text file for a pattern, like grep on a single file. Returns 'line:text' for every " +
+			"matching line. The search is case-insensitive unless 'case_sensitive' is set, and 'regex' treats the " +
+			"pattern as a regular expression. Use 'max_matches' to stop after that many matches. The file is " +
+			"streamed, so large files can be searched. Only works within allowed directories.",
+		InputSchema: FindInFileSchema,
+	},
+	"glob_files": {
+		Name: "glob_files",
+		Description: "Find files and directories whose path relative to 'path' matches a shell-style glob. " +
+			"'*', '?' and '[...]' match within one path component, and '**' matches any number of " +
+			"directory levels, so '**/*.json' finds JSON files at any depth. Returns full paths sorted " +
+			"lexically. Only searches within allowed directories.",
+		InputSchema: GlobFilesSchema,
+	},
+	"directory_tree": {
+		Name: "directory_tree",
+		Description: "Get a recursive tree view of a directory as nested JSON. Each entry has a 'name', " +
+			"a 'type' ('file' or 'directory') and, for directories, 'children'. Directories beyond " +
+			"'max_depth' are marked 'truncated', and symlinked directories are listed but not followed. " +
+			"Only works within allowed directories.",
+		InputSchema: DirectoryTreeSchema,
+	},
+	"hash_file": {
+		Name: "hash_file",
+		Description: "Compute the hex digest of a file's contents, for checking whether a file has changed. " +
+			"Supports sha256 (default), sha512, sha1 and md5. The file is streamed, so large files are fine. " +
+			"Only works within allowed directories.",
+		InputSchema: HashFileSchema,
+	},
+	"read_file_chunk": {
+		Name: "read_file_chunk",
+		Description: "Read one window of a file: up to 'size' bytes starting at byte 'offset'. Returns JSON " +
+			"with the content, the bytes returned, the file's 'totalSize' and 'eof', so large files can be read " +
+			"in a loop by advancing offset until eof is true. Use encoding base64 for binary files, since a " +
+			"window may split a multi-byte character. Only works within allowed directories.",
+		InputSchema: ReadFileChunkSchema,
+	},
+	"get_directory_size": {
+		Name: "get_directory_size",
+		Description: "Report the total size of the files under a directory and how many there are, e.g. " +
+			"before archiving it. Returns a human-readable size (KB/MB/GB) with the exact byte count. Symbolic " +
+			"links are not followed, so nothing is counted twice, and entries that cannot be read or fall " +
+			"outside the allowed directories are skipped. Only works within allowed directories.",
+		InputSchema: GetDirectorySizeSchema,
+	},
+}
+
+// GetFileStats returns file metadata
+func GetFileStats(filePath string) (FileInfo, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	// Creation and access times come from platform-specific stat data;
+	// platforms that cannot provide them report the modification time
+	modified := info.ModTime()
+	created, accessed := fileTimes(info)
+
+	// Get file permissions in octal format
+	permissions := fmt.Sprintf("%o", info.Mode().Perm())
+
+	var contentType string
+	if !info.IsDir() {
+		contentType = sniffContentType(filePath)
+	}
+
+	return FileInfo{
+		Size:        info.Size(),
+		Created:     created,
+		Modified:    modified,
+		Accessed:    accessed,
+		IsDirectory: info.IsDir(),
+		IsFile:      !info.IsDir(),
+		Permissions: permissions,
+		ContentType: contentType,
+	}, nil
+}
+
+// SearchProgressInterval is how many entries SearchFiles scans between progress reports
+const SearchProgressInterval = 500
+
+// SearchFilesOptions controls how search_files matches names
+type SearchFilesOptions struct {
+	Regex    bool // Treat the pattern as a regular expression instead of a substring
+	MaxDepth int  // Deepest level below the root to search (0 = immediate contents, -1 = unlimited)
+	// Progress, if set, is called with the number of entries scanned so far
+	// every SearchProgressInterval entries and once when the walk ends
+	Progress func(scanned int)
+}
+
+// SearchFiles searches for files matching a pattern in a directory tree
+func SearchFiles(fm *FileManager, rootPath, pattern string, options SearchFilesOptions) ([]string, error) {
+	// Validate the root path
+	validRootPath, err := fm.ValidatePath(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compile up front so a bad expression is reported before walking
+	var nameRegex *regexp.Regexp
+	if options.Regex {
+		nameRegex, err = compileSearchPattern(pattern, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results := []string{}
+	pattern = strings.ToLower(pattern)
+	counter := fm.newEntryCounter()
+	scanned := 0
+	maxDepth, err := fm.searchDepthLimit(validRootPath, options.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(validRootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip errors and continue walking
+			return nil
+		}
+
+		// Hidden directories below the starting point are not walked
+		if d.IsDir() && path != validRootPath && fm.isHiddenDirectory(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		// Enforce the depth limit relative to the starting directory
+		if maxDepth >= 0 && walkDepth(validRootPath, path) > maxDepth {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := counter.add(); err != nil {
+			return err
+		}
+		scanned++
+		if options.Progress != nil && scanned%SearchProgressInterval == 0 {
+			options.Progress(scanned)
+		}
+
+		// Try to validate each path
+		_, validateErr := fm.ValidatePath(path)
+		if validateErr != nil {
+			// Skip this path if it's not valid
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Check if the name matches the pattern
+		if nameRegex != nil {
+			if nameRegex.MatchString(d.Name()) {
+				results = append(results, path)
+			}
+		} else if strings.Contains(strings.ToLower(d.Name()), pattern) {
+			results = append(results, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if options.Progress != nil && scanned%SearchProgressInterval != 0 {
+		options.Progress(scanned)
+	}
+
+	return results, nil
+}
+
+// ReadFile reads the contents of a file
+func (fm *FileManager) ReadFile(path string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Refuse oversized files before loading them into memory
+	if info, err := os.Stat(validPath); err == nil && !info.IsDir() {
+		if err := fm.checkReadSize(info.Size()); err != nil {
+			return "", err
+		}
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	var content []byte
+	err = fm.withRetry(func() error {
+		var readErr error
+		content, readErr = os.ReadFile(validPath)
+		return readErr
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return string(content), nil
+}
+
+// ReadFileRange reads the part of a file selected by options' Offset, Length,
+// Head and Tail without loading the rest of it. Head and Tail apply to the byte
+// range. Without any range options it behaves like ReadFile. With
+// EncodingBase64 the result is base64-encoded so binary content survives.
+func (fm *FileManager) ReadFileRange(path string, options ReadFileOptions) (string, error) {
+	content, err := fm.readFileRange(path, options)
+	if err != nil {
+		return "", err
+	}
+	if options.Encoding == EncodingBase64 {
+		return base64.StdEncoding.EncodeToString([]byte(content)), nil
+	}
+	return content, nil
+}
+
+// readFileRange reads the selected part of a file without encoding it
+func (fm *FileManager) readFileRange(path string, options ReadFileOptions) (string, error) {
+	if options.Offset == 0 && options.Length == 0 && options.Head == 0 && options.Tail == 0 {
+		return fm.ReadFile(path)
+	}
+
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	var file *os.File
+	err = fm.withRetry(func() error {
+		var openErr error
+		file, openErr = os.Open(validPath)
+		return openErr
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if options.Offset >= info.Size() {
+		return "", nil
+	}
+
+	var reader io.Reader = io.NewSectionReader(file, options.Offset, info.Size()-options.Offset)
+	remaining := info.Size() - options.Offset
+	if options.Length > 0 {
+		reader = io.LimitReader(reader, options.Length)
+		if options.Length < remaining {
+			remaining = options.Length
+		}
+	}
+	// Head and tail stream lines, so only a plain range is bounded by its size
+	if options.Head == 0 && options.Tail == 0 {
+		if err := fm.checkReadSize(remaining); err != nil {
+			return "", err
+		}
+	}
+
+	var content string
+	switch {
+	case options.Head > 0:
+		content, err = headLines(reader, options.Head)
+	case options.Tail > 0:
+		content, err = tailLines(reader, options.Tail)
+	default:
+		var data []byte
+		data, err = io.ReadAll(reader)
+		content = string(data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return content, nil
+}
+
+// headLines returns the first n lines from r, keeping their line terminators
+func headLines(r io.Reader, n int) (string, error) {
+	reader := bufio.NewReader(r)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		line, err := reader.ReadString('\n')
+		b.WriteString(line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// tailLines returns the last n lines from r, keeping their line terminators.
+// Only the most recent n lines are held in memory while scanning.
+func tailLines(r io.Reader, n int) (string, error) {
+	reader := bufio.NewReader(r)
+	ring := make([]string, n)
+	count := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			ring[count%n] = line
+			count++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	start := 0
+	if count > n {
+		start = count - n
+	}
+	var b strings.Builder
+	for i := start; i < count; i++ {
+		b.WriteString(ring[i%n])
+	}
+	return b.String(), nil
+}
+
+// Output formats accepted by read_multiple_files
+const (
+	MultiReadFormatText = "text"
+	MultiReadFormatJSON = "json"
+)
+
+// FileReadResult is the outcome of reading one file of read_multiple_files
+type FileReadResult struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Error   string `json:"error,omitempty"` // Set instead of content when the read failed
+}
+
+// ReadMultipleFiles reads the contents of multiple files
+func (fm *FileManager) ReadMultipleFiles(paths []string) (string, error) {
+	var results []string
+
+	for _, result := range fm.readFiles(paths) {
+		if result.Error != "" {
+			results = append(results, fmt.Sprintf("%s: Error - %s", result.Path, result.Error))
+		} else {
+			results = append(results, fmt.Sprintf("%s:\n%s", result.Path, result.Content))
+		}
+	}
+
+	return strings.Join(results, "\n---\n"), nil
+}
+
+// ReadMultipleFilesJSON reads the contents of multiple files, returning a
+// JSON array with one FileReadResult per path in the order given
+func (fm *FileManager) ReadMultipleFilesJSON(paths []string) (string, error) {
+	jsonResult, err := json.Marshal(fm.readFiles(paths))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode results: %w", err)
+	}
+	return string(jsonResult), nil
+}
+
+// readFiles reads each file, recording failures rather than stopping at them
+func (fm *FileManager) readFiles(paths []string) []FileReadResult {
+	results := make([]FileReadResult, 0, len(paths))
+	for _, filePath := range paths {
+		content, err := fm.ReadFile(filePath)
+		if err != nil {
+			results = append(results, FileReadResult{Path: filePath, Error: err.Error()})
+		} else {
+			results = append(results, FileReadResult{Path: filePath, Content: content})
+		}
+	}
+	return results
+}
+
+// WriteFile writes content to a file
+func (fm *FileManager) WriteFile(path, content string) error {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fm.checkWritable(validPath); err != nil {
+		return err
+	}
+
+	if err := fm.checkWriteSize(int64(len(content))); err != nil {
+		return err
+	}
+
+	// Every byte written counts against the quota, including rewrites
+	delta := int64(len(content))
+	if err := fm.chargeQuota(validPath, delta); err != nil {
+		return err
+	}
+
+	release := fm.acquireFile()
+	err = fm.withRetry(func() error {
+		return AtomicWrite(validPath, []byte(content), fm.fileMode)
+	})
+	release()
+	if err != nil {
+		fm.chargeQuota(validPath, -delta)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// Trailing newline policies accepted by write_file
+const (
+	TrailingNewlinePreserve = "preserve"
+	TrailingNewlineEnsure   = "ensure"
+	TrailingNewlineStrip    = "strip"
+)
+
+// ApplyTrailingNewline applies a trailing newline policy to content.
+// "ensure" uses CRLF when the content already contains CRLF line endings.
+func ApplyTrailingNewline(content, policy string) (string, error) {
+	switch policy {
+	case "", TrailingNewlinePreserve:
+		return content, nil
+	case TrailingNewlineStrip:
+		return strings.TrimRight(content, "\r\n"), nil
+	case TrailingNewlineEnsure:
+		if content == "" {
+			return content, nil
+		}
+		newline := "\n"
+		if strings.Contains(content, "\r\n") {
+			newline = "\r\n"
+		}
+		return strings.TrimRight(content, "\r\n") + newline, nil
+	default:
+		return "", fmt.Errorf("invalid trailing_newline %q (use %q, %q or %q)",
+			policy, TrailingNewlinePreserve, TrailingNewlineEnsure, TrailingNewlineStrip)
+	}
+}
+
+// Content encodings accepted by read_file and write_file
+const (
+	EncodingUTF8   = "utf8"
+	EncodingBase64 = "base64"
+)
+
+// ReadFileOptions controls how read_file presents a file's content
+type ReadFileOptions struct {
+	TabWidth int    // Expand tabs to this many columns (0 = leave tabs as-is)
+	AsLines  bool   // Return an array of lines instead of one string
+	Offset   int64  // Byte offset to start reading from
+	Length   int64  // Maximum bytes to read from Offset (0 = to the end)
+	Head     int    // Return only the first N lines (0 = all)
+	Tail     int    // Return only the last N lines (0 = all)
+	Encoding string // EncodingUTF8 (default) or EncodingBase64
+}
+
+// SplitContentLines splits content into lines without their LF or CRLF
+// terminators and reports whether the content ends with a newline, so that
+// joining the lines with newlines (plus one if trailingNewline) restores it
+func SplitContentLines(content string) (lines []string, trailingNewline bool) {
+	trailingNewline = strings.HasSuffix(content, "\n")
+	content = strings.TrimSuffix(content, "\n")
+	content = strings.TrimSuffix(content, "\r")
+	if content == "" && !trailingNewline {
+		return []string{}, false
+	}
+
+	lines = strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines, trailingNewline
+}
+
+// DefaultTabWidth is the tab stop interval used by read_file's expand_tabs
+const DefaultTabWidth = 8
+
+// ExpandTabs replaces each tab with spaces up to the next multiple of tabWidth
+// columns, counting columns in runes from the start of each line.
+// A tabWidth of zero or less returns content unchanged.
+func ExpandTabs(content string, tabWidth int) string {
+	if tabWidth <= 0 || !strings.Contains(content, "\t") {
+		return content
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	column := 0
+	for _, r := range content {
+		switch r {
+		case '\t':
+			spaces := tabWidth - column%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+		case '\n', '\r':
+			b.WriteRune(r)
+			column = 0
+		default:
+			b.WriteRune(r)
+			column++
+		}
+	}
+	return b.String()
+}
+
+// CreateDirectory creates a directory
+func (fm *FileManager) CreateDirectory(path string) error {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fm.checkWritable(validPath); err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(validPath, fm.dirMode)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	return nil
+}
+
+// Touch creates an empty file if path does not exist, or sets the
+// modification and access times of an existing file or directory to now.
+// Existing content is never changed.
+func (fm *FileManager) Touch(path string) error {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fm.checkWritable(validPath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(validPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fm.fileMode)
+	if err == nil {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		return nil
+	}
+	if !os.IsExist(err) {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(validPath, now, now); err != nil {
+		return fmt.Errorf("failed to update timestamps: %w", err)
+	}
+	return nil
+}
+
+// Orders accepted by list_directory's sort_by
+const (
+	ListSortName     = "name"
+	ListSortSize     = "size"     // Largest first
+	ListSortModified = "modified" // Most recently modified first
+)
+
+// ListDirectoryOptions controls the order and range of a directory listing
+type ListDirectoryOptions struct {
+	Offset int    // Entries to skip
+	Limit  int    // Most entries to list (0 = no limit)
+	SortBy string // One of the ListSort values ("" = by name)
+}
+
+// ListDirectory lists the contents of a directory.
+// Entries are listed by name unless options ask for another order; with an
+// offset or limit only that slice is listed, followed by a total count line
+func (fm *FileManager) ListDirectory(path string, options ListDirectoryOptions) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	dirEntries, err := os.ReadDir(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	entries := make([]os.DirEntry, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if entry.IsDir() && fm.isHiddenDirectory(entry.Name()) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := sortDirEntries(entries, options.SortBy); err != nil {
+		return "", err
+	}
+
+	total := len(entries)
+	paginated := options.Offset > 0 || options.Limit > 0
+	start, end := options.Offset, total
+	if start > total {
+		start = total
+	}
+	// Compare without adding, so a huge limit cannot overflow
+	if options.Limit > 0 && options.Limit < end-start {
+		end = start + options.Limit
+	}
+
+	var result []string
+	for _, entry := range entries[start:end] {
+		prefix := "[FILE]"
+		if entry.IsDir() {
+			prefix = "[DIR]"
+		}
+		result = append(result, fmt.Sprintf("%s %s", prefix, entry.Name()))
+	}
+
+	if paginated {
+		if start == end {
+			result = append(result, fmt.Sprintf("Total: %d entries (none shown at offset %d)", total, options.Offset))
+		} else {
+			result = append(result, fmt.Sprintf("Total: %d entries (showing %d-%d)", total, start+1, end))
+		}
+	}
+
+	return strings.Join(result, "\n"), nil
+}
+
+// sortDirEntries orders entries for ListDirectory. Directories sort by size
+// as empty, since their own size says nothing about their contents. Entries
+// that cannot be stat'ed, e.g. because they were removed meanwhile, sort as
+// empty and old.
+func sortDirEntries(entries []os.DirEntry, sortBy string) error {
+	switch sortBy {
+	case "", ListSortName:
+		// os.ReadDir already returns entries sorted by name
+		return nil
+	case ListSortSize, ListSortModified:
+	default:
+		return fmt.Errorf("invalid sort_by %q (use %s, %s or %s)", sortBy, ListSortName, ListSortSize, ListSortModified)
+	}
+
+	infos := make(map[string]os.FileInfo, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			infos[entry.Name()] = info
+		}
+	}
+	size := func(name string) int64 {
+		if info := infos[name]; info != nil && !info.IsDir() {
+			return info.Size()
+		}
+		return 0
+	}
+	modified := func(name string) time.Time {
+		if info := infos[name]; info != nil {
+			return info.ModTime()
+		}
+		return time.Time{}
+	}
+
+	// Stable, so entries that tie stay in name order
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Name(), entries[j].Name()
+		if sortBy == ListSortSize {
+			return size(a) > size(b)
+		}
+		return modified(a).After(modified(b))
+	})
+	return nil
+}
+
+// MoveFile moves or renames a file or directory
+func (fm *FileManager) MoveFile(source, destination string) error {
+	validSource, err := fm.ValidatePath(source)
+	if err != nil {
+		return err
+	}
+
+	validDest, err := fm.ValidatePath(destination)
+	if err != nil {
+		return err
+	}
+
+	// Moving out of a directory modifies it as much as moving into one
+	if err := fm.checkWritable(validSource); err != nil {
+		return err
+	}
+	if err := fm.checkWritable(validDest); err != nil {
+		return err
+	}
+
+	// A file moved between allowed directories takes its quota usage with it
+	size := existingFileSize(validSource)
+	crossesRoots := fm.rootIndex(validSource) != fm.rootIndex(validDest)
+	if crossesRoots {
+		if err := fm.chargeQuota(validDest, size); err != nil {
+			return err
+		}
+	}
+
+	err = fm.withRetry(func() error {
+		return os.Rename(validSource, validDest)
+	})
+	if err != nil {
+		if crossesRoots {
+			fm.chargeQuota(validDest, -size)
+		}
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	if crossesRoots {
+		fm.chargeQuota(validSource, -size)
+	}
+
+	return nil
+}
+
+// GetFileInfo gets information about a file
+// Returns JSON with "exists" field - file not found is NOT an error
+func (fm *FileManager) GetFileInfo(path string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var info FileInfo
+	err = fm.withRetry(func() error {
+		var statErr error
+		info, statErr = GetFileStats(validPath)
+		return statErr
+	})
+	if err != nil {
+		// Check if it's a "file not found" error - this is NOT an error condition
+		if os.IsNotExist(err) {
+			result := map[string]interface{}{
+				"exists": false,
+				"path":   validPath,
+			}
+			jsonResult, _ := json.Marshal(result)
+			return string(jsonResult), nil
+		}
+		// Other errors (permissions, etc.) are still returned as errors
+		return "", fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	// File exists - return full info with exists: true
+	result := map[string]interface{}{
+		"exists":      true,
+		"path":        validPath,
+		"size":        info.Size,
+		"created":     info.Created,
+		"modified":    info.Modified,
+		"accessed":    info.Accessed,
+		"isDirectory": info.IsDirectory,
+		"isFile":      info.IsFile,
+		"permissions": info.Permissions,
+		"lines":       0, // Will be populated below for text files
+	}
+	if info.ContentType != "" {
+		result["contentType"] = info.ContentType
+	}
+	
+	// For text files, count lines
+	if info.IsFile && !info.IsDirectory {
+		release := fm.acquireFile()
+		if lineCount, err := countLines(validPath); err == nil {
+			result["lines"] = lineCount
+		}
+		release()
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// countLines counts the number of lines in a text file
+func countLines(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	lineCount := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineCount++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return lineCount, nil
+}
+
+// ListAllowedDirectories returns the list of allowed directories
+func (fm *FileManager) ListAllowedDirectories() string {
+	return fmt.Sprintf("Allowed directories:\n%s", strings.Join(fm.originalDirectories, "\n"))
+}
+
+// SameFile reports whether two paths refer to the same underlying file
+// Returns JSON with the resolved paths and a "sameFile" flag
+func (fm *FileManager) SameFile(path1, path2 string) (string, error) {
+	validPath1, err := fm.ValidatePath(path1)
+	if err != nil {
+		return "", err
+	}
+
+	validPath2, err := fm.ValidatePath(path2)
+	if err != nil {
+		return "", err
+	}
+
+	info1, err := os.Stat(validPath1)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", path1, err)
+	}
+
+	info2, err := os.Stat(validPath2)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", path2, err)
+	}
+
+	// os.SameFile compares device and inode on Unix and volume and file
+	// index on Windows, so hard links are detected as well as symlinks
+	result := map[string]interface{}{
+		"sameFile": os.SameFile(info1, info2),
+		"path1":    validPath1,
+		"path2":    validPath2,
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// File classifications returned by classify_file
+const (
+	ClassEmpty     = "empty"
+	ClassText      = "text"
+	ClassBinary    = "binary"
+	ClassDirectory = "directory"
+	ClassSymlink   = "symlink"
+)
+
+// binarySniffLen is how much of a file is inspected when detecting binary content
+const binarySniffLen = 8192
+
+// isBinaryFile reports whether a file looks binary by checking for NUL
+// bytes in its first binarySniffLen bytes
+func isBinaryFile(filePath string) (bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	return bytes.IndexByte(buf[:n], 0) != -1, nil
+}
+
+// ClassifyFile classifies a path as empty, text, binary, directory or symlink
+// Returns JSON with the classification and size
+func (fm *FileManager) ClassifyFile(path string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	// ValidatePath resolves symlinks, so Lstat the requested path to see the link itself
+	absolute, err := fm.absolutePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	linkInfo, err := os.Lstat(absolute)
+	if err != nil {
+		return "", fmt.Errorf("failed to classify file: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"path": absolute,
+		"size": linkInfo.Size(),
+	}
+
+	switch {
+	case linkInfo.Mode()&os.ModeSymlink != 0:
+		result["classification"] = ClassSymlink
+		result["target"] = validPath
+	case linkInfo.IsDir():
+		result["classification"] = ClassDirectory
+	case linkInfo.Size() == 0:
+		result["classification"] = ClassEmpty
+	default:
+		release := fm.acquireFile()
+		binary, err := isBinaryFile(validPath)
+		release()
+		if err != nil {
+			return "", fmt.Errorf("failed to classify file: %w", err)
+		}
+		if binary {
+			result["classification"] = ClassBinary
+		} else {
+			result["classification"] = ClassText
+		}
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// CreateTempFile creates a uniquely named empty file in a directory and returns its path
+func (fm *FileManager) CreateTempFile(directory, prefix, suffix string) (string, error) {
+	validDir, err := fm.ValidatePath(directory)
+	if err != nil {
+		return "", err
+	}
+
+	if err := fm.checkWritable(validDir); err != nil {
+		return "", err
+	}
+
+	if strings.ContainsAny(prefix+suffix, `/\`) {
+		return "", fmt.Errorf("prefix and suffix must not contain path separators")
+	}
+
+	file, err := os.CreateTemp(validDir, prefix+"*"+suffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tempPath := file.Name()
+	file.Close()
+
+	// Make sure the new file landed inside the sandbox
+	if _, err := fm.ValidatePath(tempPath); err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+
+	return tempPath, nil
+}
+
+// ReadEnclosingBlock returns the smallest block containing a 1-based line as JSON
+func (fm *FileManager) ReadEnclosingBlock(path string, line int, mode string) (string, error) {
+	content, err := fm.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	block, usedMode, err := findEnclosingBlock(lines, line, mode, path)
+	if err != nil {
+		return "", err
+	}
+
+	result := map[string]interface{}{
+		"path":      path,
+		"mode":      usedMode,
+		"startLine": block.start,
+		"endLine":   block.end,
+		"content":   strings.Join(lines[block.start-1:block.end], "\n"),
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// CanWrite checks whether writing size bytes to path would succeed
+// Returns JSON with a "canWrite" flag, failure reasons and available headroom
+func (fm *FileManager) CanWrite(path string, size int64) (string, error) {
+	if size < 0 {
+		return "", fmt.Errorf("bytes must not be negative")
+	}
+
+	var reasons []string
+	result := map[string]interface{}{
+		"path":  path,
+		"bytes": size,
+	}
+
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		reasons = append(reasons, err.Error())
+	} else {
+		result["path"] = validPath
+
+		if err := fm.checkWritable(validPath); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+		if err := fm.checkWriteSize(size); err != nil {
+			reasons = append(reasons, err.Error())
+		}
+		if fm.maxWriteBytes > 0 {
+			result["maxWriteBytes"] = fm.maxWriteBytes
+		}
+
+		// Check free space on the volume of the parent directory,
+		// allowing for the space the current file already occupies
+		if info, err := os.Stat(validPath); err == nil && info.IsDir() {
+			reasons = append(reasons, "path is a directory")
+		}
+		growth := size - existingFileSize(validPath)
+
+		if free, err := diskFree(filepath.Dir(validPath)); err == nil {
+			result["freeBytes"] = free
+			if growth > 0 && uint64(growth) > free {
+				reasons = append(reasons, fmt.Sprintf("insufficient disk space: %d bytes needed, %d available", growth, free))
+			}
+		}
+
+		if remaining, ok := fm.quotaRemaining(validPath); ok {
+			result["quotaRemainingBytes"] = remaining
+			if size > remaining {
+				reasons = append(reasons, fmt.Sprintf("write quota exceeded: %d bytes needed, %d remaining", size, remaining))
+			}
+		}
+	}
+
+	result["canWrite"] = len(reasons) == 0
+	if len(reasons) > 0 {
+		result["reasons"] = reasons
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// MaxCompletions bounds how many suggestions CompletePath returns
+const MaxCompletions = 100
+
+// CompletePath suggests paths that start with partial, for argument completion.
+// Directories are suggested with a trailing separator so completion can continue
+// into them. An empty partial suggests the allowed directories themselves.
+// Returns the suggestions (at most MaxCompletions) and the total number of matches.
+func (fm *FileManager) CompletePath(partial string) ([]string, int) {
+	matches := []string{}
+
+	// Allowed directories are the entry points when nothing inside one is typed yet
+	for _, dir := range fm.originalDirectories {
+		if strings.HasPrefix(dir, partial) && dir != partial {
+			matches = append(matches, dir+string(filepath.Separator))
+		}
+	}
+
+	// Complete the last path element against the entries of its parent directory
+	dir, base := filepath.Split(partial)
+	if partial != "" && dir != "" {
+		if validDir, err := fm.ValidatePath(dir); err == nil {
+			if entries, err := os.ReadDir(validDir); err == nil {
+				for _, entry := range entries {
+					name := entry.Name()
+					if !strings.HasPrefix(name, base) {
+						continue
+					}
+					if entry.IsDir() {
+						if fm.isHiddenDirectory(name) {
+							continue
+						}
+						name += string(filepath.Separator)
+					}
+					matches = append(matches, dir+name)
+				}
+			}
+		}
+	}
+
+	sort.Strings(matches)
+	total := len(matches)
+	if total > MaxCompletions {
+		matches = matches[:MaxCompletions]
+	}
+	return matches, total
+}
+
+// DefaultIncludePattern matches C-style include directives such as #include "common.h"
+const DefaultIncludePattern = `^[ \t]*#include[ \t]+"([^"]+)"[ \t]*$`
+
+// DefaultIncludeDepth bounds include nesting when no max_depth is given
+const DefaultIncludeDepth = 10
+
+// MaxIncludeDepth is the deepest include nesting a caller may ask for
+const MaxIncludeDepth = 32
+
+// MaxIncludeBytes caps the assembled content of read_with_includes when no
+// smaller read size limit is configured
+const MaxIncludeBytes = 64 << 20
+
+// ReadWithIncludes reads a file and recursively replaces include directives
+// matching pattern with the content of the file named by the first capture group
+func (fm *FileManager) ReadWithIncludes(path, pattern string, maxDepth int) (string, error) {
+	if pattern == "" {
+		pattern = DefaultIncludePattern
+	}
+	if maxDepth <= 0 {
+		maxDepth = DefaultIncludeDepth
+	}
+	if maxDepth > MaxIncludeDepth {
+		maxDepth = MaxIncludeDepth
+	}
+
+	re, err := regexp.Compile("(?m)" + pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid include pattern: %w", err)
+	}
+	if re.NumSubexp() < 1 {
+		return "", fmt.Errorf("include pattern must have a capture group for the referenced path")
+	}
+
+	// Every file read counts, so repeated includes cannot multiply the output unchecked
+	budget := int64(MaxIncludeBytes)
+	if fm.maxReadBytes > 0 && fm.maxReadBytes < budget {
+		budget = fm.maxReadBytes
+	}
+	return fm.expandIncludes(path, re, maxDepth, nil, &budget)
+}
+
+// expandIncludes reads path and inlines its includes; stack holds the
+// validated paths of the files currently being expanded, for cycle detection,
+// and budget the bytes that may still be read
+func (fm *FileManager) expandIncludes(path string, re *regexp.Regexp, maxDepth int, stack []string, budget *int64) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, open := range stack {
+		if open == validPath {
+			return "", fmt.Errorf("include cycle detected: %s", strings.Join(append(stack, validPath), " -> "))
+		}
+	}
+	if len(stack) > maxDepth {
+		return "", fmt.Errorf("include depth exceeds %d at %s", maxDepth, validPath)
+	}
+	stack = append(stack, validPath)
+
+	content, err := fm.ReadFile(validPath)
+	if err != nil {
+		return "", err
+	}
+	if *budget -= int64(len(content)); *budget < 0 {
+		return "", fmt.Errorf("included content exceeds the read size limit at %s", validPath)
+	}
+
+	var expandErr error
+	expanded := re.ReplaceAllStringFunc(content, func(directive string) string {
+		if expandErr != nil {
+			return directive
+		}
+
+		target := re.FindStringSubmatch(directive)[1]
+		if !filepath.IsAbs(target) && !strings.HasPrefix(target, "~") {
+			target = filepath.Join(filepath.Dir(validPath), target)
+		}
+
+		included, err := fm.expandIncludes(target, re, maxDepth, stack, budget)
+		if err != nil {
+			expandErr = err
+			return directive
+		}
+
+		// The directive's own line ending remains, so drop the included file's last one
+		return strings.TrimSuffix(strings.TrimSuffix(included, "\n"), "\r")
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	return expanded, nil
+}
+
+// globToRegexp converts a filename glob to an anchored regular expression in
+// which every * and ? is a capture group, so replacements can refer to them
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid match pattern %q: %w", glob, err)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString("(.*)")
+		case '?':
+			b.WriteString("(.)")
+		case '[':
+			// Character classes carry over, with glob negation translated
+			end := strings.IndexByte(glob[i:], ']')
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// checkRenameTemplate rejects a replacement template that references a capture
+// group the match does not have. It follows regexp.Expand, which takes the
+// longest run of letters, digits and underscores after $ as the group name,
+// so "$1_old" names a group "1_old" and would silently expand to nothing.
+func checkRenameTemplate(template string, groups int) error {
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' || i+1 == len(template) {
+			continue
+		}
+		if template[i+1] == '$' {
+			i++
+			continue
+		}
+
+		rest := template[i+1:]
+		braced := rest[0] == '{'
+		if braced {
+			end := strings.IndexByte(rest, '}')
+			if end == -1 {
+				continue // Expand keeps a malformed reference as literal text
+			}
+			rest = rest[1:end]
+		}
+		end := strings.IndexFunc(rest, func(r rune) bool {
+			return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if end == -1 {
+			end = len(rest)
+		}
+		name := rest[:end]
+		if name == "" || (braced && end != len(rest)) {
+			continue
+		}
+
+		if group, err := strconv.Atoi(name); err != nil || group > groups {
+			if braced {
+				return fmt.Errorf("replacement references ${%s}, but the match has %d capture groups", name, groups)
+			}
+			return fmt.Errorf("replacement references $%s, but the match has %d capture groups "+
+				"(write ${n} when a group number is followed by a letter, digit or underscore)", name, groups)
+		}
+	}
+	return nil
+}
+
+// stem returns a file name without its extension
+func stem(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// renamePair is one planned rename within a directory
+type renamePair struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RenamePattern renames the entries of directory matching a glob according to
+// a replacement template. Collisions are rejected before any rename happens;
+// if a rename fails, the completed ones are undone.
+// Returns JSON with the old -> new mapping.
+func (fm *FileManager) RenamePattern(directory, match, replacement string, dryRun bool) (string, error) {
+	validDir, err := fm.ValidatePath(directory)
+	if err != nil {
+		return "", err
+	}
+
+	if err := fm.checkWritable(validDir); err != nil {
+		return "", err
+	}
+
+	re, err := globToRegexp(match)
+	if err != nil {
+		return "", err
+	}
+	if err := checkRenameTemplate(replacement, re.NumSubexp()); err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(validDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	existing := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		existing[entry.Name()] = true
+	}
+
+	// Plan every rename and check for collisions before touching anything
+	renames := []renamePair{}
+	sources := make(map[string]bool)
+	targets := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !re.MatchString(name) {
+			continue
+		}
+
+		newName := re.ReplaceAllString(name, replacement)
+		if newName == name {
+			continue
+		}
+		if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+			return "", fmt.Errorf("invalid new name %q for %s", newName, name)
+		}
+		// Empty captures can strip a name down to its extension, e.g. "a.txt" -> ".txt"
+		if stem(newName) == "" && stem(name) != "" {
+			return "", fmt.Errorf("invalid new name %q for %s: nothing left before the extension", newName, name)
+		}
+		if other, ok := targets[newName]; ok {
+			return "", fmt.Errorf("collision: both %s and %s would be renamed to %s", other, name, newName)
+		}
+
+		// Neither side may be a denied path, or a rename could expose a denied file
+		for _, path := range []string{name, newName} {
+			if _, err := fm.ValidatePath(filepath.Join(validDir, path)); err != nil {
+				return "", err
+			}
+		}
+
+		targets[newName] = name
+		sources[name] = true
+		renames = append(renames, renamePair{From: name, To: newName})
+	}
+
+	for _, rename := range renames {
+		// A target may reuse the name of an entry that is itself being renamed away
+		if existing[rename.To] && !sources[rename.To] {
+			return "", fmt.Errorf("collision: %s already exists", rename.To)
+		}
+	}
+
+	if !dryRun && len(renames) > 0 {
+		if err := fm.applyRenames(validDir, renames); err != nil {
+			return "", err
+		}
+	}
+
+	result := map[string]interface{}{
+		"directory": validDir,
+		"renamed":   renames,
+		"count":     len(renames),
+		"dryRun":    dryRun,
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// applyRenames performs planned renames in two phases through temporary names,
+// so renames that swap or chain names work, and rolls back on failure
+func (fm *FileManager) applyRenames(dir string, renames []renamePair) error {
+	type step struct{ from, to string }
+	var done []step
+
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i].to, done[i].from); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to roll back rename of %s: %v\n", done[i].from, err)
+			}
+		}
+	}
+
+	rename := func(from, to string) error {
+		if err := fm.withRetry(func() error { return os.Rename(from, to) }); err != nil {
+			return err
+		}
+		done = append(done, step{from, to})
+		return nil
+	}
+
+	temps := make([]string, len(renames))
+	stamp := time.Now().UnixNano()
+	for i, r := range renames {
+		temps[i] = filepath.Join(dir, fmt.Sprintf(".rename-%d-%d.tmp", stamp, i))
+		if err := rename(filepath.Join(dir, r.From), temps[i]); err != nil {
+			rollback()
+			return fmt.Errorf("failed to rename %s: %w", r.From, err)
+		}
+	}
+
+	for i, r := range renames {
+		if err := rename(temps[i], filepath.Join(dir, r.To)); err != nil {
+			rollback()
+			return fmt.Errorf("failed to rename %s to %s: %w", r.From, r.To, err)
+		}
+	}
+
+	return nil
+}
+
+// TextStats counts lines, words, characters and bytes of a text file, mirroring wc
+// Returns JSON; binary files are reported as such without counts
+func (fm *FileManager) TextStats(path string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	binary, err := isBinaryFile(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if binary {
+		jsonResult, _ := json.Marshal(map[string]interface{}{
+			"path":   validPath,
+			"binary": true,
+		})
+		return string(jsonResult), nil
+	}
+
+	file, err := os.Open(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	var lines, words, chars, byteCount int64
+	inWord := false
+	last := rune(-1)
+	reader := bufio.NewReader(file)
+	for {
+		r, size, err := reader.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+
+		byteCount += int64(size)
+		chars++
+		if r == '\n' {
+			lines++
+		}
+		if unicode.IsSpace(r) {
+			inWord = false
+		} else if !inWord {
+			inWord = true
+			words++
+		}
+		last = r
+	}
+
+	result := map[string]interface{}{
+		"path":            validPath,
+		"binary":          false,
+		"lines":           lines,
+		"words":           words,
+		"chars":           chars,
+		"bytes":           byteCount,
+		"endsWithNewline": last == '\n',
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// LatestModification walks a directory and returns JSON describing the entry
+// with the newest modification time. maxDepth < 0 means unlimited.
+func (fm *FileManager) LatestModification(path string, maxDepth int) (string, error) {
+	validRootPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	maxDepth, err = fm.searchDepthLimit(validRootPath, maxDepth)
+	if err != nil {
+		return "", err
+	}
+
+	var newestPath string
+	var newest time.Time
+	entries := 0
+	counter := fm.newEntryCounter()
+
+	err = filepath.WalkDir(validRootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries and continue walking
+			return nil
+		}
+
+		if d.IsDir() && path != validRootPath && fm.isHiddenDirectory(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		if maxDepth >= 0 && walkDepth(validRootPath, path) > maxDepth {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := counter.add(); err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries++
+		if newestPath == "" || info.ModTime().After(newest) {
+			newest, newestPath = info.ModTime(), path
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result := map[string]interface{}{
+		"root":     validRootPath,
+		"path":     newestPath,
+		"modified": newest.Format(time.RFC3339Nano),
+		"entries":  entries,
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// ManifestEntry is an expected file hash in a manifest
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
+// hashMismatch reports a manifest entry whose file has a different hash
+type hashMismatch struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// VerifyManifest compares the files under directory with a manifest of hashes.
+// algorithm applies to entries whose hash has no "algorithm:" prefix.
+// Returns JSON with matched, mismatched, missing and (optionally) extra files.
+func (fm *FileManager) VerifyManifest(directory string, manifest []ManifestEntry, algorithm string, reportExtra bool) (string, error) {
+	validDir, err := fm.ValidatePath(directory)
+	if err != nil {
+		return "", err
+	}
+	if _, err := newHash(algorithm); err != nil {
+		return "", err
+	}
+
+	matched := []string{}
+	mismatched := []hashMismatch{}
+	missing := []string{}
+	listed := make(map[string]bool, len(manifest))
+
+	for _, entry := range manifest {
+		target := entry.Path
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(validDir, target)
+		}
+
+		validPath, err := fm.ValidatePath(target)
+		if err != nil {
+			return "", fmt.Errorf("manifest entry %s: %w", entry.Path, err)
+		}
+		listed[validPath] = true
+
+		entryAlgorithm, expected := algorithm, entry.Hash
+		if prefix, digest, ok := strings.Cut(entry.Hash, ":"); ok {
+			entryAlgorithm, expected = prefix, digest
+		}
+
+		release := fm.acquireFile()
+		actual, err := hashFile(validPath, entryAlgorithm)
+		release()
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			missing = append(missing, entry.Path)
+		case err != nil:
+			return "", fmt.Errorf("manifest entry %s: %w", entry.Path, err)
+		case strings.EqualFold(actual, expected):
+			matched = append(matched, entry.Path)
+		default:
+			mismatched = append(mismatched, hashMismatch{Path: entry.Path, Expected: expected, Actual: actual})
+		}
+	}
+
+	result := map[string]interface{}{
+		"directory":  validDir,
+		"matched":    matched,
+		"mismatched": mismatched,
+		"missing":    missing,
+	}
+	ok := len(mismatched) == 0 && len(missing) == 0
+
+	if reportExtra {
+		extra := []string{}
+		counter := fm.newEntryCounter()
+		err := filepath.WalkDir(validDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != validDir && fm.isHiddenDirectory(d.Name()) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if err := counter.add(); err != nil {
+				return err
+			}
+			if !listed[path] {
+				rel, relErr := filepath.Rel(validDir, path)
+				if relErr != nil {
+					rel = path
+				}
+				extra = append(extra, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		result["extra"] = extra
+		ok = ok && len(extra) == 0
+	}
+	result["ok"] = ok
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// WhichRoot reports the allowed directory containing path as JSON.
+// A path outside all allowed directories is reported, not treated as an error.
+func (fm *FileManager) WhichRoot(path string) (string, error) {
+	result := map[string]interface{}{
+		"path": path,
+	}
+
+	validPath, err := fm.ValidatePath(path)
+	i := -1
+	if err == nil {
+		i = fm.rootIndex(validPath)
+	}
+
+	if i == -1 {
+		result["allowed"] = false
+		if err != nil {
+			result["reason"] = err.Error()
+		} else {
+			result["reason"] = "path is not within any allowed directory"
+		}
+	} else {
+		settings := fm.directorySettings[i]
+		result["allowed"] = true
+		result["path"] = validPath
+		result["root"] = fm.originalDirectories[i]
+		result["mode"] = "read-write"
+		if settings.ReadOnly {
+			result["mode"] = "read-only"
+		}
+		if settings.MaxSearchDepth >= 0 {
+			result["maxSearchDepth"] = settings.MaxSearchDepth
+		}
+		if settings.WriteQuota > 0 {
+			result["writeQuota"] = settings.WriteQuota
+			if remaining, ok := fm.quotaRemaining(validPath); ok {
+				result["quotaRemainingBytes"] = remaining
+			}
+		}
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// DefaultReadFullMaxBytes bounds how much content read_file_full returns by default
+const DefaultReadFullMaxBytes = 1 << 20
+
+// prefixBuffer keeps the first limit bytes written to it and discards the rest
+type prefixBuffer struct {
+	data  []byte
+	limit int64
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(len(b.data)); room > 0 {
+		if int64(len(p)) > room {
+			b.data = append(b.data, p[:room]...)
+		} else {
+			b.data = append(b.data, p...)
+		}
+	}
+	return len(p), nil
+}
+
+// ReadFileFull reads a file's content and metadata in a single pass.
+// The whole file is hashed, but at most maxBytes of content are returned,
+// and none for binary files.
+// Returns JSON with the metadata, hash and content.
+func (fm *FileManager) ReadFileFull(path string, maxBytes int64) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var info FileInfo
+	err = fm.withRetry(func() error {
+		var statErr error
+		info, statErr = GetFileStats(validPath)
+		return statErr
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.IsDirectory {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	file, err := os.Open(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	h, _ := newHash(HashSHA256)
+	head := &prefixBuffer{limit: maxBytes}
+	size, err := io.Copy(h, io.TeeReader(file, head))
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Size comes from the bytes actually read, in case the file changed since the stat
+	trailingNewline := false
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, size-1); err == nil {
+			trailingNewline = last[0] == '\n'
+		}
+	}
+
+	sniff := head.data
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+	binary := bytes.IndexByte(sniff, 0) != -1
+
+	result := map[string]interface{}{
+		"path":            validPath,
+		"size":            size,
+		"created":         info.Created,
+		"modified":        info.Modified,
+		"accessed":        info.Accessed,
+		"permissions":     info.Permissions,
+		"mimeType":        detectMimeType(validPath, head.data),
+		"isBinary":        binary,
+		"sha256":          hex.EncodeToString(h.Sum(nil)),
+		"trailingNewline": trailingNewline,
+	}
+
+	if !binary {
+		content := head.data
+		truncated := size > int64(len(content))
+		if truncated {
+			// Don't cut a multi-byte character in half
+			for i := 0; i < utf8.UTFMax-1 && len(content) > 0; i++ {
+				if r, n := utf8.DecodeLastRune(content); r != utf8.RuneError || n != 1 {
+					break
+				}
+				content = content[:len(content)-1]
+			}
+		}
+		result["content"] = string(content)
+		result["truncated"] = truncated
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// fileDifference is a file present in both compared directories with different content
+type fileDifference struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"` // "size" or "content"
+}
+
+// CompareDirectories reports the files only in dirA, only in dirB, and in both but different.
+// Same-sized files are hashed unless their modification times match and ignoreMtimes is false.
+func (fm *FileManager) CompareDirectories(dirA, dirB string, ignoreMtimes bool) (string, error) {
+	validA, err := fm.ValidatePath(dirA)
+	if err != nil {
+		return "", err
+	}
+	validB, err := fm.ValidatePath(dirB)
+	if err != nil {
+		return "", err
+	}
+
+	// Both walks share one entry budget
+	counter := fm.newEntryCounter()
+	filesA, err := fm.collectFiles(validA, counter)
+	if err != nil {
+		return "", err
+	}
+	filesB, err := fm.collectFiles(validB, counter)
+	if err != nil {
+		return "", err
+	}
+
+	onlyInA := []string{}
+	onlyInB := []string{}
+	differing := []fileDifference{}
+	identical := 0
+
+	for rel, infoA := range filesA {
+		infoB, ok := filesB[rel]
+		if !ok {
+			onlyInA = append(onlyInA, rel)
+			continue
+		}
+
+		switch {
+		case infoA.Size() != infoB.Size():
+			differing = append(differing, fileDifference{Path: rel, Reason: "size"})
+		case !ignoreMtimes && infoA.ModTime().Equal(infoB.ModTime()):
+			identical++
+		default:
+			same, err := fm.sameContent(filepath.Join(validA, rel), filepath.Join(validB, rel))
+			if err != nil {
+				return "", err
+			}
+			if same {
+				identical++
+			} else {
+				differing = append(differing, fileDifference{Path: rel, Reason: "content"})
+			}
+		}
+	}
+	for rel := range filesB {
+		if _, ok := filesA[rel]; !ok {
+			onlyInB = append(onlyInB, rel)
+		}
+	}
+
+	sort.Strings(onlyInA)
+	sort.Strings(onlyInB)
+	sort.Slice(differing, func(i, j int) bool { return differing[i].Path < differing[j].Path })
+
+	result := map[string]interface{}{
+		"pathA":     validA,
+		"pathB":     validB,
+		"onlyInA":   onlyInA,
+		"onlyInB":   onlyInB,
+		"differing": differing,
+		"identical": identical,
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
+
+// collectFiles walks root and returns its regular files keyed by slash-separated relative path
+func (fm *FileManager) collectFiles(root string, counter *entryCounter) (map[string]fs.FileInfo, error) {
+	files := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && fm.isHiddenDirectory(d.Name()) {
+				return filepath.SkipDir
+			}
+			// Denied directories are skipped, not compared
+			if _, err := fm.ValidatePath(path); err != nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err := counter.add(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if _, err := fm.ValidatePath(path); err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		files[filepath.ToSlash(rel)] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// sameContent reports whether two files have the same SHA-256 hash
+func (fm *FileManager) sameContent(pathA, pathB string) (bool, error) {
+	release := fm.acquireFile()
+	hashA, err := hashFile(pathA, HashSHA256)
+	release()
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", pathA, err)
+	}
+
+	release = fm.acquireFile()
+	hashB, err := hashFile(pathB, HashSHA256)
+	release()
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", pathB, err)
+	}
+
+	return hashA == hashB, nil
+}
+
+// DeleteDirectory deletes a directory. Unless recursive is set the directory must be empty.
+// For a recursive delete every entry beneath the directory is validated first, so
+// nothing is removed if a symlink in the tree points outside the allowed directories.
+func (fm *FileManager) DeleteDirectory(path string, recursive bool) error {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fm.checkWritable(validPath); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return fmt.Errorf("failed to delete directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	normalized := normalizePath(validPath)
+	for _, dir := range fm.allowedDirectories {
+		if normalized == dir {
+			return fmt.Errorf("cannot delete allowed directory %s", path)
+		}
+	}
+
+	if !recursive {
+		entries, err := os.ReadDir(validPath)
+		if err != nil {
+			return fmt.Errorf("failed to delete directory: %w", err)
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("directory %s is not empty: %d entries remain; set recursive to true to delete them",
+				path, len(entries))
+		}
+		if err := os.Remove(validPath); err != nil {
+			return fmt.Errorf("failed to delete directory: %w", err)
+		}
+		return nil
+	}
+
+	// Check the whole tree before deleting anything, noting file sizes to refund quota
+	type deletedFile struct {
+		path string
+		size int64
+	}
+	var files []deletedFile
+	counter := fm.newEntryCounter()
+	err = filepath.WalkDir(validPath, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := counter.add(); err != nil {
+			return err
+		}
+		if _, err := fm.ValidatePath(entryPath); err != nil {
+			return fmt.Errorf("refusing to delete %s: %w", entryPath, err)
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				files = append(files, deletedFile{path: entryPath, size: info.Size()})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(validPath); err != nil {
+		return fmt.Errorf("failed to delete directory: %w", err)
+	}
+
+	for _, file := range files {
+		fm.chargeQuota(file.path, -file.size)
+	}
+	return nil
+}
+
+// CopyFile copies a file, or a directory recursively, preserving permission bits.
+// Like MoveFile it refuses to overwrite an existing destination. For directories
+// every nested source and destination path is validated before anything is copied.
+func (fm *FileManager) CopyFile(source, destination string) error {
+	validSource, err := fm.ValidatePath(source)
+	if err != nil {
+		return err
+	}
+
+	validDest, err := fm.ValidatePath(destination)
+	if err != nil {
+		return err
+	}
+
+	if err := fm.checkWritable(validDest); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(validDest); err == nil {
+		return fmt.Errorf("destination already exists: %s", destination)
+	}
+
+	info, err := os.Stat(validSource)
+	if err != nil {
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	if !info.IsDir() {
+		return fm.copyRegularFile(validSource, validDest, info)
+	}
+
+	if isWithinDirectory(validDest, validSource) {
+		return fmt.Errorf("cannot copy directory %s into itself", source)
+	}
+
+	// Plan the whole copy first so an invalid entry stops it before anything is written
+	type copyStep struct {
+		source      string
+		destination string
+		info        fs.FileInfo
+	}
+	var steps []copyStep
+	counter := fm.newEntryCounter()
+	err = filepath.WalkDir(validSource, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := counter.add(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(validSource, entryPath)
+		if err != nil {
+			return err
+		}
+		entrySource, err := fm.ValidatePath(entryPath)
+		if err != nil {
+			return fmt.Errorf("cannot copy %s: %w", entryPath, err)
+		}
+		// Directory symlinks are refused below, so the destination tree mirrors
+		// the source tree under the already validated destination root
+		entryDest := filepath.Join(validDest, rel)
+
+		entryInfo, err := os.Stat(entrySource)
+		if err != nil {
+			return fmt.Errorf("cannot copy %s: %w", entryPath, err)
+		}
+		if entryInfo.IsDir() && d.Type()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("cannot copy %s: symlinks to directories are not copied", entryPath)
+		}
+
+		steps = append(steps, copyStep{source: entrySource, destination: entryDest, info: entryInfo})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, step := range steps {
+		if step.info.IsDir() {
+			if err := os.Mkdir(step.destination, step.info.Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to copy directory: %w", err)
+			}
+			continue
+		}
+		if err := fm.copyRegularFile(step.source, step.destination, step.info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyRegularFile streams one file to a destination that must not exist yet
+// and gives it the source's permission bits
+func (fm *FileManager) copyRegularFile(validSource, validDest string, info fs.FileInfo) error {
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("cannot copy %s: not a regular file", validSource)
+	}
+	if err := fm.checkWriteSize(info.Size()); err != nil {
+		return err
+	}
+	if err := fm.chargeQuota(validDest, info.Size()); err != nil {
+		return err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	in, err := os.Open(validSource)
+	if err != nil {
+		fm.chargeQuota(validDest, -info.Size())
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(validDest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		fm.chargeQuota(validDest, -info.Size())
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// OpenFile's mode is filtered by the umask; set the bits explicitly
+		err = os.Chmod(validDest, info.Mode().Perm())
+	}
+	if err != nil {
+		os.Remove(validDest)
+		fm.chargeQuota(validDest, -info.Size())
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	return nil
+}
+
+// AppendFile appends content to a file, creating it with the configured file mode if needed.
+// Appends to the same file are serialized so concurrent callers never interleave.
+func (fm *FileManager) AppendFile(path, content string) error {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fm.checkWritable(validPath); err != nil {
+		return err
+	}
+
+	unlock := fm.appends.lock(validPath)
+	defer unlock()
+
+	if err := fm.checkWriteSize(existingFileSize(validPath) + int64(len(content))); err != nil {
+		return err
+	}
+
+	if err := fm.chargeQuota(validPath, int64(len(content))); err != nil {
+		return err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	err = fm.withRetry(func() error {
+		file, openErr := os.OpenFile(validPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, fm.fileMode)
+		if openErr != nil {
+			return openErr
+		}
+		_, writeErr := file.WriteString(content)
+		if closeErr := file.Close(); writeErr == nil {
+			writeErr = closeErr
+		}
+		return writeErr
+	})
+	if err != nil {
+		fm.chargeQuota(validPath, -int64(len(content)))
+		return fmt.Errorf("failed to append to file: %w", err)
+	}
+
+	return nil
+}
+
+// DirectorySize returns the total size in bytes and the number of regular files
+// under path. Symlinks are not followed; entries that fail validation are skipped.
+func (fm *FileManager) DirectorySize(path string) (int64, int, error) {
+	validRootPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info, err := os.Stat(validRootPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return 0, 0, fmt.Errorf("path is not a directory: %s", path)
+	}
+
+	var total int64
+	files := 0
+	counter := fm.newEntryCounter()
+
+	err = filepath.WalkDir(validRootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable entries and continue walking
+			return nil
+		}
+
+		if d.IsDir() && path != validRootPath && fm.isHiddenDirectory(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		if _, err := fm.ValidatePath(path); err != nil {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := counter.add(); err != nil {
+			return err
+		}
+
+		// WalkDir does not follow symlinks; only regular files are counted
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		files++
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return total, files, nil
+}
+
+// FormatSize formats a byte count for people, e.g. "1.5 MB"
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes) / unit
+	suffix := 0
+	for value >= unit && suffix < 3 {
+		value /= unit
+		suffix++
+	}
+	return fmt.Sprintf("%.1f %s", value, []string{"KB", "MB", "GB", "TB"}[suffix])
+}
+
+// ParseReadFileArgs parses arguments for read_file
+func ParseReadFileArgs(args json.RawMessage) (string, ReadFileOptions, error) {
+	var params struct {
+		Path       string `json:"path"`
+		ExpandTabs bool   `json:"expand_tabs"`
+		TabWidth   int    `json:"tab_width"`
+		AsLines    bool   `json:"as_lines"`
+		Offset     int64  `json:"offset"`
+		Length     int64  `json:"length"`
+		Head       int    `json:"head"`
+		Tail       int    `json:"tail"`
+		Encoding   string `json:"encoding"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", ReadFileOptions{}, fmt.Errorf("invalid arguments for read_file: %w", err)
+	}
+	
+	if params.Path == "" {
+		return "", ReadFileOptions{}, fmt.Errorf("path parameter is required")
+	}
+
+	if params.TabWidth < 0 {
+		return "", ReadFileOptions{}, fmt.Errorf("tab_width must not be negative")
+	}
+
+	if params.Offset < 0 || params.Length < 0 || params.Head < 0 || params.Tail < 0 {
+		return "", ReadFileOptions{}, fmt.Errorf("offset, length, head and tail must not be negative")
+	}
+
+	if params.Head > 0 && params.Tail > 0 {
+		return "", ReadFileOptions{}, fmt.Errorf("head and tail cannot be used together")
+	}
+
+	switch params.Encoding {
+	case "", EncodingUTF8:
+		params.Encoding = EncodingUTF8
+	case EncodingBase64:
+		if params.AsLines || params.ExpandTabs {
+			return "", ReadFileOptions{}, fmt.Errorf("as_lines and expand_tabs cannot be used with base64 encoding")
+		}
+	default:
+		return "", ReadFileOptions{}, fmt.Errorf("invalid encoding %q (use %q or %q)", params.Encoding, EncodingUTF8, EncodingBase64)
+	}
+
+	options := ReadFileOptions{
+		AsLines:  params.AsLines,
+		Offset:   params.Offset,
+		Length:   params.Length,
+		Head:     params.Head,
+		Tail:     params.Tail,
+		Encoding: params.Encoding,
+	}
+	if params.ExpandTabs {
+		options.TabWidth = params.TabWidth
+		if options.TabWidth == 0 {
+			options.TabWidth = DefaultTabWidth
+		}
+	}
+	
+	return params.Path, options, nil
+}
+
+// ParseReadMultipleFilesArgs parses arguments for read_multiple_files
+// The format defaults to MultiReadFormatText
+func ParseReadMultipleFilesArgs(args json.RawMessage) ([]string, string, error) {
+	var params struct {
+		Paths  []string `json:"paths"`
+		Format string   `json:"format"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, "", fmt.Errorf("invalid arguments for read_multiple_files: %w", err)
+	}
+	
+	if len(params.Paths) == 0 {
+		return nil, "", fmt.Errorf("paths parameter is required and must not be empty")
+	}
+
+	switch params.Format {
+	case "":
+		params.Format = MultiReadFormatText
+	case MultiReadFormatText, MultiReadFormatJSON:
+	default:
+		return nil, "", fmt.Errorf("invalid format %q (use %s or %s)", params.Format, MultiReadFormatText, MultiReadFormatJSON)
+	}
+	
+	return params.Paths, params.Format, nil
+}
+
+// ParseWriteFileArgs parses arguments for write_file
+// The returned content already has the requested trailing_newline policy applied
+func ParseWriteFileArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		Path            string `json:"path"`
+		Content         string `json:"content"`
+		TrailingNewline string `json:"trailing_newline"`
+		Encoding        string `json:"encoding"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for write_file: %w", err)
+	}
+	
+	if params.Path == "" {
+		return "", "", fmt.Errorf("path parameter is required")
+	}
+
+	switch params.Encoding {
+	case "", EncodingUTF8:
+	case EncodingBase64:
+		if params.TrailingNewline != "" && params.TrailingNewline != TrailingNewlinePreserve {
+			return "", "", fmt.Errorf("trailing_newline cannot be used with base64 encoding")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(params.Content)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 content: %w", err)
+		}
+		return params.Path, string(decoded), nil
+	default:
+		return "", "", fmt.Errorf("invalid encoding %q (use %q or %q)", params.Encoding, EncodingUTF8, EncodingBase64)
+	}
+	
+	content, err := ApplyTrailingNewline(params.Content, params.TrailingNewline)
+	if err != nil {
+		return "", "", err
+	}
+	
+	return params.Path, content, nil
+}
+
+// ParseCreateDirectoryArgs parses arguments for create_directory
+func ParseCreateDirectoryArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for create_directory: %w", err)
+	}
+	
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+	
+	return params.Path, nil
+}
+
+// ParseTouchFileArgs parses arguments for touch_file
+func ParseTouchFileArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for touch_file: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseCreateSymlinkArgs parses arguments for create_symlink
+// Returns the target and the link path
+func ParseCreateSymlinkArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Target string `json:"target"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for create_symlink: %w", err)
+	}
+
+	if params.Path == "" || params.Target == "" {
+		return "", "", fmt.Errorf("path and target parameters are required")
+	}
+
+	return params.Target, params.Path, nil
+}
+
+// ParseReadLinkArgs parses arguments for read_link
+func ParseReadLinkArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for read_link: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseListDirectoryArgs parses arguments for list_directory
+func ParseListDirectoryArgs(args json.RawMessage) (string, ListDirectoryOptions, error) {
+	var params struct {
+		Path   string `json:"path"`
+		Offset int    `json:"offset"`
+		Limit  int    `json:"limit"`
+		SortBy string `json:"sort_by"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", ListDirectoryOptions{}, fmt.Errorf("invalid arguments for list_directory: %w", err)
+	}
+	
+	if params.Path == "" {
+		return "", ListDirectoryOptions{}, fmt.Errorf("path parameter is required")
+	}
+
+	if params.Offset < 0 || params.Limit < 0 {
+		return "", ListDirectoryOptions{}, fmt.Errorf("offset and limit must not be negative")
+	}
+	
+	return params.Path, ListDirectoryOptions{Offset: params.Offset, Limit: params.Limit, SortBy: params.SortBy}, nil
+}
+
+// ParseMoveFileArgs parses arguments for move_file
+func ParseMoveFileArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for move_file: %w", err)
+	}
+	
+	if params.Source == "" || params.Destination == "" {
+		return "", "", fmt.Errorf("source and destination parameters are required")
+	}
+	
+	return params.Source, params.Destination, nil
 }
 
-// GetFileStats returns file metadata
-func GetFileStats(filePath string) (FileInfo, error) {
-	info, err := os.Stat(filePath)
-	if err != nil {
-		return FileInfo{}, err
+// ParseSearchFilesArgs parses arguments for search_files
+func ParseSearchFilesArgs(args json.RawMessage) (string, string, SearchFilesOptions, error) {
+	var params struct {
+		Path     string `json:"path"`
+		Pattern  string `json:"pattern"`
+		Regex    bool   `json:"regex"`
+		MaxDepth *int   `json:"max_depth"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", SearchFilesOptions{}, fmt.Errorf("invalid arguments for search_files: %w", err)
+	}
+	
+	if params.Path == "" || params.Pattern == "" {
+		return "", "", SearchFilesOptions{}, fmt.Errorf("path and pattern parameters are required")
+	}
+
+	options := SearchFilesOptions{Regex: params.Regex, MaxDepth: -1}
+	if params.MaxDepth != nil {
+		if *params.MaxDepth < 0 {
+			return "", "", SearchFilesOptions{}, fmt.Errorf("max_depth must not be negative")
+		}
+		options.MaxDepth = *params.MaxDepth
 	}
+	
+	return params.Path, params.Pattern, options, nil
+}
 
-	// Get file time attributes
-	var created, accessed, modified time.Time
+// ParseGetFileInfoArgs parses arguments for get_file_info
+func ParseGetFileInfoArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for get_file_info: %w", err)
+	}
 	
-	// On some file systems, some time attributes might not be available
-	// Here's a basic implementation that works cross-platform
-	modified = info.ModTime()
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
 	
-	// For creation time and access time, we use platform-specific methods
-	// In a real implementation, this would use platform-specific syscalls
-	// For simplicity, we'll use ModTime for all times here
-	created = modified
-	accessed = modified
+	return params.Path, nil
+}
 
-	// Get file permissions in octal format
-	permissions := fmt.Sprintf("%o", info.Mode().Perm())
+// ParseSameFileArgs parses arguments for same_file
+func ParseSameFileArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		Path1 string `json:"path1"`
+		Path2 string `json:"path2"`
+	}
 
-	return FileInfo{
-		Size:        info.Size(),
-		Created:     created,
-		Modified:    modified,
-		Accessed:    accessed,
-		IsDirectory: info.IsDir(),
-		IsFile:      !info.IsDir(),
-		Permissions: permissions,
-	}, nil
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for same_file: %w", err)
+	}
+
+	if params.Path1 == "" || params.Path2 == "" {
+		return "", "", fmt.Errorf("path1 and path2 parameters are required")
+	}
+
+	return params.Path1, params.Path2, nil
 }
 
-// SearchFiles searches for files matching a pattern in a directory tree
-func SearchFiles(fm *FileManager, rootPath, pattern string) ([]string, error) {
-	// Validate the root path
-	validRootPath, err := fm.ValidatePath(rootPath)
-	if err != nil {
-		return nil, err
+// ParseClassifyFileArgs parses arguments for classify_file
+func ParseClassifyFileArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
 	}
 
-	var results []string
-	pattern = strings.ToLower(pattern)
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for classify_file: %w", err)
+	}
 
-	err = filepath.WalkDir(validRootPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			// Skip errors and continue walking
-			return nil
-		}
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
 
-		// Try to validate each path
-		_, validateErr := fm.ValidatePath(path)
-		if validateErr != nil {
-			// Skip this path if it's not valid
-			if d.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
+	return params.Path, nil
+}
+
+// ParseCreateTempFileArgs parses arguments for create_temp_file
+func ParseCreateTempFileArgs(args json.RawMessage) (string, string, string, error) {
+	var params struct {
+		Directory string `json:"directory"`
+		Prefix    string `json:"prefix"`
+		Suffix    string `json:"suffix"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", "", fmt.Errorf("invalid arguments for create_temp_file: %w", err)
+	}
+
+	if params.Directory == "" {
+		return "", "", "", fmt.Errorf("directory parameter is required")
+	}
+
+	return params.Directory, params.Prefix, params.Suffix, nil
+}
+
+// ParseReadEnclosingBlockArgs parses arguments for read_enclosing_block
+func ParseReadEnclosingBlockArgs(args json.RawMessage) (string, int, string, error) {
+	var params struct {
+		Path string `json:"path"`
+		Line int    `json:"line"`
+		Mode string `json:"mode"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, "", fmt.Errorf("invalid arguments for read_enclosing_block: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", 0, "", fmt.Errorf("path parameter is required")
+	}
+
+	if params.Line < 1 {
+		return "", 0, "", fmt.Errorf("line parameter is required and must be at least 1")
+	}
+
+	return params.Path, params.Line, params.Mode, nil
+}
+
+// ParseCanWriteArgs parses arguments for can_write
+func ParseCanWriteArgs(args json.RawMessage) (string, int64, error) {
+	var params struct {
+		Path  string `json:"path"`
+		Bytes *int64 `json:"bytes"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, fmt.Errorf("invalid arguments for can_write: %w", err)
+	}
+
+	if params.Path == "" || params.Bytes == nil {
+		return "", 0, fmt.Errorf("path and bytes parameters are required")
+	}
+
+	return params.Path, *params.Bytes, nil
+}
+
+// ParseReadWithIncludesArgs parses arguments for read_with_includes
+func ParseReadWithIncludesArgs(args json.RawMessage) (string, string, int, error) {
+	var params struct {
+		Path     string `json:"path"`
+		Pattern  string `json:"pattern"`
+		MaxDepth int    `json:"max_depth"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", 0, fmt.Errorf("invalid arguments for read_with_includes: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", "", 0, fmt.Errorf("path parameter is required")
+	}
+
+	if params.MaxDepth < 0 {
+		return "", "", 0, fmt.Errorf("max_depth must not be negative")
+	}
+
+	return params.Path, params.Pattern, params.MaxDepth, nil
+}
+
+// ParseRenamePatternArgs parses arguments for rename_pattern
+func ParseRenamePatternArgs(args json.RawMessage) (string, string, string, bool, error) {
+	var params struct {
+		Directory   string `json:"directory"`
+		Match       string `json:"match"`
+		Replacement string `json:"replacement"`
+		DryRun      bool   `json:"dry_run"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", "", false, fmt.Errorf("invalid arguments for rename_pattern: %w", err)
+	}
+
+	if params.Directory == "" || params.Match == "" || params.Replacement == "" {
+		return "", "", "", false, fmt.Errorf("directory, match and replacement parameters are required")
+	}
+
+	return params.Directory, params.Match, params.Replacement, params.DryRun, nil
+}
+
+// ParseTextStatsArgs parses arguments for text_stats
+func ParseTextStatsArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for text_stats: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseLatestModificationArgs parses arguments for latest_modification
+// Returns the path and the depth limit (-1 = unlimited)
+func ParseLatestModificationArgs(args json.RawMessage) (string, int, error) {
+	var params struct {
+		Path     string `json:"path"`
+		MaxDepth *int   `json:"max_depth"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, fmt.Errorf("invalid arguments for latest_modification: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", 0, fmt.Errorf("path parameter is required")
+	}
+
+	maxDepth := -1
+	if params.MaxDepth != nil {
+		if *params.MaxDepth < 0 {
+			return "", 0, fmt.Errorf("max_depth must not be negative")
 		}
+		maxDepth = *params.MaxDepth
+	}
 
-		// Check if the name matches the pattern
-		if strings.Contains(strings.ToLower(d.Name()), pattern) {
-			results = append(results, path)
+	return params.Path, maxDepth, nil
+}
+
+// ParseVerifyManifestArgs parses arguments for verify_manifest
+func ParseVerifyManifestArgs(args json.RawMessage) (string, []ManifestEntry, string, bool, error) {
+	var params struct {
+		Directory   string          `json:"directory"`
+		Manifest    []ManifestEntry `json:"manifest"`
+		Algorithm   string          `json:"algorithm"`
+		ReportExtra *bool           `json:"report_extra"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", nil, "", false, fmt.Errorf("invalid arguments for verify_manifest: %w", err)
+	}
+
+	if params.Directory == "" || params.Manifest == nil {
+		return "", nil, "", false, fmt.Errorf("directory and manifest parameters are required")
+	}
+
+	for i, entry := range params.Manifest {
+		if entry.Path == "" || entry.Hash == "" {
+			return "", nil, "", false, fmt.Errorf("manifest entry %d needs both path and hash", i)
 		}
+	}
 
-		return nil
-	})
+	reportExtra := params.ReportExtra == nil || *params.ReportExtra
 
-	if err != nil {
-		return nil, err
+	return params.Directory, params.Manifest, params.Algorithm, reportExtra, nil
+}
+
+// ParseBeginWriteArgs parses arguments for begin_write
+func ParseBeginWriteArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
 	}
 
-	return results, nil
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for begin_write: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
 }
 
-// ReadFile reads the contents of a file
-func (fm *FileManager) ReadFile(path string) (string, error) {
-	validPath, err := fm.ValidatePath(path)
-	if err != nil {
-		return "", err
+// ParseAppendChunkArgs parses arguments for append_chunk
+func ParseAppendChunkArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		WriteID string  `json:"write_id"`
+		Content *string `json:"content"`
 	}
 
-	content, err := os.ReadFile(validPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for append_chunk: %w", err)
+	}
+
+	if params.WriteID == "" || params.Content == nil {
+		return "", "", fmt.Errorf("write_id and content parameters are required")
+	}
+
+	return params.WriteID, *params.Content, nil
+}
+
+// ParseWriteSessionArgs parses arguments for commit_write and abort_write
+func ParseWriteSessionArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		WriteID string `json:"write_id"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	if params.WriteID == "" {
+		return "", fmt.Errorf("write_id parameter is required")
+	}
+
+	return params.WriteID, nil
+}
+
+// ParseWhichRootArgs parses arguments for which_root
+func ParseWhichRootArgs(args json.RawMessage) (string, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments for which_root: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", fmt.Errorf("path parameter is required")
+	}
+
+	return params.Path, nil
+}
+
+// ParseReadFileFullArgs parses arguments for read_file_full
+func ParseReadFileFullArgs(args json.RawMessage) (string, int64, error) {
+	var params struct {
+		Path     string `json:"path"`
+		MaxBytes int64  `json:"max_bytes"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, fmt.Errorf("invalid arguments for read_file_full: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", 0, fmt.Errorf("path parameter is required")
+	}
+
+	if params.MaxBytes < 0 {
+		return "", 0, fmt.Errorf("max_bytes must not be negative")
+	}
+	if params.MaxBytes == 0 {
+		params.MaxBytes = DefaultReadFullMaxBytes
+	}
+
+	return params.Path, params.MaxBytes, nil
+}
+
+// ParseJSONGetArgs parses arguments for json_get
+func ParseJSONGetArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		Path  string `json:"path"`
+		Query string `json:"query"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for json_get: %w", err)
+	}
+
+	if params.Path == "" {
+		return "", "", fmt.Errorf("path parameter is required")
 	}
 
-	return string(content), nil
+	return params.Path, params.Query, nil
 }
 
-// ReadMultipleFiles reads the contents of multiple files
-func (fm *FileManager) ReadMultipleFiles(paths []string) (string, error) {
-	var results []string
-
-	for _, filePath := range paths {
-		content, err := fm.ReadFile(filePath)
-		if err != nil {
-			results = append(results, fmt.Sprintf("%s: Error - %s", filePath, err.Error()))
-		} else {
-			results = append(results, fmt.Sprintf("%s:\n%s", filePath, content))
-		}
+// ParseWaitForFileArgs parses arguments for wait_for_file
+func ParseWaitForFileArgs(args json.RawMessage) (string, time.Duration, error) {
+	var params struct {
+		Path      string `json:"path"`
+		TimeoutMs *int64 `json:"timeout_ms"`
 	}
 
-	return strings.Join(results, "\n---\n"), nil
-}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, fmt.Errorf("invalid arguments for wait_for_file: %w", err)
+	}
 
-// WriteFile writes content to a file
-func (fm *FileManager) WriteFile(path, content string) error {
-	validPath, err := fm.ValidatePath(path)
-	if err != nil {
-		return err
+	if params.Path == "" {
+		return "", 0, fmt.Errorf("path parameter is required")
 	}
 
-	err = os.WriteFile(validPath, []byte(content), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if params.TimeoutMs == nil {
+		return params.Path, DefaultWaitTimeout, nil
+	}
+	if *params.TimeoutMs < 0 {
+		return "", 0, fmt.Errorf("timeout_ms must not be negative")
 	}
 
-	return nil
+	return params.Path, time.Duration(*params.TimeoutMs) * time.Millisecond, nil
 }
 
-// CreateDirectory creates a directory
-func (fm *FileManager) CreateDirectory(path string) error {
-	validPath, err := fm.ValidatePath(path)
-	if err != nil {
-		return err
+// ParseWatchFileArgs parses arguments for watch_file
+func ParseWatchFileArgs(args json.RawMessage) (string, time.Duration, error) {
+	var params struct {
+		Path           string `json:"path"`
+		TimeoutSeconds *int64 `json:"timeout_seconds"`
 	}
 
-	err = os.MkdirAll(validPath, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", 0, fmt.Errorf("invalid arguments for watch_file: %w", err)
 	}
 
-	return nil
+	if params.Path == "" {
+		return "", 0, fmt.Errorf("path parameter is required")
+	}
+
+	if params.TimeoutSeconds == nil {
+		return params.Path, DefaultWaitTimeout, nil
+	}
+	if *params.TimeoutSeconds < 0 {
+		return "", 0, fmt.Errorf("timeout_seconds must not be negative")
+	}
+
+	return params.Path, time.Duration(*params.TimeoutSeconds) * time.Second, nil
 }
 
-// ListDirectory lists the contents of a directory
-func (fm *FileManager) ListDirectory(path string) (string, error) {
-	validPath, err := fm.ValidatePath(path)
-	if err != nil {
-		return "", err
+// ParseCompareDirectoriesArgs parses arguments for compare_directories
+func ParseCompareDirectoriesArgs(args json.RawMessage) (string, string, bool, error) {
+	var params struct {
+		PathA        string `json:"path_a"`
+		PathB        string `json:"path_b"`
+		IgnoreMtimes bool   `json:"ignore_mtimes"`
 	}
 
-	entries, err := os.ReadDir(validPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read directory: %w", err)
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", false, fmt.Errorf("invalid arguments for compare_directories: %w", err)
 	}
 
-	var result []string
-	for _, entry := range entries {
-		prefix := "[FILE]"
-		if entry.IsDir() {
-			prefix = "[DIR]"
-		}
-		result = append(result, fmt.Sprintf("%s %s", prefix, entry.Name()))
+	if params.PathA == "" || params.PathB == "" {
+		return "", "", false, fmt.Errorf("path_a and path_b parameters are required")
 	}
 
-	return strings.Join(result, "\n"), nil
+	return params.PathA, params.PathB, params.IgnoreMtimes, nil
 }
 
-// MoveFile moves or renames a file or directory
-func (fm *FileManager) MoveFile(source, destination string) error {
-	validSource, err := fm.ValidatePath(source)
-	if err != nil {
-		return err
+// ParseReadBetweenMarkersArgs parses arguments for read_between_markers
+func ParseReadBetweenMarkersArgs(args json.RawMessage) (path, startMarker, endMarker string, inclusive bool, err error) {
+	var params struct {
+		Path        string `json:"path"`
+		StartMarker string `json:"start_marker"`
+		EndMarker   string `json:"end_marker"`
+		Inclusive   bool   `json:"inclusive"`
 	}
 
-	validDest, err := fm.ValidatePath(destination)
-	if err != nil {
-		return err
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", "", false, fmt.Errorf("invalid arguments for read_between_markers: %w", err)
 	}
 
-	err = os.Rename(validSource, validDest)
-	if err != nil {
-		return fmt.Errorf("failed to move file: %w", err)
+	if params.Path == "" || params.StartMarker == "" || params.EndMarker == "" {
+		return "", "", "", false, fmt.Errorf("path, start_marker and end_marker parameters are required")
 	}
 
-	return nil
+	return params.Path, params.StartMarker, params.EndMarker, params.Inclusive, nil
 }
 
-// GetFileInfo gets information about a file
-// Returns JSON with "exists" field - file not found is NOT an error
-func (fm *FileManager) GetFileInfo(path string) (string, error) {
-	validPath, err := fm.ValidatePath(path)
-	if err != nil {
-		return "", err
+// ParseDeleteDirectoryArgs parses arguments for delete_directory
+func ParseDeleteDirectoryArgs(args json.RawMessage) (string, bool, error) {
+	var params struct {
+		Path      string `json:"path"`
+		Recursive bool   `json:"recursive"`
 	}
 
-	info, err := GetFileStats(validPath)
-	if err != nil {
-		// Check if it's a "file not found" error - this is NOT an error condition
-		if os.IsNotExist(err) {
-			result := map[string]interface{}{
-				"exists": false,
-				"path":   validPath,
-			}
-			jsonResult, _ := json.Marshal(result)
-			return string(jsonResult), nil
-		}
-		// Other errors (permissions, etc.) are still returned as errors
-		return "", fmt.Errorf("failed to get file info: %w", err)
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", false, fmt.Errorf("invalid arguments for delete_directory: %w", err)
 	}
 
-	// File exists - return full info with exists: true
-	result := map[string]interface{}{
-		"exists":      true,
-		"path":        validPath,
-		"size":        info.Size,
-		"created":     info.Created,
-		"modified":    info.Modified,
-		"accessed":    info.Accessed,
-		"isDirectory": info.IsDirectory,
-		"isFile":      info.IsFile,
-		"permissions": info.Permissions,
-		"lines":       0, // Will be populated below for text files
-	}
-	
-	// For text files, count lines
-	if info.IsFile && !info.IsDirectory {
-		if lineCount, err := countLines(validPath); err == nil {
-			result["lines"] = lineCount
-		}
+	if params.Path == "" {
+		return "", false, fmt.Errorf("path parameter is required")
 	}
 
-	jsonResult, _ := json.Marshal(result)
-	return string(jsonResult), nil
+	return params.Path, params.Recursive, nil
 }
 
-// countLines counts the number of lines in a text file
-func countLines(filePath string) (int, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return 0, err
+// ParseCopyFileArgs parses arguments for copy_file
+func ParseCopyFileArgs(args json.RawMessage) (string, string, error) {
+	var params struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
 	}
-	defer file.Close()
 
-	lineCount := 0
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lineCount++
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", "", fmt.Errorf("invalid arguments for copy_file: %w", err)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return 0, err
+	if params.Source == "" || params.Destination == "" {
+		return "", "", fmt.Errorf("source and destination parameters are required")
 	}
 
-	return lineCount, nil
-}
-
-// ListAllowedDirectories returns the list of allowed directories
-func (fm *FileManager) ListAllowedDirectories() string {
-	return fmt.Sprintf("Allowed directories:\n%s", strings.Join(fm.originalDirectories, "\n"))
+	return params.Source, params.Destination, nil
 }
 
-// ParseReadFileArgs parses arguments for read_file
-func ParseReadFileArgs(args json.RawMessage) (string, error) {
+// ParseAppendFileArgs parses arguments for append_file
+func ParseAppendFileArgs(args json.RawMessage) (string, string, error) {
 	var params struct {
-		Path string `json:"path"`
+		Path    string `json:"path"`
+		Content string `json:"content"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", fmt.Errorf("invalid arguments for read_file: %w", err)
+		return "", "", fmt.Errorf("invalid arguments for append_file: %w", err)
 	}
-	
+
 	if params.Path == "" {
-		return "", fmt.Errorf("path parameter is required")
+		return "", "", fmt.Errorf("path parameter is required")
 	}
-	
-	return params.Path, nil
+
+	return params.Path, params.Content, nil
 }
 
-// ParseReadMultipleFilesArgs parses arguments for read_multiple_files
-func ParseReadMultipleFilesArgs(args json.RawMessage) ([]string, error) {
+// ParseSearchContentArgs parses arguments for search_content
+func ParseSearchContentArgs(args json.RawMessage) (string, string, ContentSearchOptions, error) {
 	var params struct {
-		Paths []string `json:"paths"`
+		Path          string `json:"path"`
+		Pattern       string `json:"pattern"`
+		CaseSensitive bool   `json:"case_sensitive"`
+		MaxMatches    int    `json:"max_matches"`
+		NamesOnly     bool   `json:"names_only"`
+		Regex         bool   `json:"regex"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, fmt.Errorf("invalid arguments for read_multiple_files: %w", err)
+		return "", "", ContentSearchOptions{}, fmt.Errorf("invalid arguments for search_content: %w", err)
 	}
-	
-	if len(params.Paths) == 0 {
-		return nil, fmt.Errorf("paths parameter is required and must not be empty")
+
+	if params.Path == "" || params.Pattern == "" {
+		return "", "", ContentSearchOptions{}, fmt.Errorf("path and pattern parameters are required")
 	}
-	
-	return params.Paths, nil
+
+	if params.MaxMatches < 0 {
+		return "", "", ContentSearchOptions{}, fmt.Errorf("max_matches must not be negative")
+	}
+
+	options := ContentSearchOptions{
+		CaseSensitive: params.CaseSensitive,
+		MaxMatches:    params.MaxMatches,
+		NamesOnly:     params.NamesOnly,
+		Regex:         params.Regex,
+	}
+	return params.Path, params.Pattern, options, nil
 }
 
-// ParseWriteFileArgs parses arguments for write_file
-func ParseWriteFileArgs(args json.RawMessage) (string, string, error) {
+// ParseFindInFileArgs parses arguments for find_in_file
+func ParseFindInFileArgs(args json.RawMessage) (string, string, ContentSearchOptions, error) {
 	var params struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
+		Path          string `json:"path"`
+		Pattern       string `json:"pattern"`
+		CaseSensitive bool   `json:"case_sensitive"`
+		MaxMatches    int    `json:"max_matches"`
+		Regex         bool   `json:"regex"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", "", fmt.Errorf("invalid arguments for write_file: %w", err)
+		return "", "", ContentSearchOptions{}, fmt.Errorf("invalid arguments for find_in_file: %w", err)
 	}
-	
-	if params.Path == "" {
-		return "", "", fmt.Errorf("path parameter is required")
+
+	if params.Path == "" || params.Pattern == "" {
+		return "", "", ContentSearchOptions{}, fmt.Errorf("path and pattern parameters are required")
 	}
-	
-	return params.Path, params.Content, nil
+
+	if params.MaxMatches < 0 {
+		return "", "", ContentSearchOptions{}, fmt.Errorf("max_matches must not be negative")
+	}
+
+	options := ContentSearchOptions{
+		CaseSensitive: params.CaseSensitive,
+		MaxMatches:    params.MaxMatches,
+		Regex:         params.Regex,
+	}
+	return params.Path, params.Pattern, options, nil
 }
 
-// ParseCreateDirectoryArgs parses arguments for create_directory
-func ParseCreateDirectoryArgs(args json.RawMessage) (string, error) {
+// ParseGlobFilesArgs parses arguments for glob_files
+func ParseGlobFilesArgs(args json.RawMessage) (string, string, error) {
 	var params struct {
-		Path string `json:"path"`
+		Path    string `json:"path"`
+		Pattern string `json:"pattern"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", fmt.Errorf("invalid arguments for create_directory: %w", err)
+		return "", "", fmt.Errorf("invalid arguments for glob_files: %w", err)
 	}
-	
-	if params.Path == "" {
-		return "", fmt.Errorf("path parameter is required")
+
+	if params.Path == "" || params.Pattern == "" {
+		return "", "", fmt.Errorf("path and pattern parameters are required")
 	}
-	
-	return params.Path, nil
+
+	return params.Path, params.Pattern, nil
 }
 
-// ParseListDirectoryArgs parses arguments for list_directory
-func ParseListDirectoryArgs(args json.RawMessage) (string, error) {
+// ParseDirectoryTreeArgs parses arguments for directory_tree
+func ParseDirectoryTreeArgs(args json.RawMessage) (string, int, error) {
 	var params struct {
-		Path string `json:"path"`
+		Path     string `json:"path"`
+		MaxDepth *int   `json:"max_depth"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", fmt.Errorf("invalid arguments for list_directory: %w", err)
+		return "", 0, fmt.Errorf("invalid arguments for directory_tree: %w", err)
 	}
-	
+
 	if params.Path == "" {
-		return "", fmt.Errorf("path parameter is required")
+		return "", 0, fmt.Errorf("path parameter is required")
 	}
-	
-	return params.Path, nil
+
+	maxDepth := DefaultTreeDepth
+	if params.MaxDepth != nil {
+		if *params.MaxDepth < 0 {
+			return "", 0, fmt.Errorf("max_depth must not be negative")
+		}
+		maxDepth = *params.MaxDepth
+	}
+
+	return params.Path, maxDepth, nil
 }
 
-// ParseMoveFileArgs parses arguments for move_file
-func ParseMoveFileArgs(args json.RawMessage) (string, string, error) {
+// ParseHashFileArgs parses arguments for hash_file
+func ParseHashFileArgs(args json.RawMessage) (string, string, error) {
 	var params struct {
-		Source      string `json:"source"`
-		Destination string `json:"destination"`
+		Path      string `json:"path"`
+		Algorithm string `json:"algorithm"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", "", fmt.Errorf("invalid arguments for move_file: %w", err)
+		return "", "", fmt.Errorf("invalid arguments for hash_file: %w", err)
 	}
-	
-	if params.Source == "" || params.Destination == "" {
-		return "", "", fmt.Errorf("source and destination parameters are required")
+
+	if params.Path == "" {
+		return "", "", fmt.Errorf("path parameter is required")
 	}
-	
-	return params.Source, params.Destination, nil
+
+	if params.Algorithm == "" {
+		params.Algorithm = HashSHA256
+	}
+
+	return params.Path, strings.ToLower(params.Algorithm), nil
 }
 
-// ParseSearchFilesArgs parses arguments for search_files
-func ParseSearchFilesArgs(args json.RawMessage) (string, string, error) {
+// ParseReadFileChunkArgs parses arguments for read_file_chunk
+func ParseReadFileChunkArgs(args json.RawMessage) (string, int64, int64, string, error) {
 	var params struct {
-		Path    string `json:"path"`
-		Pattern string `json:"pattern"`
+		Path     string `json:"path"`
+		Offset   int64  `json:"offset"`
+		Size     int64  `json:"size"`
+		Encoding string `json:"encoding"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", "", fmt.Errorf("invalid arguments for search_files: %w", err)
+		return "", 0, 0, "", fmt.Errorf("invalid arguments for read_file_chunk: %w", err)
 	}
-	
-	if params.Path == "" || params.Pattern == "" {
-		return "", "", fmt.Errorf("path and pattern parameters are required")
+
+	if params.Path == "" {
+		return "", 0, 0, "", fmt.Errorf("path parameter is required")
 	}
-	
-	return params.Path, params.Pattern, nil
+
+	if params.Offset < 0 || params.Size < 0 {
+		return "", 0, 0, "", fmt.Errorf("offset and size must not be negative")
+	}
+
+	switch params.Encoding {
+	case "":
+		params.Encoding = EncodingUTF8
+	case EncodingUTF8, EncodingBase64:
+	default:
+		return "", 0, 0, "", fmt.Errorf("invalid encoding %q (use %q or %q)", params.Encoding, EncodingUTF8, EncodingBase64)
+	}
+
+	return params.Path, params.Offset, params.Size, params.Encoding, nil
 }
 
-// ParseGetFileInfoArgs parses arguments for get_file_info
-func ParseGetFileInfoArgs(args json.RawMessage) (string, error) {
+// ParseGetDirectorySizeArgs parses arguments for get_directory_size
+func ParseGetDirectorySizeArgs(args json.RawMessage) (string, error) {
 	var params struct {
 		Path string `json:"path"`
 	}
-	
+
 	if err := json.Unmarshal(args, &params); err != nil {
-		return "", fmt.Errorf("invalid arguments for get_file_info: %w", err)
+		return "", fmt.Errorf("invalid arguments for get_directory_size: %w", err)
 	}
-	
+
 	if params.Path == "" {
 		return "", fmt.Errorf("path parameter is required")
 	}
-	
+
 	return params.Path, nil
 }
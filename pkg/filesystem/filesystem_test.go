@@ -0,0 +1,2543 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newTestDirectory creates a temporary allowed directory with a few files
+func newTestDirectory(t *testing.T) string {
+	t.Helper()
+
+	tmpDir, err := os.MkdirTemp("", "filesystem-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	// Resolve symlinks (e.g. /tmp on macOS) so paths compare as ValidatePath returns them
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to resolve temp dir: %v", err)
+	}
+
+	files := map[string]string{
+		"a.txt":     "alpha",
+		"sub/b.txt": "beta",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	return tmpDir
+}
+
+func TestRelativePathsUseBaseDirectory(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+
+	// Without a base directory, relative paths resolve against the process
+	// working directory (the package directory), which is not allowed
+	if _, err := fm.ValidatePath("a.txt"); err == nil {
+		t.Error("Expected relative path outside allowed directories to be rejected")
+	}
+
+	fm.SetBaseDirectory(tmpDir)
+
+	validPath, err := fm.ValidatePath("sub/b.txt")
+	if err != nil {
+		t.Fatalf("ValidatePath failed: %v", err)
+	}
+	if validPath != filepath.Join(tmpDir, "sub", "b.txt") {
+		t.Errorf("Expected path under base directory, got %s", validPath)
+	}
+
+	// A batch mixing absolute and relative entries resolves both consistently
+	result, err := fm.ReadMultipleFiles([]string{filepath.Join(tmpDir, "a.txt"), "sub/b.txt", "./a.txt"})
+	if err != nil {
+		t.Fatalf("ReadMultipleFiles failed: %v", err)
+	}
+	if strings.Contains(result, "Error") {
+		t.Errorf("Expected every entry to be read, got:\n%s", result)
+	}
+	if strings.Count(result, "alpha") != 2 || !strings.Contains(result, "beta") {
+		t.Errorf("Unexpected ReadMultipleFiles result:\n%s", result)
+	}
+
+	// Searches accept a relative root too
+	matches, err := SearchFiles(fm, "sub", "b.txt", SearchFilesOptions{MaxDepth: -1})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != filepath.Join(tmpDir, "sub", "b.txt") {
+		t.Errorf("Expected one match under the base directory, got %v", matches)
+	}
+
+	// Relative paths still cannot escape the allowed directories
+	if _, err := fm.ValidatePath("../outside.txt"); err == nil {
+		t.Error("Expected relative path escaping the base directory to be rejected")
+	}
+}
+
+func TestSiblingDirectoryWithSharedPrefix(t *testing.T) {
+	parent := newTestDirectory(t)
+	data := filepath.Join(parent, "data")
+	secret := filepath.Join(parent, "data-secret")
+	os.Mkdir(data, 0755)
+	os.Mkdir(secret, 0755)
+	os.WriteFile(filepath.Join(secret, "key.txt"), []byte("secret"), 0644)
+
+	fm := NewFileManager([]string{data})
+
+	// Direct access to the sibling, existing or not
+	for _, path := range []string{secret, filepath.Join(secret, "key.txt"), filepath.Join(secret, "new.txt")} {
+		if _, err := fm.ValidatePath(path); err == nil {
+			t.Errorf("Expected %s to be outside %s", path, data)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(secret, "key.txt"), filepath.Join(data, "key-link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	os.Symlink(secret, filepath.Join(data, "dir-link"))
+
+	// A symlink whose target is in the sibling
+	if _, err := fm.ValidatePath(filepath.Join(data, "key-link")); err == nil {
+		t.Error("Expected symlink into the sibling directory to be rejected")
+	}
+	// A new file whose parent resolves into the sibling
+	if _, err := fm.ValidatePath(filepath.Join(data, "dir-link", "new.txt")); err == nil {
+		t.Error("Expected new file under a symlink into the sibling directory to be rejected")
+	}
+
+	if fm.rootIndex(filepath.Join(secret, "key.txt")) != -1 {
+		t.Error("Expected the sibling directory to belong to no allowed root")
+	}
+
+	// The allowed directory itself and its contents are still accepted
+	for _, path := range []string{data, filepath.Join(data, "new.txt")} {
+		if _, err := fm.ValidatePath(path); err != nil {
+			t.Errorf("Expected %s to be allowed, got: %v", path, err)
+		}
+	}
+}
+
+func TestDeniedPatterns(t *testing.T) {
+	dir := newTestDirectory(t)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "prod.env"), []byte("KEY=1"), 0644)
+
+	fm := NewFileManagerWithDenyList([]string{dir}, []string{"*.env", ".git/", "id_rsa"})
+
+	denied := []string{
+		filepath.Join(dir, ".git"),
+		filepath.Join(dir, ".git", "config"),
+		filepath.Join(dir, "sub", "prod.env"),
+		filepath.Join(dir, "sub", "id_rsa"),
+	}
+	for _, path := range denied {
+		_, err := fm.ValidatePath(path)
+		if err == nil || !strings.Contains(err.Error(), "path matches deny rule") {
+			t.Errorf("Expected %s to be denied, got: %v", path, err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(dir, "sub", "prod.env"), filepath.Join(dir, "settings")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if _, err := fm.ValidatePath(filepath.Join(dir, "settings")); err == nil {
+		t.Error("Expected symlink to a denied file to be rejected")
+	}
+
+	for _, path := range []string{dir, filepath.Join(dir, "a.txt"), filepath.Join(dir, "sub", "env.txt")} {
+		if _, err := fm.ValidatePath(path); err != nil {
+			t.Errorf("Expected %s to be allowed, got: %v", path, err)
+		}
+	}
+}
+
+func TestRenamePattern(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+
+	for _, name := range []string{"foo_1.txt", "foo_2.txt", "foo_3.log"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	// Dry run reports the plan without renaming
+	result, err := fm.RenamePattern(tmpDir, "foo_*.txt", "bar_$1.txt", true)
+	if err != nil {
+		t.Fatalf("RenamePattern dry run failed: %v", err)
+	}
+	if !strings.Contains(result, `"count":2`) {
+		t.Errorf("Expected two planned renames, got %s", result)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "foo_1.txt")); err != nil {
+		t.Error("Dry run must not rename files")
+	}
+
+	if _, err := fm.RenamePattern(tmpDir, "foo_*.txt", "bar_$1.txt", false); err != nil {
+		t.Fatalf("RenamePattern failed: %v", err)
+	}
+	for _, name := range []string{"bar_1.txt", "bar_2.txt", "foo_3.log"} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		} else if !strings.HasSuffix(name, ".log") && string(content) != strings.Replace(name, "bar", "foo", 1) {
+			t.Errorf("%s has wrong content %q", name, string(content))
+		}
+	}
+
+	// Two sources mapping to one name is rejected before anything changes
+	if _, err := fm.RenamePattern(tmpDir, "bar_?.txt", "same.txt", false); err == nil {
+		t.Error("Expected collision error, got nil")
+	}
+	// So is renaming onto an existing entry that is not itself being renamed
+	if _, err := fm.RenamePattern(tmpDir, "bar_1.txt", "a.txt", false); err == nil {
+		t.Error("Expected collision with existing file, got nil")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "bar_1.txt")); err != nil {
+		t.Error("Rejected renames must leave files in place")
+	}
+
+	// A target may reuse a name that is itself being renamed away ("f" -> "fx", "fx" -> "fxx")
+	for _, name := range []string{"f", "fx"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if _, err := fm.RenamePattern(tmpDir, "f*", "f${1}x", false); err != nil {
+		t.Fatalf("RenamePattern chain failed: %v", err)
+	}
+	for name, want := range map[string]string{"fx": "f", "fxx": "fx"} {
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("Expected %s to contain %q, got %q (%v)", name, want, string(content), err)
+		}
+	}
+}
+
+func TestRenamePatternTemplates(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.WriteFile(filepath.Join(dir, "secret.env"), []byte("KEY=1"), 0644)
+
+	for _, replacement := range []string{"$1_old.txt", "${2}.txt", "$name.txt", "${x}.txt"} {
+		if _, err := fm.RenamePattern(dir, "*.env", replacement, true); err == nil {
+			t.Errorf("Expected %q to be rejected as an unknown capture", replacement)
+		}
+	}
+	// Captures that expand to nothing must not leave a bare extension
+	if _, err := fm.RenamePattern(dir, "secret*.env", "$1.txt", true); err == nil {
+		t.Error("Expected a new name with nothing before its extension to be rejected")
+	}
+
+	for replacement, want := range map[string]string{
+		"${1}_old.txt": "secret_old.txt",
+		"$1.txt":       "secret.txt",
+		"$$$1.env":     "$secret.env",
+		"${1.env":      "${1.env",
+	} {
+		result, err := fm.RenamePattern(dir, "*.env", replacement, true)
+		if err != nil {
+			t.Errorf("%q: RenamePattern failed: %v", replacement, err)
+		} else if !strings.Contains(result, `"to":"`+want+`"`) {
+			t.Errorf("%q: expected a rename to %s, got %s", replacement, want, result)
+		}
+	}
+}
+
+func TestRenamePatternDeniedPaths(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManagerWithDenyList([]string{dir}, []string{"*.env"})
+	for _, name := range []string{"secret.env", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	// Renaming a denied file away would make it readable
+	if _, err := fm.RenamePattern(dir, "*.env", "$1.txt", false); err == nil {
+		t.Error("Expected renaming a denied file to be rejected")
+	}
+	// Renaming onto a denied name would hide the file from every tool
+	if _, err := fm.RenamePattern(dir, "*.txt", "$1.env", true); err == nil {
+		t.Error("Expected renaming to a denied name to be rejected")
+	}
+
+	// The whole batch is refused, so nothing moved
+	for _, name := range []string{"secret.env", "notes.txt", "a.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be left in place: %v", name, err)
+		}
+	}
+	if _, err := fm.ReadFile(filepath.Join(dir, "secret.txt")); err == nil {
+		t.Error("Expected no readable copy of the denied file")
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+	fm.SetMaxOpenFiles(1)
+
+	// Hold the only slot so the read has to wait for it
+	release := fm.acquireFile()
+	done := make(chan error, 1)
+	go func() {
+		_, err := fm.ReadFile(filepath.Join(tmpDir, "a.txt"))
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("ReadFile did not wait for a free open file slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ReadFile failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ReadFile did not proceed after the slot was released")
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+
+	// sha256("alpha") and md5("beta")
+	manifest := []ManifestEntry{
+		{Path: "a.txt", Hash: "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8"},
+		{Path: "sub/b.txt", Hash: "md5:987bcab01b929eb2c07877b224215c92"},
+	}
+
+	result, err := fm.VerifyManifest(tmpDir, manifest, "", true)
+	if err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+	if !strings.Contains(result, `"ok":true`) {
+		t.Errorf("Expected manifest to match, got %s", result)
+	}
+
+	// Drift: a changed file, a missing file and an extra file
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "extra.txt"), []byte("extra"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	manifest = append(manifest, ManifestEntry{Path: "gone.txt", Hash: "00"})
+
+	result, err = fm.VerifyManifest(tmpDir, manifest, "", true)
+	if err != nil {
+		t.Fatalf("VerifyManifest failed: %v", err)
+	}
+	for _, want := range []string{`"ok":false`, `"mismatched":[{"path":"a.txt"`, `"missing":["gone.txt"]`, `"extra":["extra.txt"]`, `"matched":["sub/b.txt"]`} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Expected %s in result, got %s", want, result)
+		}
+	}
+}
+
+func TestWriteQuota(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManagerWithDirectories([]AllowedDirectory{{Path: tmpDir, MaxSearchDepth: -1, WriteQuota: 12}})
+	target := filepath.Join(tmpDir, "sub", "quota.txt")
+
+	// Rewriting a file in place still uses up the quota
+	for i := 0; i < 2; i++ {
+		if err := fm.WriteFile(target, "hello"); err != nil {
+			t.Fatalf("WriteFile %d failed: %v", i, err)
+		}
+	}
+	if err := fm.WriteFile(target, "hello"); err == nil || !strings.Contains(err.Error(), "write quota exceeded") {
+		t.Errorf("Expected quota error on third rewrite, got: %v", err)
+	}
+	if err := fm.AppendFile(target, "ab"); err != nil {
+		t.Errorf("AppendFile within the quota failed: %v", err)
+	}
+	if err := fm.AppendFile(target, "c"); err == nil || !strings.Contains(err.Error(), "write quota exceeded") {
+		t.Errorf("Expected quota error from AppendFile, got: %v", err)
+	}
+
+	// Writes made for other components are charged the same way
+	if _, err := fm.ReserveWrite(target, 1); err == nil || !strings.Contains(err.Error(), "write quota exceeded") {
+		t.Errorf("Expected quota error from ReserveWrite, got: %v", err)
+	}
+
+	// Deleting refunds the deleted bytes
+	if err := fm.DeleteDirectory(filepath.Join(tmpDir, "sub"), true); err != nil {
+		t.Fatalf("DeleteDirectory failed: %v", err)
+	}
+	cancel, err := fm.ReserveWrite(filepath.Join(tmpDir, "a.txt"), 7)
+	if err != nil {
+		t.Fatalf("ReserveWrite after delete failed: %v", err)
+	}
+	cancel()
+	if err := fm.WriteFile(filepath.Join(tmpDir, "a.txt"), "1234567"); err != nil {
+		t.Errorf("WriteFile after a cancelled reservation failed: %v", err)
+	}
+}
+
+func TestChunkedWrite(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+	fm.SetMaxWriteBytes(10)
+	target := filepath.Join(tmpDir, "a.txt")
+
+	id, err := fm.BeginWrite(target)
+	if err != nil {
+		t.Fatalf("BeginWrite failed: %v", err)
+	}
+	for _, chunk := range []string{"one ", "two ", "3"} {
+		if _, err := fm.AppendChunk(id, chunk); err != nil {
+			t.Fatalf("AppendChunk failed: %v", err)
+		}
+	}
+
+	// The destination is untouched until commit
+	if content, _ := os.ReadFile(target); string(content) != "alpha" {
+		t.Errorf("Destination changed before commit: %q", string(content))
+	}
+
+	// The size cap applies to the accumulated total
+	if _, err := fm.AppendChunk(id, "four"); err == nil {
+		t.Error("Expected size limit error for accumulated total, got nil")
+	}
+
+	path, size, err := fm.CommitWrite(id)
+	if err != nil {
+		t.Fatalf("CommitWrite failed: %v", err)
+	}
+	if path != target || size != 9 {
+		t.Errorf("Expected %s with 9 bytes, got %s with %d", target, path, size)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "one two 3" {
+		t.Errorf("Unexpected committed content %q", string(content))
+	}
+	if _, err := fm.AppendChunk(id, "x"); err == nil {
+		t.Error("Expected error appending to a committed session, got nil")
+	}
+
+	// Aborting leaves the destination alone and removes the partial file
+	id, err = fm.BeginWrite(target)
+	if err != nil {
+		t.Fatalf("BeginWrite failed: %v", err)
+	}
+	if _, err := fm.AppendChunk(id, "discard"); err != nil {
+		t.Fatalf("AppendChunk failed: %v", err)
+	}
+	if err := fm.AbortWrite(id); err != nil {
+		t.Fatalf("AbortWrite failed: %v", err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "one two 3" {
+		t.Errorf("Destination changed by aborted write: %q", string(content))
+	}
+	if partials, _ := filepath.Glob(filepath.Join(tmpDir, ".a.txt.*.partial")); len(partials) != 0 {
+		t.Errorf("Expected partial files to be removed, found %v", partials)
+	}
+}
+
+func TestBareFilenameRoot(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	otherDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir, otherDir})
+	fm.SetBaseDirectory(otherDir)
+	fm.SetBareFilenameRoot(tmpDir)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		// Bare filenames go to the designated root
+		{"a.txt", filepath.Join(tmpDir, "a.txt")},
+		// Anything with a directory part resolves like any relative path
+		{"./a.txt", filepath.Join(otherDir, "a.txt")},
+		{"sub/b.txt", filepath.Join(otherDir, "sub", "b.txt")},
+		// Absolute paths are unchanged
+		{filepath.Join(otherDir, "a.txt"), filepath.Join(otherDir, "a.txt")},
+	}
+
+	for _, tt := range tests {
+		validPath, err := fm.ValidatePath(tt.path)
+		if err != nil {
+			t.Errorf("%s: ValidatePath failed: %v", tt.path, err)
+			continue
+		}
+		if validPath != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.path, tt.expected, validPath)
+		}
+	}
+
+	for _, path := range []string{".", ".."} {
+		if isBareFilename(path) {
+			t.Errorf("%q must not be treated as a bare filename", path)
+		}
+	}
+}
+
+func TestSplitContentLines(t *testing.T) {
+	tests := []struct {
+		content         string
+		lines           []string
+		trailingNewline bool
+	}{
+		{"", []string{}, false},
+		{"\n", []string{""}, true},
+		{"one", []string{"one"}, false},
+		{"one\ntwo\n", []string{"one", "two"}, true},
+		{"one\r\ntwo\r\n", []string{"one", "two"}, true},
+		{"one\n\ntwo", []string{"one", "", "two"}, false},
+	}
+
+	for _, tt := range tests {
+		lines, trailingNewline := SplitContentLines(tt.content)
+		if strings.Join(lines, "|") != strings.Join(tt.lines, "|") || len(lines) != len(tt.lines) {
+			t.Errorf("%q: expected lines %q, got %q", tt.content, tt.lines, lines)
+		}
+		if trailingNewline != tt.trailingNewline {
+			t.Errorf("%q: expected trailingNewline %v, got %v", tt.content, tt.trailingNewline, trailingNewline)
+		}
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct {
+		content  string
+		tabWidth int
+		want     string
+	}{
+		{"\tx", 4, "    x"},
+		{"ab\tx", 4, "ab  x"},
+		{"abcd\tx", 4, "abcd    x"},
+		{"a\tb\tc", 2, "a b c"},
+		{"\tx\n\ty", 2, "  x\n  y"},
+		{"\tx\r\n\ty", 2, "  x\r\n  y"},
+		{"é\tx", 4, "é   x"},
+		{"\tx", 0, "\tx"},
+		{"no tabs", 4, "no tabs"},
+	}
+
+	for _, tt := range tests {
+		if got := ExpandTabs(tt.content, tt.tabWidth); got != tt.want {
+			t.Errorf("%q with width %d: expected %q, got %q", tt.content, tt.tabWidth, tt.want, got)
+		}
+	}
+
+	for args, want := range map[string]int{
+		`{"path": "a.txt"}`:                                      0,
+		`{"path": "a.txt", "expand_tabs": true}`:                 DefaultTabWidth,
+		`{"path": "a.txt", "expand_tabs": true, "tab_width": 2}`: 2,
+		`{"path": "a.txt", "tab_width": 2}`:                      0,
+	} {
+		_, options, err := ParseReadFileArgs(json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("ParseReadFileArgs(%s) failed: %v", args, err)
+		}
+		if options.TabWidth != want {
+			t.Errorf("%s: expected tab width %d, got %d", args, want, options.TabWidth)
+		}
+	}
+	for _, args := range []string{
+		`{"path": "a.txt", "expand_tabs": true, "tab_width": -1}`,
+		`{"path": "a.txt", "expand_tabs": true, "encoding": "base64"}`,
+	} {
+		if _, _, err := ParseReadFileArgs(json.RawMessage(args)); err == nil {
+			t.Errorf("Expected %s to be rejected", args)
+		}
+	}
+}
+
+func TestReadFileFull(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	result, err := fm.ReadFileFull(filepath.Join(dir, "a.txt"), DefaultReadFullMaxBytes)
+	if err != nil {
+		t.Fatalf("ReadFileFull failed: %v", err)
+	}
+	var full map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &full); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if full["content"] != "alpha" || full["truncated"] != false || full["isBinary"] != false {
+		t.Errorf("Unexpected content fields: %s", result)
+	}
+	// sha256("alpha")
+	if full["sha256"] != "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8" {
+		t.Errorf("Unexpected hash: %v", full["sha256"])
+	}
+	if !strings.HasPrefix(full["mimeType"].(string), "text/plain") {
+		t.Errorf("Expected text/plain, got: %v", full["mimeType"])
+	}
+
+	// Truncation keeps whole characters and the hash still covers the whole file
+	unicodePath := filepath.Join(dir, "u.txt")
+	if err := os.WriteFile(unicodePath, []byte("aé\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = fm.ReadFileFull(unicodePath, 2)
+	if err != nil {
+		t.Fatalf("ReadFileFull failed: %v", err)
+	}
+	full = nil
+	json.Unmarshal([]byte(result), &full)
+	if full["content"] != "a" || full["truncated"] != true || full["trailingNewline"] != true || full["size"] != float64(4) {
+		t.Errorf("Unexpected truncated result: %s", result)
+	}
+
+	// Binary files report metadata but no content
+	binaryPath := filepath.Join(dir, "b.bin")
+	if err := os.WriteFile(binaryPath, []byte{0, 1, 2}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err = fm.ReadFileFull(binaryPath, DefaultReadFullMaxBytes)
+	if err != nil {
+		t.Fatalf("ReadFileFull failed: %v", err)
+	}
+	if strings.Contains(result, `"content"`) || !strings.Contains(result, `"isBinary":true`) {
+		t.Errorf("Expected binary result without content, got: %s", result)
+	}
+}
+
+func TestJSONGet(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	jsonPath := filepath.Join(dir, "data.json")
+	document := `{"meta":{"count":5},"items":[{"id":0,"tags":["a"]},{"id":1,"tags":["b","c"]},{"id":2},{"id":3},{"id":4}]}`
+	if err := os.WriteFile(jsonPath, []byte(document), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"meta.count", `5`},
+		{"items[1:3]", `[{"id":1,"tags":["b","c"]},{"id":2}]`},
+		{"items[3:]", `[{"id":3},{"id":4}]`},
+		{"items[:2].id", `[0,1]`},
+		{"items[0:2].tags[0]", `["a","b"]`},
+		{"items[4].id", `4`},
+		{"items[9:12]", `[]`},
+	}
+
+	for _, tt := range tests {
+		result, err := fm.JSONGet(jsonPath, tt.query)
+		if err != nil {
+			t.Errorf("%s: JSONGet failed: %v", tt.query, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.query, tt.expected, result)
+		}
+	}
+
+	for _, query := range []string{"missing", "items[7]", "meta[0]", "items[-1]", "items[2:1]"} {
+		if _, err := fm.JSONGet(jsonPath, query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestWaitForFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	// A file that never appears times out without an error
+	result, err := fm.WaitForFile(filepath.Join(dir, "never.txt"), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitForFile failed: %v", err)
+	}
+	if !strings.Contains(result, `"appeared":false`) {
+		t.Errorf("Expected the file not to appear, got: %s", result)
+	}
+
+	// A file created while waiting is reported with its metadata
+	target := filepath.Join(dir, "later.txt")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// Rename into place so the file never appears half-written
+		os.WriteFile(target+".tmp", []byte("done"), 0644)
+		os.Rename(target+".tmp", target)
+	}()
+	result, err = fm.WaitForFile(target, 5*time.Second)
+	if err != nil {
+		t.Fatalf("WaitForFile failed: %v", err)
+	}
+	if !strings.Contains(result, `"appeared":true`) || !strings.Contains(result, `"size":4`) {
+		t.Errorf("Expected the file to appear with its metadata, got: %s", result)
+	}
+
+	// Timeouts are capped by the configured maximum
+	fm.SetMaxWait(10 * time.Millisecond)
+	start := time.Now()
+	if _, err := fm.WaitForFile(filepath.Join(dir, "never.txt"), time.Hour); err != nil {
+		t.Fatalf("WaitForFile failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the wait to be capped, took %v", elapsed)
+	}
+}
+
+func TestWatchPath(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	ctx := context.Background()
+
+	// Nothing changing times out without an error
+	result, err := fm.WatchPath(ctx, filepath.Join(dir, "a.txt"), 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchPath failed: %v", err)
+	}
+	if !strings.Contains(result, `"timedOut":true`) {
+		t.Errorf("Expected a timeout, got: %s", result)
+	}
+
+	// A write to a watched file is reported
+	target := filepath.Join(dir, "a.txt")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(target, []byte("changed"), 0644)
+	}()
+	result, err = fm.WatchPath(ctx, target, 5*time.Second)
+	if err != nil {
+		t.Fatalf("WatchPath failed: %v", err)
+	}
+	if !strings.Contains(result, `"event":"write"`) {
+		t.Errorf("Expected a write event, got: %s", result)
+	}
+
+	// A file created in a watched directory is reported with its path
+	created := filepath.Join(dir, "sub", "new.txt")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.WriteFile(created, []byte("new"), 0644)
+	}()
+	result, err = fm.WatchPath(ctx, filepath.Join(dir, "sub"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("WatchPath failed: %v", err)
+	}
+	if !strings.Contains(result, `"event":"create"`) || !strings.Contains(result, strconv.Quote(created)) {
+		t.Errorf("Expected a create event for %s, got: %s", created, result)
+	}
+
+	// Cancelling the context ends the wait with an error
+	cancelled, cancel := context.WithCancel(ctx)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := fm.WatchPath(cancelled, target, 5*time.Second); err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("Expected the watch to be cancelled, got %v", err)
+	}
+
+	// Paths outside the allowed directories are rejected
+	if _, err := fm.WatchPath(ctx, t.TempDir(), time.Second); err == nil {
+		t.Error("Expected a path outside the allowed directories to be rejected")
+	}
+}
+
+func TestReadMultipleFilesJSON(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	paths := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "missing.txt"), filepath.Join(dir, "sub", "b.txt")}
+	result, err := fm.ReadMultipleFilesJSON(paths)
+	if err != nil {
+		t.Fatalf("ReadMultipleFilesJSON failed: %v", err)
+	}
+
+	var results []FileReadResult
+	if err := json.Unmarshal([]byte(result), &results); err != nil {
+		t.Fatalf("Expected a JSON array, got %s: %v", result, err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected one result per path, got %d", len(results))
+	}
+	if results[0].Path != paths[0] || results[0].Content != "alpha" || results[0].Error != "" {
+		t.Errorf("Unexpected result for a.txt: %+v", results[0])
+	}
+	if results[1].Error == "" || results[1].Content != "" {
+		t.Errorf("Expected an error for the missing file, got %+v", results[1])
+	}
+	if results[2].Content != "beta" {
+		t.Errorf("Unexpected result for b.txt: %+v", results[2])
+	}
+
+	// The text format stays the default
+	if _, format, err := ParseReadMultipleFilesArgs(json.RawMessage(`{"paths":["a"]}`)); err != nil || format != MultiReadFormatText {
+		t.Errorf("Expected the text format by default, got %q (%v)", format, err)
+	}
+	if _, _, err := ParseReadMultipleFilesArgs(json.RawMessage(`{"paths":["a"],"format":"xml"}`)); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
+
+func TestListDirectoryPagination(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	for i, name := range []string{"c.txt", "d.txt", "e.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Repeat("x", 10*(i+1))), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// Without options the listing is unchanged: every entry by name, no total
+	listing, err := fm.ListDirectory(dir, ListDirectoryOptions{})
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+	if listing != "[FILE] a.txt\n[FILE] c.txt\n[FILE] d.txt\n[FILE] e.txt\n[DIR] sub" {
+		t.Errorf("Unexpected full listing:\n%s", listing)
+	}
+
+	listing, err = fm.ListDirectory(dir, ListDirectoryOptions{Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+	if listing != "[FILE] c.txt\n[FILE] d.txt\nTotal: 5 entries (showing 2-3)" {
+		t.Errorf("Unexpected page:\n%s", listing)
+	}
+
+	listing, err = fm.ListDirectory(dir, ListDirectoryOptions{Offset: 1, Limit: math.MaxInt})
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+	if !strings.HasSuffix(listing, "Total: 5 entries (showing 2-5)") {
+		t.Errorf("Expected a huge limit to list the rest, got:\n%s", listing)
+	}
+
+	listing, _ = fm.ListDirectory(dir, ListDirectoryOptions{Offset: 10})
+	if listing != "Total: 5 entries (none shown at offset 10)" {
+		t.Errorf("Unexpected listing past the end:\n%s", listing)
+	}
+
+	// Largest first
+	listing, _ = fm.ListDirectory(dir, ListDirectoryOptions{Limit: 2, SortBy: ListSortSize})
+	if !strings.HasPrefix(listing, "[FILE] e.txt\n[FILE] d.txt\n") {
+		t.Errorf("Expected the largest files first, got:\n%s", listing)
+	}
+
+	// Most recently modified first
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "c.txt", "d.txt", "e.txt", "sub"} {
+		os.Chtimes(filepath.Join(dir, name), old, old)
+	}
+	os.Chtimes(filepath.Join(dir, "d.txt"), time.Now(), time.Now())
+	listing, _ = fm.ListDirectory(dir, ListDirectoryOptions{Limit: 1, SortBy: ListSortModified})
+	if !strings.HasPrefix(listing, "[FILE] d.txt\n") {
+		t.Errorf("Expected the newest file first, got:\n%s", listing)
+	}
+
+	if _, err := fm.ListDirectory(dir, ListDirectoryOptions{SortBy: "color"}); err == nil {
+		t.Error("Expected an unknown sort order to be rejected")
+	}
+	if _, _, err := ParseListDirectoryArgs(json.RawMessage(`{"path":"x","limit":-1}`)); err == nil {
+		t.Error("Expected a negative limit to be rejected")
+	}
+}
+
+func TestCompareDirectories(t *testing.T) {
+	dirA := newTestDirectory(t)
+	dirB := newTestDirectory(t)
+	fm := NewFileManager([]string{dirA, dirB})
+
+	os.WriteFile(filepath.Join(dirA, "only-a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dirB, "only-b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(dirB, "a.txt"), []byte("alphabet"), 0644)
+	// Same size, different content, with matching modification times
+	os.WriteFile(filepath.Join(dirB, "sub", "b.txt"), []byte("BETA"), 0644)
+	stamp := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dirA, "sub", "b.txt"), stamp, stamp)
+	os.Chtimes(filepath.Join(dirB, "sub", "b.txt"), stamp, stamp)
+
+	var result struct {
+		OnlyInA   []string         `json:"onlyInA"`
+		OnlyInB   []string         `json:"onlyInB"`
+		Differing []fileDifference `json:"differing"`
+		Identical int              `json:"identical"`
+	}
+
+	output, err := fm.CompareDirectories(dirA, dirB, false)
+	if err != nil {
+		t.Fatalf("CompareDirectories failed: %v", err)
+	}
+	json.Unmarshal([]byte(output), &result)
+	if strings.Join(result.OnlyInA, ",") != "only-a.txt" || strings.Join(result.OnlyInB, ",") != "only-b.txt" {
+		t.Errorf("Unexpected one-sided files: %s", output)
+	}
+	// Matching size and mtime are trusted without hashing
+	if len(result.Differing) != 1 || result.Differing[0] != (fileDifference{Path: "a.txt", Reason: "size"}) || result.Identical != 1 {
+		t.Errorf("Unexpected differences: %s", output)
+	}
+
+	output, err = fm.CompareDirectories(dirA, dirB, true)
+	if err != nil {
+		t.Fatalf("CompareDirectories failed: %v", err)
+	}
+	result.Differing = nil
+	json.Unmarshal([]byte(output), &result)
+	if len(result.Differing) != 2 || result.Differing[1] != (fileDifference{Path: "sub/b.txt", Reason: "content"}) {
+		t.Errorf("Expected hashing to find the content difference: %s", output)
+	}
+}
+
+func TestCompareDirectoriesSkipsDeniedPaths(t *testing.T) {
+	dirA := newTestDirectory(t)
+	dirB := newTestDirectory(t)
+	fm := NewFileManagerWithDenyList([]string{dirA, dirB}, []string{"*.env", "private"})
+
+	os.WriteFile(filepath.Join(dirA, "prod.env"), []byte("KEY=1"), 0644)
+	os.WriteFile(filepath.Join(dirB, "prod.env"), []byte("KEY=2"), 0644)
+	os.WriteFile(filepath.Join(dirA, "sub", "only-a.env"), []byte("KEY=3"), 0644)
+	os.MkdirAll(filepath.Join(dirB, "private"), 0755)
+	os.WriteFile(filepath.Join(dirB, "private", "notes.txt"), []byte("secret"), 0644)
+
+	output, err := fm.CompareDirectories(dirA, dirB, true)
+	if err != nil {
+		t.Fatalf("CompareDirectories failed: %v", err)
+	}
+	for _, name := range []string{"prod.env", "only-a.env", "private", "notes.txt"} {
+		if strings.Contains(output, name) {
+			t.Errorf("Expected denied path %s to be left out, got %s", name, output)
+		}
+	}
+	if !strings.Contains(output, `"identical":2`) {
+		t.Errorf("Expected the allowed files to still be compared, got %s", output)
+	}
+}
+
+func TestFindMarkerRegion(t *testing.T) {
+	content := "keep\n# BEGIN\none\ntwo\n# END\ntail\n"
+	region, err := FindMarkerRegion(content, "BEGIN", "END")
+	if err != nil {
+		t.Fatalf("FindMarkerRegion failed: %v", err)
+	}
+	if region.StartLine != 2 || region.EndLine != 5 {
+		t.Errorf("Expected marker lines 2 and 5, got %d and %d", region.StartLine, region.EndLine)
+	}
+	if inner := content[region.InnerStart:region.InnerEnd]; inner != "one\ntwo\n" {
+		t.Errorf("Unexpected inner content: %q", inner)
+	}
+	if outer := content[region.OuterStart:region.OuterEnd]; outer != "# BEGIN\none\ntwo\n# END\n" {
+		t.Errorf("Unexpected outer content: %q", outer)
+	}
+
+	// Identical markers pair up with the next occurrence
+	if region, err := FindMarkerRegion("---\na: 1\n---\nbody\n", "---", "---"); err != nil || region.EndLine != 3 {
+		t.Errorf("Expected identical markers to pair, got %+v (%v)", region, err)
+	}
+
+	failures := map[string]string{
+		"no markers":   "text\n",
+		"no end":       "# BEGIN\ntext\n",
+		"end first":    "# END\n# BEGIN\n# END\n",
+		"nested start": "# BEGIN\n# BEGIN\n# END\n",
+		"start only":   "# BEGIN",
+	}
+	for name, text := range failures {
+		if _, err := FindMarkerRegion(text, "BEGIN", "END"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDeleteDirectory(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	sub := filepath.Join(dir, "sub")
+
+	err := fm.DeleteDirectory(sub, false)
+	if err == nil || !strings.Contains(err.Error(), "1 entries remain") {
+		t.Errorf("Expected non-empty error naming the remaining entries, got: %v", err)
+	}
+
+	// A symlink leading out of the sandbox blocks the whole recursive delete
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(sub, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := fm.DeleteDirectory(sub, true); err == nil {
+		t.Error("Expected recursive delete to refuse a tree with an escaping symlink")
+	}
+	if _, err := os.Stat(filepath.Join(sub, "b.txt")); err != nil {
+		t.Errorf("Expected nothing to be deleted, got: %v", err)
+	}
+
+	os.Remove(filepath.Join(sub, "escape"))
+	if err := fm.DeleteDirectory(sub, true); err != nil {
+		t.Fatalf("DeleteDirectory failed: %v", err)
+	}
+	if _, err := os.Stat(sub); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be deleted, got: %v", sub, err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	os.Mkdir(empty, 0755)
+	if err := fm.DeleteDirectory(empty, false); err != nil {
+		t.Errorf("Expected empty directory to be deleted, got: %v", err)
+	}
+
+	if err := fm.DeleteDirectory(dir, true); err == nil {
+		t.Error("Expected deleting an allowed directory to fail")
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	script := filepath.Join(dir, "run.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	os.Chmod(script, 0750)
+
+	copied := filepath.Join(dir, "copy.sh")
+	if err := fm.CopyFile(script, copied); err != nil {
+		t.Fatalf("CopyFile failed: %v", err)
+	}
+	info, err := os.Stat(copied)
+	if err != nil {
+		t.Fatalf("Expected copy to exist: %v", err)
+	}
+	if info.Mode().Perm() != 0750 {
+		t.Errorf("Expected mode 0750, got %v", info.Mode().Perm())
+	}
+
+	if err := fm.CopyFile(script, filepath.Join(dir, "a.txt")); err == nil {
+		t.Error("Expected copy over an existing file to fail")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "alpha" {
+		t.Errorf("Expected existing file to be untouched, got %q", string(data))
+	}
+
+	if err := fm.CopyFile(filepath.Join(dir, "sub"), filepath.Join(dir, "sub", "inner")); err == nil {
+		t.Error("Expected copying a directory into itself to fail")
+	}
+
+	if err := fm.CopyFile(filepath.Join(dir, "sub"), filepath.Join(dir, "sub2")); err != nil {
+		t.Fatalf("CopyFile of directory failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "sub2", "b.txt")); err != nil || string(data) != "beta" {
+		t.Errorf("Expected sub2/b.txt to contain beta, got %q (%v)", string(data), err)
+	}
+
+	// A symlink leading out of the sandbox blocks the whole copy
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "sub", "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := fm.CopyFile(filepath.Join(dir, "sub"), filepath.Join(dir, "sub3")); err == nil {
+		t.Error("Expected copy of a tree with an escaping symlink to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub3")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be copied, got: %v", err)
+	}
+}
+
+func TestReadFileRange(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	path := filepath.Join(dir, "log.txt")
+	os.WriteFile(path, []byte("one\ntwo\nthree\nfour"), 0644)
+
+	tests := []struct {
+		options ReadFileOptions
+		want    string
+	}{
+		{ReadFileOptions{}, "one\ntwo\nthree\nfour"},
+		{ReadFileOptions{Offset: 4, Length: 3}, "two"},
+		{ReadFileOptions{Offset: 8}, "three\nfour"},
+		{ReadFileOptions{Offset: 100}, ""},
+		{ReadFileOptions{Head: 2}, "one\ntwo\n"},
+		{ReadFileOptions{Tail: 2}, "three\nfour"},
+		{ReadFileOptions{Tail: 10}, "one\ntwo\nthree\nfour"},
+		{ReadFileOptions{Offset: 4, Head: 1}, "two\n"},
+	}
+	for _, tt := range tests {
+		got, err := fm.ReadFileRange(path, tt.options)
+		if err != nil {
+			t.Errorf("ReadFileRange(%+v) failed: %v", tt.options, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ReadFileRange(%+v) = %q, want %q", tt.options, got, tt.want)
+		}
+	}
+
+	if _, _, err := ParseReadFileArgs(json.RawMessage(`{"path":"x","head":1,"tail":1}`)); err == nil {
+		t.Error("Expected head with tail to be rejected")
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	path := filepath.Join(dir, "app.log")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fm.AppendFile(path, "line\n"); err != nil {
+				t.Errorf("AppendFile failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read appended file: %v", err)
+	}
+	if string(data) != strings.Repeat("line\n", 20) {
+		t.Errorf("Unexpected content after concurrent appends: %q", string(data))
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm()&^0644 != 0 {
+		t.Errorf("Expected created file to have at most mode 0644, got %v", info.Mode().Perm())
+	}
+
+	if err := fm.AppendFile(filepath.Join(dir, "a.txt"), "!"); err != nil {
+		t.Fatalf("AppendFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "alpha!" {
+		t.Errorf("Expected alpha!, got %q", string(data))
+	}
+}
+
+func TestSearchContent(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.WriteFile(filepath.Join(dir, "sub", "log.txt"), []byte("Alpha one\nbeta\nALPHA two\r\nalpha three\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "bin.dat"), []byte("alpha\x00"), 0644)
+
+	results, err := SearchContent(fm, dir, "alpha", ContentSearchOptions{})
+	if err != nil {
+		t.Fatalf("SearchContent failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "a.txt") + ":1:alpha",
+		filepath.Join(dir, "sub", "log.txt") + ":1:Alpha one",
+		filepath.Join(dir, "sub", "log.txt") + ":3:ALPHA two",
+		filepath.Join(dir, "sub", "log.txt") + ":4:alpha three",
+	}
+	if strings.Join(results, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected results:\n%s", strings.Join(results, "\n"))
+	}
+
+	results, _ = SearchContent(fm, dir, "ALPHA", ContentSearchOptions{CaseSensitive: true})
+	if len(results) != 1 || !strings.HasSuffix(results[0], ":3:ALPHA two") {
+		t.Errorf("Expected one case-sensitive match, got %v", results)
+	}
+
+	results, _ = SearchContent(fm, dir, "alpha", ContentSearchOptions{MaxMatches: 1})
+	if len(results) != 3 || !strings.Contains(results[2], "further matches omitted") {
+		t.Errorf("Expected per-file truncation note, got %v", results)
+	}
+
+	results, _ = SearchContent(fm, dir, "alpha", ContentSearchOptions{NamesOnly: true})
+	if len(results) != 2 || results[1] != filepath.Join(dir, "sub", "log.txt") {
+		t.Errorf("Expected two file names, got %v", results)
+	}
+
+	fm.SetMaxSearchFileBytes(5)
+	results, _ = SearchContent(fm, dir, "alpha", ContentSearchOptions{})
+	if len(results) != 1 {
+		t.Errorf("Expected large files to be skipped, got %v", results)
+	}
+}
+
+func TestFindInFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	log := filepath.Join(dir, "log.txt")
+	if err := os.WriteFile(log, []byte("Alpha one\nbeta\n  alpha two\nalpha three\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	results, err := FindInFile(fm, log, "alpha", ContentSearchOptions{})
+	if err != nil {
+		t.Fatalf("FindInFile failed: %v", err)
+	}
+	if want := "1:Alpha one\n3:  alpha two\n4:alpha three"; strings.Join(results, "\n") != want {
+		t.Errorf("Unexpected results:\n%s", strings.Join(results, "\n"))
+	}
+
+	results, _ = FindInFile(fm, log, "alpha", ContentSearchOptions{MaxMatches: 2})
+	if len(results) != 3 || results[1] != "3:  alpha two" || !strings.HasPrefix(results[2], "further matches omitted after 2") {
+		t.Errorf("Expected two matches and a truncation note, got %v", results)
+	}
+
+	results, _ = FindInFile(fm, log, "^a.*e$", ContentSearchOptions{Regex: true, CaseSensitive: true})
+	if len(results) != 1 || results[0] != "4:alpha three" {
+		t.Errorf("Expected one regex match, got %v", results)
+	}
+
+	// The search size cap does not apply to a single streamed file
+	fm.SetMaxSearchFileBytes(5)
+	if results, _ := FindInFile(fm, log, "beta", ContentSearchOptions{}); len(results) != 1 {
+		t.Errorf("Expected a match in a file over the search size cap, got %v", results)
+	}
+
+	if _, err := FindInFile(fm, filepath.Join(dir, "sub"), "beta", ContentSearchOptions{}); err == nil {
+		t.Error("Expected searching a directory to fail")
+	}
+}
+
+func TestSearchRegex(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\nfunc main() {}\n"), 0644)
+
+	matches, err := SearchFiles(fm, dir, `\.go$`, SearchFilesOptions{Regex: true, MaxDepth: -1})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != filepath.Join(dir, "main.go") {
+		t.Errorf("Expected only main.go, got %v", matches)
+	}
+
+	// Substring matching is unchanged: the pattern is not a regex by default
+	if matches, _ := SearchFiles(fm, dir, `\.go$`, SearchFilesOptions{MaxDepth: -1}); len(matches) != 0 {
+		t.Errorf("Expected no substring matches, got %v", matches)
+	}
+
+	if _, err := SearchFiles(fm, dir, "(", SearchFilesOptions{Regex: true, MaxDepth: -1}); err == nil || !strings.Contains(err.Error(), "invalid regex") {
+		t.Errorf("Expected invalid regex error, got: %v", err)
+	}
+
+	results, err := SearchContent(fm, dir, `^FUNC \w+\(`, ContentSearchOptions{Regex: true})
+	if err != nil {
+		t.Fatalf("SearchContent failed: %v", err)
+	}
+	if len(results) != 1 || !strings.HasSuffix(results[0], ":2:func main() {}") {
+		t.Errorf("Expected one regex content match, got %v", results)
+	}
+	if _, err := SearchContent(fm, dir, "[", ContentSearchOptions{Regex: true}); err == nil {
+		t.Error("Expected invalid regex to be rejected")
+	}
+}
+
+func TestGlobFiles(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "deep", "c.txt"), []byte("gamma"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "deep", "c.json"), []byte("{}"), 0644)
+
+	tests := []struct {
+		glob string
+		want []string
+	}{
+		{"*.txt", []string{"a.txt"}},
+		{"**/*.txt", []string{"a.txt", "sub/b.txt", "sub/deep/c.txt"}},
+		{"sub/**/*.txt", []string{"sub/b.txt", "sub/deep/c.txt"}},
+		{"sub/*/c.*", []string{"sub/deep/c.json", "sub/deep/c.txt"}},
+		{"**/deep", []string{"sub/deep"}},
+		{"*.md", []string{}},
+	}
+	for _, tt := range tests {
+		got, err := GlobFiles(fm, dir, tt.glob)
+		if err != nil {
+			t.Errorf("GlobFiles(%q) failed: %v", tt.glob, err)
+			continue
+		}
+		want := make([]string, len(tt.want))
+		for i, rel := range tt.want {
+			want[i] = filepath.Join(dir, filepath.FromSlash(rel))
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("GlobFiles(%q) = %v, want %v", tt.glob, got, want)
+		}
+	}
+
+	if _, err := GlobFiles(fm, dir, "[a"); err == nil {
+		t.Error("Expected malformed glob to be rejected")
+	}
+}
+
+func TestSearchFilesMaxDepth(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "deep", "c.txt"), []byte("gamma"), 0644)
+
+	for depth, want := range map[int]int{-1: 3, 0: 1, 1: 2, 2: 3} {
+		matches, err := SearchFiles(fm, dir, ".txt", SearchFilesOptions{MaxDepth: depth})
+		if err != nil {
+			t.Fatalf("SearchFiles failed: %v", err)
+		}
+		if len(matches) != want {
+			t.Errorf("max_depth %d: expected %d matches, got %v", depth, want, matches)
+		}
+	}
+}
+
+func TestDirectoryMaxSearchDepth(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManagerWithDirectories([]AllowedDirectory{{Path: dir, MaxSearchDepth: 1}})
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "deep", "c.txt"), []byte("alpha"), 0644)
+
+	// The configured depth caps unlimited and deeper requests but not stricter ones
+	for depth, want := range map[int]int{-1: 2, 0: 1, 1: 2, 5: 2} {
+		matches, err := SearchFiles(fm, dir, ".txt", SearchFilesOptions{MaxDepth: depth})
+		if err != nil {
+			t.Fatalf("SearchFiles failed: %v", err)
+		}
+		if len(matches) != want {
+			t.Errorf("max_depth %d: expected %d matches, got %v", depth, want, matches)
+		}
+	}
+
+	// The depth counts from the allowed directory, not the search start
+	matches, err := SearchFiles(fm, filepath.Join(dir, "sub"), ".txt", SearchFilesOptions{MaxDepth: -1})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("Expected only sub/b.txt, got %v", matches)
+	}
+	if _, err := SearchFiles(fm, filepath.Join(dir, "sub", "deep"), ".txt", SearchFilesOptions{MaxDepth: -1}); err == nil {
+		t.Error("Expected a search starting below the configured depth to be refused")
+	}
+
+	content, err := SearchContent(fm, dir, "alpha", ContentSearchOptions{})
+	if err != nil {
+		t.Fatalf("SearchContent failed: %v", err)
+	}
+	if len(content) != 1 {
+		t.Errorf("Expected search_content to stop at the configured depth, got %v", content)
+	}
+}
+
+func TestSearchFilesReportsProgress(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	for i := 0; i < SearchProgressInterval; i++ {
+		os.WriteFile(filepath.Join(dir, "f"+strconv.Itoa(i)+".dat"), nil, 0644)
+	}
+
+	var reports []int
+	options := SearchFilesOptions{MaxDepth: -1, Progress: func(scanned int) { reports = append(reports, scanned) }}
+	if _, err := SearchFiles(fm, dir, ".txt", options); err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+
+	// The root, a.txt, sub, sub/b.txt and the added files: one report at the
+	// interval and a final one with the total
+	total := SearchProgressInterval + 4
+	if len(reports) != 2 || reports[0] != SearchProgressInterval || reports[1] != total {
+		t.Errorf("Expected reports [%d %d], got %v", SearchProgressInterval, total, reports)
+	}
+}
+
+func TestDirectoryTree(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	result, err := fm.DirectoryTree(dir, DefaultTreeDepth)
+	if err != nil {
+		t.Fatalf("DirectoryTree failed: %v", err)
+	}
+	var root TreeNode
+	if err := json.Unmarshal([]byte(result), &root); err != nil {
+		t.Fatalf("Failed to decode tree: %v", err)
+	}
+	if len(root.Children) != 2 || root.Children[1].Name != "sub" || root.Children[1].Type != "directory" {
+		t.Fatalf("Unexpected root children: %s", result)
+	}
+	for _, child := range root.Children[1].Children {
+		if child.Name == "loop" && (!child.Symlink || child.Type != "directory" || child.Children != nil) {
+			t.Errorf("Expected symlinked directory to be listed without children: %+v", child)
+		}
+	}
+
+	result, _ = fm.DirectoryTree(dir, 0)
+	var shallow TreeNode
+	json.Unmarshal([]byte(result), &shallow)
+	if sub := shallow.Children[1]; !sub.Truncated || sub.Children != nil {
+		t.Errorf("Expected sub to be truncated at depth 0: %s", result)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	// A missing file is created empty
+	created := filepath.Join(dir, "placeholder")
+	if err := fm.Touch(created); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if info, err := os.Stat(created); err != nil || info.Size() != 0 {
+		t.Fatalf("Expected an empty file, got %v (%v)", info, err)
+	}
+
+	// An existing file keeps its content and gets a new modification time
+	existing := filepath.Join(dir, "a.txt")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(existing, old, old); err != nil {
+		t.Fatalf("Failed to set times: %v", err)
+	}
+	if err := fm.Touch(existing); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	info, _ := os.Stat(existing)
+	if time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("Expected the modification time to be now, got %v", info.ModTime())
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "alpha" {
+		t.Errorf("Expected the content to be unchanged, got %q", string(data))
+	}
+
+	if err := fm.Touch(filepath.Join(t.TempDir(), "outside")); err == nil {
+		t.Error("Expected a path outside the allowed directories to be rejected")
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	// A relative target is stored as given and resolved from the link's directory
+	link := filepath.Join(dir, "sub", "a-link")
+	if err := fm.CreateSymlink("../a.txt", link); err != nil {
+		t.Fatalf("CreateSymlink failed: %v", err)
+	}
+	if target, err := fm.ReadLink(link); err != nil || target != "../a.txt" {
+		t.Errorf("Expected ../a.txt, got %q (%v)", target, err)
+	}
+	if content, err := fm.ReadFile(link); err != nil || content != "alpha" {
+		t.Errorf("Expected to read through the link, got %q (%v)", content, err)
+	}
+
+	if err := fm.CreateSymlink("a.txt", link); err == nil {
+		t.Error("Expected an existing link path to be rejected")
+	}
+	if _, err := fm.ReadLink(filepath.Join(dir, "a.txt")); err == nil {
+		t.Error("Expected reading a regular file as a link to fail")
+	}
+
+	// Targets escaping the allowed directories are refused, however written
+	outside := t.TempDir()
+	escapes := map[string]string{
+		"absolute": outside,
+		"relative": "../../" + filepath.Base(outside),
+		"dotdot":   "../../../../../../../../etc/passwd",
+	}
+	for name, target := range escapes {
+		escape := filepath.Join(dir, "sub", "escape-"+name)
+		if err := fm.CreateSymlink(target, escape); err == nil {
+			t.Errorf("%s: expected target %s to be refused", name, target)
+		}
+		if _, err := os.Lstat(escape); err == nil {
+			t.Errorf("%s: expected no link to be created", name)
+		}
+	}
+
+	// ".." after a symlink climbs from where the symlink points, not lexically
+	os.Mkdir(filepath.Join(outside, "inner"), 0755)
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644)
+	if err := os.Symlink(filepath.Join(outside, "inner"), filepath.Join(dir, "s")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	through := filepath.Join(dir, "through")
+	for _, target := range []string{"s/../secret", filepath.Join(dir, "s") + "/../secret"} {
+		if err := fm.CreateSymlink(target, through); err == nil {
+			os.Remove(through)
+			t.Errorf("Expected target %s to be refused", target)
+		}
+	}
+	if err := fm.CreateSymlink("missing/../../"+filepath.Base(outside)+"/secret", through); err == nil {
+		t.Error("Expected '..' after a missing component to be refused")
+	}
+	if err := fm.CreateSymlink("sub/../a.txt", through); err != nil {
+		t.Errorf("Expected '..' through a real directory to be allowed, got: %v", err)
+	}
+
+	// The link itself must be within the allowed directories too
+	if err := fm.CreateSymlink(filepath.Join(dir, "a.txt"), filepath.Join(outside, "in-link")); err == nil {
+		t.Error("Expected a link outside the allowed directories to be refused")
+	}
+}
+
+func TestReadOnlyDirectory(t *testing.T) {
+	dir := newTestDirectory(t)
+	writable := t.TempDir()
+	fm := NewFileManagerWithDirectories([]AllowedDirectory{
+		{Path: dir, MaxSearchDepth: -1, ReadOnly: true},
+		{Path: writable, MaxSearchDepth: -1},
+	})
+
+	if _, err := fm.ReadFile(filepath.Join(dir, "a.txt")); err != nil {
+		t.Errorf("Expected reads to be allowed, got: %v", err)
+	}
+	if fm.IsWritable(filepath.Join(dir, "a.txt")) || !fm.IsWritable(filepath.Join(writable, "x.txt")) {
+		t.Error("Unexpected IsWritable results")
+	}
+
+	checks := map[string]error{
+		"write_file":       fm.WriteFile(filepath.Join(dir, "a.txt"), "changed"),
+		"append_file":      fm.AppendFile(filepath.Join(dir, "a.txt"), "!"),
+		"create_directory": fm.CreateDirectory(filepath.Join(dir, "new")),
+		"touch_file":       fm.Touch(filepath.Join(dir, "a.txt")),
+		"create_symlink":   fm.CreateSymlink("a.txt", filepath.Join(dir, "link")),
+		"move out":         fm.MoveFile(filepath.Join(dir, "a.txt"), filepath.Join(writable, "a.txt")),
+		"move in":          fm.MoveFile(filepath.Join(writable), filepath.Join(dir, "moved")),
+		"delete_directory": fm.DeleteDirectory(filepath.Join(dir, "sub"), true),
+	}
+	for name, err := range checks {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: expected read-only error, got: %v", name, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "alpha" {
+		t.Errorf("Expected read-only file to be unchanged, got %q", string(data))
+	}
+
+	// Copying out of a read-only directory is fine
+	if err := fm.CopyFile(filepath.Join(dir, "a.txt"), filepath.Join(writable, "a.txt")); err != nil {
+		t.Errorf("Expected copy out of a read-only directory to work, got: %v", err)
+	}
+}
+
+func TestFileModes(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	fm.SetFileModes(0600, 0700)
+
+	if err := fm.WriteFile(filepath.Join(dir, "private.txt"), "x"); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := fm.CreateDirectory(filepath.Join(dir, "private")); err != nil {
+		t.Fatalf("CreateDirectory failed: %v", err)
+	}
+	id, err := fm.BeginWrite(filepath.Join(dir, "chunked.txt"))
+	if err != nil {
+		t.Fatalf("BeginWrite failed: %v", err)
+	}
+	if _, _, err := fm.CommitWrite(id); err != nil {
+		t.Fatalf("CommitWrite failed: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{"private.txt": 0600, "private": 0700, "chunked.txt": 0600} {
+		info, err := os.Stat(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatalf("Stat failed: %v", err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s: expected mode %v, got %v", path, want, info.Mode().Perm())
+		}
+	}
+}
+
+func TestGetFileStatsTimes(t *testing.T) {
+	dir := newTestDirectory(t)
+	path := filepath.Join(dir, "a.txt")
+
+	// Push the access and modification times apart so they cannot be confused
+	accessed := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	modified := time.Now().Add(-1 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, accessed, modified); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	info, err := GetFileStats(path)
+	if err != nil {
+		t.Fatalf("GetFileStats failed: %v", err)
+	}
+	if !info.Modified.Equal(modified) {
+		t.Errorf("Expected modified %v, got %v", modified, info.Modified)
+	}
+	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		if !info.Accessed.Equal(accessed) {
+			t.Errorf("Expected accessed %v, got %v", accessed, info.Accessed)
+		}
+		if info.Created.Equal(modified) {
+			t.Errorf("Expected a real creation time, got the modification time %v", info.Created)
+		}
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	path := filepath.Join(dir, "a.txt")
+
+	tests := map[string]string{
+		"":       "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8",
+		"sha256": "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8",
+		"sha1":   "be76331b95dfc399cd776d2fc68021e0db03cc4f",
+		"md5":    "2c1743a391305fbf367df8e4f069f9f9",
+	}
+	for algorithm, want := range tests {
+		got, err := fm.HashFile(path, algorithm)
+		if err != nil {
+			t.Errorf("HashFile(%q) failed: %v", algorithm, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("HashFile(%q) = %s, want %s", algorithm, got, want)
+		}
+	}
+
+	if _, err := fm.HashFile(path, "crc32"); err == nil || !strings.Contains(err.Error(), "unsupported hash algorithm") {
+		t.Errorf("Expected unsupported algorithm error, got: %v", err)
+	}
+	if _, err := fm.HashFile(dir, ""); err == nil {
+		t.Error("Expected hashing a directory to fail")
+	}
+}
+
+func TestContentType(t *testing.T) {
+	dir := newTestDirectory(t)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	os.WriteFile(filepath.Join(dir, "image.dat"), png, 0644)
+	os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"a": 1}`), 0644)
+
+	tests := map[string]string{
+		"image.dat": "image/png",
+		"data.json": "application/json",
+		"a.txt":     "text/plain; charset=utf-8",
+		"sub":       "",
+	}
+	for name, want := range tests {
+		info, err := GetFileStats(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("GetFileStats failed: %v", err)
+		}
+		if info.ContentType != want {
+			t.Errorf("%s: expected content type %q, got %q", name, want, info.ContentType)
+		}
+	}
+
+	fm := NewFileManager([]string{dir})
+	result, err := fm.GetFileInfo(filepath.Join(dir, "image.dat"))
+	if err != nil || !strings.Contains(result, `"contentType":"image/png"`) {
+		t.Errorf("Expected contentType in get_file_info output, got %s (%v)", result, err)
+	}
+}
+
+func TestBase64RoundTrip(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\r', '\n'}
+	encoded := base64.StdEncoding.EncodeToString(binary)
+
+	args, _ := json.Marshal(map[string]string{"path": filepath.Join(dir, "image.png"), "content": encoded, "encoding": "base64"})
+	path, content, err := ParseWriteFileArgs(args)
+	if err != nil {
+		t.Fatalf("ParseWriteFileArgs failed: %v", err)
+	}
+	if err := fm.WriteFile(path, content); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, binary) {
+		t.Errorf("Expected decoded bytes on disk, got %v", data)
+	}
+
+	_, options, err := ParseReadFileArgs(json.RawMessage(`{"path":"x","encoding":"base64"}`))
+	if err != nil {
+		t.Fatalf("ParseReadFileArgs failed: %v", err)
+	}
+	got, err := fm.ReadFileRange(path, options)
+	if err != nil {
+		t.Fatalf("ReadFileRange failed: %v", err)
+	}
+	if got != encoded {
+		t.Errorf("Expected %s, got %s", encoded, got)
+	}
+
+	if _, _, err := ParseWriteFileArgs(json.RawMessage(`{"path":"x","content":"not base64!","encoding":"base64"}`)); err == nil {
+		t.Error("Expected invalid base64 to be rejected")
+	}
+	if _, _, err := ParseReadFileArgs(json.RawMessage(`{"path":"x","encoding":"latin1"}`)); err == nil {
+		t.Error("Expected unknown encoding to be rejected")
+	}
+}
+
+func TestMaxReadBytes(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	fm.SetMaxReadBytes(3)
+
+	_, err := fm.ReadFile(filepath.Join(dir, "a.txt"))
+	if err == nil || !strings.Contains(err.Error(), "file too large: 5 bytes exceeds limit 3") {
+		t.Fatalf("Expected size limit error, got: %v", err)
+	}
+	if results, _ := fm.ReadMultipleFiles([]string{filepath.Join(dir, "a.txt")}); !strings.Contains(results, "file too large") {
+		t.Errorf("Expected read_multiple_files to report the limit, got: %q", results)
+	}
+
+	// A range within the limit is still readable
+	content, err := fm.ReadFileRange(filepath.Join(dir, "a.txt"), ReadFileOptions{Offset: 1, Length: 3})
+	if err != nil || content != "lph" {
+		t.Errorf("Expected ranged read under the limit, got %q (%v)", content, err)
+	}
+
+	fm.SetMaxReadBytes(0)
+	if content, err := fm.ReadFile(filepath.Join(dir, "a.txt")); err != nil || content != "alpha" {
+		t.Errorf("Expected unlimited read, got %q (%v)", content, err)
+	}
+}
+
+func TestReadFileChunk(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	path := filepath.Join(dir, "a.txt")
+
+	var content string
+	for offset := int64(0); ; {
+		chunk, err := fm.ReadFileChunk(path, offset, 2, EncodingUTF8)
+		if err != nil {
+			t.Fatalf("ReadFileChunk failed: %v", err)
+		}
+		if chunk.TotalSize != 5 {
+			t.Errorf("Expected total size 5, got %d", chunk.TotalSize)
+		}
+		content += chunk.Content
+		offset += int64(chunk.Size)
+		if chunk.EOF {
+			break
+		}
+	}
+	if content != "alpha" {
+		t.Errorf("Expected chunks to reassemble to alpha, got %q", content)
+	}
+
+	chunk, err := fm.ReadFileChunk(path, 1, 3, EncodingBase64)
+	if err != nil || chunk.Content != base64.StdEncoding.EncodeToString([]byte("lph")) {
+		t.Errorf("Expected base64 chunk of lph, got %+v (%v)", chunk, err)
+	}
+
+	chunk, err = fm.ReadFileChunk(path, 10, 3, EncodingUTF8)
+	if err != nil || chunk.Size != 0 || !chunk.EOF {
+		t.Errorf("Expected empty chunk past the end, got %+v (%v)", chunk, err)
+	}
+
+	if _, err := fm.ReadFileChunk(path, -1, 3, EncodingUTF8); err == nil {
+		t.Error("Expected negative offset to be rejected")
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(filepath.Join(dir, "sub", fmt.Sprintf("f%d.txt", i)), []byte("x"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	// sub holds itself and six files, one more than the limit
+	fm.SetMaxEntries(6)
+	checks := map[string]func() error{
+		"CopyFile": func() error { return fm.CopyFile(filepath.Join(dir, "sub"), filepath.Join(dir, "copy")) },
+		"DirectorySize": func() error {
+			_, _, err := fm.DirectorySize(filepath.Join(dir, "sub"))
+			return err
+		},
+		"SearchFiles": func() error {
+			_, err := SearchFiles(fm, filepath.Join(dir, "sub"), "f", SearchFilesOptions{})
+			return err
+		},
+		"DeleteDirectory": func() error { return fm.DeleteDirectory(filepath.Join(dir, "sub"), true) },
+	}
+	for name, check := range checks {
+		if err := check(); !errors.Is(err, ErrTooManyEntries) {
+			t.Errorf("%s: expected too many entries error, got: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "copy")); !os.IsNotExist(err) {
+		t.Error("Expected an aborted copy to create nothing")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "f0.txt")); err != nil {
+		t.Error("Expected an aborted delete to remove nothing")
+	}
+
+	// At the limit, or with the guard disabled, the operations run
+	fm.SetMaxEntries(7)
+	if err := fm.CopyFile(filepath.Join(dir, "sub"), filepath.Join(dir, "copy")); err != nil {
+		t.Errorf("CopyFile at the limit failed: %v", err)
+	}
+	fm.SetMaxEntries(0)
+	if _, _, err := fm.DirectorySize(dir); err != nil {
+		t.Errorf("DirectorySize without a limit failed: %v", err)
+	}
+}
+
+func TestDirectorySize(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+
+	// A symlink to a file must not count it twice
+	if err := os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	size, files, err := fm.DirectorySize(dir)
+	if err != nil {
+		t.Fatalf("DirectorySize failed: %v", err)
+	}
+	if size != int64(len("alpha")+len("beta")) || files != 2 {
+		t.Errorf("Expected 9 bytes in 2 files, got %d bytes in %d files", size, files)
+	}
+
+	if _, _, err := fm.DirectorySize(filepath.Join(dir, "a.txt")); err == nil {
+		t.Error("Expected an error for a file path")
+	}
+
+	for bytes, want := range map[int64]string{512: "512 B", 1536: "1.5 KB", 5 << 20: "5.0 MB", 3 << 30: "3.0 GB"} {
+		if got := FormatSize(bytes); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
+
+func TestAtomicWrite(t *testing.T) {
+	dir := newTestDirectory(t)
+	path := filepath.Join(dir, "a.txt")
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Chmod failed: %v", err)
+	}
+
+	if err := AtomicWrite(path, []byte("replaced"), 0644); err != nil {
+		t.Fatalf("AtomicWrite failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "replaced" {
+		t.Errorf("Expected new content, got %q", string(data))
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected existing permissions to be kept, got %v", info.Mode().Perm())
+	}
+
+	// A symlink is written through, not replaced
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(path, link); err == nil {
+		if err := AtomicWrite(link, []byte("via link"), 0644); err != nil {
+			t.Fatalf("AtomicWrite through symlink failed: %v", err)
+		}
+		if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+			t.Error("Expected the symlink to survive the write")
+		}
+		if data, _ := os.ReadFile(path); string(data) != "via link" {
+			t.Errorf("Expected the target to be written, got %q", string(data))
+		}
+	}
+
+	// No temp files are left behind
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(leftovers) != 0 {
+		t.Errorf("Expected no temp files, found %v", leftovers)
+	}
+}
+
+func TestResources(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+
+	// One file per page walks the whole listing through cursors
+	var names []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Expected the listing to end")
+		}
+		files, next, err := fm.ListResources(cursor, 1)
+		if err != nil {
+			t.Fatalf("ListResources failed: %v", err)
+		}
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if strings.Join(names, ",") != "a.txt,sub/b.txt" {
+		t.Errorf("Expected a.txt,sub/b.txt, got %v", names)
+	}
+	if _, _, err := fm.ListResources("bogus", 0); err == nil {
+		t.Error("Expected an invalid cursor to be rejected")
+	}
+
+	path := filepath.Join(tmpDir, "sub", "b.txt")
+	uri := FileURI(path)
+	if !strings.HasPrefix(uri, "file:///") {
+		t.Errorf("Expected a file:/// URI, got %s", uri)
+	}
+	if back, err := PathFromFileURI(uri); err != nil || back != path {
+		t.Errorf("Expected %s back from %s, got %s (%v)", path, uri, back, err)
+	}
+	if _, err := PathFromFileURI("http://example.com/a.txt"); err == nil {
+		t.Error("Expected a non-file URI to be rejected")
+	}
+
+	file, content, err := fm.ReadResource(path)
+	if err != nil {
+		t.Fatalf("ReadResource failed: %v", err)
+	}
+	if string(content) != "beta" || file.Binary {
+		t.Errorf("Expected text content beta, got %q (binary %v)", content, file.Binary)
+	}
+
+	binary := filepath.Join(tmpDir, "data.bin")
+	os.WriteFile(binary, []byte{0x00, 0xff, 0x01}, 0644)
+	if file, _, err := fm.ReadResource(binary); err != nil || !file.Binary {
+		t.Errorf("Expected binary content to be detected (%v)", err)
+	}
+	if _, _, err := fm.ReadResource(filepath.Join(tmpDir, "sub")); err == nil {
+		t.Error("Expected a directory to be rejected")
+	}
+}
+
+func TestResourceWatcher(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+
+	notified := make(chan string, 10)
+	watcher, err := NewResourceWatcher(fm, 50*time.Millisecond, func(path string, sessions []string) {
+		if len(sessions) != 1 || sessions[0] != "s1" {
+			t.Errorf("Expected only s1 to be notified, got %v", sessions)
+		}
+		notified <- path
+	})
+	if err != nil {
+		t.Skipf("File watching unavailable: %v", err)
+	}
+	defer watcher.Close()
+
+	path := filepath.Join(tmpDir, "a.txt")
+	if _, err := watcher.Subscribe("s1", path); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if _, err := watcher.Subscribe("s1", filepath.Join(tmpDir, "sub")); err == nil {
+		t.Error("Expected a directory subscription to be rejected")
+	}
+	// Another session subscribed to another file in the directory
+	if _, err := watcher.Subscribe("s2", filepath.Join(tmpDir, "b.txt")); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// A burst of writes, ending in a replace by rename, is reported once
+	for i := 0; i < 5; i++ {
+		os.WriteFile(path, []byte(strings.Repeat("x", i)), 0644)
+	}
+	AtomicWrite(path, []byte("replaced"), 0644)
+	select {
+	case got := <-notified:
+		if got != path {
+			t.Errorf("Expected notification for %s, got %s", path, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change notification")
+	}
+	select {
+	case got := <-notified:
+		t.Errorf("Expected one debounced notification, got another for %s", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Other files in the directory are not reported, nor files once unsubscribed
+	os.WriteFile(filepath.Join(tmpDir, "other.txt"), []byte("x"), 0644)
+	watcher.CloseSession("s1")
+	os.WriteFile(path, []byte("after"), 0644)
+	select {
+	case got := <-notified:
+		t.Errorf("Expected no notification, got one for %s", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+
+	summarize, ok := FindPromptTemplate("summarize_file")
+	if !ok {
+		t.Fatal("Expected the summarize_file prompt")
+	}
+	text, err := fm.RenderPrompt(summarize, filepath.Join(tmpDir, "a.txt"))
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if !strings.HasPrefix(text, "Summarize the file") || !strings.Contains(text, "\nalpha\n</file>") {
+		t.Errorf("Expected the file content embedded, got %q", text)
+	}
+
+	review, _ := FindPromptTemplate("review_directory")
+	text, err = fm.RenderPrompt(review, tmpDir)
+	if err != nil {
+		t.Fatalf("RenderPrompt failed: %v", err)
+	}
+	if !strings.Contains(text, `"b.txt"`) {
+		t.Errorf("Expected the directory tree embedded, got %q", text)
+	}
+
+	// The path must suit the template and be allowed
+	if _, err := fm.RenderPrompt(summarize, tmpDir); err == nil {
+		t.Error("Expected a directory to be rejected by a file prompt")
+	}
+	if _, err := fm.RenderPrompt(review, filepath.Join(tmpDir, "a.txt")); err == nil {
+		t.Error("Expected a file to be rejected by a directory prompt")
+	}
+	if _, err := fm.RenderPrompt(summarize, filepath.Join(filepath.Dir(tmpDir), "outside.txt")); err == nil {
+		t.Error("Expected a path outside the allowed directories to be rejected")
+	}
+	if _, ok := FindPromptTemplate("missing"); ok {
+		t.Error("Expected an unknown prompt not to be found")
+	}
+}
+
+func TestReadWithIncludes(t *testing.T) {
+	tmpDir := newTestDirectory(t)
+	fm := NewFileManager([]string{tmpDir})
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		return path
+	}
+
+	top := write("main.c", "top\n#include \"sub/b.txt\"\nbottom\n")
+	result, err := fm.ReadWithIncludes(top, "", 0)
+	if err != nil {
+		t.Fatalf("ReadWithIncludes failed: %v", err)
+	}
+	if result != "top\nbeta\nbottom\n" {
+		t.Errorf("Unexpected expansion: %q", result)
+	}
+
+	// Cycles are reported rather than followed
+	cycle := write("x.h", "#include \"y.h\"\n")
+	write("y.h", "#include \"x.h\"\n")
+	if _, err := fm.ReadWithIncludes(cycle, "", 0); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Expected include cycle error, got: %v", err)
+	}
+
+	// A chain deeper than max_depth fails, and max_depth cannot exceed the server maximum
+	for i := 0; i < MaxIncludeDepth+2; i++ {
+		write(fmt.Sprintf("chain%d.h", i), fmt.Sprintf("#include \"chain%d.h\"\n", i+1))
+	}
+	write(fmt.Sprintf("chain%d.h", MaxIncludeDepth+2), "end\n")
+	chain := filepath.Join(tmpDir, "chain0.h")
+	if _, err := fm.ReadWithIncludes(chain, "", 3); err == nil || !strings.Contains(err.Error(), "include depth exceeds 3") {
+		t.Errorf("Expected depth error for max_depth 3, got: %v", err)
+	}
+	if _, err := fm.ReadWithIncludes(chain, "", 1000); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("include depth exceeds %d", MaxIncludeDepth)) {
+		t.Errorf("Expected max_depth to be clamped to %d, got: %v", MaxIncludeDepth, err)
+	}
+
+	// Repeated includes count every time against the size limit
+	write("leaf.h", strings.Repeat("x", 100)+"\n")
+	write("twice.h", "#include \"leaf.h\"\n#include \"leaf.h\"\n")
+	wide := write("wide.h", "#include \"twice.h\"\n#include \"twice.h\"\n")
+	if _, err := fm.ReadWithIncludes(wide, "", 0); err != nil {
+		t.Fatalf("ReadWithIncludes within the limit failed: %v", err)
+	}
+	fm.SetMaxReadBytes(300)
+	if _, err := fm.ReadWithIncludes(wide, "", 0); err == nil || !strings.Contains(err.Error(), "exceeds the read size limit") {
+		t.Errorf("Expected size limit error, got: %v", err)
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	a := filepath.Join(dir, "a.txt")
+
+	same := func(path1, path2 string) bool {
+		t.Helper()
+		result, err := fm.SameFile(path1, path2)
+		if err != nil {
+			t.Fatalf("SameFile(%s, %s) failed: %v", path1, path2, err)
+		}
+		var decoded struct {
+			SameFile bool `json:"sameFile"`
+		}
+		if err := json.Unmarshal([]byte(result), &decoded); err != nil {
+			t.Fatalf("Failed to decode %s: %v", result, err)
+		}
+		return decoded.SameFile
+	}
+
+	if !same(a, filepath.Join(dir, "sub", "..", "a.txt")) {
+		t.Error("Expected two spellings of one path to be the same file")
+	}
+	if same(a, filepath.Join(dir, "sub", "b.txt")) {
+		t.Error("Expected different files not to be the same file")
+	}
+
+	// A copy with identical content is still a different file
+	copied := filepath.Join(dir, "copy.txt")
+	os.WriteFile(copied, []byte("alpha"), 0644)
+	if same(a, copied) {
+		t.Error("Expected a copy not to be the same file")
+	}
+
+	if err := os.Link(a, filepath.Join(dir, "hard.txt")); err == nil {
+		if !same(a, filepath.Join(dir, "hard.txt")) {
+			t.Error("Expected a hard link to be the same file")
+		}
+	}
+	if runtime.GOOS != "windows" {
+		os.Symlink(a, filepath.Join(dir, "soft.txt"))
+		if !same(a, filepath.Join(dir, "soft.txt")) {
+			t.Error("Expected a symlink to be the same file as its target")
+		}
+	}
+
+	if _, err := fm.SameFile(a, filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expected a missing path to fail")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	fm := NewFileManager([]string{t.TempDir()})
+
+	// failing returns an op that fails with err the first failures times
+	failing := func(err error, failures int) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= failures {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+	busy := &fs.PathError{Op: "open", Path: "x", Err: syscall.EBUSY}
+
+	// Retries are off by default
+	op, calls := failing(busy, 1)
+	if err := fm.withRetry(op); !errors.Is(err, syscall.EBUSY) || *calls != 1 {
+		t.Errorf("Expected one attempt without a policy, got %d (%v)", *calls, err)
+	}
+
+	fm.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: 5 * time.Millisecond})
+	op, calls = failing(busy, 2)
+	start := time.Now()
+	if err := fm.withRetry(op); err != nil || *calls != 3 {
+		t.Errorf("Expected success on the third attempt, got %d attempts (%v)", *calls, err)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("Expected backoff of 5ms then 10ms, took %v", elapsed)
+	}
+
+	// Attempts are bounded, and the last error is returned
+	op, calls = failing(&fs.PathError{Op: "read", Path: "x", Err: syscall.EAGAIN}, 10)
+	if err := fm.withRetry(op); !errors.Is(err, syscall.EAGAIN) || *calls != 3 {
+		t.Errorf("Expected three attempts then EAGAIN, got %d (%v)", *calls, err)
+	}
+
+	// Permanent errors are never retried
+	for _, permanent := range []error{fs.ErrNotExist, fs.ErrPermission, errors.New("disk on fire")} {
+		op, calls = failing(permanent, 10)
+		if err := fm.withRetry(op); err == nil || *calls != 1 {
+			t.Errorf("Expected %v to fail after one attempt, got %d", permanent, *calls)
+		}
+	}
+}
+
+func TestClassifyFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.WriteFile(filepath.Join(dir, "empty.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "data.bin"), []byte{0x7f, 'E', 'L', 'F', 0, 1, 2}, 0644)
+
+	tests := map[string]string{
+		"a.txt":     ClassText,
+		"empty.txt": ClassEmpty,
+		"data.bin":  ClassBinary,
+		"sub":       ClassDirectory,
+	}
+	if runtime.GOOS != "windows" {
+		os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt"))
+		tests["link.txt"] = ClassSymlink
+	}
+	for name, want := range tests {
+		result, err := fm.ClassifyFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: ClassifyFile failed: %v", name, err)
+			continue
+		}
+		var decoded struct {
+			Classification string `json:"classification"`
+			Size           int64  `json:"size"`
+			Target         string `json:"target"`
+		}
+		if err := json.Unmarshal([]byte(result), &decoded); err != nil {
+			t.Fatalf("%s: failed to decode %s: %v", name, result, err)
+		}
+		if decoded.Classification != want {
+			t.Errorf("%s: expected %s, got %s", name, want, decoded.Classification)
+		}
+		if name == "a.txt" && decoded.Size != 5 {
+			t.Errorf("Expected a.txt to be 5 bytes, got %d", decoded.Size)
+		}
+		if want == ClassSymlink && decoded.Target != filepath.Join(dir, "a.txt") {
+			t.Errorf("Expected the link target to be reported, got %q", decoded.Target)
+		}
+	}
+
+	if _, err := fm.ClassifyFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected a missing path to fail")
+	}
+}
+
+func TestTextStats(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.WriteFile(filepath.Join(dir, "words.txt"), []byte("one two\n  three\tfour\nfünf"), 0644)
+	os.WriteFile(filepath.Join(dir, "data.bin"), []byte{'a', 0, 'b'}, 0644)
+
+	type stats struct {
+		Binary          bool  `json:"binary"`
+		Lines           int64 `json:"lines"`
+		Words           int64 `json:"words"`
+		Chars           int64 `json:"chars"`
+		Bytes           int64 `json:"bytes"`
+		EndsWithNewline bool  `json:"endsWithNewline"`
+	}
+	tests := map[string]stats{
+		"a.txt":     {Words: 1, Chars: 5, Bytes: 5},
+		"words.txt": {Lines: 2, Words: 5, Chars: 25, Bytes: 26},
+		"data.bin":  {Binary: true},
+	}
+	os.WriteFile(filepath.Join(dir, "empty.txt"), nil, 0644)
+	tests["empty.txt"] = stats{}
+	os.WriteFile(filepath.Join(dir, "lines.txt"), []byte("x\n\n"), 0644)
+	tests["lines.txt"] = stats{Lines: 2, Words: 1, Chars: 3, Bytes: 3, EndsWithNewline: true}
+
+	for name, want := range tests {
+		result, err := fm.TextStats(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: TextStats failed: %v", name, err)
+			continue
+		}
+		var got stats
+		if err := json.Unmarshal([]byte(result), &got); err != nil {
+			t.Fatalf("%s: failed to decode %s: %v", name, result, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", name, want, got)
+		}
+	}
+
+	if _, err := fm.TextStats(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+}
+
+func TestLatestModification(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(dir, "sub", "deep", "c.txt"), []byte("gamma"), 0644)
+
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{".", "sub", "sub/deep", "a.txt", "sub/b.txt", "sub/deep/c.txt"} {
+		when := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), when, when)
+	}
+
+	latest := func(path string, maxDepth int) (string, int) {
+		t.Helper()
+		result, err := fm.LatestModification(path, maxDepth)
+		if err != nil {
+			t.Fatalf("LatestModification failed: %v", err)
+		}
+		var decoded struct {
+			Path    string `json:"path"`
+			Entries int    `json:"entries"`
+		}
+		if err := json.Unmarshal([]byte(result), &decoded); err != nil {
+			t.Fatalf("Failed to decode %s: %v", result, err)
+		}
+		return decoded.Path, decoded.Entries
+	}
+
+	if path, entries := latest(dir, -1); path != filepath.Join(dir, "sub", "deep", "c.txt") || entries != 6 {
+		t.Errorf("Expected c.txt among 6 entries, got %s among %d", path, entries)
+	}
+	if path, entries := latest(dir, 1); path != filepath.Join(dir, "sub", "b.txt") || entries != 5 {
+		t.Errorf("Expected b.txt among 5 entries at depth 1, got %s among %d", path, entries)
+	}
+	if path, entries := latest(dir, 0); path != filepath.Join(dir, "a.txt") || entries != 3 {
+		t.Errorf("Expected a.txt among 3 entries at depth 0, got %s among %d", path, entries)
+	}
+
+	// Hidden directories are not walked
+	fm.SetHiddenDirectories([]string{"deep"})
+	if path, _ := latest(dir, -1); path != filepath.Join(dir, "sub", "b.txt") {
+		t.Errorf("Expected hidden directories to be skipped, got %s", path)
+	}
+
+	if _, err := fm.LatestModification(t.TempDir(), -1); err == nil {
+		t.Error("Expected a directory outside the allowed directories to be rejected")
+	}
+}
+
+func TestWhichRoot(t *testing.T) {
+	dir := newTestDirectory(t)
+	readOnly := t.TempDir()
+	fm := NewFileManagerWithDirectories([]AllowedDirectory{
+		{Path: dir, MaxSearchDepth: 3, WriteQuota: 100},
+		{Path: readOnly, MaxSearchDepth: -1, ReadOnly: true},
+		{Path: filepath.Join(dir, "sub"), MaxSearchDepth: -1},
+	})
+
+	type root struct {
+		Allowed        bool   `json:"allowed"`
+		Path           string `json:"path"`
+		Root           string `json:"root"`
+		Mode           string `json:"mode"`
+		MaxSearchDepth *int   `json:"maxSearchDepth"`
+		WriteQuota     int64  `json:"writeQuota"`
+		QuotaRemaining int64  `json:"quotaRemainingBytes"`
+		Reason         string `json:"reason"`
+	}
+	which := func(path string) root {
+		t.Helper()
+		result, err := fm.WhichRoot(path)
+		if err != nil {
+			t.Fatalf("WhichRoot failed: %v", err)
+		}
+		var decoded root
+		if err := json.Unmarshal([]byte(result), &decoded); err != nil {
+			t.Fatalf("Failed to decode %s: %v", result, err)
+		}
+		return decoded
+	}
+
+	got := which(filepath.Join(dir, "a.txt"))
+	if !got.Allowed || got.Root != dir || got.Mode != "read-write" || got.MaxSearchDepth == nil || *got.MaxSearchDepth != 3 ||
+		got.WriteQuota != 100 || got.QuotaRemaining != 100 {
+		t.Errorf("Unexpected result for a.txt: %+v", got)
+	}
+	if got := which(filepath.Join(readOnly, "new.txt")); !got.Allowed || got.Root != readOnly || got.Mode != "read-only" || got.MaxSearchDepth != nil {
+		t.Errorf("Unexpected result in the read-only directory: %+v", got)
+	}
+
+	// Nested allowed directories resolve to the most specific one
+	if got := which(filepath.Join(dir, "sub", "b.txt")); got.Root != filepath.Join(dir, "sub") {
+		t.Errorf("Expected the nested directory, got %+v", got)
+	}
+
+	// Paths outside every allowed directory are reported, not errors
+	if got := which(filepath.Join(t.TempDir(), "x.txt")); got.Allowed || got.Root != "" || got.Reason == "" {
+		t.Errorf("Expected an outside path to be reported as not allowed, got %+v", got)
+	}
+}
+
+func TestHiddenDirectories(t *testing.T) {
+	dir := newTestDirectory(t)
+	fm := NewFileManager([]string{dir})
+	for _, name := range []string{".git/config", ".cache/alpha.txt", "sub/.git/alpha.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("alpha"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	fm.SetHiddenDirectories([]string{".git", ".c*"})
+
+	listing, err := fm.ListDirectory(dir, ListDirectoryOptions{})
+	if err != nil {
+		t.Fatalf("ListDirectory failed: %v", err)
+	}
+	tree, err := fm.DirectoryTree(dir, DefaultTreeDepth)
+	if err != nil {
+		t.Fatalf("DirectoryTree failed: %v", err)
+	}
+	for name, output := range map[string]string{"ListDirectory": listing, "DirectoryTree": tree} {
+		if strings.Contains(output, ".git") || strings.Contains(output, ".cache") {
+			t.Errorf("%s: expected hidden directories to be omitted, got:\n%s", name, output)
+		}
+	}
+
+	files, err := SearchFiles(fm, dir, "alpha", SearchFilesOptions{})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected SearchFiles to skip hidden directories, got %v", files)
+	}
+	matches, err := SearchContent(fm, dir, "alpha", ContentSearchOptions{})
+	if err != nil {
+		t.Fatalf("SearchContent failed: %v", err)
+	}
+	if len(matches) != 1 || !strings.HasPrefix(matches[0], filepath.Join(dir, "a.txt")) {
+		t.Errorf("Expected only a.txt to match, got %v", matches)
+	}
+
+	// Hidden directories stay reachable by their full path
+	if listing, err := fm.ListDirectory(filepath.Join(dir, ".git"), ListDirectoryOptions{}); err != nil || !strings.Contains(listing, "config") {
+		t.Errorf("Expected an explicit listing of .git, got %q (%v)", listing, err)
+	}
+	if content, err := fm.ReadFile(filepath.Join(dir, ".git", "config")); err != nil || content != "alpha" {
+		t.Errorf("Expected an explicit read inside .git, got %q (%v)", content, err)
+	}
+	if files, _ := SearchFiles(fm, filepath.Join(dir, ".cache"), "alpha", SearchFilesOptions{}); len(files) != 1 {
+		t.Errorf("Expected a search started inside a hidden directory to run, got %v", files)
+	}
+}
+
+func TestCreateTempFile(t *testing.T) {
+	dir := newTestDirectory(t)
+	readOnly := t.TempDir()
+	fm := NewFileManagerWithDirectories([]AllowedDirectory{
+		{Path: dir, MaxSearchDepth: -1},
+		{Path: readOnly, MaxSearchDepth: -1, ReadOnly: true},
+	})
+
+	first, err := fm.CreateTempFile(filepath.Join(dir, "sub"), "scratch-", ".txt")
+	if err != nil {
+		t.Fatalf("CreateTempFile failed: %v", err)
+	}
+	second, err := fm.CreateTempFile(filepath.Join(dir, "sub"), "scratch-", ".txt")
+	if err != nil {
+		t.Fatalf("CreateTempFile failed: %v", err)
+	}
+	if first == second {
+		t.Errorf("Expected unique names, got %s twice", first)
+	}
+	for _, path := range []string{first, second} {
+		name := filepath.Base(path)
+		if filepath.Dir(path) != filepath.Join(dir, "sub") || !strings.HasPrefix(name, "scratch-") || !strings.HasSuffix(name, ".txt") {
+			t.Errorf("Unexpected temporary file path %s", path)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+			t.Errorf("Expected an empty file at %s, got %v (%v)", path, info, err)
+		}
+	}
+
+	if _, err := fm.CreateTempFile(dir, "../", ""); err == nil {
+		t.Error("Expected a prefix with a path separator to be rejected")
+	}
+	if _, err := fm.CreateTempFile(t.TempDir(), "", ""); err == nil {
+		t.Error("Expected a directory outside the allowed directories to be rejected")
+	}
+	if _, err := fm.CreateTempFile(readOnly, "", ""); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected a read-only error, got: %v", err)
+	}
+}
+
+func TestFindBraceBlock(t *testing.T) {
+	lines := []string{
+		"func a() {",
+		"\ts := \"{\" + '}'",
+		"\t// } in a comment",
+		"\tif x {",
+		"\t\ty()",
+		"\t}",
+		"\t/* { */",
+		"}",
+		"",
+		"var z = 1",
+	}
+	tests := []struct {
+		line  int
+		block textBlock
+		found bool
+	}{
+		{1, textBlock{1, 8}, true}, // First line opens the outer block
+		{2, textBlock{1, 8}, true}, // Braces in strings are ignored
+		{3, textBlock{1, 8}, true}, // Braces in comments are ignored
+		{4, textBlock{4, 6}, true}, // A line opening a nested block picks the nested one
+		{5, textBlock{4, 6}, true}, // Nested blocks win over enclosing ones
+		{7, textBlock{1, 8}, true}, // Block comments are ignored
+		{8, textBlock{1, 8}, true}, // Closing line belongs to the block
+		{10, textBlock{}, false},   // Last line is outside any block
+	}
+	for _, tt := range tests {
+		block, found := findBraceBlock(lines, tt.line)
+		if found != tt.found || block != tt.block {
+			t.Errorf("Line %d: expected %v (%v), got %v (%v)", tt.line, tt.block, tt.found, block, found)
+		}
+	}
+
+	// A block ending on the file's last line
+	if block, found := findBraceBlock([]string{"{", "x", "}"}, 3); !found || block != (textBlock{1, 3}) {
+		t.Errorf("Expected block 1-3, got %v (%v)", block, found)
+	}
+}
+
+func TestFindIndentBlock(t *testing.T) {
+	lines := []string{
+		"def f():",
+		"    if x:",
+		"        y()",
+		"",
+		"    return 1",
+		"z = 2",
+	}
+	tests := []struct {
+		line  int
+		block textBlock
+		found bool
+	}{
+		{1, textBlock{1, 5}, true}, // First line is a header
+		{2, textBlock{2, 3}, true}, // A nested header starts its own block
+		{3, textBlock{2, 3}, true}, // Body lines belong to the nearest header above
+		{4, textBlock{1, 5}, true}, // Blank lines take the next line's indentation
+		{5, textBlock{1, 5}, true},
+		{6, textBlock{}, false}, // Last line is outside any block
+	}
+	for _, tt := range tests {
+		block, found := findIndentBlock(lines, tt.line)
+		if found != tt.found || block != tt.block {
+			t.Errorf("Line %d: expected %v (%v), got %v (%v)", tt.line, tt.block, tt.found, block, found)
+		}
+	}
+
+	// Auto mode uses indentation for Python even when braces are present
+	block, mode, err := findEnclosingBlock([]string{"def g():", "    d = {", "    }"}, 2, BlockModeAuto, "x.py")
+	if err != nil || mode != BlockModeIndent || block != (textBlock{1, 3}) {
+		t.Errorf("Expected indent block 1-3, got %v %s (%v)", block, mode, err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build darwin || freebsd
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns a file's creation (birth) and access times
+func fileTimes(info os.FileInfo) (created, accessed time.Time) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(stat.Birthtimespec.Unix()), time.Unix(stat.Atimespec.Unix())
+}
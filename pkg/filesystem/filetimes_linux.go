@@ -0,0 +1,19 @@
+//go:build linux
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns a file's creation and access times. Linux's stat does not
+// report a birth time, so the inode change time (ctime) stands in for creation.
+func fileTimes(info os.FileInfo) (created, accessed time.Time) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(stat.Ctim.Unix()), time.Unix(stat.Atim.Unix())
+}
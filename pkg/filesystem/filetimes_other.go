@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package filesystem
+
+import (
+	"os"
+	"time"
+)
+
+// fileTimes falls back to the modification time on platforms whose stat
+// results are not decoded here
+func fileTimes(info os.FileInfo) (created, accessed time.Time) {
+	return info.ModTime(), info.ModTime()
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package filesystem
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileTimes returns a file's creation and last access times
+func fileTimes(info os.FileInfo) (created, accessed time.Time) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime(), info.ModTime()
+	}
+	return time.Unix(0, data.CreationTime.Nanoseconds()), time.Unix(0, data.LastAccessTime.Nanoseconds())
+}
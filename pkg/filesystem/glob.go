@@ -0,0 +1,134 @@
+package filesystem
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// splitGlob splits a slash-separated glob into components and checks that
+// each one is a valid filepath.Match pattern
+func splitGlob(glob string) ([]string, error) {
+	glob = strings.Trim(filepath.ToSlash(glob), "/")
+	if glob == "" {
+		return nil, fmt.Errorf("glob pattern is empty")
+	}
+
+	parts := strings.Split(glob, "/")
+	for _, part := range parts {
+		if part == "**" {
+			continue
+		}
+		if _, err := filepath.Match(part, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", glob, err)
+		}
+	}
+	return parts, nil
+}
+
+// matchGlob reports whether the components of a relative path match the
+// glob's components. A "**" component matches zero or more whole components.
+func matchGlob(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated ** and try every split point
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(path); i++ {
+				if matchGlob(pattern, path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
+
+// GlobFiles returns the full paths below rootPath whose path relative to
+// rootPath matches a shell-style glob such as "**/*.json". Components are
+// matched with filepath.Match and "**" spans any number of directory levels.
+// Results are sorted lexically.
+func GlobFiles(fm *FileManager, rootPath, glob string) ([]string, error) {
+	validRootPath, err := fm.ValidatePath(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, err := splitGlob(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []string{}
+	counter := fm.newEntryCounter()
+	maxDepth, err := fm.searchDepthLimit(validRootPath, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(validRootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip errors and continue walking
+			return nil
+		}
+		if path == validRootPath {
+			return nil
+		}
+
+		// Hidden directories below the starting point are not walked
+		if d.IsDir() && fm.isHiddenDirectory(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		// Enforce the depth limit relative to the starting directory
+		if maxDepth >= 0 && walkDepth(validRootPath, path) > maxDepth {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := counter.add(); err != nil {
+			return err
+		}
+
+		if _, err := fm.ValidatePath(path); err != nil {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(validRootPath, path)
+		if err != nil {
+			return nil
+		}
+		if matchGlob(pattern, strings.Split(filepath.ToSlash(rel), "/")) {
+			results = append(results, path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(results)
+	return results, nil
+}
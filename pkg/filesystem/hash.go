@@ -0,0 +1,92 @@
+package filesystem
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+// Hash algorithms accepted by hashing tools
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashSHA1   = "sha1"
+	HashMD5    = "md5"
+)
+
+// hashAlgorithms maps algorithm names to hash constructors
+var hashAlgorithms = map[string]func() hash.Hash{
+	HashSHA256: sha256.New,
+	HashSHA512: sha512.New,
+	HashSHA1:   sha1.New,
+	HashMD5:    md5.New,
+}
+
+// newHash returns a hash for the named algorithm, defaulting to SHA-256
+func newHash(algorithm string) (hash.Hash, error) {
+	if algorithm == "" {
+		algorithm = HashSHA256
+	}
+	constructor, ok := hashAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash algorithm %q (use %s, %s, %s or %s)",
+			algorithm, HashSHA256, HashSHA512, HashSHA1, HashMD5)
+	}
+	return constructor(), nil
+}
+
+// hashFile streams a file through the named hash and returns the lowercase hex digest
+func hashFile(filePath, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashFile returns the hex digest of a file using sha256 (the default),
+// sha512, sha1 or md5. The file is streamed, so its size does not matter.
+func (fm *FileManager) HashFile(path, algorithm string) (string, error) {
+	if _, err := newHash(algorithm); err != nil {
+		return "", err
+	}
+
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("cannot hash %s: is a directory", path)
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	digest, err := hashFile(validPath, algorithm)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return digest, nil
+}
@@ -0,0 +1,273 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxJSONSliceLength bounds how many array elements a single json_get slice may return
+const MaxJSONSliceLength = 1000
+
+// jsonStep is one step of a json_get query: an object key, an array index or an array slice
+type jsonStep struct {
+	key     string
+	isIndex bool
+	isSlice bool
+	index   int
+	start   int
+	end     int // -1 when the slice is open-ended
+}
+
+// parseJSONQuery parses a query such as "items[10:20]" or "config.servers[0].name"
+// An empty query selects the whole document
+func parseJSONQuery(query string) ([]jsonStep, error) {
+	var steps []jsonStep
+	rest := query
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if rest == "" || rest[0] == '.' || rest[0] == '[' {
+				return nil, fmt.Errorf("invalid query %q: empty key", query)
+			}
+		case '[':
+			closing := strings.IndexByte(rest, ']')
+			if closing == -1 {
+				return nil, fmt.Errorf("invalid query %q: missing ']'", query)
+			}
+			step, err := parseJSONBrackets(rest[1:closing])
+			if err != nil {
+				return nil, fmt.Errorf("invalid query %q: %w", query, err)
+			}
+			steps = append(steps, step)
+			rest = rest[closing+1:]
+			continue
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end == -1 {
+			end = len(rest)
+		}
+		if end > 0 {
+			steps = append(steps, jsonStep{key: rest[:end]})
+		}
+		rest = rest[end:]
+	}
+
+	return steps, nil
+}
+
+// parseJSONBrackets parses the inside of [...]: an index "3" or a slice "10:20", ":5" or "10:"
+func parseJSONBrackets(inside string) (jsonStep, error) {
+	startText, endText, isSlice := strings.Cut(inside, ":")
+	if !isSlice {
+		index, err := strconv.Atoi(strings.TrimSpace(inside))
+		if err != nil || index < 0 {
+			return jsonStep{}, fmt.Errorf("array index must be a non-negative integer, got %q", inside)
+		}
+		return jsonStep{isIndex: true, index: index}, nil
+	}
+
+	step := jsonStep{isSlice: true, end: -1}
+	if startText = strings.TrimSpace(startText); startText != "" {
+		start, err := strconv.Atoi(startText)
+		if err != nil || start < 0 {
+			return jsonStep{}, fmt.Errorf("slice start must be a non-negative integer, got %q", startText)
+		}
+		step.start = start
+	}
+	if endText = strings.TrimSpace(endText); endText != "" {
+		end, err := strconv.Atoi(endText)
+		if err != nil || end < 0 {
+			return jsonStep{}, fmt.Errorf("slice end must be a non-negative integer, got %q", endText)
+		}
+		if end < step.start {
+			return jsonStep{}, fmt.Errorf("slice end %d is before start %d", end, step.start)
+		}
+		if end-step.start > MaxJSONSliceLength {
+			return jsonStep{}, fmt.Errorf("slice of %d elements exceeds the limit of %d", end-step.start, MaxJSONSliceLength)
+		}
+		step.end = end
+	}
+	return step, nil
+}
+
+// JSONGet returns the part of a JSON file selected by query.
+// The file is decoded as a stream, so only the selected values are held in memory
+// and reading stops once a slice's last element has been read.
+func (fm *FileManager) JSONGet(path, query string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	steps, err := parseJSONQuery(query)
+	if err != nil {
+		return "", err
+	}
+
+	release := fm.acquireFile()
+	defer release()
+
+	file, err := os.Open(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	value, err := selectJSON(decoder, steps, false)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", fmt.Errorf("invalid JSON in %s: unexpected end of input", path)
+		}
+		return "", err
+	}
+
+	return string(value), nil
+}
+
+// selectJSON applies steps to the next value in the decoder and returns the selected JSON.
+// When drain is set the rest of the value is consumed too, leaving the decoder
+// after it; otherwise reading stops as soon as the selection is complete.
+func selectJSON(decoder *json.Decoder, steps []jsonStep, drain bool) (json.RawMessage, error) {
+	if len(steps) == 0 {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		return raw, nil
+	}
+
+	step := steps[0]
+	if step.key != "" {
+		if err := expectDelim(decoder, '{', "object", step); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			if token == step.key {
+				return finishSelection(decoder, steps[1:], drain)
+			}
+			if err := skipJSONValue(decoder); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("key %q not found", step.key)
+	}
+
+	if err := expectDelim(decoder, '[', "array", step); err != nil {
+		return nil, err
+	}
+
+	if step.isIndex {
+		for i := 0; decoder.More(); i++ {
+			if i == step.index {
+				return finishSelection(decoder, steps[1:], drain)
+			}
+			if err := skipJSONValue(decoder); err != nil {
+				return nil, err
+			}
+		}
+		return nil, fmt.Errorf("index %d is out of range", step.index)
+	}
+
+	// Slice: collect elements in [start, end), applying the remaining steps to each
+	elements := []json.RawMessage{}
+	for i := 0; decoder.More(); i++ {
+		if step.end != -1 && i >= step.end {
+			if drain {
+				if err := skipRemaining(decoder); err != nil {
+					return nil, err
+				}
+			}
+			return json.Marshal(elements)
+		}
+		if i < step.start {
+			if err := skipJSONValue(decoder); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(elements) == MaxJSONSliceLength {
+			return nil, fmt.Errorf("slice has more than %d elements; give an explicit end", MaxJSONSliceLength)
+		}
+		element, err := selectJSON(decoder, steps[1:], true)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		elements = append(elements, element)
+	}
+
+	// Consume the closing bracket
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(elements)
+}
+
+// finishSelection selects from the current container's value and, when drain
+// is set, skips the rest of the container
+func finishSelection(decoder *json.Decoder, steps []jsonStep, drain bool) (json.RawMessage, error) {
+	value, err := selectJSON(decoder, steps, drain)
+	if err != nil || !drain {
+		return value, err
+	}
+	return value, skipRemaining(decoder)
+}
+
+// skipRemaining skips the remaining values of the current object or array and its closing delimiter
+func skipRemaining(decoder *json.Decoder) error {
+	for decoder.More() {
+		if err := skipJSONValue(decoder); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+// expectDelim reads the next token and checks that it opens the container step needs
+func expectDelim(decoder *json.Decoder, delim json.Delim, kind string, step jsonStep) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		if step.key != "" {
+			return fmt.Errorf("cannot look up key %q: value is not an %s", step.key, kind)
+		}
+		return fmt.Errorf("cannot index value: it is not an %s", kind)
+	}
+	return nil
+}
+
+// skipJSONValue reads past the next value without keeping it
+func skipJSONValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MarkerRegion locates a region delimited by a start marker line and an end
+// marker line. Line numbers are 1-indexed; offsets are byte offsets into the content.
+type MarkerRegion struct {
+	StartLine  int    // Line containing the start marker
+	EndLine    int    // Line containing the end marker
+	OuterStart int    // Start of the start marker line
+	InnerStart int    // Just after the start marker line
+	InnerEnd   int    // Start of the end marker line
+	OuterEnd   int    // Just after the end marker line
+	LineEnding string // Terminator of the start marker line ("\n" or "\r\n")
+}
+
+// FindMarkerRegion finds the first line containing startMarker and the next
+// line after it containing endMarker. It is an error for either marker to be
+// missing, for the end marker to appear before any start marker, or for a second
+// start marker to appear before the region is closed.
+func FindMarkerRegion(content, startMarker, endMarker string) (MarkerRegion, error) {
+	if startMarker == "" || endMarker == "" {
+		return MarkerRegion{}, fmt.Errorf("start and end markers must not be empty")
+	}
+
+	region := MarkerRegion{}
+	inRegion := false
+	offset := 0
+	for lineNumber := 1; offset < len(content); lineNumber++ {
+		next := strings.IndexByte(content[offset:], '\n')
+		lineEnd := len(content)
+		if next != -1 {
+			lineEnd = offset + next + 1
+		}
+		line := strings.TrimRight(content[offset:lineEnd], "\r\n")
+
+		switch {
+		case !inRegion && strings.Contains(line, startMarker):
+			region.StartLine = lineNumber
+			region.OuterStart = offset
+			region.InnerStart = lineEnd
+			region.LineEnding = content[offset+len(line) : lineEnd]
+			inRegion = true
+		case !inRegion && strings.Contains(line, endMarker):
+			return MarkerRegion{}, fmt.Errorf("end marker %q on line %d appears before any start marker %q",
+				endMarker, lineNumber, startMarker)
+		case inRegion && strings.Contains(line, endMarker):
+			region.EndLine = lineNumber
+			region.InnerEnd = offset
+			region.OuterEnd = lineEnd
+			return region, nil
+		case inRegion && strings.Contains(line, startMarker):
+			return MarkerRegion{}, fmt.Errorf("start marker %q on line %d is not closed before another start marker on line %d",
+				startMarker, region.StartLine, lineNumber)
+		}
+
+		offset = lineEnd
+	}
+
+	if !inRegion {
+		return MarkerRegion{}, fmt.Errorf("start marker %q not found", startMarker)
+	}
+	return MarkerRegion{}, fmt.Errorf("start marker %q on line %d has no matching end marker %q",
+		startMarker, region.StartLine, endMarker)
+}
+
+// ReadBetweenMarkers returns the content between the first start marker line and
+// the end marker line that closes it, excluding the marker lines unless inclusive is set.
+// Returns JSON with the content and the marker line numbers.
+func (fm *FileManager) ReadBetweenMarkers(path, startMarker, endMarker string, inclusive bool) (string, error) {
+	content, err := fm.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	region, err := FindMarkerRegion(content, startMarker, endMarker)
+	if err != nil {
+		return "", err
+	}
+
+	selected := content[region.InnerStart:region.InnerEnd]
+	if inclusive {
+		selected = content[region.OuterStart:region.OuterEnd]
+	}
+
+	result := map[string]interface{}{
+		"path":      path,
+		"startLine": region.StartLine,
+		"endLine":   region.EndLine,
+		"inclusive": inclusive,
+		"content":   selected,
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult), nil
+}
@@ -0,0 +1,50 @@
+package filesystem
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// contentSniffLen is how much of a file http.DetectContentType considers
+const contentSniffLen = 512
+
+// detectMimeType guesses a file's MIME type from its extension, falling back
+// to sniffing the first bytes of its content
+func detectMimeType(filePath string, head []byte) string {
+	if byExtension := mime.TypeByExtension(filepath.Ext(filePath)); byExtension != "" {
+		return byExtension
+	}
+	if len(head) > binarySniffLen {
+		head = head[:binarySniffLen]
+	}
+	return http.DetectContentType(head)
+}
+
+// sniffContentType detects a file's MIME type from its first bytes, using the
+// extension when sniffing only finds generic text or binary data.
+// Returns "" if the file cannot be read.
+func sniffContentType(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, contentSniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+
+	sniffed := http.DetectContentType(head[:n])
+	switch sniffed {
+	case "application/octet-stream", "text/plain; charset=utf-8":
+		if byExtension := mime.TypeByExtension(filepath.Ext(filePath)); byExtension != "" {
+			return byExtension
+		}
+	}
+	return sniffed
+}
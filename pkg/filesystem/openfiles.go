@@ -0,0 +1,63 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// openFileWarningInterval is the minimum time between warnings about the open file limit
+const openFileWarningInterval = time.Minute
+
+// openFileLimiter bounds how many files the FileManager holds open at once
+type openFileLimiter struct {
+	slots       chan struct{}
+	mutex       sync.Mutex
+	waits       int       // Acquisitions that had to wait since the last warning
+	lastWarning time.Time // When the limit was last reported
+}
+
+// SetMaxOpenFiles bounds how many files operations may hold open simultaneously,
+// so batch tools cannot exhaust the process's file descriptors.
+// Zero or a negative value removes the limit.
+func (fm *FileManager) SetMaxOpenFiles(limit int) {
+	if limit <= 0 {
+		fm.openFiles = nil
+		return
+	}
+	fm.openFiles = &openFileLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquireFile reserves an open file slot, waiting if the limit is reached,
+// and returns the function that releases it
+func (fm *FileManager) acquireFile() func() {
+	limiter := fm.openFiles
+	if limiter == nil {
+		return func() {}
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+	default:
+		limiter.recordWait()
+		limiter.slots <- struct{}{}
+	}
+
+	return func() { <-limiter.slots }
+}
+
+// recordWait counts an acquisition that hit the limit and periodically warns about it
+func (l *openFileLimiter) recordWait() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.waits++
+	if time.Since(l.lastWarning) < openFileWarningInterval {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: open file limit of %d reached %d time(s) since last report; consider raising maxOpenFiles\n",
+		cap(l.slots), l.waits)
+	l.waits = 0
+	l.lastWarning = time.Now()
+}
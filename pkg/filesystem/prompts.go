@@ -0,0 +1,88 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+)
+
+// reviewDirectoryDepth is how deep the tree embedded by review_directory goes
+const reviewDirectoryDepth = 2
+
+// PromptTemplate is a reusable prompt parameterized by a path
+type PromptTemplate struct {
+	Name        string
+	Description string
+	PathHelp    string // Description of the path argument
+	Directory   bool   // The path names a directory rather than a file
+	instruction string // Placed before the embedded content
+}
+
+// PromptTemplates lists the prompts offered to clients
+var PromptTemplates = []PromptTemplate{
+	{
+		Name:        "summarize_file",
+		Description: "Summarize what a file contains",
+		PathHelp:    "Path of the file to summarize",
+		instruction: "Summarize the file %s. Describe its purpose, its main parts and anything notable.",
+	},
+	{
+		Name:        "review_file",
+		Description: "Review a file for bugs, unclear code and possible improvements",
+		PathHelp:    "Path of the file to review",
+		instruction: "Review the file %s. Point out bugs, unclear or risky code, and suggest concrete improvements.",
+	},
+	{
+		Name:        "review_directory",
+		Description: "Review how a directory is organized",
+		PathHelp:    "Path of the directory to review",
+		Directory:   true,
+		instruction: "Review the layout of the directory %s, shown below as a JSON tree. Explain how it is organized and suggest improvements.",
+	},
+}
+
+// FindPromptTemplate returns the prompt template with the given name
+func FindPromptTemplate(name string) (PromptTemplate, bool) {
+	for _, template := range PromptTemplates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return PromptTemplate{}, false
+}
+
+// RenderPrompt validates path and returns the prompt text with the file's
+// content, or for a directory prompt its tree, embedded
+func (fm *FileManager) RenderPrompt(template PromptTemplate, path string) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if info.IsDir() != template.Directory {
+		if template.Directory {
+			return "", fmt.Errorf("not a directory: %s", path)
+		}
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	tag, content := "file", ""
+	if template.Directory {
+		tag = "directory"
+		content, err = fm.DirectoryTree(validPath, reviewDirectoryDepth)
+	} else {
+		if binary, _ := isBinaryFile(validPath); binary {
+			return "", fmt.Errorf("%s is a binary file", path)
+		}
+		content, err = fm.ReadFile(validPath)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(template.instruction, validPath) +
+		fmt.Sprintf("\n\n<%s path=%q>\n%s\n</%s>", tag, validPath, content, tag), nil
+}
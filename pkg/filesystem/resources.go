@@ -0,0 +1,184 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultResourcePageSize is how many files one page of ListResources holds
+const DefaultResourcePageSize = 100
+
+// errPageFull stops a resource walk once a page has been filled
+var errPageFull = errors.New("resource page full")
+
+// ResourceFile is a file exposed as an MCP resource
+type ResourceFile struct {
+	Path     string
+	Name     string // Path relative to its allowed directory
+	Size     int64
+	MimeType string // Guessed from the extension when listing; may be empty
+	Binary   bool   // Content is not UTF-8 text; set by ReadResource
+}
+
+// ListResources lists the regular files in the allowed directories as
+// resources, in a stable order and skipping hidden directories and denied
+// paths. The listing is paged: cursor is the opaque value returned with the
+// previous page ("" for the first), and the returned cursor is "" once no
+// files remain.
+func (fm *FileManager) ListResources(cursor string, pageSize int) ([]ResourceFile, string, error) {
+	skip := 0
+	if cursor != "" {
+		var err error
+		if skip, err = strconv.Atoi(cursor); err != nil || skip < 0 {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultResourcePageSize
+	}
+
+	var page []ResourceFile
+	seen := make(map[string]bool) // Nested allowed directories would list files twice
+	position := 0
+	counter := fm.newEntryCounter()
+
+	for _, root := range fm.originalDirectories {
+		validRoot, err := fm.ValidatePath(root)
+		if err != nil {
+			continue
+		}
+
+		err = filepath.WalkDir(validRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// Skip unreadable entries and continue walking
+				return nil
+			}
+
+			if d.IsDir() && path != validRoot && fm.isHiddenDirectory(d.Name()) {
+				return filepath.SkipDir
+			}
+
+			if _, err := fm.ValidatePath(path); err != nil {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if err := counter.add(); err != nil {
+				return err
+			}
+
+			if !d.Type().IsRegular() || seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			position++
+			if position <= skip {
+				return nil
+			}
+			if len(page) == pageSize {
+				// One more file exists, so there is a next page
+				return errPageFull
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			name, err := filepath.Rel(validRoot, path)
+			if err != nil {
+				name = filepath.Base(path)
+			}
+			page = append(page, ResourceFile{
+				Path:     path,
+				Name:     filepath.ToSlash(name),
+				Size:     info.Size(),
+				MimeType: mime.TypeByExtension(filepath.Ext(path)),
+			})
+			return nil
+		})
+
+		if errors.Is(err, errPageFull) {
+			return page, strconv.Itoa(skip + len(page)), nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return page, "", nil
+}
+
+// ReadResource reads a file for a resource read, detecting its MIME type
+func (fm *FileManager) ReadResource(path string) (ResourceFile, []byte, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return ResourceFile{}, nil, err
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return ResourceFile{}, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.IsDir() {
+		return ResourceFile{}, nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	content, err := fm.ReadFile(validPath)
+	if err != nil {
+		return ResourceFile{}, nil, err
+	}
+
+	sniff := content
+	if len(sniff) > binarySniffLen {
+		sniff = sniff[:binarySniffLen]
+	}
+
+	return ResourceFile{
+		Path:     validPath,
+		Name:     filepath.Base(validPath),
+		Size:     int64(len(content)),
+		MimeType: sniffContentType(validPath),
+		Binary:   strings.IndexByte(sniff, 0) != -1 || !utf8.ValidString(content),
+	}, []byte(content), nil
+}
+
+// FileURI returns the file:// URI of an absolute path
+func FileURI(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		// Windows drive paths become file:///C:/...
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+// PathFromFileURI returns the local path of a file:// URI
+func PathFromFileURI(uri string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid resource URI %q: %w", uri, err)
+	}
+	if parsed.Scheme != "file" {
+		return "", fmt.Errorf("unsupported resource URI %q: only file:// URIs are supported", uri)
+	}
+	if parsed.Host != "" && parsed.Host != "localhost" {
+		return "", fmt.Errorf("unsupported resource URI %q: remote hosts are not supported", uri)
+	}
+
+	path := parsed.Path
+	if filepath.Separator == '\\' && len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:] // file:///C:/... names C:/...
+	}
+	return filepath.FromSlash(path), nil
+}
@@ -0,0 +1,55 @@
+package filesystem
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how transient filesystem errors are retried
+// A MaxAttempts of 0 or 1 disables retries
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one
+	Backoff     time.Duration // Delay before the first retry, doubled after each attempt
+}
+
+// transientErrors are errors that commonly clear up on their own,
+// e.g. on network filesystems or when another process briefly holds a file
+var transientErrors = []error{
+	syscall.EAGAIN,
+	syscall.EBUSY,
+	syscall.EINTR,
+	syscall.ETIMEDOUT,
+}
+
+// SetRetryPolicy configures retries for read, write, move and stat operations
+func (fm *FileManager) SetRetryPolicy(policy RetryPolicy) {
+	fm.retryPolicy = policy
+}
+
+// isTransientError reports whether err is worth retrying
+// Not-found and permission errors are permanent and never retried
+func isTransientError(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return false
+	}
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs op, retrying transient failures according to the retry policy
+func (fm *FileManager) withRetry(op func() error) error {
+	delay := fm.retryPolicy.Backoff
+	err := op()
+	for attempt := 1; attempt < fm.retryPolicy.MaxAttempts && err != nil && isTransientError(err); attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = op()
+	}
+	return err
+}
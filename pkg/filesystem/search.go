@@ -0,0 +1,224 @@
+package filesystem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultMaxSearchFileBytes is the largest file search_content scans unless configured otherwise
+const DefaultMaxSearchFileBytes = 10 << 20
+
+// ContentSearchOptions controls how search_content matches file contents
+type ContentSearchOptions struct {
+	CaseSensitive bool // Match the pattern's case exactly
+	MaxMatches    int  // Stop scanning a file after this many matching lines (0 = unlimited)
+	NamesOnly     bool // Report each matching file once instead of its matching lines
+	Regex         bool // Treat the pattern as a regular expression instead of literal text
+}
+
+// compileSearchPattern compiles a search regular expression, making it
+// case-insensitive unless caseSensitive is set
+func compileSearchPattern(pattern string, caseSensitive bool) (*regexp.Regexp, error) {
+	expr := pattern
+	if !caseSensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// SetMaxSearchFileBytes sets the largest file search_content scans.
+// Zero or a negative value restores DefaultMaxSearchFileBytes.
+func (fm *FileManager) SetMaxSearchFileBytes(limit int64) {
+	if limit <= 0 {
+		limit = DefaultMaxSearchFileBytes
+	}
+	fm.maxSearchFileBytes = limit
+}
+
+// SearchContent searches the contents of text files in a directory tree for
+// literal text or, with Regex, a regular expression, walking the tree like SearchFiles. Matches are returned
+// as "path:lineNumber:line" entries, or as bare paths with NamesOnly.
+// Binary files and files larger than the configured cap are skipped.
+func SearchContent(fm *FileManager, rootPath, pattern string, options ContentSearchOptions) ([]string, error) {
+	validRootPath, err := fm.ValidatePath(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Literal patterns are matched as a regular expression too, so both
+	// modes share one case-folding rule
+	if !options.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	re, err := compileSearchPattern(pattern, options.CaseSensitive)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []string{}
+	counter := fm.newEntryCounter()
+	maxDepth, err := fm.searchDepthLimit(validRootPath, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(validRootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip errors and continue walking
+			return nil
+		}
+
+		// Hidden directories below the starting point are not walked
+		if d.IsDir() && path != validRootPath && fm.isHiddenDirectory(d.Name()) {
+			return filepath.SkipDir
+		}
+
+		// Enforce the depth limit relative to the starting directory
+		if maxDepth >= 0 && walkDepth(validRootPath, path) > maxDepth {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := counter.add(); err != nil {
+			return err
+		}
+
+		validPath, validateErr := fm.ValidatePath(path)
+		if validateErr != nil {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := os.Stat(validPath)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > fm.maxSearchFileBytes {
+			return nil
+		}
+		if binary, err := isBinaryFile(validPath); err != nil || binary {
+			return nil
+		}
+
+		matches, err := fm.searchFileContent(validPath, re, options)
+		if err != nil {
+			// Unreadable files are skipped like invalid paths
+			return nil
+		}
+		for _, match := range matches {
+			results = append(results, path+match)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// FindInFile searches a single text file for literal text or, with Regex, a
+// regular expression. Matches are returned as "lineNumber:line" entries,
+// followed by a note if MaxMatches cut the scan short. Unlike SearchContent
+// there is no size cap, since the file is streamed rather than loaded.
+func FindInFile(fm *FileManager, path, pattern string, options ContentSearchOptions) ([]string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file: %s", path)
+	}
+	if binary, err := isBinaryFile(validPath); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	} else if binary {
+		return nil, fmt.Errorf("cannot search binary file: %s", path)
+	}
+
+	if !options.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	re, err := compileSearchPattern(pattern, options.CaseSensitive)
+	if err != nil {
+		return nil, err
+	}
+
+	options.NamesOnly = false
+	matches, err := fm.searchFileContent(validPath, re, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Without a path in front, the separating colon is not needed
+	results := make([]string, len(matches))
+	for i, match := range matches {
+		results[i] = strings.TrimPrefix(strings.TrimPrefix(match, ":"), " ")
+	}
+	return results, nil
+}
+
+// searchFileContent scans one file line by line. Each result is the suffix
+// to append to the file's path: ":lineNumber:line" for a match, a note when
+// MaxMatches cut the scan short, or "" once for NamesOnly.
+func (fm *FileManager) searchFileContent(validPath string, re *regexp.Regexp, options ContentSearchOptions) ([]string, error) {
+	release := fm.acquireFile()
+	defer release()
+
+	file, err := os.Open(validPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matches []string
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if re.MatchString(line) {
+			if options.NamesOnly {
+				return []string{""}, nil
+			}
+			if options.MaxMatches > 0 && len(matches) == options.MaxMatches {
+				matches = append(matches, fmt.Sprintf(": further matches omitted after %d (max_matches)", options.MaxMatches))
+				break
+			}
+			matches = append(matches, fmt.Sprintf(":%d:%s", lineNumber, line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,120 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CreateSymlink creates a symbolic link at linkPath pointing to target. A
+// relative target is kept relative in the link and resolved from the link's
+// real directory, following any symlinks along the way. Both the link and the
+// resolved target must be within the allowed directories; the target does
+// not need to exist yet.
+func (fm *FileManager) CreateSymlink(target, linkPath string) error {
+	if target == "" {
+		return fmt.Errorf("symlink target must not be empty")
+	}
+
+	validLink, err := fm.ValidatePath(linkPath)
+	if err != nil {
+		return err
+	}
+	if err := fm.checkWritable(validLink); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(validLink); err == nil {
+		return fmt.Errorf("%s already exists", linkPath)
+	}
+
+	linkDir, err := filepath.EvalSymlinks(filepath.Dir(validLink))
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", filepath.Dir(linkPath), err)
+	}
+	resolved, err := resolveLinkTarget(linkDir, target)
+	if err != nil {
+		return fmt.Errorf("invalid symlink target %s: %w", target, err)
+	}
+	if _, err := fm.ValidatePath(resolved); err != nil {
+		return fmt.Errorf("invalid symlink target %s: %w", target, err)
+	}
+
+	if err := os.Symlink(target, validLink); err != nil {
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+	return nil
+}
+
+// resolveLinkTarget returns the path a link in linkDir pointing at target
+// leads to. Cleaning the target first would be wrong: in "s/../x" the ".."
+// applies to wherever symlink s points, not to linkDir. So components are
+// followed one at a time, resolving existing symlinks as the OS will, and
+// ".." below a component that does not exist yet is refused since its
+// meaning could change once that component is created.
+func resolveLinkTarget(linkDir, target string) (string, error) {
+	resolved := linkDir
+	if filepath.IsAbs(target) {
+		volume := filepath.VolumeName(target)
+		resolved = volume + string(filepath.Separator)
+		target = target[len(volume):]
+	}
+
+	missing := false
+	for _, part := range strings.Split(filepath.ToSlash(target), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if missing {
+				return "", fmt.Errorf("'..' follows a path component that does not exist")
+			}
+			resolved = filepath.Dir(resolved)
+		default:
+			resolved = filepath.Join(resolved, part)
+			if missing {
+				continue
+			}
+			real, err := filepath.EvalSymlinks(resolved)
+			if err == nil {
+				resolved = real
+				continue
+			}
+			// A dangling symlink exists but cannot be followed, so it is not simply missing
+			if _, lerr := os.Lstat(resolved); !os.IsNotExist(lerr) {
+				return "", fmt.Errorf("failed to resolve %s: %w", resolved, err)
+			}
+			missing = true
+		}
+	}
+	return resolved, nil
+}
+
+// ReadLink returns the target of a symbolic link as stored in the link,
+// without resolving it. Links whose target leaves the allowed directories
+// are rejected like any other path through them.
+func (fm *FileManager) ReadLink(path string) (string, error) {
+	if _, err := fm.ValidatePath(path); err != nil {
+		return "", err
+	}
+
+	// ValidatePath resolves symlinks, so look at the requested path itself
+	absolute, err := fm.absolutePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(absolute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read link: %w", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", fmt.Errorf("not a symbolic link: %s", path)
+	}
+
+	target, err := os.Readlink(absolute)
+	if err != nil {
+		return "", fmt.Errorf("failed to read link: %w", err)
+	}
+	return target, nil
+}
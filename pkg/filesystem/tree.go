@@ -0,0 +1,101 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultTreeDepth is how deep directory_tree descends when no depth is given
+const DefaultTreeDepth = 5
+
+// TreeNode is one entry in the output of directory_tree
+type TreeNode struct {
+	Name      string      `json:"name"`
+	Type      string      `json:"type"` // "file" or "directory"
+	Symlink   bool        `json:"symlink,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"` // Children were not listed because of the depth cap
+	Children  []*TreeNode `json:"children,omitempty"`
+}
+
+// DirectoryTree returns a nested JSON tree of the directory at path.
+// maxDepth is the deepest level whose contents are listed (0 = immediate
+// contents only). Every entry is re-validated; entries that fail validation
+// are left out. Symlinked directories are listed but not descended into.
+func (fm *FileManager) DirectoryTree(path string, maxDepth int) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(validPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("not a directory: %s", path)
+	}
+
+	maxDepth, err = fm.searchDepthLimit(validPath, maxDepth)
+	if err != nil {
+		return "", err
+	}
+
+	root := &TreeNode{Name: filepath.Base(validPath), Type: "directory"}
+	if err := fm.buildTree(root, validPath, 0, maxDepth, fm.newEntryCounter()); err != nil {
+		return "", err
+	}
+
+	jsonResult, _ := json.MarshalIndent(root, "", "  ")
+	return string(jsonResult), nil
+}
+
+// buildTree fills in the children of the directory node at dirPath
+func (fm *FileManager) buildTree(node *TreeNode, dirPath string, depth, maxDepth int, counter *entryCounter) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	node.Children = []*TreeNode{}
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+		validEntry, err := fm.ValidatePath(entryPath)
+		if err != nil {
+			continue
+		}
+
+		child := &TreeNode{Name: entry.Name(), Type: "file", Symlink: entry.Type()&os.ModeSymlink != 0}
+		isDir := entry.IsDir()
+		if child.Symlink {
+			if info, err := os.Stat(validEntry); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if isDir {
+			if fm.isHiddenDirectory(entry.Name()) {
+				continue
+			}
+			child.Type = "directory"
+		}
+
+		if err := counter.add(); err != nil {
+			return err
+		}
+		node.Children = append(node.Children, child)
+
+		if !isDir || child.Symlink {
+			continue
+		}
+		if maxDepth >= 0 && depth >= maxDepth {
+			child.Truncated = true
+			continue
+		}
+		if err := fm.buildTree(child, entryPath, depth+1, maxDepth, counter); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
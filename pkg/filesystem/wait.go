@@ -0,0 +1,178 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultMaxWait is the longest wait_for_file and watch_file may block unless configured otherwise
+const DefaultMaxWait = 60 * time.Second
+
+// DefaultWaitTimeout is how long wait_for_file waits when no timeout is given
+const DefaultWaitTimeout = 30 * time.Second
+
+// waitPollInterval is how often wait_for_file checks for the file
+const waitPollInterval = 100 * time.Millisecond
+
+// SetMaxWait sets the longest time wait_for_file and watch_file may block.
+// Zero or a negative value restores DefaultMaxWait.
+func (fm *FileManager) SetMaxWait(limit time.Duration) {
+	if limit <= 0 {
+		limit = DefaultMaxWait
+	}
+	fm.maxWait = limit
+}
+
+// WaitForFile polls until a file exists or the timeout elapses.
+// Timeouts longer than the configured maximum are shortened to it.
+// Returns JSON with whether the file appeared, how long the wait took and,
+// if it appeared, the file's metadata as reported by get_file_info.
+func (fm *FileManager) WaitForFile(path string, timeout time.Duration) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if timeout > fm.maxWait {
+		timeout = fm.maxWait
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for {
+		if _, err := os.Stat(validPath); err == nil {
+			// Revalidate now that the file exists, in case it is a symlink leaving the sandbox
+			info, err := fm.GetFileInfo(path)
+			if err != nil {
+				return "", err
+			}
+			return waitResult(validPath, true, time.Since(start), json.RawMessage(info)), nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to check file: %w", err)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return waitResult(validPath, false, time.Since(start), nil), nil
+		}
+		if remaining > waitPollInterval {
+			remaining = waitPollInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// waitResult formats the JSON result of WaitForFile
+func waitResult(path string, appeared bool, waited time.Duration, info json.RawMessage) string {
+	result := map[string]interface{}{
+		"path":     path,
+		"appeared": appeared,
+		"waitedMs": waited.Milliseconds(),
+	}
+	if info != nil {
+		result["info"] = info
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult)
+}
+
+// WatchPath blocks until a file or directory changes, the timeout elapses or
+// ctx is cancelled. For a directory a change to any entry directly inside it
+// counts; a file that does not exist yet is watched for its creation.
+// Timeouts longer than the configured maximum are shortened to it.
+// Returns JSON with the event (create, write, remove or rename) and the path
+// it happened to, or with timedOut set if nothing changed.
+func (fm *FileManager) WatchPath(ctx context.Context, path string, timeout time.Duration) (string, error) {
+	validPath, err := fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if timeout > fm.maxWait {
+		timeout = fm.maxWait
+	}
+
+	// A file is watched through its directory, so it stays watched when it
+	// is created, or replaced by a rename as AtomicWrite does
+	watchDir, isDir := filepath.Dir(validPath), false
+	if info, err := os.Stat(validPath); err == nil && info.IsDir() {
+		watchDir, isDir = validPath, true
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return "", fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(watchDir); err != nil {
+		return "", fmt.Errorf("failed to watch %s: %w", path, err)
+	}
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return "", fmt.Errorf("file watcher closed")
+			}
+			eventPath := filepath.Clean(event.Name)
+			if !isDir && eventPath != validPath {
+				continue
+			}
+			if op := watchEventName(event.Op); op != "" {
+				return watchResult(validPath, op, eventPath, time.Since(start)), nil
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return "", fmt.Errorf("file watcher closed")
+			}
+			return "", fmt.Errorf("failed to watch %s: %w", path, err)
+		case <-timer.C:
+			return watchResult(validPath, "", "", time.Since(start)), nil
+		case <-ctx.Done():
+			return "", fmt.Errorf("watch of %s cancelled: %w", path, ctx.Err())
+		}
+	}
+}
+
+// watchEventName names the change an event reports, or returns "" for
+// changes watch_file ignores, such as permission changes
+func watchEventName(op fsnotify.Op) string {
+	switch {
+	case op.Has(fsnotify.Create):
+		return "create"
+	case op.Has(fsnotify.Write):
+		return "write"
+	case op.Has(fsnotify.Remove):
+		return "remove"
+	case op.Has(fsnotify.Rename):
+		return "rename"
+	}
+	return ""
+}
+
+// watchResult formats the JSON result of WatchPath; an empty event means
+// the watch timed out
+func watchResult(path, event, eventPath string, waited time.Duration) string {
+	result := map[string]interface{}{
+		"path":     path,
+		"timedOut": event == "",
+		"waitedMs": waited.Milliseconds(),
+	}
+	if event != "" {
+		result["event"] = event
+		result["eventPath"] = eventPath
+	}
+
+	jsonResult, _ := json.Marshal(result)
+	return string(jsonResult)
+}
@@ -0,0 +1,203 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ResourceUpdateDebounce is how long a subscribed file must stay unchanged
+// before its change is reported, so a burst of writes gives one notification
+const ResourceUpdateDebounce = 200 * time.Millisecond
+
+// ResourceWatcher reports changes to files that client sessions have
+// subscribed to. The parent directories are watched rather than the files,
+// so a file replaced by rename (as AtomicWrite and many editors do) stays
+// watched.
+type ResourceWatcher struct {
+	fm       *FileManager
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+	notify   func(path string, sessions []string)
+
+	mutex         sync.Mutex
+	subscriptions map[string]map[string]bool // Subscribed path -> sessions subscribed to it
+	directories   map[string]int             // Watched directory -> subscribed paths in it
+	pending       map[string]*time.Timer     // Changes waiting out the debounce
+	done          chan struct{}
+}
+
+// NewResourceWatcher creates a watcher that calls notify with the path of a
+// subscribed file, and the sessions subscribed to it, once it has changed and
+// then been quiet for debounce
+func NewResourceWatcher(fm *FileManager, debounce time.Duration, notify func(path string, sessions []string)) (*ResourceWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if debounce <= 0 {
+		debounce = ResourceUpdateDebounce
+	}
+
+	rw := &ResourceWatcher{
+		fm:            fm,
+		watcher:       watcher,
+		debounce:      debounce,
+		notify:        notify,
+		subscriptions: make(map[string]map[string]bool),
+		directories:   make(map[string]int),
+		pending:       make(map[string]*time.Timer),
+		done:          make(chan struct{}),
+	}
+	go rw.watch()
+	return rw, nil
+}
+
+// Subscribe subscribes a session to changes of a file, returning the
+// validated path that notifications will name
+func (rw *ResourceWatcher) Subscribe(session, path string) (string, error) {
+	validPath, err := rw.fm.ValidatePath(path)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(validPath); err == nil && info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	sessions, ok := rw.subscriptions[validPath]
+	if !ok {
+		dir := filepath.Dir(validPath)
+		if rw.directories[dir] == 0 {
+			if err := rw.watcher.Add(dir); err != nil {
+				return "", fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+		}
+		rw.directories[dir]++
+		sessions = make(map[string]bool)
+		rw.subscriptions[validPath] = sessions
+	}
+	sessions[session] = true
+	return validPath, nil
+}
+
+// Unsubscribe ends a session's subscription to a file. Unsubscribing from a
+// file the session is not subscribed to is not an error.
+func (rw *ResourceWatcher) Unsubscribe(session, path string) error {
+	validPath, err := rw.fm.ValidatePath(path)
+	if err != nil {
+		return err
+	}
+
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+	rw.unsubscribe(session, validPath)
+	return nil
+}
+
+// CloseSession ends every subscription held by a session
+func (rw *ResourceWatcher) CloseSession(session string) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	for path, sessions := range rw.subscriptions {
+		if sessions[session] {
+			rw.unsubscribe(session, path)
+		}
+	}
+}
+
+// Close stops watching and drops pending notifications
+func (rw *ResourceWatcher) Close() error {
+	rw.mutex.Lock()
+	for path, timer := range rw.pending {
+		timer.Stop()
+		delete(rw.pending, path)
+	}
+	rw.mutex.Unlock()
+
+	err := rw.watcher.Close()
+	<-rw.done
+	return err
+}
+
+// unsubscribe removes a subscription, and the watch on its directory once
+// nothing else there is subscribed. The caller must hold the mutex.
+func (rw *ResourceWatcher) unsubscribe(session, path string) {
+	sessions, ok := rw.subscriptions[path]
+	if !ok || !sessions[session] {
+		return
+	}
+	delete(sessions, session)
+	if len(sessions) > 0 {
+		return
+	}
+
+	delete(rw.subscriptions, path)
+	if timer, ok := rw.pending[path]; ok {
+		timer.Stop()
+		delete(rw.pending, path)
+	}
+
+	dir := filepath.Dir(path)
+	rw.directories[dir]--
+	if rw.directories[dir] <= 0 {
+		delete(rw.directories, dir)
+		rw.watcher.Remove(dir)
+	}
+}
+
+// watch turns file system events for subscribed files into debounced notifications
+func (rw *ResourceWatcher) watch() {
+	defer close(rw.done)
+
+	for {
+		select {
+		case event, ok := <-rw.watcher.Events:
+			if !ok {
+				return
+			}
+			rw.changed(filepath.Clean(event.Name))
+		case err, ok := <-rw.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "File watcher error: %v\n", err)
+		}
+	}
+}
+
+// changed restarts the debounce for a path if it is subscribed
+func (rw *ResourceWatcher) changed(path string) {
+	rw.mutex.Lock()
+	defer rw.mutex.Unlock()
+
+	if _, ok := rw.subscriptions[path]; !ok {
+		return
+	}
+	if timer, ok := rw.pending[path]; ok {
+		timer.Reset(rw.debounce)
+		return
+	}
+	rw.pending[path] = time.AfterFunc(rw.debounce, func() {
+		rw.mutex.Lock()
+		delete(rw.pending, path)
+		var sessions []string
+		for session := range rw.subscriptions[path] {
+			sessions = append(sessions, session)
+		}
+		rw.mutex.Unlock()
+
+		if len(sessions) > 0 {
+			sort.Strings(sessions)
+			rw.notify(path, sessions)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Message framings supported by the stdio and TCP transports
+const (
+	FramingLine = "line" // One JSON-RPC message per line
+	FramingLSP  = "lsp"  // A Content-Length header block before each message, as in LSP
+)
+
+// maxFramedMessage is the largest message accepted from a client, whether
+// given by Content-Length, read as a line or decompressed from a gzip frame
+const maxFramedMessage = 64 << 20
+
+// validateFraming checks a framing name, returning the default for an empty one
+func validateFraming(framing string) (string, error) {
+	switch framing {
+	case "":
+		return FramingLine, nil
+	case FramingLine, FramingLSP:
+		return framing, nil
+	default:
+		return "", fmt.Errorf("invalid framing %q (use %q or %q)", framing, FramingLine, FramingLSP)
+	}
+}
+
+// readFramedMessage reads the next message in the given framing. In line
+// framing the message is the line without its terminator and may be empty.
+func readFramedMessage(reader *bufio.Reader, framing string) ([]byte, error) {
+	if framing != FramingLSP {
+		return readLine(reader, maxFramedMessage)
+	}
+
+	// Header lines end at a blank line; only Content-Length matters
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if length == -1 {
+				// Tolerate blank lines between messages
+				continue
+			}
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header line %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", strings.TrimSpace(value))
+			}
+			if length > maxFramedMessage {
+				return nil, fmt.Errorf("message of %d bytes exceeds limit %d", length, maxFramedMessage)
+			}
+		}
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// readLine reads a line without its terminator, failing once it grows past
+// limit bytes rather than buffering an unbounded line
+func readLine(reader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			if len(line) > limit {
+				return nil, fmt.Errorf("message exceeds limit %d", limit)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > limit {
+			return nil, fmt.Errorf("message of %d bytes exceeds limit %d", len(line), limit)
+		}
+		return line, nil
+	}
+}
+
+// writeFramedMessage writes one message in the given framing
+func writeFramedMessage(writer io.Writer, framing string, message []byte) error {
+	if framing == FramingLSP {
+		if _, err := fmt.Fprintf(writer, "Content-Length: %d\r\n\r\n", len(message)); err != nil {
+			return err
+		}
+		_, err := writer.Write(message)
+		return err
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	_, err := writer.Write([]byte("\n"))
+	return err
+}
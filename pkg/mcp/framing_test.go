@@ -0,0 +1,69 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLSPFraming(t *testing.T) {
+	// The body contains a raw newline, which line framing would split
+	body := []byte("{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"x\",\"params\":{\"text\":\"a\nb\"}}")
+
+	var buffer bytes.Buffer
+	if err := writeFramedMessage(&buffer, FramingLSP, body); err != nil {
+		t.Fatalf("writeFramedMessage failed: %v", err)
+	}
+	if err := writeFramedMessage(&buffer, FramingLSP, []byte("{}")); err != nil {
+		t.Fatalf("writeFramedMessage failed: %v", err)
+	}
+
+	reader := bufio.NewReader(&buffer)
+	for _, want := range [][]byte{body, []byte("{}")} {
+		message, err := readFramedMessage(reader, FramingLSP)
+		if err != nil {
+			t.Fatalf("readFramedMessage failed: %v", err)
+		}
+		if !bytes.Equal(message, want) {
+			t.Errorf("Expected %q, got %q", want, message)
+		}
+	}
+
+	// Other headers are ignored and the name is case-insensitive
+	reader = bufio.NewReader(strings.NewReader("content-length: 2\r\nContent-Type: application/json\r\n\r\n{}"))
+	if message, err := readFramedMessage(reader, FramingLSP); err != nil || string(message) != "{}" {
+		t.Errorf("Expected {}, got %q (%v)", message, err)
+	}
+
+	for _, input := range []string{
+		"Content-Length: abc\r\n\r\n",
+		"Content-Length: -1\r\n\r\n",
+		"not a header\r\n\r\n",
+	} {
+		if _, err := readFramedMessage(bufio.NewReader(strings.NewReader(input)), FramingLSP); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+
+	if _, err := validateFraming("xml"); err == nil {
+		t.Error("Expected an unknown framing to be rejected")
+	}
+}
+
+func TestLineFramingLimit(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader("{\"a\":1}\r\n"+strings.Repeat("x", 100)+"\n{}\n"), 16)
+
+	if line, err := readLine(reader, 50); err != nil || string(line) != `{"a":1}` {
+		t.Errorf("Expected {\"a\":1}, got %q (%v)", line, err)
+	}
+	if _, err := readLine(reader, 50); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("Expected an overlong line to be rejected, got: %v", err)
+	}
+
+	// A line exactly at the limit is accepted
+	reader = bufio.NewReaderSize(strings.NewReader(strings.Repeat("y", 50)+"\n"), 16)
+	if line, err := readLine(reader, 50); err != nil || len(line) != 50 {
+		t.Errorf("Expected a 50 byte line, got %d bytes (%v)", len(line), err)
+	}
+}
@@ -0,0 +1,548 @@
+package mcp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHTTPPath is the URL path of the MCP endpoint when none is configured
+const DefaultHTTPPath = "/mcp"
+
+// sessionHeader carries the session id assigned at initialization (MCP streamable HTTP)
+const sessionHeader = "Mcp-Session-Id"
+
+// maxHTTPMessage is the largest request body a client may POST
+const maxHTTPMessage = 64 << 20
+
+// httpSessionIdleTimeout is how long a session may go unused before it is closed
+const httpSessionIdleTimeout = 30 * time.Minute
+
+// HTTPTransport implements the Transport interface using the MCP streamable
+// HTTP transport: clients POST JSON-RPC messages to a single endpoint and
+// receive the responses as a Server-Sent Events stream, or as plain JSON if
+// they do not accept event streams. Sessions are keyed by the Mcp-Session-Id
+// header assigned in the response to initialize. Notifications go out on the
+// session's newest open event stream: the response to a POST being handled,
+// or a standalone stream the client opens with GET.
+type HTTPTransport struct {
+	config       NetworkConfig
+	listener     net.Listener
+	server       *http.Server
+	running      bool
+	mutex        sync.Mutex
+	handler      RequestHandlerFunc
+	closed       SessionClosedFunc
+	sessionMutex sync.Mutex
+	sessions     map[string]*httpSession // Open sessions by id
+	logger       Logger
+}
+
+// httpSession is an open session of the HTTP transport
+type httpSession struct {
+	lastUsed time.Time
+	streams  []*sseStream // Open event streams, newest last
+}
+
+// sseStream is a Server-Sent Events response that messages can be written to
+// from any goroutine while its request is being served
+type sseStream struct {
+	mutex   sync.Mutex
+	w       http.ResponseWriter
+	started bool          // Whether the response headers have been sent
+	closed  bool          // Set once the response is finished; later writes are dropped
+	done    chan struct{} // Closed when the session ends
+}
+
+// newSSEStream wraps a response writer as an event stream
+func newSSEStream(w http.ResponseWriter) *sseStream {
+	return &sseStream{w: w, done: make(chan struct{})}
+}
+
+// start sends the response headers if they have not been sent yet
+func (s *sseStream) start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.startLocked()
+}
+
+func (s *sseStream) startLocked() {
+	if s.started || s.closed {
+		return
+	}
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+	s.flush()
+}
+
+// write sends a message as an event, starting the stream if needed.
+// It reports false if the stream was already closed.
+func (s *sseStream) write(message []byte) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.startLocked()
+	fmt.Fprintf(s.w, "event: message\ndata: %s\n\n", message)
+	s.flush()
+	return true
+}
+
+// close stops further writes, reporting whether the stream was started.
+// It must be called before the handler serving the stream returns.
+func (s *sseStream) close() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	return s.started
+}
+
+func (s *sseStream) flush() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// NewHTTPTransport creates a new HTTP transport
+func NewHTTPTransport(config NetworkConfig) (*HTTPTransport, error) {
+	switch config.LogFormat {
+	case "":
+		config.LogFormat = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid log format %q (use %q or %q)", config.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	if config.Path == "" {
+		config.Path = DefaultHTTPPath
+	}
+	if !strings.HasPrefix(config.Path, "/") {
+		return nil, fmt.Errorf("invalid HTTP path %q: must start with /", config.Path)
+	}
+
+	return &HTTPTransport{
+		config:   config,
+		sessions: make(map[string]*httpSession),
+		logger:   defaultLogger(),
+	}, nil
+}
+
+// SetLogger sets the logger the transport reports to. It must be called before Start.
+func (t *HTTPTransport) SetLogger(logger Logger) {
+	t.logger = logger
+}
+
+// Start starts the HTTP transport
+func (t *HTTPTransport) Start(handler RequestHandlerFunc, closed SessionClosedFunc) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.running {
+		return fmt.Errorf("transport already running")
+	}
+
+	t.handler = handler
+	t.closed = closed
+
+	addr := fmt.Sprintf("%s:%d", t.config.Host, t.config.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(t.config.Path, t)
+	t.listener = listener
+	t.server = &http.Server{Handler: mux}
+	t.running = true
+
+	t.logger.Info("MCP HTTP Transport listening on http://%s%s", addr, t.config.Path)
+	t.config.logWhitelist(t.logger)
+
+	go t.server.Serve(listener)
+
+	return nil
+}
+
+// Stop stops the HTTP transport and closes every open session
+func (t *HTTPTransport) Stop() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.running {
+		return nil
+	}
+
+	t.server.Close()
+
+	t.sessionMutex.Lock()
+	sessions := t.sessions
+	t.sessions = make(map[string]*httpSession)
+	t.sessionMutex.Unlock()
+	for id, session := range sessions {
+		t.endSession(id, session)
+	}
+	t.running = false
+
+	return nil
+}
+
+// SendNotification sends a notification to every session with an open event stream
+func (t *HTTPTransport) SendNotification(method string, params interface{}) {
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+
+	t.sessionMutex.Lock()
+	streams := make([]*sseStream, 0, len(t.sessions))
+	for _, session := range t.sessions {
+		if len(session.streams) > 0 {
+			streams = append(streams, session.streams[len(session.streams)-1])
+		}
+	}
+	t.sessionMutex.Unlock()
+
+	for _, stream := range streams {
+		stream.write(message)
+	}
+}
+
+// SendSessionNotification sends a notification on a session's newest open
+// event stream. It is dropped if the session has none.
+func (t *HTTPTransport) SendSessionNotification(session, method string, params interface{}) {
+	t.sessionMutex.Lock()
+	var stream *sseStream
+	if s, ok := t.sessions[session]; ok && len(s.streams) > 0 {
+		stream = s.streams[len(s.streams)-1]
+	}
+	t.sessionMutex.Unlock()
+
+	if stream == nil {
+		t.logger.Debug("Dropping notification %s: session %s has no open event stream", method, session)
+		return
+	}
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+	stream.write(message)
+}
+
+// ServeHTTP handles requests to the MCP endpoint
+func (t *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	remoteAddr := httpRemoteAddr(r)
+	if !t.config.isIPAllowed(remoteAddr) {
+		t.config.logConnectionEvent(t.logger, "rejected", remoteAddr, "not in whitelist")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	// The streamable HTTP spec requires validating Origin against DNS rebinding
+	if !t.config.isOriginAllowed(r) {
+		t.config.logConnectionEvent(t.logger, "rejected", remoteAddr, "origin not allowed")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	t.expireSessions()
+
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r, remoteAddr)
+	case http.MethodGet:
+		t.handleGet(w, r)
+	case http.MethodDelete:
+		id := r.Header.Get(sessionHeader)
+		session, ok := t.takeSession(id)
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		t.endSession(id, session)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGet serves a standalone event stream carrying the notifications sent
+// to a session between requests, until the client disconnects or the session ends
+func (t *HTTPTransport) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "GET opens an event stream and requires Accept: text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+	session := r.Header.Get(sessionHeader)
+	if session == "" {
+		http.Error(w, "missing "+sessionHeader+" header; send initialize first", http.StatusBadRequest)
+		return
+	}
+
+	stream := newSSEStream(w)
+	if !t.addStream(session, stream) {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	stream.start()
+
+	select {
+	case <-r.Context().Done():
+	case <-stream.done:
+	}
+	t.removeStream(session, stream)
+	stream.close()
+}
+
+// handlePost processes a POSTed JSON-RPC message or batch and writes the responses
+func (t *HTTPTransport) handlePost(w http.ResponseWriter, r *http.Request, remoteAddr net.Addr) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxHTTPMessage+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxHTTPMessage {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	messages, batch, err := splitBatch(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, parseErrorResponse(err))
+		return
+	}
+
+	// An initialize request starts a new session; anything else must name an open one
+	session := r.Header.Get(sessionHeader)
+	if containsInitialize(messages) {
+		session, err = t.newSession()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.config.logConnectionEvent(t.logger, "accepted", remoteAddr, "")
+		w.Header().Set(sessionHeader, session)
+	} else if session == "" {
+		http.Error(w, "missing "+sessionHeader+" header; send initialize first", http.StatusBadRequest)
+		return
+	} else if !t.touchSession(session) {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	// With an event stream, notifications sent while the messages are handled,
+	// such as progress, are delivered in the response ahead of the results
+	var stream *sseStream
+	if acceptsEventStream(r) {
+		stream = newSSEStream(w)
+		t.addStream(session, stream)
+	}
+
+	var responses [][]byte
+	for _, message := range messages {
+		response, err := t.handler(session, message)
+		if err != nil {
+			response = internalErrorResponse(err)
+		}
+		if len(response) == 0 {
+			continue
+		}
+
+		if stream != nil {
+			// Send each response as soon as it is ready
+			stream.write(response)
+			continue
+		}
+		responses = append(responses, response)
+	}
+
+	started := false
+	if stream != nil {
+		t.removeStream(session, stream)
+		started = stream.close()
+	}
+
+	switch {
+	case started:
+		// The stream ends with the last response
+	case len(responses) == 0:
+		// Only notifications or responses were sent
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeJSON(w, http.StatusOK, append(append([]byte("["), bytes.Join(responses, []byte(","))...), ']'))
+	default:
+		writeJSON(w, http.StatusOK, responses[0])
+	}
+}
+
+// newSession opens a session with a random id
+func (t *HTTPTransport) newSession() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("failed to create session id: %w", err)
+	}
+	session := hex.EncodeToString(id[:])
+
+	t.sessionMutex.Lock()
+	t.sessions[session] = &httpSession{lastUsed: time.Now()}
+	t.sessionMutex.Unlock()
+	return session, nil
+}
+
+// touchSession records a use of a session, reporting whether it is open
+func (t *HTTPTransport) touchSession(id string) bool {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	session, ok := t.sessions[id]
+	if !ok {
+		return false
+	}
+	session.lastUsed = time.Now()
+	return true
+}
+
+// takeSession removes a session, returning it if it was open
+func (t *HTTPTransport) takeSession(id string) (*httpSession, bool) {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	session, ok := t.sessions[id]
+	if ok {
+		delete(t.sessions, id)
+	}
+	return session, ok
+}
+
+// addStream registers an open event stream of a session, reporting whether the session is open
+func (t *HTTPTransport) addStream(id string, stream *sseStream) bool {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	session, ok := t.sessions[id]
+	if !ok {
+		return false
+	}
+	session.lastUsed = time.Now()
+	session.streams = append(session.streams, stream)
+	return true
+}
+
+// removeStream unregisters an event stream once its response is finishing
+func (t *HTTPTransport) removeStream(id string, stream *sseStream) {
+	t.sessionMutex.Lock()
+	defer t.sessionMutex.Unlock()
+
+	session, ok := t.sessions[id]
+	if !ok {
+		return
+	}
+	for i, open := range session.streams {
+		if open == stream {
+			session.streams = append(session.streams[:i], session.streams[i+1:]...)
+			break
+		}
+	}
+	session.lastUsed = time.Now()
+}
+
+// expireSessions closes sessions that have been idle too long, since HTTP
+// clients may simply stop sending requests instead of deleting their session
+func (t *HTTPTransport) expireSessions() {
+	cutoff := time.Now().Add(-httpSessionIdleTimeout)
+
+	t.sessionMutex.Lock()
+	expired := make(map[string]*httpSession)
+	for id, session := range t.sessions {
+		// A session listening on an event stream is in use however long it waits
+		if len(session.streams) == 0 && session.lastUsed.Before(cutoff) {
+			expired[id] = session
+			delete(t.sessions, id)
+		}
+	}
+	t.sessionMutex.Unlock()
+
+	for id, session := range expired {
+		t.endSession(id, session)
+	}
+}
+
+// endSession runs the session closer for a session already removed from the
+// map and releases its standalone event streams
+func (t *HTTPTransport) endSession(id string, session *httpSession) {
+	for _, stream := range session.streams {
+		close(stream.done)
+	}
+	if t.closed != nil {
+		t.closed(id)
+	}
+	t.logger.Info("HTTP session %s closed", id)
+}
+
+// splitBatch splits a POST body into its JSON-RPC messages, reporting whether it was a batch
+func splitBatch(body []byte) ([]json.RawMessage, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, false, fmt.Errorf("empty request body")
+	}
+	if trimmed[0] != '[' {
+		return []json.RawMessage{trimmed}, false, nil
+	}
+
+	var messages []json.RawMessage
+	if err := json.Unmarshal(trimmed, &messages); err != nil {
+		return nil, false, fmt.Errorf("invalid JSON-RPC batch: %w", err)
+	}
+	if len(messages) == 0 {
+		return nil, false, fmt.Errorf("empty JSON-RPC batch")
+	}
+	return messages, true, nil
+}
+
+// containsInitialize reports whether any message is an initialize request
+func containsInitialize(messages []json.RawMessage) bool {
+	for _, message := range messages {
+		var request struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(message, &request) == nil && request.Method == "initialize" {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEventStream reports whether the client accepts a Server-Sent Events response
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+			if strings.EqualFold(mediaType, "text/event-stream") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeJSON writes a JSON response body with a status code
+func writeJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
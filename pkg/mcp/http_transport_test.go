@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestHTTPTransport creates a transport whose handler echoes each request,
+// answers nothing to notifications and records closed sessions
+func newTestHTTPTransport(t *testing.T) (*HTTPTransport, *[]string) {
+	t.Helper()
+
+	transport, err := NewHTTPTransport(NetworkConfig{})
+	if err != nil {
+		t.Fatalf("NewHTTPTransport failed: %v", err)
+	}
+	transport.handler = func(session string, message []byte) ([]byte, error) {
+		if !strings.Contains(string(message), `"id"`) {
+			return nil, nil
+		}
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{"session":"` + session + `"}}`), nil
+	}
+	var closed []string
+	transport.closed = func(session string) {
+		closed = append(closed, session)
+	}
+	return transport, &closed
+}
+
+// post sends a request to the transport and returns the recorded response
+func post(transport *HTTPTransport, body, session, accept string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, DefaultHTTPPath, strings.NewReader(body))
+	request.RemoteAddr = "127.0.0.1:5000"
+	if session != "" {
+		request.Header.Set(sessionHeader, session)
+	}
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	transport.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestHTTPTransportSessions(t *testing.T) {
+	transport, closed := newTestHTTPTransport(t)
+
+	// Requests before initialize have no session
+	if response := post(transport, `{"jsonrpc":"2.0","id":1,"method":"ping"}`, "", ""); response.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a session, got %d", response.Code)
+	}
+
+	initialize := post(transport, `{"jsonrpc":"2.0","id":1,"method":"initialize"}`, "", "application/json")
+	session := initialize.Header().Get(sessionHeader)
+	if initialize.Code != http.StatusOK || session == "" {
+		t.Fatalf("Expected initialize to assign a session, got %d %q", initialize.Code, session)
+	}
+	if !strings.Contains(initialize.Body.String(), session) {
+		t.Errorf("Expected handler to run in the new session, got %s", initialize.Body.String())
+	}
+
+	if response := post(transport, `{"jsonrpc":"2.0","id":2,"method":"ping"}`, "unknown", ""); response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", response.Code)
+	}
+
+	// Notifications alone are accepted without a body
+	if response := post(transport, `{"jsonrpc":"2.0","method":"notifications/initialized"}`, session, ""); response.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 for a notification, got %d", response.Code)
+	}
+
+	request := httptest.NewRequest(http.MethodDelete, DefaultHTTPPath, nil)
+	request.RemoteAddr = "127.0.0.1:5000"
+	request.Header.Set(sessionHeader, session)
+	recorder := httptest.NewRecorder()
+	transport.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusNoContent || len(*closed) != 1 || (*closed)[0] != session {
+		t.Errorf("Expected DELETE to close the session, got %d %v", recorder.Code, *closed)
+	}
+	if response := post(transport, `{"jsonrpc":"2.0","id":3,"method":"ping"}`, session, ""); response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after the session ended, got %d", response.Code)
+	}
+}
+
+func TestHTTPTransportStreamsResponses(t *testing.T) {
+	transport, _ := newTestHTTPTransport(t)
+	session := post(transport, `{"jsonrpc":"2.0","id":1,"method":"initialize"}`, "", "").Header().Get(sessionHeader)
+
+	batch := `[{"jsonrpc":"2.0","id":2,"method":"a"},{"jsonrpc":"2.0","method":"b"},{"jsonrpc":"2.0","id":3,"method":"c"}]`
+	response := post(transport, batch, session, "application/json, text/event-stream")
+	if contentType := response.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", contentType)
+	}
+	if events := strings.Count(response.Body.String(), "event: message\ndata: {"); events != 2 {
+		t.Errorf("Expected one event per request, got %d in %q", events, response.Body.String())
+	}
+
+	// Without text/event-stream a batch gets a JSON array
+	response = post(transport, batch, session, "application/json")
+	if body := response.Body.String(); !strings.HasPrefix(body, "[{") || strings.Count(body, `"result"`) != 2 {
+		t.Errorf("Expected a JSON array of two responses, got %q", body)
+	}
+
+	// Clients outside the whitelist are refused
+	transport.config.AllowedIPs = []string{"192.0.2.1"}
+	if response := post(transport, `{"jsonrpc":"2.0","id":4,"method":"a"}`, session, ""); response.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 outside the whitelist, got %d", response.Code)
+	}
+}
+
+func TestHTTPTransportOriginCheck(t *testing.T) {
+	transport, _ := newTestHTTPTransport(t)
+	transport.config.AllowedOrigins = []string{"https://app.example"}
+
+	for origin, want := range map[string]int{
+		"":                      http.StatusOK,
+		"http://127.0.0.1:8080": http.StatusOK,
+		"https://app.example":   http.StatusOK,
+		"https://evil.example":  http.StatusForbidden,
+		"http://localhost:9090": http.StatusForbidden,
+	} {
+		request := httptest.NewRequest(http.MethodPost, DefaultHTTPPath, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+		request.RemoteAddr = "127.0.0.1:5000"
+		request.Host = "127.0.0.1:8080"
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		recorder := httptest.NewRecorder()
+		transport.ServeHTTP(recorder, request)
+		if recorder.Code != want {
+			t.Errorf("Origin %q: expected %d, got %d", origin, want, recorder.Code)
+		}
+	}
+}
+
+func TestHTTPTransportStreamsNotifications(t *testing.T) {
+	transport, _ := newTestHTTPTransport(t)
+	session := post(transport, `{"jsonrpc":"2.0","id":1,"method":"initialize"}`, "", "").Header().Get(sessionHeader)
+
+	// Notifications sent while a request is handled arrive ahead of its response
+	echo := transport.handler
+	transport.handler = func(session string, message []byte) ([]byte, error) {
+		transport.SendSessionNotification(session, "notifications/progress", map[string]interface{}{"progress": 1})
+		return echo(session, message)
+	}
+	body := post(transport, `{"jsonrpc":"2.0","id":2,"method":"a"}`, session, "text/event-stream").Body.String()
+	progress := strings.Index(body, `"method":"notifications/progress"`)
+	result := strings.Index(body, `"result"`)
+	if progress < 0 || result < progress {
+		t.Errorf("Expected the progress notification before the response, got %q", body)
+	}
+	transport.handler = echo
+
+	// Between requests they go to the standalone stream opened with GET
+	server := httptest.NewServer(transport)
+	defer server.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+DefaultHTTPPath, nil)
+	for _, tt := range []struct {
+		accept, session string
+		want            int
+	}{
+		{"application/json", session, http.StatusNotAcceptable},
+		{"text/event-stream", "unknown", http.StatusNotFound},
+	} {
+		request.Header.Set("Accept", tt.accept)
+		request.Header.Set(sessionHeader, tt.session)
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != tt.want {
+			t.Errorf("GET with Accept %q in session %q: expected %d, got %d", tt.accept, tt.session, tt.want, response.StatusCode)
+		}
+	}
+	request.Header.Set("Accept", "text/event-stream")
+
+	request.Header.Set(sessionHeader, session)
+	response, err := client.Do(request)
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("Expected GET to open an event stream, got %v %v", response, err)
+	}
+	defer response.Body.Close()
+
+	transport.SendSessionNotification(session, "notifications/resources/updated", map[string]string{"uri": "file:///a.txt"})
+	reader := bufio.NewReader(response.Body)
+	var line string
+	for !strings.HasPrefix(line, "data: ") && err == nil {
+		line, err = reader.ReadString('\n')
+	}
+	if !strings.Contains(line, `"method":"notifications/resources/updated"`) {
+		t.Errorf("Expected the notification on the GET stream, got %q (%v)", line, err)
+	}
+
+	// Ending the session ends its stream
+	remove := httptest.NewRequest(http.MethodDelete, DefaultHTTPPath, nil)
+	remove.RemoteAddr = "127.0.0.1:5000"
+	remove.Header.Set(sessionHeader, session)
+	transport.ServeHTTP(httptest.NewRecorder(), remove)
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected the stream to end with the session, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package mcp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LogLevel is the severity of a log message, using the syslog levels of the
+// MCP logging capability
+type LogLevel int
+
+// Log levels from least to most severe
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelNotice
+	LevelWarning
+	LevelError
+	LevelCritical
+	LevelAlert
+	LevelEmergency
+)
+
+// logLevelNames are the MCP names of the levels, indexed by level
+var logLevelNames = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// String returns the MCP name of the level
+func (l LogLevel) String() string {
+	if l < LevelDebug || l > LevelEmergency {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// ParseLogLevel parses an MCP log level name such as "debug" or "warning"
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return LogLevel(level), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q (use one of %s)", name, strings.Join(logLevelNames, ", "))
+}
+
+// Logger receives the log messages of the server and transports
+type Logger interface {
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+	Error(format string, args ...interface{})
+}
+
+// levelController is implemented by loggers that clients may receive
+// messages from by choosing a level with logging/setLevel
+type levelController interface {
+	SetSessionLevel(session string, level LogLevel)
+	ForgetSession(session string)
+	EnableNotifications(notify func(session string, message LoggingMessageParams))
+	Session(session string) Logger
+}
+
+// rawLogger is implemented by loggers that can write a preformatted line,
+// such as a JSON record, exactly as given
+type rawLogger interface {
+	LogRaw(level LogLevel, line string)
+}
+
+// NopLogger discards every message
+type NopLogger struct{}
+
+func (NopLogger) Debug(format string, args ...interface{}) {}
+func (NopLogger) Info(format string, args ...interface{})  {}
+func (NopLogger) Warn(format string, args ...interface{})  {}
+func (NopLogger) Error(format string, args ...interface{}) {}
+
+// LevelLogger is the default Logger. It writes messages at or above its
+// level to stderr. Messages logged on behalf of a session that has chosen a
+// level with logging/setLevel are also sent to that session alone as
+// notifications/message, so clients never see each other's requests.
+type LevelLogger struct {
+	out           io.Writer
+	outMutex      sync.Mutex
+	level         atomic.Int32
+	notify        atomic.Value // func(string, LoggingMessageParams), set by EnableNotifications
+	notifying     atomic.Bool  // Set while a message is being sent to a client
+	sessionMutex  sync.RWMutex
+	sessionLevels map[string]LogLevel // Level each session chose with logging/setLevel
+}
+
+// NewLevelLogger creates a logger writing messages at or above level to out
+func NewLevelLogger(out io.Writer, level LogLevel) *LevelLogger {
+	logger := &LevelLogger{out: out, sessionLevels: make(map[string]LogLevel)}
+	logger.level.Store(int32(level))
+	return logger
+}
+
+// defaultLogger creates the logger used until SetLogger is called: info and
+// above, to stderr
+func defaultLogger() Logger {
+	return NewLevelLogger(os.Stderr, LevelInfo)
+}
+
+// SetLevel sets the least severe level that is logged
+func (l *LevelLogger) SetLevel(level LogLevel) {
+	l.level.Store(int32(level))
+}
+
+// Level returns the least severe level that is logged
+func (l *LevelLogger) Level() LogLevel {
+	return LogLevel(l.level.Load())
+}
+
+// SetSessionLevel sets the least severe level sent to a session as
+// notifications/message. It does not change what is written to stderr.
+func (l *LevelLogger) SetSessionLevel(session string, level LogLevel) {
+	l.sessionMutex.Lock()
+	defer l.sessionMutex.Unlock()
+	l.sessionLevels[session] = level
+}
+
+// ForgetSession stops sending messages to a session that has ended
+func (l *LevelLogger) ForgetSession(session string) {
+	l.sessionMutex.Lock()
+	defer l.sessionMutex.Unlock()
+	delete(l.sessionLevels, session)
+}
+
+// sessionLevel returns the level a session chose, if it chose one
+func (l *LevelLogger) sessionLevel(session string) (LogLevel, bool) {
+	l.sessionMutex.RLock()
+	defer l.sessionMutex.RUnlock()
+	level, ok := l.sessionLevels[session]
+	return level, ok
+}
+
+// EnableNotifications makes the logger pass the messages meant for a session to notify
+func (l *LevelLogger) EnableNotifications(notify func(session string, message LoggingMessageParams)) {
+	l.notify.Store(notify)
+}
+
+// Session returns a logger for messages about one session's requests: they
+// are logged as usual and sent to that session if it chose a level
+func (l *LevelLogger) Session(session string) Logger {
+	return sessionLogger{logger: l, session: session}
+}
+
+// Debug logs a message at LevelDebug
+func (l *LevelLogger) Debug(format string, args ...interface{}) {
+	l.log("", LevelDebug, format, args...)
+}
+
+// Info logs a message at LevelInfo
+func (l *LevelLogger) Info(format string, args ...interface{}) {
+	l.log("", LevelInfo, format, args...)
+}
+
+// Warn logs a message at LevelWarning
+func (l *LevelLogger) Warn(format string, args ...interface{}) {
+	l.log("", LevelWarning, format, args...)
+}
+
+// Error logs a message at LevelError
+func (l *LevelLogger) Error(format string, args ...interface{}) {
+	l.log("", LevelError, format, args...)
+}
+
+// LogRaw writes line as it is, without the level prefix, if level is enabled.
+// It is not sent to clients.
+func (l *LevelLogger) LogRaw(level LogLevel, line string) {
+	if level < l.Level() {
+		return
+	}
+	l.outMutex.Lock()
+	defer l.outMutex.Unlock()
+	fmt.Fprintln(l.out, line)
+}
+
+// log writes a message if its level is enabled and sends it to session if
+// the session chose a level it meets. Messages logged while another is being
+// sent to a client only go to stderr, so a transport that logs its own write
+// errors cannot recurse.
+func (l *LevelLogger) log(session string, level LogLevel, format string, args ...interface{}) {
+	sessionLevel, ok := l.sessionLevel(session)
+	toSession := ok && level >= sessionLevel
+	toOut := level >= l.Level()
+	if !toOut && !toSession {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+
+	if toOut {
+		l.outMutex.Lock()
+		fmt.Fprintf(l.out, "[%s] %s\n", level, message)
+		l.outMutex.Unlock()
+	}
+
+	notify, _ := l.notify.Load().(func(string, LoggingMessageParams))
+	if !toSession || notify == nil || !l.notifying.CompareAndSwap(false, true) {
+		return
+	}
+	defer l.notifying.Store(false)
+	notify(session, LoggingMessageParams{Level: level.String(), Logger: "server", Data: message})
+}
+
+// sessionLogger logs on behalf of one session of a LevelLogger
+type sessionLogger struct {
+	logger  *LevelLogger
+	session string
+}
+
+func (l sessionLogger) Debug(format string, args ...interface{}) {
+	l.logger.log(l.session, LevelDebug, format, args...)
+}
+
+func (l sessionLogger) Info(format string, args ...interface{}) {
+	l.logger.log(l.session, LevelInfo, format, args...)
+}
+
+func (l sessionLogger) Warn(format string, args ...interface{}) {
+	l.logger.log(l.session, LevelWarning, format, args...)
+}
+
+func (l sessionLogger) Error(format string, args ...interface{}) {
+	l.logger.log(l.session, LevelError, format, args...)
+}
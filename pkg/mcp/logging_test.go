@@ -0,0 +1,157 @@
+package mcp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	var out bytes.Buffer
+	log := NewLevelLogger(&out, LevelInfo)
+
+	var sent []LoggingMessageParams
+	log.EnableNotifications(func(session string, message LoggingMessageParams) {
+		if session != "a" {
+			t.Errorf("Expected messages for session a only, got one for %q", session)
+		}
+		sent = append(sent, message)
+		// Logging while sending only reaches stderr
+		log.Error("while sending")
+	})
+	client := log.Session("a")
+	client.Debug("hidden")
+	client.Info("before %d", 1)
+	log.SetSessionLevel("a", LevelWarning)
+	client.Warn("after")
+	log.Session("b").Error("other session")
+	log.Error("no session")
+
+	if got := out.String(); got != "[info] before 1\n[warning] after\n[error] while sending\n[error] other session\n[error] no session\n" {
+		t.Errorf("Unexpected log output %q", got)
+	}
+	if len(sent) != 1 || sent[0].Level != "warning" || sent[0].Data != "after" {
+		t.Errorf("Expected one warning notification, got %+v", sent)
+	}
+
+	// A session's level reaches below the stderr level without changing it
+	log.SetSessionLevel("a", LevelDebug)
+	client.Debug("verbose")
+	if len(sent) != 2 || sent[1].Data != "verbose" || strings.Contains(out.String(), "verbose") {
+		t.Errorf("Expected debug to reach the session but not stderr, got %+v and %q", sent, out.String())
+	}
+	log.ForgetSession("a")
+	client.Error("gone")
+	if len(sent) != 2 {
+		t.Errorf("Expected nothing sent after the session ended, got %+v", sent)
+	}
+
+	log.SetLevel(LevelError)
+	log.Warn("quiet")
+	if strings.Contains(out.String(), "quiet") {
+		t.Error("Expected messages below the level to be dropped")
+	}
+
+	if level, err := ParseLogLevel("Warning"); err != nil || level != LevelWarning {
+		t.Errorf("Expected warning, got %v (%v)", level, err)
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("Expected an unknown level to be rejected")
+	}
+}
+
+func TestSetLevelRejectsUnknownLevels(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	response, err := server.handleRequest([]byte(`{"jsonrpc":"2.0","id":2,"method":"logging/setLevel","params":{"level":"loud"}}`))
+	if err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+	if !strings.Contains(string(response), `"code":-32602`) {
+		t.Errorf("Expected an invalid params error, got %s", response)
+	}
+}
+
+func TestInfoLoggingOmitsPayloads(t *testing.T) {
+	server, _ := newTestServer(t)
+	var out bytes.Buffer
+	server.SetLogger(NewLevelLogger(&out, LevelInfo))
+
+	request := `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"write_file","arguments":{"content":"secret"}}}`
+	if _, err := server.handleRequest([]byte(request)); err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "[info] tools/call id=7 (") {
+		t.Errorf("Expected the method, id and duration to be logged, got %q", out.String())
+	}
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("Expected no payloads at info level, got %q", out.String())
+	}
+
+	// Debug includes the response
+	out.Reset()
+	server.SetLogger(NewLevelLogger(&out, LevelDebug))
+	server.handleRequest([]byte(request))
+	if !strings.Contains(out.String(), `Response: {"jsonrpc":"2.0","id":7`) {
+		t.Errorf("Expected payloads at debug level, got %q", out.String())
+	}
+}
+
+// recordingTransport records the notifications sent to each session
+type recordingTransport struct {
+	mutex sync.Mutex
+	sent  map[string][]interface{} // Session -> params of each notification
+}
+
+func (t *recordingTransport) Start(handler RequestHandlerFunc, closed SessionClosedFunc) error {
+	return nil
+}
+
+func (t *recordingTransport) Stop() error                                        { return nil }
+func (t *recordingTransport) SendNotification(method string, params interface{}) {}
+func (t *recordingTransport) SetLogger(logger Logger)                            {}
+
+func (t *recordingTransport) SendSessionNotification(session, method string, params interface{}) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sent[session] = append(t.sent[session], params)
+}
+
+func TestSetLevelIsPerSession(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.SetLogger(NewLevelLogger(io.Discard, LevelInfo))
+	transport := &recordingTransport{sent: make(map[string][]interface{})}
+	server.transport = transport
+	server.handleRequest([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+
+	if _, err := server.handleSessionRequest("a", []byte(`{"jsonrpc":"2.0","id":1,"method":"logging/setLevel","params":{"level":"debug"}}`)); err != nil {
+		t.Fatalf("logging/setLevel failed: %v", err)
+	}
+	server.handleSessionRequest("b", []byte(`{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"write_file","arguments":{"content":"secret"}}}`))
+	server.handleSessionRequest("a", []byte(`{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{}}`))
+
+	if len(transport.sent) != 1 || len(transport.sent["a"]) == 0 {
+		t.Fatalf("Expected messages for session a only, got %v", transport.sent)
+	}
+	var data []string
+	for _, params := range transport.sent["a"] {
+		data = append(data, params.(LoggingMessageParams).Data.(string))
+	}
+	all := strings.Join(data, "\n")
+	if !strings.Contains(all, `Response: {"jsonrpc":"2.0","id":9`) {
+		t.Errorf("Expected the session's own response at debug, got %q", all)
+	}
+	if strings.Contains(all, "secret") || strings.Contains(all, "id=8") {
+		t.Errorf("Expected nothing about another session's requests, got %q", all)
+	}
+
+	// The level ends with the session
+	server.closeSession("a")
+	sent := len(transport.sent["a"])
+	server.handleSessionRequest("a", []byte(`{"jsonrpc":"2.0","id":10,"method":"ping"}`))
+	if len(transport.sent["a"]) != sent {
+		t.Errorf("Expected no messages after the session closed, got %v", transport.sent["a"][sent:])
+	}
+}
@@ -2,21 +2,61 @@ package mcp
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// Connection log formats supported by the network transport
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Response compression modes supported by the network transport
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// DefaultCompressionMinBytes is the smallest response compressed when gzip is enabled
+const DefaultCompressionMinBytes = 1024
+
+// gzipFramePrefix starts a compressed response line. The rest of the line is the
+// base64-encoded gzip of the JSON message. Plain JSON-RPC messages always start
+// with '{', so the prefix unambiguously distinguishes the two.
+const gzipFramePrefix = "gzip:"
+
 // NetworkConfig holds configuration for network transport
 type NetworkConfig struct {
-	Host           string
-	Port           int
-	AllowedIPs     []string
-	AllowedSubnets []*net.IPNet
+	Host                string
+	Port                int
+	AllowedIPs          []string
+	AllowedSubnets      []*net.IPNet
+	LogFormat           string // Format of connection events: "text" (default) or "json"
+	Compression         string // Response compression: "none" (default) or "gzip"
+	CompressionMinBytes int    // Responses smaller than this are sent uncompressed (0 = default)
+	Path                string // URL path served by the WebSocket and HTTP transports (default "/mcp")
+	MaxConnections      int           // Connections served at once; further clients are refused (0 = unlimited)
+	IdleTimeout         time.Duration // Connections with no traffic for this long are closed (0 = never)
+	Framing             string        // Message framing of the TCP transport: FramingLine (default) or FramingLSP
+	AllowedOrigins      []string      // Browser origins, e.g. "https://app.example", the WebSocket and HTTP transports accept besides the server's own; "*" accepts any
+}
+
+// connectionEvent is a connection lifecycle event in JSON log format
+type connectionEvent struct {
+	Time       string `json:"time"`
+	Event      string `json:"event"`
+	RemoteAddr string `json:"remoteAddr"`
+	Reason     string `json:"reason,omitempty"`
 }
 
 // NetworkTransport implements the Transport interface using TCP sockets
@@ -28,16 +68,55 @@ type NetworkTransport struct {
 	waitGroup sync.WaitGroup
 	mutex     sync.Mutex
 	handler   RequestHandlerFunc
+	closed    SessionClosedFunc
+	sessions  uint64        // Connections accepted so far, used to number sessions
+	connSlots chan struct{} // Bounds open connections; nil means unlimited
+	connMutex sync.Mutex
+	writers   map[string]func([]byte) // Writers of open sessions, for notifications
+	logger    Logger
 }
 
 // NewNetworkTransport creates a new network transport
 func NewNetworkTransport(config NetworkConfig) (*NetworkTransport, error) {
+	switch config.LogFormat {
+	case "":
+		config.LogFormat = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid log format %q (use %q or %q)", config.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	switch config.Compression {
+	case "":
+		config.Compression = CompressionNone
+	case CompressionNone, CompressionGzip:
+	default:
+		return nil, fmt.Errorf("invalid compression %q (use %q or %q)", config.Compression, CompressionNone, CompressionGzip)
+	}
+	if config.CompressionMinBytes <= 0 {
+		config.CompressionMinBytes = DefaultCompressionMinBytes
+	}
+
+	framing, err := validateFraming(config.Framing)
+	if err != nil {
+		return nil, err
+	}
+	config.Framing = framing
+
 	return &NetworkTransport{
-		config:   config,
-		stopChan: make(chan struct{}),
+		config:    config,
+		stopChan:  make(chan struct{}),
+		connSlots: newConnectionSlots(config.MaxConnections),
+		writers:   make(map[string]func([]byte)),
+		logger:    defaultLogger(),
 	}, nil
 }
 
+// SetLogger sets the logger the transport reports to. It must be called before Start.
+func (t *NetworkTransport) SetLogger(logger Logger) {
+	t.logger = logger
+}
+
 // ParseNetworkConfig parses network configuration including CIDR subnets
 func ParseNetworkConfig(host string, port int, allowedIPs []string, allowedSubnetStrs []string) (NetworkConfig, error) {
 	config := NetworkConfig{
@@ -59,7 +138,7 @@ func ParseNetworkConfig(host string, port int, allowedIPs []string, allowedSubne
 }
 
 // Start starts the network transport
-func (t *NetworkTransport) Start(handler RequestHandlerFunc) error {
+func (t *NetworkTransport) Start(handler RequestHandlerFunc, closed SessionClosedFunc) error {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -68,6 +147,7 @@ func (t *NetworkTransport) Start(handler RequestHandlerFunc) error {
 	}
 
 	t.handler = handler
+	t.closed = closed
 
 	addr := fmt.Sprintf("%s:%d", t.config.Host, t.config.Port)
 	listener, err := net.Listen("tcp", addr)
@@ -78,13 +158,8 @@ func (t *NetworkTransport) Start(handler RequestHandlerFunc) error {
 	t.listener = listener
 	t.running = true
 
-	fmt.Fprintf(os.Stderr, "MCP Network Transport listening on %s\n", addr)
-	if len(t.config.AllowedIPs) > 0 || len(t.config.AllowedSubnets) > 0 {
-		fmt.Fprintf(os.Stderr, "IP Whitelist enabled: IPs=%v, Subnets=%v\n", 
-			t.config.AllowedIPs, formatSubnets(t.config.AllowedSubnets))
-	} else {
-		fmt.Fprintf(os.Stderr, "WARNING: No IP restrictions configured - all connections allowed\n")
-	}
+	t.logger.Info("MCP Network Transport listening on %s", addr)
+	t.config.logWhitelist(t.logger)
 
 	t.waitGroup.Add(1)
 	go t.acceptConnections()
@@ -125,26 +200,36 @@ func (t *NetworkTransport) acceptConnections() {
 				case <-t.stopChan:
 					return
 				default:
-					fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
+					t.logger.Error("Error accepting connection: %v", err)
 					continue
 				}
 			}
 
-			if !t.isIPAllowed(conn.RemoteAddr()) {
-				fmt.Fprintf(os.Stderr, "Connection rejected from %s - not in whitelist\n", conn.RemoteAddr())
+			if !t.config.isIPAllowed(conn.RemoteAddr()) {
+				t.config.logConnectionEvent(t.logger, "rejected", conn.RemoteAddr(), "not in whitelist")
+				conn.Close()
+				continue
+			}
+
+			if !acquireConnectionSlot(t.connSlots) {
+				t.config.logConnectionEvent(t.logger, "rejected", conn.RemoteAddr(), "connection limit reached")
 				conn.Close()
 				continue
 			}
 
-			fmt.Fprintf(os.Stderr, "Accepted connection from %s\n", conn.RemoteAddr())
+			t.config.logConnectionEvent(t.logger, "accepted", conn.RemoteAddr(), "")
 			t.waitGroup.Add(1)
-			go t.handleConnection(conn)
+			go func() {
+				defer releaseConnectionSlot(t.connSlots)
+				t.handleConnection(conn)
+			}()
 		}
 	}
 }
 
-func (t *NetworkTransport) isIPAllowed(addr net.Addr) bool {
-	if len(t.config.AllowedIPs) == 0 && len(t.config.AllowedSubnets) == 0 {
+// isIPAllowed reports whether the whitelist admits a client address
+func (c NetworkConfig) isIPAllowed(addr net.Addr) bool {
+	if len(c.AllowedIPs) == 0 && len(c.AllowedSubnets) == 0 {
 		return true
 	}
 
@@ -155,13 +240,13 @@ func (t *NetworkTransport) isIPAllowed(addr net.Addr) bool {
 	
 	ip := tcpAddr.IP.String()
 	
-	for _, allowedIP := range t.config.AllowedIPs {
+	for _, allowedIP := range c.AllowedIPs {
 		if ip == allowedIP {
 			return true
 		}
 	}
 	
-	for _, subnet := range t.config.AllowedSubnets {
+	for _, subnet := range c.AllowedSubnets {
 		if subnet.Contains(tcpAddr.IP) {
 			return true
 		}
@@ -174,55 +259,321 @@ func (t *NetworkTransport) handleConnection(conn net.Conn) {
 	defer t.waitGroup.Done()
 	defer conn.Close()
 
+	// Each connection is its own session
+	session := fmt.Sprintf("%s#%d", conn.RemoteAddr(), atomic.AddUint64(&t.sessions, 1))
+	if t.closed != nil {
+		defer t.closed(session)
+	}
+
+	// Requests run concurrently, so a slow one does not hold up the rest;
+	// responses carry their request id and may be sent out of order
+	dispatcher := newRequestDispatcher(MaxConcurrentRequests)
+	defer dispatcher.wait()
+
 	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
+	var writeMutex sync.Mutex
+	write := func(message []byte) {
+		// Compress before locking, since a compression failure is logged
+		message = t.compressMessage(message)
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+		writeFramedMessage(writer, t.config.Framing, message)
+		writer.Flush()
+	}
+
+	t.connMutex.Lock()
+	t.writers[session] = write
+	t.connMutex.Unlock()
+	defer func() {
+		t.connMutex.Lock()
+		delete(t.writers, session)
+		t.connMutex.Unlock()
+	}()
 
 	for {
 		select {
 		case <-t.stopChan:
 			return
 		default:
-			line, err := reader.ReadString('\n')
+			if err := waitForInput(conn, reader, t.config.IdleTimeout, dispatcher.busy); err != nil {
+				t.config.logConnectionEvent(t.logger, "disconnected", conn.RemoteAddr(), disconnectReason(err))
+				return
+			}
+			// Read errors end the connection: after a malformed LSP header there is
+			// nothing to resynchronize on
+			message, err := readFramedMessage(reader, t.config.Framing)
 			if err != nil {
-				if err == io.EOF {
-					fmt.Fprintf(os.Stderr, "Client %s disconnected\n", conn.RemoteAddr())
-					return
-				}
+				t.config.logConnectionEvent(t.logger, "disconnected", conn.RemoteAddr(), disconnectReason(err))
 				return
 			}
 
-			line = strings.TrimRight(line, "\r\n")
-			if line == "" {
+			if len(message) == 0 {
 				continue
 			}
 
-			response, err := t.handler([]byte(line))
-			if err != nil {
-				errorResp := map[string]interface{}{
-					"jsonrpc": "2.0",
-					"error": map[string]interface{}{
-						"code":    -32603,
-						"message": err.Error(),
-					},
+			// Clients may compress large requests with the same encoding as responses
+			if t.config.Compression == CompressionGzip {
+				message, err = decodeGzipFrame(message)
+				if err != nil {
+					write(parseErrorResponse(err))
+					continue
 				}
-				errorBytes, _ := json.Marshal(errorResp)
-				writer.Write(errorBytes)
-				writer.Write([]byte("\n"))
-				writer.Flush()
-				continue
 			}
 
-			if len(response) == 0 {
-				continue
-			}
+			dispatcher.dispatch(func() {
+				response, err := t.handler(session, message)
+				if err != nil {
+					write(internalErrorResponse(err))
+					return
+				}
+
+				if len(response) == 0 {
+					return
+				}
 
-			response = append(response, '\n')
-			writer.Write(response)
-			writer.Flush()
+				write(response)
+			})
 		}
 	}
 }
 
+// SendNotification sends a notification to every open connection
+func (t *NetworkTransport) SendNotification(method string, params interface{}) {
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+
+	t.connMutex.Lock()
+	writers := make([]func([]byte), 0, len(t.writers))
+	for _, write := range t.writers {
+		writers = append(writers, write)
+	}
+	t.connMutex.Unlock()
+
+	for _, write := range writers {
+		write(message)
+	}
+}
+
+// SendSessionNotification sends a notification to one session's connection
+func (t *NetworkTransport) SendSessionNotification(session, method string, params interface{}) {
+	t.connMutex.Lock()
+	write, ok := t.writers[session]
+	t.connMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+	write(message)
+}
+
+// waitForInput waits until a client sends more data. With an idle timeout the
+// client is given that long, extended for as long as busy reports requests still
+// running, since a client waiting for a slow response is not idle. The deadline
+// stays in force while the message that follows is read.
+func waitForInput(conn net.Conn, reader *bufio.Reader, idleTimeout time.Duration, busy func() bool) error {
+	if idleTimeout <= 0 {
+		return nil
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		// Peek consumes nothing, so a timeout here never splits a message
+		_, err := reader.Peek(1)
+		if err == nil {
+			return nil
+		}
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() || !busy() {
+			return err
+		}
+	}
+}
+
+// disconnectReason describes why a connection ended for the connection log
+func disconnectReason(err error) string {
+	var netErr net.Error
+	switch {
+	case err == io.EOF:
+		return ""
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "idle timeout"
+	default:
+		return err.Error()
+	}
+}
+
+// newConnectionSlots creates a semaphore admitting limit connections, or nil for no limit
+func newConnectionSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
+// acquireConnectionSlot takes a connection slot without waiting, reporting
+// whether one was free. A nil semaphore always admits.
+func acquireConnectionSlot(slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseConnectionSlot frees a slot taken by acquireConnectionSlot
+func releaseConnectionSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// parseErrorResponse builds a JSON-RPC parse error for a message that could not be decoded
+func parseErrorResponse(err error) []byte {
+	errorBytes, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      nil,
+		"error": map[string]interface{}{
+			"code":    -32700,
+			"message": err.Error(),
+		},
+	})
+	return errorBytes
+}
+
+// internalErrorResponse builds a JSON-RPC internal error for a message the handler failed on
+func internalErrorResponse(err error) []byte {
+	errorBytes, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"error": map[string]interface{}{
+			"code":    -32603,
+			"message": err.Error(),
+		},
+	})
+	return errorBytes
+}
+
+// compressMessage returns a message as it is to be sent: as a gzip frame
+// when gzip is enabled and the message is large enough
+func (t *NetworkTransport) compressMessage(message []byte) []byte {
+	if t.config.Compression == CompressionGzip && len(message) >= t.config.CompressionMinBytes {
+		if frame, err := encodeGzipFrame(message); err == nil {
+			message = frame
+		} else {
+			t.logger.Warn("Failed to compress response, sending uncompressed: %v", err)
+		}
+	}
+	return message
+}
+
+// encodeGzipFrame compresses a message into a single-line gzip frame
+func encodeGzipFrame(message []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(message); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, len(gzipFramePrefix)+base64.StdEncoding.EncodedLen(compressed.Len()))
+	copy(frame, gzipFramePrefix)
+	base64.StdEncoding.Encode(frame[len(gzipFramePrefix):], compressed.Bytes())
+	return frame, nil
+}
+
+// decodeGzipFrame reverses encodeGzipFrame; lines without the gzip prefix are returned as-is
+func decodeGzipFrame(line []byte) ([]byte, error) {
+	if !bytes.HasPrefix(line, []byte(gzipFramePrefix)) {
+		return line, nil
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(string(line[len(gzipFramePrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip frame encoding: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip frame: %w", err)
+	}
+	defer zr.Close()
+
+	// A small frame can inflate enormously, so stop reading past the message limit
+	message, err := io.ReadAll(io.LimitReader(zr, maxFramedMessage+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip frame: %w", err)
+	}
+	if len(message) > maxFramedMessage {
+		return nil, fmt.Errorf("decompressed message exceeds limit %d", maxFramedMessage)
+	}
+	return message, nil
+}
+
+// logConnectionEvent logs a connection lifecycle event in the configured format
+func (c NetworkConfig) logConnectionEvent(logger Logger, event string, addr net.Addr, reason string) {
+	if c.LogFormat == LogFormatJSON {
+		line, err := json.Marshal(connectionEvent{
+			Time:       time.Now().UTC().Format(time.RFC3339Nano),
+			Event:      event,
+			RemoteAddr: addr.String(),
+			Reason:     reason,
+		})
+		if err != nil {
+			return
+		}
+		level := LevelInfo
+		if event == "rejected" {
+			level = LevelWarning
+		}
+		// Written bare so each line of the log parses as JSON; the log level still applies
+		if raw, ok := logger.(rawLogger); ok {
+			raw.LogRaw(level, string(line))
+		} else if level == LevelWarning {
+			logger.Warn("%s", line)
+		} else {
+			logger.Info("%s", line)
+		}
+		return
+	}
+
+	switch event {
+	case "accepted":
+		logger.Info("Accepted connection from %s", addr)
+	case "rejected":
+		logger.Warn("Connection rejected from %s - %s", addr, reason)
+	case "disconnected":
+		if reason != "" {
+			logger.Info("Client %s disconnected: %s", addr, reason)
+		} else {
+			logger.Info("Client %s disconnected", addr)
+		}
+	default:
+		logger.Info("Connection %s from %s %s", event, addr, reason)
+	}
+}
+
+// logWhitelist reports the IP whitelist, or warns that there is none
+func (c NetworkConfig) logWhitelist(logger Logger) {
+	if len(c.AllowedIPs) > 0 || len(c.AllowedSubnets) > 0 {
+		logger.Info("IP Whitelist enabled: IPs=%v, Subnets=%v",
+			c.AllowedIPs, formatSubnets(c.AllowedSubnets))
+	} else {
+		logger.Warn("No IP restrictions configured - all connections allowed")
+	}
+}
+
 func formatSubnets(subnets []*net.IPNet) []string {
 	result := make([]string, len(subnets))
 	for i, subnet := range subnets {
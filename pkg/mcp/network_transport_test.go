@@ -0,0 +1,323 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGzipFrameRoundTrip(t *testing.T) {
+	message := []byte(`{"jsonrpc":"2.0","id":1,"result":{"content":"` + strings.Repeat("x", 4096) + `"}}`)
+
+	frame, err := encodeGzipFrame(message)
+	if err != nil {
+		t.Fatalf("encodeGzipFrame failed: %v", err)
+	}
+	if !bytes.HasPrefix(frame, []byte(gzipFramePrefix)) || bytes.ContainsAny(frame, "\r\n") {
+		t.Fatalf("Expected a single-line gzip frame, got %q", frame[:20])
+	}
+	if len(frame) >= len(message) {
+		t.Errorf("Expected compressed frame to be smaller than %d bytes, got %d", len(message), len(frame))
+	}
+
+	decoded, err := decodeGzipFrame(frame)
+	if err != nil {
+		t.Fatalf("decodeGzipFrame failed: %v", err)
+	}
+	if !bytes.Equal(decoded, message) {
+		t.Error("Decoded frame does not match the original message")
+	}
+
+	// Plain JSON passes through unchanged
+	plain := []byte(`{"jsonrpc":"2.0","id":2,"result":{}}`)
+	if decoded, err := decodeGzipFrame(plain); err != nil || !bytes.Equal(decoded, plain) {
+		t.Errorf("Expected plain message unchanged, got %q (%v)", decoded, err)
+	}
+	// A frame that inflates past the message limit is rejected
+	bomb, err := encodeGzipFrame(make([]byte, maxFramedMessage+1))
+	if err != nil {
+		t.Fatalf("encodeGzipFrame failed: %v", err)
+	}
+	if _, err := decodeGzipFrame(bomb); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("Expected oversized decompressed frame to be rejected, got: %v", err)
+	}
+}
+
+func TestNetworkTransportCompressesLargeResponses(t *testing.T) {
+	transport, err := NewNetworkTransport(NetworkConfig{Compression: CompressionGzip, CompressionMinBytes: 100})
+	if err != nil {
+		t.Fatalf("NewNetworkTransport failed: %v", err)
+	}
+	transport.handler = func(session string, message []byte) ([]byte, error) {
+		if strings.Contains(string(message), "small") {
+			return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+		}
+		return []byte(`{"jsonrpc":"2.0","id":2,"result":"` + strings.Repeat("y", 500) + `"}`), nil
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	transport.waitGroup.Add(1)
+	go transport.handleConnection(serverConn)
+
+	reader := bufio.NewReader(clientConn)
+	exchange := func(request string) string {
+		if _, err := clientConn.Write([]byte(request + "\n")); err != nil {
+			t.Fatalf("Failed to write request: %v", err)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		return strings.TrimRight(line, "\n")
+	}
+
+	if small := exchange(`{"method":"small"}`); !strings.HasPrefix(small, "{") {
+		t.Errorf("Expected small response uncompressed, got %q", small)
+	}
+
+	large := exchange(`{"method":"large"}`)
+	if !strings.HasPrefix(large, gzipFramePrefix) {
+		t.Fatalf("Expected large response compressed, got %q", large[:20])
+	}
+	decoded, err := decodeGzipFrame([]byte(large))
+	if err != nil || !strings.Contains(string(decoded), strings.Repeat("y", 500)) {
+		t.Errorf("Failed to decode compressed response: %v", err)
+	}
+
+	// Compressed requests are accepted too
+	frame, _ := encodeGzipFrame([]byte(`{"method":"small"}`))
+	if small := exchange(string(frame)); !strings.HasPrefix(small, "{") {
+		t.Errorf("Expected response to compressed small request, got %q", small)
+	}
+}
+
+func TestNetworkTransportHandlesRequestsConcurrently(t *testing.T) {
+	transport, err := NewNetworkTransport(NetworkConfig{})
+	if err != nil {
+		t.Fatalf("NewNetworkTransport failed: %v", err)
+	}
+	release := make(chan struct{})
+	transport.handler = func(session string, message []byte) ([]byte, error) {
+		if strings.Contains(string(message), "slow") {
+			<-release
+			return []byte(`{"jsonrpc":"2.0","id":1,"result":"slow"}`), nil
+		}
+		return []byte(`{"jsonrpc":"2.0","id":2,"result":"fast"}`), nil
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	transport.waitGroup.Add(1)
+	go transport.handleConnection(serverConn)
+
+	if _, err := clientConn.Write([]byte("{\"method\":\"slow\"}\n{\"method\":\"fast\"}\n")); err != nil {
+		t.Fatalf("Failed to write requests: %v", err)
+	}
+
+	// The fast request is answered while the slow one is still running
+	reader := bufio.NewReader(clientConn)
+	first, err := reader.ReadString('\n')
+	if err != nil || !strings.Contains(first, "fast") {
+		t.Fatalf("Expected the fast response first, got %q (%v)", first, err)
+	}
+	close(release)
+	second, err := reader.ReadString('\n')
+	if err != nil || !strings.Contains(second, "slow") {
+		t.Errorf("Expected the slow response second, got %q (%v)", second, err)
+	}
+}
+
+func TestNetworkTransportConnectionLimits(t *testing.T) {
+	transport, err := NewNetworkTransport(NetworkConfig{
+		Host:           "127.0.0.1",
+		MaxConnections: 1,
+		IdleTimeout:    200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewNetworkTransport failed: %v", err)
+	}
+	if err := transport.Start(func(session string, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	}, nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer transport.Stop()
+	addr := transport.listener.Addr().String()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer first.Close()
+	first.Write([]byte("{\"method\":\"ping\"}\n"))
+	reader := bufio.NewReader(first)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("Expected a response on the first connection: %v", err)
+	}
+
+	// A second client beyond the limit is closed straight away
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the connection over the limit to be closed, got %v", err)
+	}
+
+	// The idle first client is reaped, freeing its slot
+	first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := reader.ReadString('\n'); err != io.EOF {
+		t.Errorf("Expected the idle connection to be closed, got %v", err)
+	}
+	// The slot is released just after the close, so allow a few attempts
+	for attempt := 0; ; attempt++ {
+		third, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		third.Write([]byte("{\"method\":\"ping\"}\n"))
+		third.SetReadDeadline(time.Now().Add(time.Second))
+		_, err = bufio.NewReader(third).ReadString('\n')
+		third.Close()
+		if err == nil {
+			break
+		}
+		if attempt == 10 {
+			t.Fatalf("Expected a response once the idle client was reaped: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestNetworkTransportSendsNotifications(t *testing.T) {
+	transport, err := NewNetworkTransport(NetworkConfig{})
+	if err != nil {
+		t.Fatalf("NewNetworkTransport failed: %v", err)
+	}
+	transport.handler = func(session string, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+	}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	transport.waitGroup.Add(1)
+	go transport.handleConnection(serverConn)
+
+	// A completed request shows the connection is registered
+	reader := bufio.NewReader(clientConn)
+	clientConn.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n"))
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	go transport.SendNotification("notifications/resources/updated", ResourceUpdatedParams{URI: "file:///tmp/a.txt"})
+	clientConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	want := `{"jsonrpc":"2.0","method":"notifications/resources/updated","params":{"uri":"file:///tmp/a.txt"}}`
+	if strings.TrimSpace(line) != want {
+		t.Errorf("Expected %s, got %s", want, line)
+	}
+
+	// Session notifications reach only their own session
+	go func() {
+		transport.SendSessionNotification("elsewhere#9", "notifications/progress", ProgressParams{ProgressToken: []byte(`"x"`), Progress: 1})
+		transport.SendSessionNotification("pipe#1", "notifications/progress", ProgressParams{ProgressToken: []byte(`"t"`), Progress: 2})
+	}()
+	line, err = reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	if !strings.Contains(line, `"progressToken":"t"`) {
+		t.Errorf("Expected only the notification for this session, got %s", line)
+	}
+}
+
+func TestJSONConnectionEventsAreJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	config := NetworkConfig{LogFormat: LogFormatJSON}
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4000}
+
+	logger := NewLevelLogger(&out, LevelInfo)
+	logger.Info("starting")
+	config.logConnectionEvent(logger, "rejected", addr, "not whitelisted")
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 || !json.Valid([]byte(lines[1])) {
+		t.Fatalf("Expected the event as a bare JSON line, got %q", out.String())
+	}
+	for _, want := range []string{`"event":"rejected"`, `"remoteAddr":"127.0.0.1:4000"`, `"reason":"not whitelisted"`} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("Expected %s in %s", want, lines[1])
+		}
+	}
+
+	// Rejections are warnings, so an error level drops them
+	out.Reset()
+	logger.SetLevel(LevelError)
+	config.logConnectionEvent(logger, "rejected", addr, "not whitelisted")
+	if out.Len() != 0 {
+		t.Errorf("Expected no event below the log level, got %q", out.String())
+	}
+}
+
+func TestConnectionEventsFollowLogLevel(t *testing.T) {
+	for _, format := range []string{LogFormatText, LogFormatJSON} {
+		for _, level := range []LogLevel{LevelInfo, LevelError} {
+			var out bytes.Buffer
+			transport, err := NewNetworkTransport(NetworkConfig{Host: "127.0.0.1", MaxConnections: 1, LogFormat: format})
+			if err != nil {
+				t.Fatalf("NewNetworkTransport failed: %v", err)
+			}
+			transport.SetLogger(NewLevelLogger(&out, level))
+			if err := transport.Start(func(session string, message []byte) ([]byte, error) {
+				return []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), nil
+			}, nil); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			addr := transport.listener.Addr().String()
+
+			// One accepted client, and one rejected over the connection limit
+			first, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			first.Write([]byte("{\"method\":\"ping\"}\n"))
+			if _, err := bufio.NewReader(first).ReadString('\n'); err != nil {
+				t.Fatalf("Expected a response: %v", err)
+			}
+			second, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			second.SetReadDeadline(time.Now().Add(time.Second))
+			second.Read(make([]byte, 1))
+			second.Close()
+			first.Close()
+			transport.Stop()
+
+			logged := out.String()
+			switch level {
+			case LevelInfo:
+				for _, event := range []string{"accepted", "rejected", "disconnected"} {
+					if !strings.Contains(strings.ToLower(logged), event) {
+						t.Errorf("%s at %s: expected a %s event, got %q", format, level, event, logged)
+					}
+				}
+			case LevelError:
+				if logged != "" {
+					t.Errorf("%s at %s: expected no connection events, got %q", format, level, logged)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package mcp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PageBounds returns the slice bounds of the page of a list of total items
+// that starts at cursor, and the cursor of the following page ("" when no
+// items remain). An empty cursor starts at the first item; other cursors are
+// the values previously returned as nextCursor.
+func PageBounds(total int, cursor string, pageSize int) (start, end int, nextCursor string, err error) {
+	if cursor != "" {
+		start, err = strconv.Atoi(cursor)
+		if err != nil || start < 0 || start > total {
+			return 0, 0, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+
+	end = total
+	if pageSize > 0 && total-start > pageSize {
+		end = start + pageSize
+		nextCursor = strconv.Itoa(end)
+	}
+	return start, end, nextCursor, nil
+}
@@ -0,0 +1,36 @@
+package mcp
+
+import "testing"
+
+func TestPageBounds(t *testing.T) {
+	// A list that fits on one page has no next cursor
+	if start, end, next, err := PageBounds(5, "", 10); err != nil || start != 0 || end != 5 || next != "" {
+		t.Errorf("Expected 0:5 without a cursor, got %d:%d %q (%v)", start, end, next, err)
+	}
+
+	// Following nextCursor visits every item once
+	var visited []int
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		start, end, next, err := PageBounds(7, cursor, 3)
+		if err != nil {
+			t.Fatalf("PageBounds failed: %v", err)
+		}
+		for i := start; i < end; i++ {
+			visited = append(visited, i)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(visited) != 7 || visited[6] != 6 {
+		t.Errorf("Expected items 0-6, got %v", visited)
+	}
+
+	for _, cursor := range []string{"abc", "-1", "8"} {
+		if _, _, _, err := PageBounds(7, cursor, 3); err == nil {
+			t.Errorf("Expected cursor %q to be rejected", cursor)
+		}
+	}
+}
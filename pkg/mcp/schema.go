@@ -0,0 +1,188 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidateArguments checks tool call arguments against a tool's input schema and
+// returns the violations found, or nil if the arguments are valid.
+// It supports the subset of JSON Schema the tools use: type, properties, required,
+// enum, items and oneOf. Properties not declared in an object's schema are
+// violations unless the schema sets additionalProperties to true.
+func ValidateArguments(schema map[string]interface{}, args json.RawMessage) []string {
+	// Round-trip the schema so nested values have the same types as decoded JSON
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid schema: %v", err)}
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(schemaJSON, &normalized); err != nil {
+		return []string{fmt.Sprintf("invalid schema: %v", err)}
+	}
+
+	args = bytes.TrimSpace(args)
+	if len(args) == 0 || bytes.Equal(args, []byte("null")) {
+		args = json.RawMessage("{}")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("arguments are not valid JSON: %v", err)}
+	}
+
+	return validateValue(normalized, value, "arguments")
+}
+
+// validateValue checks value against schema, describing violations relative to path
+func validateValue(schema map[string]interface{}, value interface{}, path string) []string {
+	if options, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, option := range options {
+			if optionSchema, ok := option.(map[string]interface{}); ok && len(validateValue(optionSchema, value, path)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return []string{fmt.Sprintf("%s must match exactly one of %d allowed forms", path, len(options))}
+		}
+	}
+
+	if expected, ok := schema["type"]; ok && !matchesType(expected, value) {
+		return []string{fmt.Sprintf("%s must be of type %s, got %s", path, describeType(expected), jsonTypeOf(value))}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !inEnum(enum, value) {
+		allowed := make([]string, len(enum))
+		for i, option := range enum {
+			encoded, _ := json.Marshal(option)
+			allowed[i] = string(encoded)
+		}
+		return []string{fmt.Sprintf("%s must be one of %s", path, strings.Join(allowed, ", "))}
+	}
+
+	var violations []string
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := typed[key]; !present {
+						violations = append(violations, fmt.Sprintf("%s is missing required property %q", path, key))
+					}
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		allowExtra, _ := schema["additionalProperties"].(bool)
+		for _, key := range keys {
+			propertySchema, declared := properties[key].(map[string]interface{})
+			if !declared {
+				if properties != nil && !allowExtra {
+					violations = append(violations, fmt.Sprintf("%s has unexpected property %q", path, key))
+				}
+				continue
+			}
+			violations = append(violations, validateValue(propertySchema, typed[key], path+"."+key)...)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range typed {
+				violations = append(violations, validateValue(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+
+	return violations
+}
+
+// matchesType reports whether value has the schema type, which may be a name or a list of names
+func matchesType(expected interface{}, value interface{}) bool {
+	switch typed := expected.(type) {
+	case string:
+		return matchesTypeName(typed, value)
+	case []interface{}:
+		for _, name := range typed {
+			if name, ok := name.(string); ok && matchesTypeName(name, value) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matchesTypeName reports whether value has the named JSON Schema type
+func matchesTypeName(name string, value interface{}) bool {
+	actual := jsonTypeOf(value)
+	switch name {
+	case "number":
+		return actual == "integer" || actual == "number"
+	case "integer":
+		if actual == "number" {
+			// A number with a zero fraction such as 5.0 is still an integer
+			f, err := value.(json.Number).Float64()
+			return err == nil && f == math.Trunc(f)
+		}
+		return actual == "integer"
+	}
+	return actual == name
+}
+
+// jsonTypeOf names the JSON type of a decoded value
+func jsonTypeOf(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// describeType formats a schema type for messages
+func describeType(expected interface{}) string {
+	if names, ok := expected.([]interface{}); ok {
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprint(name)
+		}
+		return strings.Join(parts, " or ")
+	}
+	return fmt.Sprint(expected)
+}
+
+// inEnum reports whether value equals one of the enum options
+func inEnum(enum []interface{}, value interface{}) bool {
+	encoded, _ := json.Marshal(value)
+	for _, option := range enum {
+		if optionJSON, _ := json.Marshal(option); bytes.Equal(optionJSON, encoded) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package mcp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateArguments(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":  map[string]interface{}{"type": "string"},
+			"count": map[string]interface{}{"type": "integer"},
+			"mode":  map[string]interface{}{"type": "string", "enum": []string{"fast", "slow"}},
+			"paths": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"line": map[string]interface{}{
+				"oneOf": []interface{}{
+					map[string]interface{}{"type": "integer"},
+					map[string]interface{}{"type": "string", "enum": []string{"end"}},
+				},
+			},
+		},
+		"required": []string{"path"},
+	}
+
+	tests := []struct {
+		args       string
+		violations []string
+	}{
+		{`{"path":"a","count":3,"mode":"fast","paths":["x"],"line":"end"}`, nil},
+		{`{"path":"a","count":3.0,"line":7}`, nil},
+		{``, []string{`missing required property "path"`}},
+		{`{"path":1}`, []string{"arguments.path must be of type string, got integer"}},
+		{`{"path":"a","count":1.5}`, []string{"arguments.count must be of type integer, got number"}},
+		{`{"path":"a","mode":"medium"}`, []string{`arguments.mode must be one of "fast", "slow"`}},
+		{`{"path":"a","paths":["x",2]}`, []string{"arguments.paths[1] must be of type string"}},
+		{`{"path":"a","line":"start"}`, []string{"arguments.line must match exactly one"}},
+		{`{"path":"a","extra":true}`, []string{`unexpected property "extra"`}},
+		{`[]`, []string{"arguments must be of type object, got array"}},
+	}
+
+	for _, tt := range tests {
+		violations := ValidateArguments(schema, json.RawMessage(tt.args))
+		if len(violations) != len(tt.violations) {
+			t.Errorf("%s: expected %d violations, got %q", tt.args, len(tt.violations), violations)
+			continue
+		}
+		for i, expected := range tt.violations {
+			if !strings.Contains(violations[i], expected) {
+				t.Errorf("%s: expected violation containing %q, got %q", tt.args, expected, violations[i])
+			}
+		}
+	}
+}
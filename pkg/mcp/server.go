@@ -1,50 +1,138 @@
 package mcp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server represents an MCP server
 type Server struct {
-	info        ServerInfo
-	config      ServerConfig
-	handlers    map[string]RequestHandler
-	transport   Transport
-	handlersMux sync.RWMutex
-	initialized bool
+	info           ServerInfo
+	config         ServerConfig
+	handlers       map[string]ContextRequestHandler
+	transport      Transport
+	handlersMux    sync.RWMutex
+	initialized    atomic.Bool         // Set once the client has initialized; read by concurrent requests
+	sessionClosers []SessionClosedFunc // Called when a client session ends
+	logger         Logger
+	clientMutex    sync.RWMutex
+	clientInfos    map[string]ClientInfo // Client of each initialized session
+	requestMutex   sync.Mutex
+	inFlight       map[string]map[string]context.CancelFunc // Session -> request id -> cancel of its running requests
 }
 
 // NewServer creates a new MCP server
 func NewServer(info ServerInfo, config ServerConfig) *Server {
-	return &Server{
-		info:        info,
-		config:      config,
-		handlers:    make(map[string]RequestHandler),
-		initialized: false,
+	s := &Server{
+		info:     info,
+		config:   config,
+		handlers:    make(map[string]ContextRequestHandler),
+		logger:      defaultLogger(),
+		clientInfos: make(map[string]ClientInfo),
+		inFlight:    make(map[string]map[string]context.CancelFunc),
 	}
+	s.SetSessionRequestHandler("logging/setLevel", s.handleSetLevel)
+	s.SetSessionRequestHandler("notifications/cancelled", s.handleCancelled)
+	return s
 }
 
 // SetRequestHandler sets a handler for a specific request method
 func (s *Server) SetRequestHandler(method string, handler RequestHandler) {
+	s.SetSessionRequestHandler(method, func(session string, params json.RawMessage) (json.RawMessage, error) {
+		return handler(params)
+	})
+}
+
+// SetSessionRequestHandler sets a handler that needs to know which client session sent the request
+func (s *Server) SetSessionRequestHandler(method string, handler SessionRequestHandler) {
+	s.SetContextRequestHandler(method, func(ctx context.Context, session string, params json.RawMessage) (json.RawMessage, error) {
+		return handler(session, params)
+	})
+}
+
+// SetContextRequestHandler sets a handler for a long-running method, which
+// should stop once its context is cancelled
+func (s *Server) SetContextRequestHandler(method string, handler ContextRequestHandler) {
 	s.handlersMux.Lock()
 	defer s.handlersMux.Unlock()
 	s.handlers[method] = handler
 }
 
 // GetHandler gets a handler for a specific request method
+// The returned handler runs as the default session
 func (s *Server) GetHandler(method string) RequestHandler {
 	s.handlersMux.RLock()
-	defer s.handlersMux.RUnlock()
-	return s.handlers[method]
+	handler := s.handlers[method]
+	s.handlersMux.RUnlock()
+	if handler == nil {
+		return nil
+	}
+	return func(params json.RawMessage) (json.RawMessage, error) {
+		return handler(context.Background(), DefaultSessionID, params)
+	}
+}
+
+// OnSessionClosed registers a function to call when a client session ends,
+// so per-session state can be released
+func (s *Server) OnSessionClosed(closer SessionClosedFunc) {
+	s.handlersMux.Lock()
+	defer s.handlersMux.Unlock()
+	s.sessionClosers = append(s.sessionClosers, closer)
+}
+
+// closeSession cancels the session's running requests and runs the
+// registered session closers
+func (s *Server) closeSession(session string) {
+	s.requestMutex.Lock()
+	for _, cancel := range s.inFlight[session] {
+		cancel()
+	}
+	delete(s.inFlight, session)
+	s.requestMutex.Unlock()
+
+	s.handlersMux.RLock()
+	closers := append([]SessionClosedFunc(nil), s.sessionClosers...)
+	s.handlersMux.RUnlock()
+
+	for _, closer := range closers {
+		closer(session)
+	}
+	if controller, ok := s.logger.(levelController); ok {
+		controller.ForgetSession(session)
+	}
+
+	// Closers may still look up the client, so forget it last
+	s.clientMutex.Lock()
+	delete(s.clientInfos, session)
+	s.clientMutex.Unlock()
+}
+
+// logFor returns the logger for messages about a session's requests, which
+// the session receives as notifications/message once it has set a level
+func (s *Server) logFor(session string) Logger {
+	if controller, ok := s.logger.(levelController); ok {
+		return controller.Session(session)
+	}
+	return s.logger
+}
+
+// SetLogger sets the logger the server reports to. The transport given to
+// Connect logs to it as well.
+func (s *Server) SetLogger(logger Logger) {
+	s.logger = logger
 }
 
 // Connect connects the server to a transport
 func (s *Server) Connect(transport Transport) error {
 	s.transport = transport
-	return s.transport.Start(s.handleRequest)
+	s.transport.SetLogger(s.logger)
+	return s.transport.Start(s.handleSessionRequest, s.closeSession)
 }
 
 // Disconnect disconnects the server from its transport
@@ -55,41 +143,96 @@ func (s *Server) Disconnect() error {
 	return s.transport.Stop()
 }
 
-// handleRequest handles incoming requests
+// ClientInfo returns the name and version the client of a session gave in
+// its initialize request, or an empty ClientInfo if the session has not
+// initialized. Each network connection is its own session.
+func (s *Server) ClientInfo(session string) ClientInfo {
+	s.clientMutex.RLock()
+	defer s.clientMutex.RUnlock()
+	return s.clientInfos[session]
+}
+
+// SendNotification sends a server-initiated notification through the transport
+func (s *Server) SendNotification(method string, params interface{}) {
+	if s.transport == nil {
+		return
+	}
+	s.transport.SendNotification(method, params)
+}
+
+// SendSessionNotification sends a notification to a single client session.
+// It is dropped if the transport cannot address sessions individually.
+func (s *Server) SendSessionNotification(session, method string, params interface{}) {
+	notifier, ok := s.transport.(SessionNotifier)
+	if !ok {
+		return
+	}
+	notifier.SendSessionNotification(session, method, params)
+}
+
+// handleRequest handles incoming requests from the default session
 func (s *Server) handleRequest(data []byte) ([]byte, error) {
+	return s.handleSessionRequest(DefaultSessionID, data)
+}
+
+// handleSessionRequest handles incoming requests from a client session
+func (s *Server) handleSessionRequest(session string, data []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return s.handleBatch(session, trimmed)
+	}
+	log := s.logFor(session)
+
 	// Parse the request
 	var request RequestMessage
 	if err := json.Unmarshal(data, &request); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to unmarshal request: %v\n", err)
+		log.Error("Failed to unmarshal request: %v", err)
 		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
 	}
 
-	fmt.Fprintf(os.Stderr, "Handling method: %s, ID: %s\n", request.Method, request.ID.String())
+	log.Debug("Handling method: %s, ID: %s", request.Method, request.ID.String())
+
+	// At info level only the method, id and duration are logged: parameters
+	// and results may hold file contents
+	start := time.Now()
+	defer func() {
+		if request.ID.IsEmpty() {
+			log.Info("%s notification (%s)", request.Method, time.Since(start))
+		} else {
+			log.Info("%s id=%s (%s)", request.Method, request.ID.String(), time.Since(start))
+		}
+	}()
 
 	// Check if this is the initialize method
 	if request.Method == "initialize" {
-		fmt.Fprintf(os.Stderr, "Processing initialize request\n")
-		return s.handleInitialize(request)
+		log.Debug("Processing initialize request")
+		return s.handleInitialize(session, request)
 	}
 
 	// Handle the initialized notification - UPDATED THIS SECTION
 	if request.Method == "notifications/initialized" {
-		fmt.Fprintf(os.Stderr, "Received initialized notification, setting server as ready\n")
-		s.initialized = true
+		log.Debug("Received initialized notification, setting server as ready")
+		s.initialized.Store(true)
 		// This is a notification, no response needed - return empty array to signal no response
 		return nil, nil
 	}
 
 	// Handle initialized without the notifications/ prefix (just in case)
 	if request.Method == "initialized" {
-		fmt.Fprintf(os.Stderr, "Received initialized notification (legacy format), setting server as ready\n")
-		s.initialized = true
+		log.Debug("Received initialized notification (legacy format), setting server as ready")
+		s.initialized.Store(true)
 		return nil, nil
 	}
 
+	// A message without an id is a notification: the handler still runs for
+	// its side effects, but JSON-RPC forbids sending any response back
+	isNotification := request.ID.IsEmpty()
+
 	// If not initialized and not a ping, reject the request
-	if !s.initialized && request.Method != "ping" {
-		fmt.Fprintf(os.Stderr, "Rejecting request %s because server is not initialized\n", request.Method)
+	if !s.initialized.Load() && request.Method != "ping" {
+		log.Warn("Rejecting request %s because server is not initialized", request.Method)
+		if isNotification {
+			return nil, nil
+		}
 		response := ResponseMessage{
 			JsonRPC: "2.0",
 			ID:      request.ID,
@@ -107,13 +250,16 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	s.handlersMux.RUnlock()
 
 	if !ok {
-		fmt.Fprintf(os.Stderr, "Method not supported: %s\n", request.Method)
+		log.Warn("Method not supported: %s", request.Method)
+		if isNotification {
+			return nil, nil
+		}
 		// Method not supported
 		response := ResponseMessage{
 			JsonRPC: "2.0",
 			ID:      request.ID,
 			Error: &ErrorResponse{
-				Code:    -32601,
+				Code:    CodeMethodNotFound,
 				Message: fmt.Sprintf("Method not supported: %s", request.Method),
 			},
 		}
@@ -121,10 +267,18 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	}
 
 	// Call the handler
-	fmt.Fprintf(os.Stderr, "Calling handler for method: %s\n", request.Method)
-	result, err := handler(request.Params)
+	log.Debug("Calling handler for method: %s", request.Method)
+	ctx, done := s.trackRequest(session, request.ID)
+	result, err := handler(ctx, session, request.Params)
+	done()
+	if isNotification {
+		if err != nil {
+			log.Warn("Handler error for notification %s: %v", request.Method, err)
+		}
+		return nil, nil
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Handler error for method %s: %v\n", request.Method, err)
+		log.Warn("Handler error for method %s: %v", request.Method, err)
 		// Handler returned an error
 		response := ResponseMessage{
 			JsonRPC: "2.0",
@@ -134,11 +288,16 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 				Message: err.Error(),
 			},
 		}
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) {
+			response.Error.Code = rpcErr.Code
+			response.Error.Data = rpcErr.Data
+		}
 		return json.Marshal(response)
 	}
 
 	// Return the result
-	fmt.Fprintf(os.Stderr, "Handler successful for method: %s\n", request.Method)
+	log.Debug("Handler successful for method: %s", request.Method)
 	response := ResponseMessage{
 		JsonRPC: "2.0",
 		ID:      request.ID,
@@ -147,20 +306,140 @@ func (s *Server) handleRequest(data []byte) ([]byte, error) {
 	
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling response: %v\n", err)
+		log.Error("Error marshaling response: %v", err)
 		return nil, err
 	}
 	
-	fmt.Fprintf(os.Stderr, "Response: %s\n", string(responseBytes))
+	log.Debug("Response: %s", string(responseBytes))
 	return responseBytes, nil
 }
 
-// handleInitialize handles the initialize method
-func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
-	fmt.Fprintf(os.Stderr, "Parsing initialize params\n")
+// handleBatch handles a JSON-RPC batch: each element is handled as its own
+// message and the responses are returned as an array. Notifications get no
+// entry, and a batch of only notifications gets no response at all.
+func (s *Server) handleBatch(session string, data []byte) ([]byte, error) {
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return json.Marshal(ResponseMessage{
+			JsonRPC: "2.0",
+			Error:   &ErrorResponse{Code: CodeParseError, Message: fmt.Sprintf("Invalid batch: %v", err)},
+		})
+	}
+	if len(messages) == 0 {
+		return json.Marshal(ResponseMessage{
+			JsonRPC: "2.0",
+			Error:   &ErrorResponse{Code: CodeInvalidRequest, Message: "Empty batch"},
+		})
+	}
+
+	responses := make([]json.RawMessage, 0, len(messages))
+	for _, message := range messages {
+		var response []byte
+		var err error
+		if trimmed := bytes.TrimSpace(message); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = fmt.Errorf("batch elements must be request objects")
+		} else {
+			response, err = s.handleSessionRequest(session, message)
+		}
+		if err != nil {
+			// An element that is not a request object still gets an error entry
+			response, _ = json.Marshal(ResponseMessage{
+				JsonRPC: "2.0",
+				Error:   &ErrorResponse{Code: CodeInvalidRequest, Message: err.Error()},
+			})
+		}
+		if len(response) > 0 {
+			responses = append(responses, response)
+		}
+	}
+
+	if len(responses) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(responses)
+}
+
+// trackRequest creates the context a request's handler runs with, so
+// notifications/cancelled can reach it. The returned function must be called
+// once the handler returns.
+func (s *Server) trackRequest(session string, id RequestID) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if id.IsEmpty() {
+		return ctx, cancel
+	}
+
+	// The encoded id keeps the number 1 and the string "1" apart
+	key, _ := json.Marshal(id)
+	s.requestMutex.Lock()
+	requests, ok := s.inFlight[session]
+	if !ok {
+		requests = make(map[string]context.CancelFunc)
+		s.inFlight[session] = requests
+	}
+	requests[string(key)] = cancel
+	s.requestMutex.Unlock()
+
+	return ctx, func() {
+		cancel()
+		s.requestMutex.Lock()
+		delete(requests, string(key))
+		if len(s.inFlight[session]) == 0 {
+			delete(s.inFlight, session)
+		}
+		s.requestMutex.Unlock()
+	}
+}
+
+// handleCancelled handles notifications/cancelled by cancelling the context
+// of the named request. Requests that already finished are ignored.
+func (s *Server) handleCancelled(session string, params json.RawMessage) (json.RawMessage, error) {
+	var request CancelledParams
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, fmt.Errorf("invalid cancellation parameters: %w", err)
+	}
+
+	key, _ := json.Marshal(request.RequestID)
+	s.requestMutex.Lock()
+	cancel := s.inFlight[session][string(key)]
+	s.requestMutex.Unlock()
+
+	if cancel != nil {
+		s.logger.Debug("Cancelling request %s: %s", request.RequestID.String(), request.Reason)
+		cancel()
+	}
+	return nil, nil
+}
+
+// handleSetLevel handles logging/setLevel: from now on, the messages logged
+// about the session's own requests at or above the level are sent to it as
+// notifications/message. Other sessions and the server's own log are unaffected.
+func (s *Server) handleSetLevel(session string, params json.RawMessage) (json.RawMessage, error) {
+	var request SetLevelParams
+	if err := json.Unmarshal(params, &request); err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid logging/setLevel parameters: %v", err)}
+	}
+	level, err := ParseLogLevel(request.Level)
+	if err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	controller, ok := s.logger.(levelController)
+	if !ok {
+		return nil, fmt.Errorf("the server's logger does not support changing the level")
+	}
+
+	controller.EnableNotifications(func(session string, message LoggingMessageParams) {
+		s.SendSessionNotification(session, "notifications/message", message)
+	})
+	controller.SetSessionLevel(session, level)
+	return json.Marshal(struct{}{})
+}
+
+// handleInitialize handles the initialize method, remembering the session's client
+func (s *Server) handleInitialize(session string, request RequestMessage) ([]byte, error) {
+	s.logger.Debug("Parsing initialize params")
 	var params InitializeParams
 	if err := json.Unmarshal(request.Params, &params); err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid initialize parameters: %v\n", err)
+		s.logger.Warn("Invalid initialize parameters: %v", err)
 		response := ResponseMessage{
 			JsonRPC: "2.0",
 			ID:      request.ID,
@@ -172,8 +451,11 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 		return json.Marshal(response)
 	}
 
-	fmt.Fprintf(os.Stderr, "Client info: %s %s\n", params.ClientInfo.Name, params.ClientInfo.Version)
-	fmt.Fprintf(os.Stderr, "Protocol version: %s\n", params.ProtocolVersion)
+	s.logger.Info("Client info: %s %s", params.ClientInfo.Name, params.ClientInfo.Version)
+	s.clientMutex.Lock()
+	s.clientInfos[session] = params.ClientInfo
+	s.clientMutex.Unlock()
+	s.logger.Info("Protocol version: %s", params.ProtocolVersion)
 
 	// Accept the client's protocol version
 	protocolVersion := params.ProtocolVersion
@@ -187,12 +469,16 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 		Version: s.info.Version,
 	}
 
-	// Create capabilities object
-	capabilities := map[string]interface{}{
-		"tools": map[string]interface{}{
+	// Advertise the configured capabilities, defaulting to tools only
+	capabilities := s.config.Capabilities
+	if capabilities.Tools == nil {
+		capabilities.Tools = map[string]interface{}{
 			"list": true,
 			"call": true,
-		},
+		}
+	}
+	if _, ok := s.logger.(levelController); ok {
+		capabilities.Logging = &LoggingCapability{}
 	}
 
 	// Create the initialize result
@@ -204,7 +490,7 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 	// Marshal capabilities
 	capabilitiesJson, err := json.Marshal(capabilities)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to marshal capabilities: %v\n", err)
+		s.logger.Error("Failed to marshal capabilities: %v", err)
 		return nil, fmt.Errorf("failed to marshal capabilities: %w", err)
 	}
 	initializeResult.Capabilities = capabilitiesJson
@@ -212,7 +498,7 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 	// Marshal the result
 	resultJson, err := json.Marshal(initializeResult)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to marshal initialize result: %v\n", err)
+		s.logger.Error("Failed to marshal initialize result: %v", err)
 		return nil, fmt.Errorf("failed to marshal initialize result: %w", err)
 	}
 
@@ -226,13 +512,13 @@ func (s *Server) handleInitialize(request RequestMessage) ([]byte, error) {
 	// Marshal the response
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to marshal response: %v\n", err)
+		s.logger.Error("Failed to marshal response: %v", err)
 		return nil, fmt.Errorf("failed to marshal response: %w", err)
 	}
 
-	fmt.Fprintf(os.Stderr, "Initialize response: %s\n", string(responseBytes))
+	s.logger.Debug("Initialize response: %s", string(responseBytes))
 	
 	// We've successfully processed the initialize request
-	s.initialized = true
+	s.initialized.Store(true)
 	return responseBytes, nil
 }
@@ -0,0 +1,319 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTestServer creates an initialized server with a tools/call handler that
+// counts how many times it was invoked
+func newTestServer(t *testing.T) (*Server, *int) {
+	t.Helper()
+
+	server := NewServer(ServerInfo{Name: "test", Version: "test"}, ServerConfig{})
+	calls := 0
+	server.SetRequestHandler("tools/call", func(params json.RawMessage) (json.RawMessage, error) {
+		calls++
+		return json.RawMessage(`{"content":[]}`), nil
+	})
+
+	initRequest := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"test","version":"1"}}}`
+	if _, err := server.handleRequest([]byte(initRequest)); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+
+	return server, &calls
+}
+
+func TestNotificationGetsNoResponse(t *testing.T) {
+	server, calls := newTestServer(t)
+
+	// A tools/call without an id is a notification
+	notification := `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"list_allowed_directories"}}`
+	response, err := server.handleRequest([]byte(notification))
+	if err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+	if response != nil {
+		t.Errorf("Expected no response for notification, got: %s", string(response))
+	}
+	if *calls != 1 {
+		t.Errorf("Expected handler to run once for notification, ran %d times", *calls)
+	}
+
+	// Unknown methods sent as notifications must also be silent
+	response, err = server.handleRequest([]byte(`{"jsonrpc":"2.0","method":"notifications/unknown"}`))
+	if err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+	if response != nil {
+		t.Errorf("Expected no response for unknown notification, got: %s", string(response))
+	}
+}
+
+func TestNullIDGetsResponse(t *testing.T) {
+	server, calls := newTestServer(t)
+
+	// An explicit null id is a request, not a notification
+	request := `{"jsonrpc":"2.0","id":null,"method":"tools/call","params":{"name":"list_allowed_directories"}}`
+	response, err := server.handleRequest([]byte(request))
+	if err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+	if response == nil {
+		t.Fatal("Expected a response for a request with a null id")
+	}
+	if *calls != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", *calls)
+	}
+
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(response, &decoded); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if string(decoded["id"]) != "null" {
+		t.Errorf("Expected id null in response, got: %s", string(decoded["id"]))
+	}
+}
+
+func TestRequestIDPresence(t *testing.T) {
+	tests := []struct {
+		message string
+		empty   bool
+		null    bool
+	}{
+		{`{"method":"x"}`, true, false},
+		{`{"id":null,"method":"x"}`, false, true},
+		{`{"id":0,"method":"x"}`, false, false},
+		{`{"id":"abc","method":"x"}`, false, false},
+	}
+
+	for _, tt := range tests {
+		var request RequestMessage
+		if err := json.Unmarshal([]byte(tt.message), &request); err != nil {
+			t.Fatalf("Failed to unmarshal %s: %v", tt.message, err)
+		}
+		if request.ID.IsEmpty() != tt.empty {
+			t.Errorf("%s: IsEmpty() = %v, want %v", tt.message, request.ID.IsEmpty(), tt.empty)
+		}
+		if request.ID.IsNull() != tt.null {
+			t.Errorf("%s: IsNull() = %v, want %v", tt.message, request.ID.IsNull(), tt.null)
+		}
+	}
+}
+
+func TestInitializeAdvertisesCompletions(t *testing.T) {
+	server := NewServer(ServerInfo{Name: "test", Version: "test"}, ServerConfig{
+		Capabilities: ServerCapabilities{Completions: &CompletionsCapability{}},
+	})
+
+	initRequest := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"test","version":"1"}}}`
+	response, err := server.handleRequest([]byte(initRequest))
+	if err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+
+	var decoded struct {
+		Result struct {
+			Capabilities map[string]json.RawMessage `json:"capabilities"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(response, &decoded); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if _, ok := decoded.Result.Capabilities["completions"]; !ok {
+		t.Errorf("Expected completions capability, got: %s", string(response))
+	}
+	if _, ok := decoded.Result.Capabilities["tools"]; !ok {
+		t.Errorf("Expected default tools capability, got: %s", string(response))
+	}
+}
+
+func TestRPCErrorSetsCodeAndData(t *testing.T) {
+	server, _ := newTestServer(t)
+	server.SetRequestHandler("tools/call", func(params json.RawMessage) (json.RawMessage, error) {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "bad arguments", Data: []string{"x"}}
+	})
+
+	request := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"x"}}`
+	response, err := server.handleRequest([]byte(request))
+	if err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+
+	var decoded ResponseMessage
+	if err := json.Unmarshal(response, &decoded); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if decoded.Error == nil || decoded.Error.Code != CodeInvalidParams || decoded.Error.Message != "bad arguments" {
+		t.Fatalf("Expected invalid params error, got: %s", string(response))
+	}
+	if decoded.Error.Data == nil {
+		t.Errorf("Expected error data, got: %s", string(response))
+	}
+}
+
+func TestSessionHandlers(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	var seen string
+	server.SetSessionRequestHandler("tools/call", func(session string, params json.RawMessage) (json.RawMessage, error) {
+		seen = session
+		return json.RawMessage(`{"content":[]}`), nil
+	})
+	var closed []string
+	server.OnSessionClosed(func(session string) {
+		closed = append(closed, session)
+	})
+
+	request := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"x"}}`
+	if _, err := server.handleSessionRequest("client#1", []byte(request)); err != nil {
+		t.Fatalf("handleSessionRequest failed: %v", err)
+	}
+	if seen != "client#1" {
+		t.Errorf("Expected handler to see session client#1, got %q", seen)
+	}
+
+	// Plain handlers keep working and run as the default session
+	if _, err := server.GetHandler("tools/call")(nil); err != nil || seen != DefaultSessionID {
+		t.Errorf("Expected GetHandler to run as %q, got %q (%v)", DefaultSessionID, seen, err)
+	}
+
+	server.closeSession("client#1")
+	if len(closed) != 1 || closed[0] != "client#1" {
+		t.Errorf("Expected session closer to run once for client#1, got %v", closed)
+	}
+}
+
+func TestBatchRequests(t *testing.T) {
+	server, calls := newTestServer(t)
+
+	batch := `[
+		{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"a"}},
+		{"jsonrpc":"2.0","method":"tools/call","params":{"name":"b"}},
+		{"jsonrpc":"2.0","id":"two","method":"unknown/method"},
+		42
+	]`
+	response, err := server.handleRequest([]byte(batch))
+	if err != nil {
+		t.Fatalf("handleRequest failed: %v", err)
+	}
+	if *calls != 2 {
+		t.Errorf("Expected handler to run for both tools/call messages, ran %d times", *calls)
+	}
+
+	var decoded []ResponseMessage
+	if err := json.Unmarshal(response, &decoded); err != nil {
+		t.Fatalf("Expected a JSON array, got %s: %v", string(response), err)
+	}
+	// The notification gets no entry
+	if len(decoded) != 3 {
+		t.Fatalf("Expected 3 responses, got %d: %s", len(decoded), string(response))
+	}
+	if decoded[0].ID.String() != "1" || decoded[0].Error != nil {
+		t.Errorf("Expected a result for id 1, got %+v", decoded[0])
+	}
+	if decoded[1].ID.String() != "two" || decoded[1].Error == nil {
+		t.Errorf("Expected an error for the unknown method, got %+v", decoded[1])
+	}
+	if decoded[2].Error == nil || decoded[2].Error.Code != CodeInvalidRequest {
+		t.Errorf("Expected an invalid request error for a non-object element, got %+v", decoded[2])
+	}
+
+	// A batch of only notifications gets no response
+	response, err = server.handleRequest([]byte(`[{"jsonrpc":"2.0","method":"tools/call","params":{"name":"c"}}]`))
+	if err != nil || response != nil {
+		t.Errorf("Expected no response for a notification-only batch, got %s (%v)", string(response), err)
+	}
+
+	response, _ = server.handleRequest([]byte(`[]`))
+	var single ResponseMessage
+	if err := json.Unmarshal(response, &single); err != nil || single.Error == nil || single.Error.Code != CodeInvalidRequest {
+		t.Errorf("Expected an invalid request error for an empty batch, got %s", string(response))
+	}
+}
+
+func TestClientInfoIsPerSession(t *testing.T) {
+	server := NewServer(ServerInfo{Name: "test", Version: "test"}, ServerConfig{})
+	initialize := func(session, client string) {
+		request := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","clientInfo":{"name":"` + client + `","version":"1.0"}}}`
+		if _, err := server.handleSessionRequest(session, []byte(request)); err != nil {
+			t.Fatalf("initialize failed: %v", err)
+		}
+	}
+	initialize("a", "editor")
+	initialize("b", "agent")
+
+	if info := server.ClientInfo("a"); info.Name != "editor" || info.Version != "1.0" {
+		t.Errorf("Expected editor 1.0 for session a, got %+v", info)
+	}
+	if info := server.ClientInfo("b"); info.Name != "agent" {
+		t.Errorf("Expected agent for session b, got %+v", info)
+	}
+
+	// Session closers still see the client; afterwards it is forgotten
+	var seen string
+	server.OnSessionClosed(func(session string) { seen = server.ClientInfo(session).Name })
+	server.closeSession("a")
+	if seen != "editor" {
+		t.Errorf("Expected the closer to see the client, got %q", seen)
+	}
+	if info := server.ClientInfo("a"); info.Name != "" {
+		t.Errorf("Expected no client after the session closed, got %+v", info)
+	}
+}
+
+func TestCancelledRequest(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	started := make(chan struct{})
+	server.SetContextRequestHandler("tools/call", func(ctx context.Context, session string, params json.RawMessage) (json.RawMessage, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	finished := make(chan []byte)
+	go func() {
+		response, _ := server.handleSessionRequest("a", []byte(`{"jsonrpc":"2.0","id":"w","method":"tools/call","params":{}}`))
+		finished <- response
+	}()
+	<-started
+
+	// A request with the same id from another session is not affected
+	cancel := func(session, id string) {
+		notification := `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":` + id + `,"reason":"test"}}`
+		if response, err := server.handleSessionRequest(session, []byte(notification)); err != nil || len(response) != 0 {
+			t.Fatalf("Expected no response to a cancellation, got %s (%v)", response, err)
+		}
+	}
+	cancel("b", `"w"`)
+	select {
+	case <-finished:
+		t.Fatal("Request was cancelled by another session")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel("a", `"w"`)
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request was not cancelled")
+	}
+
+	// Closing a session cancels its running requests as well
+	started = make(chan struct{})
+	go func() {
+		response, _ := server.handleSessionRequest("a", []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{}}`))
+		finished <- response
+	}()
+	<-started
+	server.closeSession("a")
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request was not cancelled when its session closed")
+	}
+}
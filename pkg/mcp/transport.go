@@ -2,30 +2,56 @@ package mcp
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"strings"
 	"sync"
 )
 
 // RequestHandlerFunc is a function that processes a request and returns a response
-type RequestHandlerFunc func(data []byte) ([]byte, error)
+// session identifies the client connection the request arrived on
+type RequestHandlerFunc func(session string, data []byte) ([]byte, error)
+
+// SessionClosedFunc is called by a transport when a client session ends
+type SessionClosedFunc func(session string)
+
+// DefaultSessionID identifies the single session of the stdio transport
+const DefaultSessionID = "stdio"
+
+// MaxConcurrentRequests is how many requests from one connection are handled at
+// once. Further requests wait for a free slot, which stops the connection being read.
+const MaxConcurrentRequests = 8
 
 // Transport defines the interface for MCP transport mechanisms
 type Transport interface {
-	Start(handler RequestHandlerFunc) error
+	Start(handler RequestHandlerFunc, closed SessionClosedFunc) error
 	Stop() error
+	// SendNotification sends a server-initiated notification to every
+	// connected client. Transports that cannot push messages drop it.
+	SendNotification(method string, params interface{})
+	// SetLogger sets the logger the transport reports to; Server.Connect
+	// passes on the server's logger
+	SetLogger(logger Logger)
+}
+
+// SessionNotifier is implemented by transports that can send a notification
+// to one client session instead of every client
+type SessionNotifier interface {
+	SendSessionNotification(session, method string, params interface{})
 }
 
 // StdioTransport implements the Transport interface using stdin/stdout
 type StdioTransport struct {
-	running   bool
-	stopChan  chan struct{}
-	waitGroup sync.WaitGroup
-	reader    *bufio.Reader
-	writer    *bufio.Writer
-	mutex     sync.Mutex
+	running    bool
+	stopChan   chan struct{}
+	waitGroup  sync.WaitGroup
+	reader     *bufio.Reader
+	writer     *bufio.Writer
+	mutex      sync.Mutex
+	writeMutex sync.Mutex // Serializes responses from concurrent requests
+	framing    string     // Message framing: FramingLine (default) or FramingLSP
+	logger     Logger
 }
 
 // NewStdioTransport creates a new stdio transport
@@ -34,11 +60,29 @@ func NewStdioTransport() *StdioTransport {
 		reader:   bufio.NewReader(os.Stdin),
 		writer:   bufio.NewWriter(os.Stdout),
 		stopChan: make(chan struct{}),
+		framing:  FramingLine,
+		logger:   defaultLogger(),
 	}
 }
 
+// SetLogger sets the logger the transport reports to. It must be called before Start.
+func (t *StdioTransport) SetLogger(logger Logger) {
+	t.logger = logger
+}
+
+// SetFraming selects how messages are delimited: FramingLine (the default)
+// or FramingLSP. It must be called before Start.
+func (t *StdioTransport) SetFraming(framing string) error {
+	framing, err := validateFraming(framing)
+	if err != nil {
+		return err
+	}
+	t.framing = framing
+	return nil
+}
+
 // Start starts the transport
-func (t *StdioTransport) Start(handler RequestHandlerFunc) error {
+func (t *StdioTransport) Start(handler RequestHandlerFunc, closed SessionClosedFunc) error {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
@@ -49,7 +93,7 @@ func (t *StdioTransport) Start(handler RequestHandlerFunc) error {
 	t.running = true
 	t.waitGroup.Add(1)
 
-	go t.processRequests(handler)
+	go t.processRequests(handler, closed)
 
 	return nil
 }
@@ -71,68 +115,150 @@ func (t *StdioTransport) Stop() error {
 }
 
 // processRequests reads and processes requests from stdin
-func (t *StdioTransport) processRequests(handler RequestHandlerFunc) {
+func (t *StdioTransport) processRequests(handler RequestHandlerFunc, closed SessionClosedFunc) {
 	defer t.waitGroup.Done()
+	if closed != nil {
+		defer closed(DefaultSessionID)
+	}
+
+	// Requests run concurrently, so a slow one does not hold up the rest;
+	// responses carry their request id and may be sent out of order
+	dispatcher := newRequestDispatcher(MaxConcurrentRequests)
+	defer dispatcher.wait()
 
 	for {
 		select {
 		case <-t.stopChan:
 			return
 		default:
-			// Read a line from stdin
-			line, err := t.reader.ReadString('\n')
+			// Read a message from stdin
+			message, err := readFramedMessage(t.reader, t.framing)
 			if err != nil {
 				if err == io.EOF {
 					// EOF is normal when stdin is closed
-					fmt.Fprintf(os.Stderr, "Received EOF from stdin, exiting\n")
+					t.logger.Info("Received EOF from stdin, exiting")
 					return
 				}
-				fmt.Fprintf(os.Stderr, "Error reading from stdin: %v\n", err)
+				t.logger.Error("Error reading from stdin: %v", err)
 				continue
 			}
 
-			// Trim the trailing newline
-			line = strings.TrimRight(line, "\r\n")
-			if line == "" {
+			if len(message) == 0 {
 				continue // Skip empty lines
 			}
 			
 			// Log the received message
-			fmt.Fprintf(os.Stderr, "Received message: %s\n", line)
+			t.logger.Debug("Received message: %s", message)
 
 			// Process the request
-			response, err := handler([]byte(line))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error processing request: %v\n", err)
-				continue
-			}
+			dispatcher.dispatch(func() {
+				response, err := handler(DefaultSessionID, message)
+				if err != nil {
+					t.logger.Error("Error processing request: %v", err)
+					return
+				}
 
-			// If empty response, don't send anything (notification)
-			if len(response) == 0 {
-				continue
-			}
+				// If empty response, don't send anything (notification)
+				if len(response) == 0 {
+					return
+				}
 
-			// Add newline to the response
-			response = append(response, '\n')
+				t.writeResponse(response)
+			})
+		}
+	}
+}
 
-			// Debug the outgoing message
-			fmt.Fprintf(os.Stderr, "Sending response: %s", string(response))
+// SendNotification writes a notification to stdout
+func (t *StdioTransport) SendNotification(method string, params interface{}) {
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+	if err := t.writeMessage(message); err != nil {
+		t.logger.Error("Error writing notification %s: %v", method, err)
+	}
+}
 
-			// Write the response
-			_, err = t.writer.Write(response)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing response: %v\n", err)
-				continue
-			}
-			
-			// Flush the buffer to ensure the response is sent
-			err = t.writer.Flush()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error flushing response: %v\n", err)
-				continue
-			}
+// SendSessionNotification writes a notification to stdout; stdio has only
+// the one session
+func (t *StdioTransport) SendSessionNotification(session, method string, params interface{}) {
+	if session == DefaultSessionID {
+		t.SendNotification(method, params)
+	}
+}
 
-			fmt.Fprintf(os.Stderr, "Response sent successfully\n")
+// encodeNotification builds a JSON-RPC notification message
+func encodeNotification(method string, params interface{}) ([]byte, error) {
+	notification := NotificationMessage{JsonRPC: "2.0", Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
 		}
+		notification.Params = encoded
 	}
+	return json.Marshal(notification)
+}
+
+// writeResponse writes one framed response to stdout
+func (t *StdioTransport) writeResponse(response []byte) {
+	// Debug the outgoing message
+	t.logger.Debug("Sending response: %s", string(response))
+
+	if err := t.writeMessage(response); err != nil {
+		t.logger.Error("Error writing response: %v", err)
+		return
+	}
+
+	t.logger.Debug("Response sent successfully")
+}
+
+// writeMessage writes one framed message to stdout. It does not log, since
+// logging can itself send a message: callers log after it returns.
+func (t *StdioTransport) writeMessage(message []byte) error {
+	t.writeMutex.Lock()
+	defer t.writeMutex.Unlock()
+
+	if err := writeFramedMessage(t.writer, t.framing, message); err != nil {
+		return err
+	}
+	// Flush the buffer to ensure the message is sent
+	return t.writer.Flush()
+}
+
+// requestDispatcher runs a connection's requests on their own goroutines,
+// at most a fixed number at a time
+type requestDispatcher struct {
+	slots     chan struct{}
+	waitGroup sync.WaitGroup
+}
+
+// newRequestDispatcher creates a dispatcher running up to limit requests at once
+func newRequestDispatcher(limit int) *requestDispatcher {
+	return &requestDispatcher{slots: make(chan struct{}, limit)}
+}
+
+// dispatch runs handle on a new goroutine once a slot is free
+func (d *requestDispatcher) dispatch(handle func()) {
+	d.slots <- struct{}{}
+	d.waitGroup.Add(1)
+	go func() {
+		defer func() {
+			<-d.slots
+			d.waitGroup.Done()
+		}()
+		handle()
+	}()
+}
+
+// busy reports whether any dispatched request is still running
+func (d *requestDispatcher) busy() bool {
+	return len(d.slots) > 0
+}
+
+// wait waits for every dispatched request to finish
+func (d *requestDispatcher) wait() {
+	d.waitGroup.Wait()
 }
@@ -1,17 +1,27 @@
 package mcp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
 
 // RequestID can be either a string or number as per JSON-RPC spec
 type RequestID struct {
-	value interface{}
+	value   interface{}
+	present bool // true when the message carried an "id" member, even if null
 }
 
 // UnmarshalJSON implements custom unmarshaling for RequestID
 func (r *RequestID) UnmarshalJSON(data []byte) error {
+	r.present = true
+
+	// An explicit null is a request with a null ID, not a notification
+	if string(data) == "null" {
+		r.value = nil
+		return nil
+	}
+
 	// Try to unmarshal as a number first
 	var num float64
 	if err := json.Unmarshal(data, &num); err == nil {
@@ -45,9 +55,15 @@ func (r RequestID) String() string {
 	return fmt.Sprintf("%v", r.value)
 }
 
-// IsEmpty returns true if the ID is empty/nil
+// IsEmpty returns true if the message had no "id" member, which makes it
+// a notification that must not receive a response
 func (r RequestID) IsEmpty() bool {
-	return r.value == nil
+	return !r.present
+}
+
+// IsNull returns true if the message carried an explicit "id": null
+func (r RequestID) IsNull() bool {
+	return r.present && r.value == nil
 }
 
 // RequestMessage represents a request message from the client
@@ -75,8 +91,31 @@ type NotificationMessage struct {
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Standard JSON-RPC error codes handlers may return through RPCError
+const (
+	CodeParseError       = -32700
+	CodeInvalidRequest   = -32600
+	CodeMethodNotFound   = -32601
+	CodeInvalidParams    = -32602
+	CodeResourceNotFound = -32002 // MCP: the requested resource does not exist
+)
+
+// RPCError is an error a request handler returns to choose the JSON-RPC
+// error code and data of the response, instead of the generic -32000
+type RPCError struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+// Error implements the error interface
+func (e *RPCError) Error() string {
+	return e.Message
 }
 
 // ServerInfo information
@@ -107,9 +146,16 @@ type InitializeResult struct {
 
 // Tool represents a tool that can be called by the client
 type Tool struct {
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	InputSchema json.RawMessage `json:"inputSchema"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	InputSchema json.RawMessage  `json:"inputSchema"`
+	Annotations *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations are hints describing a tool's side effects
+type ToolAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`    // Tool does not modify its environment
+	DestructiveHint bool `json:"destructiveHint"` // Tool may overwrite or remove existing data
 }
 
 // ListToolsRequest represents a request to list available tools
@@ -117,15 +163,43 @@ type ListToolsRequest struct {
 	// No parameters needed for list_tools
 }
 
+// ListToolsParams represents the parameters of a list_tools request
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
 // ListToolsResponse represents a response to list_tools
 type ListToolsResponse struct {
-	Tools []Tool `json:"tools"`
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"` // Set when more tools remain
 }
 
 // CallToolRequest represents a request to call a tool
 type CallToolRequest struct {
 	Name      string          `json:"name"`
 	Arguments json.RawMessage `json:"arguments"`
+	Meta      *RequestMeta    `json:"_meta,omitempty"`
+}
+
+// RequestMeta carries the optional _meta of a request
+type RequestMeta struct {
+	// ProgressToken, a string or number, asks for notifications/progress
+	// while the request runs and identifies them
+	ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+}
+
+// ProgressParams represents the parameters of a notifications/progress notification
+type ProgressParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      int             `json:"progress"`
+	Total         int             `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+// CancelledParams represents the parameters of a notifications/cancelled notification
+type CancelledParams struct {
+	RequestID RequestID `json:"requestId"`
+	Reason    string    `json:"reason,omitempty"`
 }
 
 // ContentItem represents an item in the content array
@@ -135,17 +209,231 @@ type ContentItem struct {
 }
 
 // CallToolResponse represents a response from calling a tool
+// Content carries human-readable text; StructuredContent, when set, carries the
+// same outcome as one of the typed results below for machine consumption
 type CallToolResponse struct {
-	Content []ContentItem `json:"content"`
-	IsError bool          `json:"isError,omitempty"`
+	Content           []ContentItem          `json:"content"`
+	StructuredContent interface{}            `json:"structuredContent,omitempty"`
+	IsError           bool                   `json:"isError,omitempty"`
+	Meta              map[string]interface{} `json:"_meta,omitempty"` // Optional operation metadata (path, bytes, duration, backup)
+}
+
+// ErrorResult is the structured result of a failed tool call
+type ErrorResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// ReadFileResult is the structured result of read_file
+type ReadFileResult struct {
+	Success  bool   `json:"success"`
+	Path     string `json:"path"`
+	Size     int    `json:"size"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"` // Set when content is not plain text, e.g. "base64"
+}
+
+// ReadFileLinesResult is the structured result of read_file with as_lines
+type ReadFileLinesResult struct {
+	Success         bool     `json:"success"`
+	Path            string   `json:"path"`
+	Lines           []string `json:"lines"`
+	TrailingNewline bool     `json:"trailingNewline"`
+}
+
+// WriteFileResult is the structured result of write_file
+type WriteFileResult struct {
+	Success      bool   `json:"success"`
+	Path         string `json:"path"`
+	BytesWritten int    `json:"bytesWritten"`
+}
+
+// PathResult is the structured result of tools that act on a single path
+// without producing content, such as create_directory
+type PathResult struct {
+	Success bool   `json:"success"`
+	Path    string `json:"path"`
+}
+
+// MoveFileResult is the structured result of move_file
+type MoveFileResult struct {
+	Success     bool   `json:"success"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// SearchResult is the structured result of search tools
+type SearchResult struct {
+	Success bool     `json:"success"`
+	Path    string   `json:"path"`
+	Matches []string `json:"matches"`
+}
+
+// EditResult is the structured result of editor tools
+type EditResult struct {
+	Success  bool   `json:"success"`
+	Path     string `json:"path"`
+	BackupID string `json:"backupId,omitempty"`
+}
+
+// CompleteParams represents the parameters of a completion/complete request
+type CompleteParams struct {
+	Ref struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"ref"`
+	Argument struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"argument"`
+}
+
+// CompleteResult represents the response to a completion/complete request
+type CompleteResult struct {
+	Completion Completion `json:"completion"`
+}
+
+// Completion holds suggested values for a partially typed argument
+type Completion struct {
+	Values  []string `json:"values"`
+	Total   int      `json:"total,omitempty"`
+	HasMore bool     `json:"hasMore"`
+}
+
+// Resource describes a resource in a resources/list response
+type Resource struct {
+	URI      string `json:"uri"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// ListResourcesParams represents the parameters of a resources/list request
+type ListResourcesParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// ListResourcesResult represents the response to a resources/list request
+type ListResourcesResult struct {
+	Resources  []Resource `json:"resources"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// ReadResourceParams represents the parameters of a resources/read request
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+// ReadResourceResult represents the response to a resources/read request
+type ReadResourceResult struct {
+	Contents []ResourceContents `json:"contents"`
+}
+
+// ResourceContents is the content of a resource: Text for text, or
+// base64-encoded Blob for binary data
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// SetLevelParams represents the parameters of a logging/setLevel request
+type SetLevelParams struct {
+	Level string `json:"level"`
+}
+
+// LoggingMessageParams represents the parameters of a notifications/message notification
+type LoggingMessageParams struct {
+	Level  string      `json:"level"`
+	Logger string      `json:"logger,omitempty"`
+	Data   interface{} `json:"data"`
+}
+
+// SubscribeParams represents the parameters of a resources/subscribe or
+// resources/unsubscribe request
+type SubscribeParams struct {
+	URI string `json:"uri"`
+}
+
+// ResourceUpdatedParams represents the parameters of a
+// notifications/resources/updated notification
+type ResourceUpdatedParams struct {
+	URI string `json:"uri"`
+}
+
+// Prompt describes a prompt template in a prompts/list response
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptArgument describes an argument of a prompt template
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// ListPromptsResult represents the response to a prompts/list request
+type ListPromptsResult struct {
+	Prompts []Prompt `json:"prompts"`
+}
+
+// GetPromptParams represents the parameters of a prompts/get request
+type GetPromptParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// GetPromptResult represents the response to a prompts/get request
+type GetPromptResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// PromptMessage is one message of a rendered prompt
+type PromptMessage struct {
+	Role    string      `json:"role"` // "user" or "assistant"
+	Content ContentItem `json:"content"`
 }
 
 // RequestHandler is a function that handles a specific request method
 type RequestHandler func(params json.RawMessage) (json.RawMessage, error)
 
+// SessionRequestHandler is a RequestHandler that also receives the id of the
+// client session the request arrived on
+type SessionRequestHandler func(session string, params json.RawMessage) (json.RawMessage, error)
+
+// ContextRequestHandler is a SessionRequestHandler that also receives a
+// context, cancelled when the client cancels the request or its session ends
+type ContextRequestHandler func(ctx context.Context, session string, params json.RawMessage) (json.RawMessage, error)
+
 // ServerCapabilities represents the capabilities of the server
 type ServerCapabilities struct {
-	Tools map[string]interface{} `json:"tools"`
+	Tools       map[string]interface{} `json:"tools"`
+	Completions *CompletionsCapability `json:"completions,omitempty"` // Set to advertise completion/complete
+	Resources   *ResourcesCapability   `json:"resources,omitempty"`   // Set to advertise resources/list and resources/read
+	Prompts     *PromptsCapability     `json:"prompts,omitempty"`     // Set to advertise prompts/list and prompts/get
+	Logging     *LoggingCapability     `json:"logging,omitempty"`     // Always advertised: the server handles logging itself
+}
+
+// CompletionsCapability advertises support for argument completion
+type CompletionsCapability struct{}
+
+// LoggingCapability advertises support for logging/setLevel and notifications/message
+type LoggingCapability struct{}
+
+// PromptsCapability advertises support for prompt templates
+type PromptsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// ResourcesCapability advertises support for resources
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
 }
 
 // ServerConfig represents the server configuration
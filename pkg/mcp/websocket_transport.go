@@ -0,0 +1,527 @@
+package mcp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultWebSocketPath is the URL path the WebSocket transport upgrades when none is configured
+const DefaultWebSocketPath = "/mcp"
+
+// maxWebSocketMessage is the largest message, after reassembling fragments, a client may send
+const maxWebSocketMessage = 64 << 20
+
+// websocketGUID is appended to the client key to compute Sec-WebSocket-Accept (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frame opcodes
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// WebSocket close status codes
+const (
+	wsCloseNormal        = 1000
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+)
+
+// errWebSocketClosed is returned by readMessage once the client has closed the connection
+var errWebSocketClosed = errors.New("websocket closed by client")
+
+// WebSocketTransport implements the Transport interface over WebSocket, for
+// clients such as browsers that cannot open raw TCP connections. Each
+// JSON-RPC message travels as one text message.
+type WebSocketTransport struct {
+	config    NetworkConfig
+	listener  net.Listener
+	server    *http.Server
+	running   bool
+	waitGroup sync.WaitGroup
+	mutex     sync.Mutex
+	handler   RequestHandlerFunc
+	closed    SessionClosedFunc
+	sessions  uint64 // Connections accepted so far, used to number sessions
+	connMutex sync.Mutex
+	conns     map[net.Conn]*wsConn // Upgraded connections, closed on Stop
+	bySession map[string]*wsConn   // Upgraded connections by session, for notifications
+	connSlots chan struct{}        // Bounds open connections; nil means unlimited
+	logger    Logger
+}
+
+// NewWebSocketTransport creates a new WebSocket transport
+func NewWebSocketTransport(config NetworkConfig) (*WebSocketTransport, error) {
+	switch config.LogFormat {
+	case "":
+		config.LogFormat = LogFormatText
+	case LogFormatText, LogFormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid log format %q (use %q or %q)", config.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	if config.Path == "" {
+		config.Path = DefaultWebSocketPath
+	}
+	if !strings.HasPrefix(config.Path, "/") {
+		return nil, fmt.Errorf("invalid WebSocket path %q: must start with /", config.Path)
+	}
+
+	return &WebSocketTransport{
+		config:    config,
+		conns:     make(map[net.Conn]*wsConn),
+		bySession: make(map[string]*wsConn),
+		connSlots: newConnectionSlots(config.MaxConnections),
+		logger:    defaultLogger(),
+	}, nil
+}
+
+// SetLogger sets the logger the transport reports to. It must be called before Start.
+func (t *WebSocketTransport) SetLogger(logger Logger) {
+	t.logger = logger
+}
+
+// Start starts the WebSocket transport
+func (t *WebSocketTransport) Start(handler RequestHandlerFunc, closed SessionClosedFunc) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.running {
+		return fmt.Errorf("transport already running")
+	}
+
+	t.handler = handler
+	t.closed = closed
+
+	addr := fmt.Sprintf("%s:%d", t.config.Host, t.config.Port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(t.config.Path, t.handleUpgrade)
+	t.listener = listener
+	t.server = &http.Server{Handler: mux}
+	t.running = true
+
+	t.logger.Info("MCP WebSocket Transport listening on ws://%s%s", addr, t.config.Path)
+	t.config.logWhitelist(t.logger)
+
+	go t.server.Serve(listener)
+
+	return nil
+}
+
+// Stop stops the WebSocket transport and closes every open connection
+func (t *WebSocketTransport) Stop() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.running {
+		return nil
+	}
+
+	// Hijacked connections are not tracked by the HTTP server, so close them here
+	t.server.Close()
+	t.connMutex.Lock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.connMutex.Unlock()
+	t.waitGroup.Wait()
+	t.running = false
+
+	return nil
+}
+
+// handleUpgrade checks the whitelist and completes the WebSocket handshake
+func (t *WebSocketTransport) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	remoteAddr := httpRemoteAddr(r)
+	if !t.config.isIPAllowed(remoteAddr) {
+		t.config.logConnectionEvent(t.logger, "rejected", remoteAddr, "not in whitelist")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !t.config.isOriginAllowed(r) {
+		t.config.logConnectionEvent(t.logger, "rejected", remoteAddr, "origin not allowed")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a WebSocket upgrade request", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	if !acquireConnectionSlot(t.connSlots) {
+		t.config.logConnectionEvent(t.logger, "rejected", remoteAddr, "connection limit reached")
+		http.Error(w, "too many connections", http.StatusServiceUnavailable)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		releaseConnectionSlot(t.connSlots)
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		releaseConnectionSlot(t.connSlots)
+		t.logger.Error("Error upgrading connection: %v", err)
+		return
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		releaseConnectionSlot(t.connSlots)
+		conn.Close()
+		return
+	}
+
+	ws := &wsConn{conn: conn, rw: rw}
+	t.connMutex.Lock()
+	t.conns[conn] = ws
+	t.connMutex.Unlock()
+
+	t.config.logConnectionEvent(t.logger, "accepted", remoteAddr, "")
+	t.waitGroup.Add(1)
+	go func() {
+		defer releaseConnectionSlot(t.connSlots)
+		t.handleConnection(ws, remoteAddr)
+	}()
+}
+
+// handleConnection processes the messages of one upgraded connection
+func (t *WebSocketTransport) handleConnection(ws *wsConn, remoteAddr net.Addr) {
+	defer t.waitGroup.Done()
+	defer func() {
+		t.connMutex.Lock()
+		delete(t.conns, ws.conn)
+		t.connMutex.Unlock()
+		ws.conn.Close()
+	}()
+
+	// Each connection is its own session
+	session := fmt.Sprintf("%s#%d", remoteAddr, atomic.AddUint64(&t.sessions, 1))
+	if t.closed != nil {
+		defer t.closed(session)
+	}
+	t.connMutex.Lock()
+	t.bySession[session] = ws
+	t.connMutex.Unlock()
+	defer func() {
+		t.connMutex.Lock()
+		delete(t.bySession, session)
+		t.connMutex.Unlock()
+	}()
+
+	// Requests run concurrently, so a slow one does not hold up the rest;
+	// writeFrame serializes the responses
+	dispatcher := newRequestDispatcher(MaxConcurrentRequests)
+	defer dispatcher.wait()
+
+	for {
+		err := waitForInput(ws.conn, ws.rw.Reader, t.config.IdleTimeout, dispatcher.busy)
+		var message []byte
+		if err == nil {
+			message, err = ws.readMessage()
+		}
+		if err != nil {
+			if err == errWebSocketClosed {
+				err = io.EOF
+			}
+			t.config.logConnectionEvent(t.logger, "disconnected", remoteAddr, disconnectReason(err))
+			return
+		}
+
+		if len(strings.TrimSpace(string(message))) == 0 {
+			continue
+		}
+
+		dispatcher.dispatch(func() {
+			response, err := t.handler(session, message)
+			if err != nil {
+				response = internalErrorResponse(err)
+			}
+			if len(response) == 0 {
+				return
+			}
+
+			// A failed write means the connection is gone; the read loop notices
+			ws.writeFrame(wsOpText, response)
+		})
+	}
+}
+
+// SendNotification sends a notification to every open connection
+func (t *WebSocketTransport) SendNotification(method string, params interface{}) {
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+
+	t.connMutex.Lock()
+	conns := make([]*wsConn, 0, len(t.conns))
+	for _, ws := range t.conns {
+		conns = append(conns, ws)
+	}
+	t.connMutex.Unlock()
+
+	for _, ws := range conns {
+		ws.writeFrame(wsOpText, message)
+	}
+}
+
+// SendSessionNotification sends a notification to one session's connection
+func (t *WebSocketTransport) SendSessionNotification(session, method string, params interface{}) {
+	t.connMutex.Lock()
+	ws, ok := t.bySession[session]
+	t.connMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	message, err := encodeNotification(method, params)
+	if err != nil {
+		t.logger.Error("Error encoding notification %s: %v", method, err)
+		return
+	}
+	ws.writeFrame(wsOpText, message)
+}
+
+// wsConn is the server side of an upgraded WebSocket connection
+type wsConn struct {
+	conn       net.Conn
+	rw         *bufio.ReadWriter
+	writeMutex sync.Mutex
+}
+
+// readMessage reads the next complete data message, reassembling fragments
+// and answering control frames along the way. A ping or pong between messages
+// returns an empty message.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing, wsOpPong:
+			if opcode == wsOpPing {
+				if err := ws.writeFrame(wsOpPong, payload); err != nil {
+					return nil, err
+				}
+			}
+			if !fragmented {
+				// Let the caller restart its idle timer
+				return nil, nil
+			}
+			continue
+		case wsOpClose:
+			// Echo the client's status code, as RFC 6455 asks
+			ws.writeFrame(wsOpClose, payload)
+			return nil, errWebSocketClosed
+		case wsOpText, wsOpBinary:
+			if fragmented {
+				return nil, ws.fail(wsCloseProtocolError, "new message started before the previous one finished")
+			}
+			message = payload
+		case wsOpContinuation:
+			if !fragmented {
+				return nil, ws.fail(wsCloseProtocolError, "continuation frame without a message to continue")
+			}
+			// Check before appending so an oversized message is never buffered;
+			// readFrame already bounds the size of a single frame
+			if len(message)+len(payload) > maxWebSocketMessage {
+				return nil, ws.fail(wsCloseTooBig, "message too large")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, ws.fail(wsCloseProtocolError, fmt.Sprintf("unknown opcode %#x", opcode))
+		}
+
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+// readFrame reads a single frame and unmasks its payload
+func (ws *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "reserved bits set without a negotiated extension")
+	}
+	if !masked {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "client frames must be masked")
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(ws.rw, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(ws.rw, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, ws.fail(wsCloseProtocolError, "control frames must be unfragmented and at most 125 bytes")
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, ws.fail(wsCloseTooBig, "message too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single unfragmented, unmasked frame
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) <= 125:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	if _, err := ws.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := ws.rw.Write(payload); err != nil {
+		return err
+	}
+	return ws.rw.Flush()
+}
+
+// fail sends a close frame with a status code and returns the reason as an error
+func (ws *wsConn) fail(code uint16, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	ws.writeFrame(wsOpClose, append(payload, reason...))
+	return errors.New(reason)
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept value for a client key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContainsToken reports whether a comma-separated header contains token, ignoring case
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOriginAllowed reports whether a request's Origin may use the transport.
+// Browsers send Origin with every WebSocket handshake and cross-site request,
+// so checking it stops any web page the user visits from driving the server.
+// Requests without one come from other clients and are allowed. Otherwise the
+// origin must be in AllowedOrigins, or be the page's own host: the Origin's
+// host must equal the Host header and name an IP address, localhost or the
+// configured Host, so a DNS name rebound to this server is still refused.
+func (c NetworkConfig) isOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || !strings.EqualFold(u.Host, r.Host) {
+		return false
+	}
+	hostname := u.Hostname()
+	return net.ParseIP(hostname) != nil || strings.EqualFold(hostname, "localhost") ||
+		(c.Host != "" && strings.EqualFold(hostname, c.Host))
+}
+
+// httpRemoteAddr returns the client address of an HTTP request as a net.Addr,
+// so it can be checked against the whitelist like a raw TCP connection
+func httpRemoteAddr(r *http.Request) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
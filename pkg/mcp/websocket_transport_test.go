@@ -0,0 +1,239 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startWebSocketTransport starts a transport on a free port that echoes each message's method
+func startWebSocketTransport(t *testing.T, config NetworkConfig) string {
+	t.Helper()
+
+	config.Host = "127.0.0.1"
+	transport, err := NewWebSocketTransport(config)
+	if err != nil {
+		t.Fatalf("NewWebSocketTransport failed: %v", err)
+	}
+	err = transport.Start(func(session string, message []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"result":%s}`, message)), nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { transport.Stop() })
+
+	return transport.listener.Addr().String()
+}
+
+// dialWebSocket performs the client handshake and returns the connection and the response status line
+func dialWebSocket(t *testing.T, addr, path string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	return dialWebSocketFrom(t, addr, path, "")
+}
+
+// dialWebSocketFrom performs the client handshake as a browser page at origin would
+func dialWebSocketFrom(t *testing.T, addr, path, origin string) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	originHeader := ""
+	if origin != "" {
+		originHeader = "Origin: " + origin + "\r\n"
+	}
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n%s"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", path, addr, originHeader)
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if response.StatusCode == http.StatusSwitchingProtocols {
+		// Example key and accept value from RFC 6455
+		if accept := response.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("Unexpected Sec-WebSocket-Accept %q", accept)
+		}
+	}
+	return conn, reader, response.Status
+}
+
+// writeClientFrame writes a masked client frame
+func writeClientFrame(t *testing.T, conn net.Conn, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) <= 125 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+}
+
+// readServerFrame reads an unmasked server frame
+func readServerFrame(t *testing.T, reader *bufio.Reader) (byte, string) {
+	t.Helper()
+
+	var header [2]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		t.Fatalf("Failed to read frame: %v", err)
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		io.ReadFull(reader, extended[:])
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Failed to read frame payload: %v", err)
+	}
+	return header[0] & 0x0F, string(payload)
+}
+
+func TestWebSocketTransportExchangesMessages(t *testing.T) {
+	addr := startWebSocketTransport(t, NetworkConfig{})
+	conn, reader, status := dialWebSocket(t, addr, DefaultWebSocketPath)
+	if !strings.HasPrefix(status, "101") {
+		t.Fatalf("Expected 101 Switching Protocols, got %s", status)
+	}
+
+	writeClientFrame(t, conn, true, wsOpText, []byte(`{"method":"ping"}`))
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpText || !strings.Contains(payload, `"ping"`) {
+		t.Errorf("Unexpected response frame %#x %q", opcode, payload)
+	}
+
+	// A fragmented message with a ping in between is reassembled, and the ping answered first
+	large := `{"method":"` + strings.Repeat("x", 300) + `"}`
+	writeClientFrame(t, conn, false, wsOpText, []byte(large[:100]))
+	writeClientFrame(t, conn, true, wsOpPing, []byte("hi"))
+	writeClientFrame(t, conn, true, wsOpContinuation, []byte(large[100:]))
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpPong || payload != "hi" {
+		t.Errorf("Expected pong with ping payload, got %#x %q", opcode, payload)
+	}
+	if opcode, payload := readServerFrame(t, reader); opcode != wsOpText || !strings.Contains(payload, large) {
+		t.Errorf("Expected response to reassembled message, got %#x %q", opcode, payload)
+	}
+
+	writeClientFrame(t, conn, true, wsOpClose, []byte{0x03, 0xE8})
+	if opcode, _ := readServerFrame(t, reader); opcode != wsOpClose {
+		t.Errorf("Expected close frame in reply, got %#x", opcode)
+	}
+}
+
+func TestWebSocketTransportHandshakeChecks(t *testing.T) {
+	addr := startWebSocketTransport(t, NetworkConfig{Path: "/ws"})
+	if _, _, status := dialWebSocket(t, addr, "/other"); !strings.HasPrefix(status, "404") {
+		t.Errorf("Expected 404 for another path, got %s", status)
+	}
+
+	// Clients outside the whitelist are refused before the upgrade
+	addr = startWebSocketTransport(t, NetworkConfig{AllowedIPs: []string{"192.0.2.1"}})
+	if _, _, status := dialWebSocket(t, addr, DefaultWebSocketPath); !strings.HasPrefix(status, "403") {
+		t.Errorf("Expected 403 for a client outside the whitelist, got %s", status)
+	}
+}
+
+func TestWebSocketTransportOriginCheck(t *testing.T) {
+	addr := startWebSocketTransport(t, NetworkConfig{AllowedOrigins: []string{"https://app.example"}})
+
+	for origin, want := range map[string]string{
+		"":                     "101",
+		"http://" + addr:       "101",
+		"https://app.example":  "101",
+		"https://evil.example": "403",
+		"null":                 "403",
+		"http://127.0.0.1:1":   "403",
+	} {
+		if _, _, status := dialWebSocketFrom(t, addr, DefaultWebSocketPath, origin); !strings.HasPrefix(status, want) {
+			t.Errorf("Origin %q: expected %s, got %s", origin, want, status)
+		}
+	}
+}
+
+func TestIsOriginAllowed(t *testing.T) {
+	tests := []struct {
+		host, origin string
+		allowed      []string
+		want         bool
+	}{
+		{"localhost:8080", "http://localhost:8080", nil, true},
+		{"127.0.0.1:8080", "http://127.0.0.1:8080", nil, true},
+		{"[::1]:8080", "http://[::1]:8080", nil, true},
+		{"mcp.internal:8080", "http://mcp.internal:8080", nil, true},
+		// A rebound DNS name matches its own Host header but is not trusted
+		{"rebind.example:8080", "http://rebind.example:8080", nil, false},
+		{"localhost:8080", "http://localhost:9090", nil, false},
+		{"localhost:8080", "https://app.example", []string{"https://app.example/"}, true},
+		{"localhost:8080", "https://other.example", []string{"*"}, true},
+	}
+	config := NetworkConfig{Host: "mcp.internal"}
+	for _, tt := range tests {
+		config.AllowedOrigins = tt.allowed
+		r := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/mcp", nil)
+		r.Header.Set("Origin", tt.origin)
+		if got := config.isOriginAllowed(r); got != tt.want {
+			t.Errorf("Origin %s on host %s with %v: expected %v, got %v", tt.origin, tt.host, tt.allowed, tt.want, got)
+		}
+	}
+}
+
+// zeroReader is an endless source of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestWebSocketMessageSizeLimit(t *testing.T) {
+	// A first fragment at the limit, then a one-byte continuation; zero masks
+	// let the payload stream from zeroReader without building it in memory
+	header := func(first byte, length int) []byte {
+		frame := []byte{first, 0x80 | 127, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+		return append(frame, 0, 0, 0, 0)
+	}
+	input := io.MultiReader(
+		bytes.NewReader(header(wsOpBinary, maxWebSocketMessage)),
+		io.LimitReader(zeroReader{}, maxWebSocketMessage),
+		bytes.NewReader(header(0x80|wsOpContinuation, 1)),
+		bytes.NewReader([]byte{0}),
+	)
+	var output bytes.Buffer
+	ws := &wsConn{rw: bufio.NewReadWriter(bufio.NewReader(input), bufio.NewWriter(&output))}
+
+	if _, err := ws.readMessage(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("Expected the reassembled message to be rejected, got %v", err)
+	}
+	if closing := output.Bytes(); len(closing) < 4 || closing[0] != 0x80|wsOpClose || binary.BigEndian.Uint16(closing[2:]) != wsCloseTooBig {
+		t.Errorf("Expected a close frame with status %d, got %x", wsCloseTooBig, closing)
+	}
+}